@@ -0,0 +1,73 @@
+// Package buildinfo describes the build of the running binary. The version,
+// commit and build date are injected at link time:
+//
+//	go build -ldflags "-X github.com/ab-dauletkhan/doozip/internal/buildinfo.Version=1.2.0 \
+//		-X github.com/ab-dauletkhan/doozip/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X github.com/ab-dauletkhan/doozip/internal/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to the VCS details the Go toolchain embeds.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set with -ldflags -X at build time
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info is the build of the running binary
+type Info struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build of the running binary for the application name
+func Get(name string) Info {
+	info := Info{
+		Name:      name,
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = strings.TrimPrefix(build.Main.Version, "v")
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+
+	return info
+}
+
+// DefaultVersion returns the version of the running binary
+func DefaultVersion() string {
+	return Get("").Version
+}
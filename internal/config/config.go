@@ -2,10 +2,20 @@ package config
 
 import (
 	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/spf13/viper"
+
+	"github.com/ab-dauletkhan/doozip/internal/buildinfo"
 )
 
 type AppConfig struct {
@@ -20,6 +30,36 @@ type ServerConfig struct {
 	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+	// ReadHeaderTimeout bounds reading the request headers, so slow clients
+	// cannot hold connections open; zero uses ReadTimeout
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	// MaxHeaderBytes limits the size of the request headers; zero uses 1 MB
+	MaxHeaderBytes int `mapstructure:"max_header_bytes"`
+	// MaxConnections limits the connections served at once across all
+	// listeners; zero is unlimited
+	MaxConnections int `mapstructure:"max_connections"`
+	// Listeners replace the single plaintext listener on Host and Port
+	Listeners []ListenerConfig `mapstructure:"listeners"`
+	// TrustedProxies are the CIDR ranges or addresses of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// ListenerConfig is an address the server accepts connections on, serving
+// TLS when a certificate is configured
+type ListenerConfig struct {
+	Address string    `mapstructure:"address"`
+	TLS     TLSConfig `mapstructure:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// Enabled reports whether a certificate is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
 }
 
 type SMTP struct {
@@ -27,21 +67,835 @@ type SMTP struct {
 	Port     string `mapstructure:"port"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	// Fallbacks are tried in order when the primary relay is unavailable
+	Fallbacks         []SMTPRelay   `mapstructure:"fallbacks"`
+	UnhealthyCooldown time.Duration `mapstructure:"unhealthy_cooldown"`
+	// HeloHostname is announced in EHLO to every relay; empty uses the
+	// hostname of the machine
+	HeloHostname string `mapstructure:"helo_hostname"`
+	// DialTimeout bounds connecting to a relay, CommandTimeout every command
+	// and its reply, and DataTimeout sending the message content. Zero
+	// leaves them unbounded.
+	DialTimeout    time.Duration `mapstructure:"dial_timeout"`
+	CommandTimeout time.Duration `mapstructure:"command_timeout"`
+	DataTimeout    time.Duration `mapstructure:"data_timeout"`
+	// PunycodeDomains converts internationalized recipient domains to ASCII,
+	// so only UTF-8 local parts require relays supporting SMTPUTF8
+	PunycodeDomains bool `mapstructure:"punycode_domains"`
+}
+
+// SMTPRelay describes a fallback SMTP server. Empty port and credentials
+// are inherited from the primary server.
+type SMTPRelay struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+type MailConfig struct {
+	// Transport selects the mail repository: "smtp" (default) or "maildir"
+	Transport       string `mapstructure:"transport"`
+	Maildir         string `mapstructure:"maildir"`
+	From            string `mapstructure:"from"`
+	ReturnPath      string `mapstructure:"return_path"`
+	TemplatesDir    string `mapstructure:"templates_dir"`
+	FanOutThreshold int    `mapstructure:"fanout_threshold"`
+	FanOutWorkers   int    `mapstructure:"fanout_workers"`
+	// MaxAttachmentSize is the size in bytes above which attachments are
+	// split into zip volumes sent in a sequence of messages; 0 disables it
+	MaxAttachmentSize int64            `mapstructure:"max_attachment_size"`
+	Upload            MailUploadConfig `mapstructure:"upload"`
+	PGP               PGPConfig        `mapstructure:"pgp"`
+	Zip               MailZipConfig    `mapstructure:"zip"`
+	Outbox            MailOutboxConfig `mapstructure:"outbox"`
+	// RecipientValidation sets how thoroughly recipient addresses are
+	// checked before a message is composed
+	RecipientValidation MailRecipientValidationConfig `mapstructure:"recipient_validation"`
+	// DefaultSubject and DefaultBody are the text/templates of the subject
+	// and body of messages sent without them, given .Filename, .Recipients
+	// and .Date
+	DefaultSubject string `mapstructure:"default_subject"`
+	DefaultBody    string `mapstructure:"default_body"`
+}
+
+// MailUploadConfig limits the size in bytes of each file uploaded to be
+// mailed. Larger files are refused rather than cut; zero disables a limit.
+type MailUploadConfig struct {
+	// MaxFileSize limits attachments, batch items included
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MaxInlineSize limits the inline images of templated mail
+	MaxInlineSize int64 `mapstructure:"max_inline_size"`
+}
+
+// MailRecipientValidationConfig selects the validation level of recipients:
+// "syntax" (default) only checks the addresses, while "mx" also resolves the
+// MX records of their domains and rejects the domains that cannot receive
+// mail. Lookups taking longer than Timeout accept the address, and results
+// are cached for CacheTTL.
+type MailRecipientValidationConfig struct {
+	Level    string        `mapstructure:"level"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// MailOutboxConfig sets how messages kept in the outbox are resent and how
+// long they are kept
+type MailOutboxConfig struct {
+	// StaleAfter is how long a message may stay sending before it is taken
+	// for interrupted and sent again; zero never resends it
+	StaleAfter time.Duration `mapstructure:"stale_after"`
+	// Retention is how long delivered and failed messages are kept; zero
+	// keeps them forever
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// MailZipConfig sets whether attachments are wrapped into a zip archive, and
+// whether it is encrypted with a generated password, when a request doesn't say
+type MailZipConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Encrypt bool `mapstructure:"encrypt"`
+}
+
+// PGPConfig encrypts the attachments of mail to recipients with a PGP
+// public key, configured here or uploaded with the message
+type PGPConfig struct {
+	Keys []PGPKeyConfig `mapstructure:"keys"`
+	// Require refuses mail to recipients without a key instead of sending
+	// their attachments in the clear
+	Require bool `mapstructure:"require"`
+}
+
+// PGPKeyConfig names the file of the armored or binary public key of an address
+type PGPKeyConfig struct {
+	Address string `mapstructure:"address"`
+	File    string `mapstructure:"file"`
+}
+
+type ArchiveConfig struct {
+	PasswordPolicy PasswordPolicy      `mapstructure:"password_policy"`
+	Remote         RemoteArchiveConfig `mapstructure:"remote"`
+	// Processors names the entry processors run, in order, on every file
+	// added to an archive, such as "strip_exif"
+	Processors []string `mapstructure:"processors"`
+	// SpecialEntries is what is done with the entries of inspected archives
+	// that are not regular files, such as symlinks and device nodes:
+	// SpecialEntriesMaterialize, SpecialEntriesSkip or SpecialEntriesReject
+	SpecialEntries string `mapstructure:"special_entries"`
+	// Hidden leaves hidden files, such as .git directories, out of created
+	// archives
+	Hidden ArchiveHiddenConfig `mapstructure:"hidden"`
+	// Grep bounds the content searches of archive searches
+	Grep ArchiveGrepConfig `mapstructure:"grep"`
+	// Contents embeds a listing of the files into every created archive
+	Contents ArchiveContentsConfig `mapstructure:"contents"`
+	// Checksums adds a SHA256SUMS file covering every entry to created archives
+	Checksums ArchiveChecksumsConfig `mapstructure:"checksums"`
+	// Signing signs every created archive with the server's key
+	Signing ArchiveSigningConfig `mapstructure:"signing"`
+	// Names sets how entry names are read from inspected archives and
+	// written to created ones
+	Names ArchiveNamesConfig `mapstructure:"names"`
+	// Compression sizes the workers compressing the files of created archives
+	Compression ArchiveCompressionConfig `mapstructure:"compression"`
+	// Information bounds the archives uploaded for inspection and sets which
+	// are inspected in the background
+	Information ArchiveInformationConfig `mapstructure:"information"`
+}
+
+// ArchiveInformationConfig sets the size of the archives uploaded to
+// /api/archive/information. Archives of at least AsyncThreshold bytes are
+// inspected by a job, so large ones don't hold the request open.
+type ArchiveInformationConfig struct {
+	// MaxFileSize is the largest archive uploaded; zero keeps the 10 MB
+	// limit of the other archive uploads
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// AsyncThreshold is the size from which uploads are inspected by a job;
+	// zero inspects every upload during the request
+	AsyncThreshold int64 `mapstructure:"async_threshold"`
+}
+
+// ArchiveHiddenConfig leaves hidden files out of created archives, as
+// bundles often ship .git directories or Thumbs.db by accident. A file is
+// hidden when a part of its path starts with a dot or is one of Names.
+type ArchiveHiddenConfig struct {
+	// Exclude leaves hidden files out unless a request sets exclude_hidden
+	// to false
+	Exclude bool `mapstructure:"exclude"`
+	// Names are the other names of hidden files and directories, matched
+	// regardless of case
+	Names []string `mapstructure:"names"`
+}
+
+// ArchiveGrepConfig bounds the work of searching the content of archive
+// entries, which are decompressed to be read. Entries left out by the limits
+// are reported as skipped.
+type ArchiveGrepConfig struct {
+	// MaxFileSize is the largest entry searched, uncompressed
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MaxFiles is the number of entries searched per request
+	MaxFiles int `mapstructure:"max_files"`
+	// MaxBytes is the number of uncompressed bytes searched per request
+	MaxBytes int64 `mapstructure:"max_bytes"`
+	// MaxLines is the number of matching lines returned per request
+	MaxLines int `mapstructure:"max_lines"`
+}
+
+// Policies for the special entries of archives
+const (
+	// SpecialEntriesMaterialize treats special entries as files holding
+	// their content, such as the target of a symlink
+	SpecialEntriesMaterialize = "materialize"
+	// SpecialEntriesSkip leaves special entries out
+	SpecialEntriesSkip = "skip"
+	// SpecialEntriesReject refuses archives with special entries
+	SpecialEntriesReject = "reject"
+)
+
+// ArchiveCompressionConfig sets how the files of an archive are compressed.
+// With a single worker they are streamed into the archive one by one; more
+// workers compress that many files at once, each into memory, trading
+// memory for throughput.
+type ArchiveCompressionConfig struct {
+	// Workers is the number of files compressed at once; zero uses GOMAXPROCS
+	Workers int `mapstructure:"workers"`
+	// BufferSize is the number of bytes each worker reads from a file at a time
+	BufferSize int `mapstructure:"buffer_size"`
+}
+
+// ArchiveNamesConfig decodes the entry names of inspected archives that are
+// not marked as UTF-8, such as those of Windows tools, which use the code page
+// of the system. Names that are valid UTF-8 are kept as they are. Created
+// archives mark non-ASCII names as UTF-8.
+type ArchiveNamesConfig struct {
+	// Encodings are the code pages the names of an archive are tried with.
+	// The one reading most like text is used, the first on ties.
+	Encodings []string `mapstructure:"encodings"`
+	// Fallback is used when none of Encodings reads like text; without it,
+	// such names are kept as they are
+	Fallback string `mapstructure:"fallback"`
+	// UnicodePath adds the Info-ZIP Unicode Path extra field holding the
+	// UTF-8 name to created entries with non-ASCII names, for older tools
+	// that ignore the UTF-8 flag
+	UnicodePath bool `mapstructure:"unicode_path"`
+	// LegacyEncoding writes the names of created entries in a code page
+	// rather than UTF-8, for tools that only read names in the code page of
+	// the system, such as Windows Explorer before Windows 10. Characters the
+	// code page lacks are replaced with underscores, and the UTF-8 name is
+	// kept in the Unicode Path extra field.
+	LegacyEncoding string `mapstructure:"legacy_encoding"`
+}
+
+// Code pages entry names can be decoded from
+var knownNameEncodings = []string{"cp437", "cp850", "cp852", "cp866", "cp1250", "cp1251", "cp1252", "koi8-r"}
+
+// ArchiveContentsConfig embeds an entry named Name into every created
+// archive, listing its files with their sizes and SHA-256 hashes, and who
+// created it and when. The entry is JSON unless Template names a
+// text/template file rendering it, such as into a README.txt.
+type ArchiveContentsConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Name     string `mapstructure:"name"`
+	Template string `mapstructure:"template"`
+	Creator  string `mapstructure:"creator"`
+}
+
+// ArchiveChecksumsConfig adds an entry named Name to every created archive,
+// with the SHA-256 hash of every other entry in the format of sha256sum
+type ArchiveChecksumsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Name    string `mapstructure:"name"`
+}
+
+// ArchiveSigningConfig makes a detached signature of every created archive
+// with the key in KeyFile: a PEM encoded PKCS #8 Ed25519 private key or an
+// unencrypted armored PGP private key
+type ArchiveSigningConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// RemoteArchiveConfig allows inspecting archives fetched by URL. At most
+// MaxSize bytes are downloaded per archive, and private addresses can only
+// be fetched with AllowPrivate, so the server cannot be used to probe the
+// internal network.
+type RemoteArchiveConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	MaxSize      int64         `mapstructure:"max_size"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	AllowPrivate bool          `mapstructure:"allow_private"`
+}
+
+// PasswordPolicy describes the requirements for archive encryption passwords
+type PasswordPolicy struct {
+	MinLength     int  `mapstructure:"min_length"`
+	RequireUpper  bool `mapstructure:"require_upper"`
+	RequireLower  bool `mapstructure:"require_lower"`
+	RequireDigit  bool `mapstructure:"require_digit"`
+	RequireSymbol bool `mapstructure:"require_symbol"`
+	DenyCommon    bool `mapstructure:"deny_common"`
+}
+
+// LimitsConfig bounds what a single request may carry
+type LimitsConfig struct {
+	// MaxFiles is the number of files accepted in one upload form; zero is
+	// unlimited. Go's multipart parser refuses forms of more than 1000 parts
+	// regardless.
+	MaxFiles int `mapstructure:"max_files"`
+}
+
+// TempConfig sets where uploads too large to hold in memory are spooled and
+// how much disk they may use there
+type TempConfig struct {
+	// Dir is the temp root; empty uses the system temp directory
+	Dir string `mapstructure:"dir"`
+	// MaxSize is the number of bytes spooled uploads may use; zero is unlimited
+	MaxSize int64 `mapstructure:"max_size"`
+	// LargeUpload is the body size above which an upload counts against
+	// MaxSize. Smaller uploads are parsed in memory.
+	LargeUpload int64 `mapstructure:"large_upload"`
+	// OrphanAge is the age past which temp files left by crashed requests are removed
+	OrphanAge time.Duration `mapstructure:"orphan_age"`
+	// CleanupInterval is how often orphaned temp files are looked for
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
+
+// SheddingConfig rejects new archive and extraction requests while the
+// server is short of disk or memory, rather than letting it be killed
+// mid-request. Zero thresholds are not checked.
+type SheddingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinFreeDisk is the number of bytes that must stay free on the volume
+	// of the temp root
+	MinFreeDisk int64 `mapstructure:"min_free_disk"`
+	// MaxHeap is the number of heap bytes in use above which requests are shed
+	MaxHeap int64 `mapstructure:"max_heap"`
+	// MaxInflight is the number of request body bytes of archive and
+	// extraction requests handled at once
+	MaxInflight int64 `mapstructure:"max_inflight"`
+	// RetryAfter is the delay suggested to shed clients
+	RetryAfter time.Duration `mapstructure:"retry_after"`
+}
+
+// ConcurrencyConfig bounds the archive builds and extractions run at once,
+// so a burst of large uploads cannot starve the other endpoints of CPU
+type ConcurrencyConfig struct {
+	// MaxArchives is the number of builds and extractions run at once; zero
+	// uses GOMAXPROCS
+	MaxArchives int `mapstructure:"max_archives"`
+	// MaxQueued is the number of requests waiting for a slot, beyond which
+	// they are rejected at once
+	MaxQueued int `mapstructure:"max_queued"`
+	// QueueTimeout is how long a request waits for a slot; zero rejects
+	// requests finding every slot taken. Keep it well below the server's
+	// write timeout, which keeps running meanwhile.
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"`
+}
+
+// OutboundConfig sets how the server makes requests to other servers, such
+// as remote archive fetches and webhook deliveries. Loopback, private,
+// link-local and other non public addresses, the cloud metadata endpoints
+// among them, are refused unless listed in Allow or AllowPrivate is set.
+type OutboundConfig struct {
+	// Timeout bounds each attempt of a request, redirects included
+	Timeout      time.Duration `mapstructure:"timeout"`
+	MaxRedirects int           `mapstructure:"max_redirects"`
+	// Retries is the number of times a request failing with a network error
+	// or a 429, 502, 503 or 504 status is sent again
+	Retries int `mapstructure:"retries"`
+	// RetryBackoff is the delay before the first retry, doubled for each one
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	// Proxy is an http, https or socks5 url requests are sent through
+	Proxy string `mapstructure:"proxy"`
+	// Allow lists the addresses and prefixes, such as 10.1.0.0/16, that may
+	// be reached although not public
+	Allow        []string `mapstructure:"allow"`
+	AllowPrivate bool     `mapstructure:"allow_private"`
+}
+
+// WebhooksConfig posts job and mail events to HTTP endpoints through the
+// outbound client. Payloads are signed with the secret of their endpoint.
+type WebhooksConfig struct {
+	Endpoints []WebhookEndpointConfig `mapstructure:"endpoints"`
+	// Workers is the number of events delivered at once
+	Workers int `mapstructure:"workers"`
+	// QueueSize is the number of events waiting for delivery, beyond which
+	// new events are dropped
+	QueueSize int `mapstructure:"queue_size"`
+}
+
+// WebhookEndpointConfig subscribes URL to events. While a secret is being
+// rotated, payloads are signed with both Secret and PreviousSecret, so
+// receivers accept them before and after switching to the new one.
+type WebhookEndpointConfig struct {
+	URL            string `mapstructure:"url"`
+	Secret         string `mapstructure:"secret"`
+	PreviousSecret string `mapstructure:"previous_secret"`
+	// Events lists the event types delivered, such as job.failed; empty
+	// delivers every event
+	Events []string `mapstructure:"events"`
+}
+
+// EventsConfig publishes archive, job and mail events to a message bus, so
+// other systems can react to them without polling the API
+type EventsConfig struct {
+	// Driver is "nats" or "kafka"; empty publishes no events
+	Driver string `mapstructure:"driver"`
+	// Topic is the NATS subject or Kafka topic of events, in which {type}
+	// is replaced by the event type, such as archive.created
+	Topic string `mapstructure:"topic"`
+	// Events lists the event types published; empty publishes every type
+	Events []string `mapstructure:"events"`
+	// Timeout bounds the publication of an event
+	Timeout time.Duration `mapstructure:"timeout"`
+	// QueueSize is the number of events waiting to be published, beyond
+	// which new events are dropped
+	QueueSize int         `mapstructure:"queue_size"`
+	NATS      NATSConfig  `mapstructure:"nats"`
+	Kafka     KafkaConfig `mapstructure:"kafka"`
+}
+
+type NATSConfig struct {
+	// URL is the server, or several separated by commas
+	URL string `mapstructure:"url"`
+	// CredentialsFile holds the user JWT and nkey seed; empty connects
+	// without credentials
+	CredentialsFile string `mapstructure:"credentials_file"`
+}
+
+type KafkaConfig struct {
+	Brokers  []string `mapstructure:"brokers"`
+	ClientID string   `mapstructure:"client_id"`
+}
+
+type AuditConfig struct {
+	// Export streams audit entries off the server as they are recorded
+	Export AuditExportConfig `mapstructure:"export"`
+}
+
+// AuditExportConfig sends the audit trail of mail sent to a sink in
+// batches, for organizations that must keep it off the server. Failed
+// batches are sent again, up to Retries times.
+type AuditExportConfig struct {
+	// Sink is "syslog", "kafka" or "https"; empty exports nothing
+	Sink string `mapstructure:"sink"`
+	// URL is the collector the https sink posts batches to
+	URL string `mapstructure:"url"`
+	// Token is sent to the collector as a bearer token, if set
+	Token  string       `mapstructure:"token"`
+	Syslog SyslogConfig `mapstructure:"syslog"`
+	// Topic is the topic the kafka sink writes entries to
+	Topic string      `mapstructure:"topic"`
+	Kafka KafkaConfig `mapstructure:"kafka"`
+	// BatchSize is the number of entries sent at once
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval is the longest an entry waits for its batch to fill
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// QueueSize is the number of entries waiting to be sent, beyond which
+	// new entries are dropped
+	QueueSize int           `mapstructure:"queue_size"`
+	Retries   int           `mapstructure:"retries"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// BlocklistConfig refuses files added to archives or attached to mail by
+// their extension and, with Executables, by their content, so renamed
+// executables are caught too
+type BlocklistConfig struct {
+	// Extensions are matched case-insensitively and include the leading dot
+	Extensions  []string `mapstructure:"extensions"`
+	Executables bool     `mapstructure:"executables"`
+}
+
+// ValidationConfig enables the built-in file validators, which check every
+// file added to an archive or attached to mail and every entry of an
+// inspected archive. Zero values disable a check.
+type ValidationConfig struct {
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MIMETypes are the accepted types; "image/*" accepts every image type
+	MIMETypes     []string `mapstructure:"mime_types"`
+	MaxNameLength int      `mapstructure:"max_name_length"`
+}
+
+// ScanConfig controls the virus scanners registered with the application.
+// Their verdicts are cached by content hash for CacheTTL, up to CacheSize
+// files; a zero value of either disables the cache.
+type ScanConfig struct {
+	// TrustedAPIKeys are the ids of API keys, as reported in api_key_id
+	// fields, whose uploads are not scanned
+	TrustedAPIKeys []string      `mapstructure:"trusted_api_keys"`
+	CacheTTL       time.Duration `mapstructure:"cache_ttl"`
+	CacheSize      int           `mapstructure:"cache_size"`
+}
+
+type StorageConfig struct {
+	// Driver is "local" (default, the directory Dir) or "s3" (shared between instances)
+	Driver string `mapstructure:"driver"`
+	// Dir is where stored archives and their metadata are kept
+	Dir string   `mapstructure:"dir"`
+	S3  S3Config `mapstructure:"s3"`
+	// Encrypt encrypts stored archives at rest with data keys wrapped by
+	// the master key of keys.provider
+	Encrypt bool `mapstructure:"encrypt"`
+}
+
+// KeysConfig selects the provider of the master keys wrapping the keys
+// encrypting data at rest and the archive signing key: "local" (key files
+// in Local.Dir), "aws_kms" or "gcp_kms". KeyID names the master key new
+// data keys are wrapped with; changing it rotates the master key, while
+// data wrapped with the previous one can still be read.
+type KeysConfig struct {
+	Provider string          `mapstructure:"provider"`
+	KeyID    string          `mapstructure:"key_id"`
+	Local    LocalKeysConfig `mapstructure:"local"`
+	AWS      AWSKMSConfig    `mapstructure:"aws"`
+	GCP      GCPKMSConfig    `mapstructure:"gcp"`
+}
+
+// LocalKeysConfig keeps master keys in Dir, each in a file named after its
+// id with a .key extension holding 32 base64 encoded random bytes
+type LocalKeysConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// AWSKMSConfig reaches AWS KMS in Region. Without AccessKey, credentials
+// come from the default chain of the AWS SDK, instance and task roles included.
+type AWSKMSConfig struct {
+	Region    string `mapstructure:"region"`
+	Endpoint  string `mapstructure:"endpoint"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+}
+
+// GCPKMSConfig reaches Cloud KMS with the service account key in
+// CredentialsFile, or Application Default Credentials without one
+type GCPKMSConfig struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	CredentialsFile string `mapstructure:"credentials_file"`
+}
+
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+	// Prefix is prepended to every object key
+	Prefix string `mapstructure:"prefix"`
+}
+
+type JobsConfig struct {
+	// Store selects where jobs are kept: "database" (default) or "memory"
+	Store string `mapstructure:"store"`
+	// Workers is the number of jobs processed concurrently
+	Workers int `mapstructure:"workers"`
+	// MaxAttempts bounds how often a job runs, including retries
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Embedded runs the job workers and outbox inside the API server; disable
+	// it when dedicated `doozip worker` processes consume a shared queue.
+	// Either requires a keys provider, to seal the secrets of jobs.
+	Embedded bool `mapstructure:"embedded"`
+}
+
+type DatabaseConfig struct {
+	// Driver is "sqlite" (default, embedded) or "postgres"
+	Driver string `mapstructure:"driver"`
+	DSN    string `mapstructure:"dsn"`
+	// AutoMigrate applies pending migrations on startup; when disabled, run `doozip migrate`
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+}
+
+type QueueConfig struct {
+	// Driver is "memory" (default, local to the process) or "redis" (shared between instances)
+	Driver string      `mapstructure:"driver"`
+	Redis  RedisConfig `mapstructure:"redis"`
+}
+
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// Prefix is prepended to every key
+	Prefix string `mapstructure:"prefix"`
+}
+
+type RetentionConfig struct {
+	// Interval is how often expired data is removed
+	Interval time.Duration   `mapstructure:"interval"`
+	Default  RetentionPolicy `mapstructure:"default"`
+	// Keys overrides the default policy per API key id (as shown in api_key_id fields)
+	Keys map[string]RetentionPolicy `mapstructure:"keys"`
+	// AuditDays is how many days the audit trail of mail sent is kept,
+	// regardless of API key; zero keeps it forever
+	AuditDays int `mapstructure:"audit_days"`
+}
+
+// RetentionPolicy sets how many days data is kept; zero keeps it forever
+type RetentionPolicy struct {
+	ArchiveDays int `mapstructure:"archive_days"`
+	HistoryDays int `mapstructure:"history_days"`
+}
+
+type AuthConfig struct {
+	// Enabled requires an API key with a sufficient role on every route
+	// except share links
+	Enabled bool           `mapstructure:"enabled"`
+	APIKeys []APIKeyConfig `mapstructure:"api_keys"`
+	// OIDC accepts bearer tokens from an OpenID Connect provider
+	OIDC OIDCConfig `mapstructure:"oidc"`
+	// HMAC accepts requests signed with a shared secret
+	HMAC HMACConfig `mapstructure:"hmac"`
+}
+
+// APIKeyConfig grants a role to an API key. Roles are viewer, sender and
+// admin, each including the ones before it.
+type APIKeyConfig struct {
+	// Key is the secret sent in the X-API-Key header
+	Key  string `mapstructure:"key"`
+	Role string `mapstructure:"role"`
+}
+
+type OIDCConfig struct {
+	// Issuer is the provider URL; its discovery document is read from
+	// <issuer>/.well-known/openid-configuration. Empty disables OIDC.
+	Issuer string `mapstructure:"issuer"`
+	// Audience is the client id that tokens must be issued for
+	Audience string `mapstructure:"audience"`
+	// RoleClaim names the claim holding the user's roles or groups
+	RoleClaim string `mapstructure:"role_claim"`
+	// Roles maps role claim values, ignoring case, to roles; the most
+	// privileged mapped role applies
+	Roles map[string]string `mapstructure:"roles"`
+}
+
+type HMACConfig struct {
+	Clients []HMACClientConfig `mapstructure:"clients"`
+	// MaxSkew is how far a request timestamp may be from the server clock
+	MaxSkew time.Duration `mapstructure:"max_skew"`
+}
+
+// HMACClientConfig grants a role to a client signing its requests with
+// Secret. While the secret is being rotated, requests signed with
+// PreviousSecret are accepted too, so the client can switch at any time.
+type HMACClientConfig struct {
+	ID             string `mapstructure:"id"`
+	Secret         string `mapstructure:"secret"`
+	PreviousSecret string `mapstructure:"previous_secret"`
+	Role           string `mapstructure:"role"`
+}
+
+type TenancyConfig struct {
+	// Enabled requires every API request to belong to a tenant
+	Enabled bool `mapstructure:"enabled"`
+	// Header names the tenant of requests whose API key belongs to no tenant
+	Header string `mapstructure:"header"`
+	// Default is the tenant of requests naming none; empty rejects them
+	Default string                  `mapstructure:"default"`
+	Tenants map[string]TenantConfig `mapstructure:"tenants"`
+}
+
+// TenantConfig describes a tenant. Tenant ids are lower case and also name
+// the storage prefix of the tenant's archives.
+type TenantConfig struct {
+	// APIKeys are the API key ids (as shown in api_key_id fields) of the
+	// tenant; a tenant with keys cannot be selected by header alone
+	APIKeys []string `mapstructure:"api_keys"`
+	// AllowedMIMETypes further restricts the accepted uploads; empty allows
+	// everything the service accepts
+	AllowedMIMETypes []string `mapstructure:"allowed_mime_types"`
+	// MailFrom replaces mail.from for the tenant's mail
+	MailFrom string `mapstructure:"mail_from"`
+	// RateLimit is the sustained number of requests per second; zero is unlimited
+	RateLimit float64 `mapstructure:"rate_limit"`
+	Burst     int     `mapstructure:"burst"`
+	// DailyQuota is the number of request bytes accepted per day; zero is unlimited
+	DailyQuota int64 `mapstructure:"daily_quota"`
+}
+
+// AccessLogConfig routes the log of served requests to its own destination,
+// apart from the application logs
+type AccessLogConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Output is stdout, stderr, file or syslog
+	Output string `mapstructure:"output"`
+	// Path is the file appended to by the file output
+	Path string `mapstructure:"path"`
+	// Format is combined, common or json
+	Format string       `mapstructure:"format"`
+	Syslog SyslogConfig `mapstructure:"syslog"`
+}
+
+// SyslogConfig selects the syslog daemon; empty network and address use
+// the local one
+type SyslogConfig struct {
+	Network string `mapstructure:"network"`
+	Address string `mapstructure:"address"`
+	Tag     string `mapstructure:"tag"`
+}
+
+// MetricsConfig exposes Prometheus metrics on Path. The endpoint is not
+// authenticated, so it is best served on a listener reachable only by the
+// scraper.
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+}
+
+// HealthConfig controls the dependency probes of the health endpoint. Probe
+// results are reused for CacheTTL, so frequent health checks don't load the
+// dependencies.
+type HealthConfig struct {
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	// Timeout bounds each probe; a dependency not answering in time is down
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// UIConfig controls the demo page served at the root, which uploads files to
+// the archive and mail endpoints from a browser.
+type UIConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// Middlewares that can be named in a route group
+const (
+	MiddlewareAuth      = "auth"
+	MiddlewareTenant    = "tenant"
+	MiddlewareRateLimit = "rate_limit"
+	MiddlewareCORS      = "cors"
+	MiddlewareLogging   = "logging"
+	MiddlewareRecovery  = "recovery"
+	MiddlewareMetrics   = "metrics"
+)
+
+var knownMiddlewares = []string{
+	MiddlewareAuth, MiddlewareTenant, MiddlewareRateLimit, MiddlewareCORS,
+	MiddlewareLogging, MiddlewareRecovery, MiddlewareMetrics,
+}
+
+// MiddlewareConfig declares the middlewares of each route group, outermost
+// first. Server wraps every request, including unmatched ones; API, Public
+// and Admin wrap their routes once the request body is limited. auth and
+// tenant depend on the route, so they cannot be used in Server.
+type MiddlewareConfig struct {
+	Server    []string        `mapstructure:"server"`
+	API       []string        `mapstructure:"api"`
+	Public    []string        `mapstructure:"public"`
+	Admin     []string        `mapstructure:"admin"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	CORS      CORSConfig      `mapstructure:"cors"`
+}
+
+// RateLimitConfig limits the requests of each client IP in the groups
+// using rate_limit
+type RateLimitConfig struct {
+	// Rate is the sustained number of requests per second
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// CORSConfig lets browsers on other origins call the routes of the groups
+// using cors. Preflight requests are only answered from the Server group,
+// since they match no route.
+type CORSConfig struct {
+	// AllowedOrigins lists the accepted origins; "*" accepts any
+	AllowedOrigins []string      `mapstructure:"allowed_origins"`
+	AllowedHeaders []string      `mapstructure:"allowed_headers"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+}
+
+// Features that can be switched off per deployment
+const (
+	// FeatureEncryption allows password protected archives
+	FeatureEncryption = "encryption"
+	// FeatureAsyncJobs allows processing uploads in background jobs
+	FeatureAsyncJobs = "async_jobs"
+	// FeatureMail allows sending files by mail
+	FeatureMail = "mail"
+)
+
+var knownFeatures = []string{FeatureEncryption, FeatureAsyncJobs, FeatureMail}
+
+// FeaturesConfig switches capabilities on or off by name, so risky ones can
+// be rolled out per deployment. Features that are not listed are enabled.
+type FeaturesConfig map[string]bool
+
+// Enabled reports whether the named feature is enabled
+func (f FeaturesConfig) Enabled(name string) bool {
+	enabled, ok := f[name]
+	return !ok || enabled
+}
+
+// Disabled returns the names of the disabled features in sorted order
+func (f FeaturesConfig) Disabled() []string {
+	var disabled []string
+	for _, name := range knownFeatures {
+		if !f.Enabled(name) {
+			disabled = append(disabled, name)
+		}
+	}
+	sort.Strings(disabled)
+	return disabled
 }
 
 type Config struct {
-	App    AppConfig    `mapstructure:"app"`
-	Env    string       `mapstructure:"environment"`
-	Server ServerConfig `mapstructure:"server"`
-	SMTP   SMTP         `mapstructure:"smtp"`
+	App         AppConfig         `mapstructure:"app"`
+	Env         string            `mapstructure:"environment"`
+	Server      ServerConfig      `mapstructure:"server"`
+	SMTP        SMTP              `mapstructure:"smtp"`
+	Mail        MailConfig        `mapstructure:"mail"`
+	Archive     ArchiveConfig     `mapstructure:"archive"`
+	Limits      LimitsConfig      `mapstructure:"limits"`
+	Temp        TempConfig        `mapstructure:"temp"`
+	Shedding    SheddingConfig    `mapstructure:"shedding"`
+	Concurrency ConcurrencyConfig `mapstructure:"concurrency"`
+	Outbound    OutboundConfig    `mapstructure:"outbound"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	Events      EventsConfig      `mapstructure:"events"`
+	Audit       AuditConfig       `mapstructure:"audit"`
+	Blocklist   BlocklistConfig   `mapstructure:"blocklist"`
+	Validation  ValidationConfig  `mapstructure:"validation"`
+	Scan        ScanConfig        `mapstructure:"scan"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	Keys        KeysConfig        `mapstructure:"keys"`
+	Jobs        JobsConfig        `mapstructure:"jobs"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Queue       QueueConfig       `mapstructure:"queue"`
+	Retention   RetentionConfig   `mapstructure:"retention"`
+	Tenancy     TenancyConfig     `mapstructure:"tenancy"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	AccessLog   AccessLogConfig   `mapstructure:"access_log"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Health      HealthConfig      `mapstructure:"health"`
+	UI          UIConfig          `mapstructure:"ui"`
+	Middleware  MiddlewareConfig  `mapstructure:"middleware"`
+	Features    FeaturesConfig    `mapstructure:"features"`
+}
+
+// LoadOptions change where the configuration is read from and override
+// settings, such as with command line flags
+type LoadOptions struct {
+	// File is the config file; empty looks for config.yml in ./config/
+	File string
+	// Overrides set keys such as "server.port" over the file and the
+	// environment
+	Overrides map[string]any
 }
 
 // LoadConfig initializes, validates, and returns the application configuration
 func LoadConfig() (*Config, error) {
+	return Load(LoadOptions{})
+}
+
+// Load is LoadConfig with the file and overrides of opts
+func Load(opts LoadOptions) (*Config, error) {
 	// Initialize and set defaults
-	if err := initializeViper(); err != nil {
+	if err := initializeViper(opts.File); err != nil {
 		return nil, fmt.Errorf("failed to initialize viper: %w", err)
 	}
+	for key, value := range opts.Overrides {
+		viper.Set(key, value)
+	}
 
 	// Unmarshal configuration
 	var config Config
@@ -57,11 +911,15 @@ func LoadConfig() (*Config, error) {
 	return &config, nil
 }
 
-func initializeViper() error {
+func initializeViper(file string) error {
 	// Set up viper to read from both config files and environment variables
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("./config/")
+	if file != "" {
+		viper.SetConfigFile(file)
+	} else {
+		viper.SetConfigName("config")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath("./config/")
+	}
 
 	// Environment variable handling
 	viper.AutomaticEnv()
@@ -86,7 +944,7 @@ func initializeViper() error {
 
 func setDefaults() {
 	viper.SetDefault("app.name", "doozip")
-	viper.SetDefault("app.version", "1.0.0")
+	viper.SetDefault("app.version", buildinfo.DefaultVersion())
 	viper.SetDefault("environment", "development")
 
 	viper.SetDefault("server.host", "localhost")
@@ -95,9 +953,176 @@ func setDefaults() {
 	viper.SetDefault("server.read_timeout", "5s")
 	viper.SetDefault("server.write_timeout", "10s")
 	viper.SetDefault("server.idle_timeout", "60s")
+	viper.SetDefault("server.read_header_timeout", "2s")
+	viper.SetDefault("server.max_header_bytes", 64<<10)
+	viper.SetDefault("server.max_connections", 1024)
 
 	viper.SetDefault("smtp.host", "smtp.example.com")
 	viper.SetDefault("smtp.port", "587")
+	viper.SetDefault("smtp.unhealthy_cooldown", "1m")
+	viper.SetDefault("smtp.dial_timeout", "10s")
+	viper.SetDefault("smtp.command_timeout", "1m")
+	viper.SetDefault("smtp.data_timeout", "5m")
+	viper.SetDefault("smtp.punycode_domains", true)
+
+	viper.SetDefault("mail.transport", "smtp")
+	viper.SetDefault("mail.maildir", "./maildir")
+	viper.SetDefault("mail.from", "")
+	viper.SetDefault("mail.return_path", "")
+	viper.SetDefault("mail.templates_dir", "")
+	viper.SetDefault("mail.default_subject", "File Attachment")
+	viper.SetDefault("mail.default_body", "Please find the attached file.")
+	viper.SetDefault("mail.fanout_threshold", 10)
+	viper.SetDefault("mail.fanout_workers", 8)
+	viper.SetDefault("mail.max_attachment_size", 0)
+	viper.SetDefault("mail.upload.max_file_size", 50<<20)
+	viper.SetDefault("mail.upload.max_inline_size", 10<<20)
+	viper.SetDefault("mail.outbox.stale_after", 15*time.Minute)
+	viper.SetDefault("mail.outbox.retention", 7*24*time.Hour)
+	viper.SetDefault("mail.recipient_validation.level", "syntax")
+	viper.SetDefault("mail.recipient_validation.timeout", "5s")
+	viper.SetDefault("mail.recipient_validation.cache_ttl", "1h")
+
+	viper.SetDefault("archive.password_policy.min_length", 8)
+	viper.SetDefault("archive.password_policy.require_upper", false)
+	viper.SetDefault("archive.password_policy.require_lower", true)
+	viper.SetDefault("archive.password_policy.require_digit", true)
+	viper.SetDefault("archive.password_policy.require_symbol", false)
+	viper.SetDefault("archive.password_policy.deny_common", true)
+	viper.SetDefault("archive.remote.enabled", false)
+	viper.SetDefault("archive.remote.max_size", 100<<20)
+	viper.SetDefault("archive.remote.timeout", "30s")
+	viper.SetDefault("archive.remote.allow_private", false)
+	viper.SetDefault("archive.contents.enabled", false)
+	viper.SetDefault("archive.contents.name", "MANIFEST.json")
+	viper.SetDefault("archive.contents.creator", "doozip")
+	viper.SetDefault("archive.checksums.enabled", false)
+	viper.SetDefault("archive.checksums.name", "SHA256SUMS")
+	viper.SetDefault("archive.signing.enabled", false)
+	viper.SetDefault("archive.special_entries", SpecialEntriesMaterialize)
+	viper.SetDefault("archive.hidden.exclude", false)
+	viper.SetDefault("archive.hidden.names", []string{"Thumbs.db", "desktop.ini", "__MACOSX"})
+	viper.SetDefault("archive.grep.max_file_size", 10<<20)
+	viper.SetDefault("archive.grep.max_files", 1000)
+	viper.SetDefault("archive.grep.max_bytes", 100<<20)
+	viper.SetDefault("archive.grep.max_lines", 1000)
+	viper.SetDefault("archive.names.encodings", []string{"cp437", "cp866", "cp1251"})
+	viper.SetDefault("archive.names.fallback", "cp437")
+	viper.SetDefault("archive.names.unicode_path", false)
+	viper.SetDefault("archive.names.legacy_encoding", "")
+	viper.SetDefault("archive.compression.workers", 1)
+	viper.SetDefault("archive.compression.buffer_size", 32<<10)
+	viper.SetDefault("archive.information.max_file_size", 10<<20)
+	viper.SetDefault("archive.information.async_threshold", 0)
+
+	viper.SetDefault("limits.max_files", 500)
+
+	viper.SetDefault("temp.dir", "")
+	viper.SetDefault("temp.max_size", 0)
+	viper.SetDefault("temp.large_upload", 10<<20)
+	viper.SetDefault("temp.orphan_age", time.Hour)
+	viper.SetDefault("temp.cleanup_interval", 10*time.Minute)
+
+	viper.SetDefault("shedding.enabled", false)
+	viper.SetDefault("shedding.min_free_disk", 512<<20)
+	viper.SetDefault("shedding.max_heap", 0)
+	viper.SetDefault("shedding.max_inflight", 512<<20)
+	viper.SetDefault("shedding.retry_after", 5*time.Second)
+
+	viper.SetDefault("concurrency.max_archives", 0)
+	viper.SetDefault("concurrency.max_queued", 64)
+	viper.SetDefault("concurrency.queue_timeout", 5*time.Second)
+
+	viper.SetDefault("outbound.timeout", 30*time.Second)
+	viper.SetDefault("outbound.max_redirects", 5)
+	viper.SetDefault("outbound.retries", 2)
+	viper.SetDefault("outbound.retry_backoff", 500*time.Millisecond)
+	viper.SetDefault("outbound.proxy", "")
+	viper.SetDefault("outbound.allow", []string{})
+	viper.SetDefault("outbound.allow_private", false)
+
+	viper.SetDefault("webhooks.workers", 2)
+	viper.SetDefault("webhooks.queue_size", 1000)
+
+	viper.SetDefault("events.driver", "")
+	viper.SetDefault("events.topic", "doozip.{type}")
+	viper.SetDefault("events.events", []string{})
+	viper.SetDefault("events.timeout", 10*time.Second)
+	viper.SetDefault("events.queue_size", 1000)
+	viper.SetDefault("events.nats.url", "nats://localhost:4222")
+	viper.SetDefault("events.kafka.brokers", []string{"localhost:9092"})
+	viper.SetDefault("events.kafka.client_id", "doozip")
+
+	viper.SetDefault("audit.export.sink", "")
+	viper.SetDefault("audit.export.syslog.tag", "doozip-audit")
+	viper.SetDefault("audit.export.topic", "doozip.audit")
+	viper.SetDefault("audit.export.kafka.brokers", []string{"localhost:9092"})
+	viper.SetDefault("audit.export.kafka.client_id", "doozip")
+	viper.SetDefault("audit.export.batch_size", 100)
+	viper.SetDefault("audit.export.flush_interval", 5*time.Second)
+	viper.SetDefault("audit.export.queue_size", 10000)
+	viper.SetDefault("audit.export.retries", 5)
+	viper.SetDefault("audit.export.timeout", 30*time.Second)
+
+	viper.SetDefault("blocklist.extensions", []string{
+		".exe", ".com", ".scr", ".pif", ".msi", ".dll", ".cpl", ".bat", ".cmd",
+		".js", ".jse", ".vbs", ".vbe", ".wsf", ".wsh", ".hta", ".ps1", ".lnk",
+		".docm", ".dotm", ".xlsm", ".xltm", ".xlam", ".pptm", ".potm", ".ppsm", ".ppam",
+	})
+	viper.SetDefault("blocklist.executables", true)
+
+	viper.SetDefault("validation.max_file_size", 0)
+	viper.SetDefault("validation.max_name_length", 255)
+	viper.SetDefault("scan.cache_ttl", 24*time.Hour)
+	viper.SetDefault("scan.cache_size", 10000)
+
+	viper.SetDefault("storage.driver", "local")
+	viper.SetDefault("storage.dir", "./data/archives")
+	viper.SetDefault("storage.s3.endpoint", "s3.amazonaws.com")
+	viper.SetDefault("storage.s3.use_ssl", true)
+	viper.SetDefault("storage.s3.prefix", "archives/")
+	viper.SetDefault("storage.encrypt", false)
+	viper.SetDefault("keys.local.dir", "./config/keys")
+	viper.SetDefault("keys.aws.region", "us-east-1")
+	viper.SetDefault("keys.gcp.endpoint", "https://cloudkms.googleapis.com")
+
+	viper.SetDefault("jobs.store", "database")
+	viper.SetDefault("jobs.workers", 2)
+	viper.SetDefault("jobs.max_attempts", 3)
+	viper.SetDefault("jobs.embedded", true)
+
+	viper.SetDefault("database.driver", "sqlite")
+	viper.SetDefault("database.dsn", "./data/doozip.db")
+	viper.SetDefault("database.auto_migrate", true)
+
+	viper.SetDefault("queue.driver", "memory")
+	viper.SetDefault("queue.redis.addr", "localhost:6379")
+	viper.SetDefault("queue.redis.prefix", "doozip:")
+
+	viper.SetDefault("retention.interval", time.Hour)
+
+	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.oidc.role_claim", "roles")
+	viper.SetDefault("auth.hmac.max_skew", "5m")
+	viper.SetDefault("access_log.enabled", false)
+	viper.SetDefault("access_log.output", "stdout")
+	viper.SetDefault("access_log.format", "combined")
+	viper.SetDefault("access_log.syslog.tag", "doozip")
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("health.cache_ttl", 30*time.Second)
+	viper.SetDefault("health.timeout", 5*time.Second)
+	viper.SetDefault("ui.enabled", false)
+
+	viper.SetDefault("middleware.server", []string{MiddlewareLogging, MiddlewareMetrics, MiddlewareRecovery})
+	viper.SetDefault("middleware.api", []string{MiddlewareAuth, MiddlewareTenant})
+	viper.SetDefault("middleware.public", []string{})
+	viper.SetDefault("middleware.admin", []string{MiddlewareAuth})
+	viper.SetDefault("middleware.cors.allowed_headers", []string{"Authorization", "Content-Type", "X-API-Key"})
+	viper.SetDefault("middleware.cors.max_age", "10m")
+
+	viper.SetDefault("tenancy.enabled", false)
+	viper.SetDefault("tenancy.header", "X-Tenant-ID")
 }
 
 func validateConfig(config *Config) error {
@@ -113,9 +1138,482 @@ func validateConfig(config *Config) error {
 	if !isValidEnvironment(config.Env) {
 		return fmt.Errorf("invalid environment: %s", config.Env)
 	}
+	if strings.ContainsFunc(config.SMTP.HeloHostname, unicode.IsSpace) {
+		return fmt.Errorf("invalid smtp helo hostname: %q", config.SMTP.HeloHostname)
+	}
+	if config.SMTP.DialTimeout < 0 || config.SMTP.CommandTimeout < 0 || config.SMTP.DataTimeout < 0 {
+		return fmt.Errorf("smtp timeouts cannot be negative")
+	}
+	switch config.Mail.Transport {
+	case "", "smtp", "maildir":
+	default:
+		return fmt.Errorf("invalid mail transport: %s", config.Mail.Transport)
+	}
+	if config.Mail.FanOutThreshold < 0 || config.Mail.FanOutWorkers < 0 {
+		return fmt.Errorf("mail fan-out settings cannot be negative")
+	}
+	if config.Mail.MaxAttachmentSize < 0 {
+		return fmt.Errorf("mail max attachment size cannot be negative")
+	}
+	if config.Mail.Upload.MaxFileSize < 0 || config.Mail.Upload.MaxInlineSize < 0 {
+		return fmt.Errorf("mail upload limits cannot be negative")
+	}
+	if config.Mail.Outbox.StaleAfter < 0 || config.Mail.Outbox.Retention < 0 {
+		return fmt.Errorf("mail outbox durations cannot be negative")
+	}
+	switch config.Mail.RecipientValidation.Level {
+	case "", "syntax", "mx":
+	default:
+		return fmt.Errorf("invalid mail recipient validation level: %s", config.Mail.RecipientValidation.Level)
+	}
+	if config.Mail.RecipientValidation.Timeout < 0 || config.Mail.RecipientValidation.CacheTTL < 0 {
+		return fmt.Errorf("mail recipient validation durations cannot be negative")
+	}
+	for _, key := range config.Mail.PGP.Keys {
+		if _, err := mail.ParseAddress(key.Address); err != nil || key.File == "" {
+			return fmt.Errorf("mail pgp keys need a valid address and a file: %q", key.Address)
+		}
+	}
+	if config.Archive.PasswordPolicy.MinLength < 0 {
+		return fmt.Errorf("archive password minimum length cannot be negative")
+	}
+	if config.Archive.Remote.Enabled && (config.Archive.Remote.MaxSize <= 0 || config.Archive.Remote.Timeout <= 0) {
+		return fmt.Errorf("remote archive size limit and timeout must be positive")
+	}
+	for _, name := range config.Archive.Processors {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("archive processor names cannot be empty")
+		}
+	}
+	for _, name := range config.Archive.Hidden.Names {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid hidden file name: %q", name)
+		}
+	}
+	if grep := config.Archive.Grep; grep.MaxFileSize < 0 || grep.MaxFiles < 0 || grep.MaxBytes < 0 || grep.MaxLines < 0 {
+		return fmt.Errorf("archive grep limits cannot be negative")
+	}
+	if info := config.Archive.Information; info.MaxFileSize < 0 || info.AsyncThreshold < 0 {
+		return fmt.Errorf("archive information limits cannot be negative")
+	}
+	switch config.Archive.SpecialEntries {
+	case "", SpecialEntriesMaterialize, SpecialEntriesSkip, SpecialEntriesReject:
+	default:
+		return fmt.Errorf("invalid archive special entries policy: %s", config.Archive.SpecialEntries)
+	}
+	if contents := config.Archive.Contents; contents.Enabled && !validEntryName(contents.Name) {
+		return fmt.Errorf("invalid archive contents name: %q", contents.Name)
+	}
+	if checksums := config.Archive.Checksums; checksums.Enabled {
+		if !validEntryName(checksums.Name) {
+			return fmt.Errorf("invalid archive checksums name: %q", checksums.Name)
+		}
+		if config.Archive.Contents.Enabled && checksums.Name == config.Archive.Contents.Name {
+			return fmt.Errorf("archive checksums and contents cannot both be named %q", checksums.Name)
+		}
+	}
+	if config.Archive.Signing.Enabled && config.Archive.Signing.KeyFile == "" {
+		return fmt.Errorf("archive signing requires a key file")
+	}
+	for _, encoding := range config.Archive.Names.Encodings {
+		if !slices.Contains(knownNameEncodings, encoding) {
+			return fmt.Errorf("unknown archive name encoding: %q", encoding)
+		}
+	}
+	for _, encoding := range []string{config.Archive.Names.Fallback, config.Archive.Names.LegacyEncoding} {
+		if encoding != "" && !slices.Contains(knownNameEncodings, encoding) {
+			return fmt.Errorf("unknown archive name encoding: %q", encoding)
+		}
+	}
+	if config.Archive.Compression.Workers < 0 || config.Archive.Compression.BufferSize < 0 {
+		return fmt.Errorf("archive compression settings cannot be negative")
+	}
+	if config.Limits.MaxFiles < 0 {
+		return fmt.Errorf("maximum files per upload cannot be negative")
+	}
+	if config.Temp.MaxSize < 0 || config.Temp.LargeUpload < 0 || config.Temp.OrphanAge < 0 || config.Temp.CleanupInterval < 0 {
+		return fmt.Errorf("temp settings cannot be negative")
+	}
+	if shed := config.Shedding; shed.MinFreeDisk < 0 || shed.MaxHeap < 0 || shed.MaxInflight < 0 || shed.RetryAfter < 0 {
+		return fmt.Errorf("load shedding thresholds cannot be negative")
+	}
+	if config.Concurrency.MaxArchives < 0 || config.Concurrency.MaxQueued < 0 || config.Concurrency.QueueTimeout < 0 {
+		return fmt.Errorf("concurrency settings cannot be negative")
+	}
+	if out := config.Outbound; out.Timeout < 0 || out.MaxRedirects < 0 || out.Retries < 0 || out.RetryBackoff < 0 {
+		return fmt.Errorf("outbound settings cannot be negative")
+	}
+	if err := validateWebhooks(&config.Webhooks); err != nil {
+		return err
+	}
+	if err := validateEvents(&config.Events); err != nil {
+		return err
+	}
+	if err := validateAuditExport(&config.Audit.Export); err != nil {
+		return err
+	}
+	if config.Validation.MaxFileSize < 0 || config.Validation.MaxNameLength < 0 {
+		return fmt.Errorf("validation limits cannot be negative")
+	}
+	for _, mimeType := range config.Validation.MIMETypes {
+		if !strings.Contains(mimeType, "/") {
+			return fmt.Errorf("validation mime type %q must be of the form type/subtype", mimeType)
+		}
+	}
+	if config.Scan.CacheTTL < 0 || config.Scan.CacheSize < 0 {
+		return fmt.Errorf("scan cache ttl and size cannot be negative")
+	}
+	for _, id := range config.Scan.TrustedAPIKeys {
+		if strings.TrimSpace(id) == "" {
+			return fmt.Errorf("trusted api key ids cannot be empty")
+		}
+	}
+	for _, ext := range config.Blocklist.Extensions {
+		if len(ext) < 2 || !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("blocklist extension %q must start with a dot", ext)
+		}
+	}
+	switch config.Storage.Driver {
+	case "", "local":
+	case "s3":
+		if config.Storage.S3.Bucket == "" {
+			return fmt.Errorf("s3 storage requires a bucket")
+		}
+	default:
+		return fmt.Errorf("invalid storage driver: %s", config.Storage.Driver)
+	}
+	switch config.Keys.Provider {
+	case "":
+		if config.Storage.Encrypt {
+			return fmt.Errorf("storage encryption requires a keys provider")
+		}
+	case "local", "aws_kms", "gcp_kms":
+		if config.Keys.KeyID == "" {
+			return fmt.Errorf("keys provider %s requires a key id", config.Keys.Provider)
+		}
+	default:
+		return fmt.Errorf("invalid keys provider: %s", config.Keys.Provider)
+	}
+	switch config.Jobs.Store {
+	case "", "database", "memory":
+	default:
+		return fmt.Errorf("invalid job store: %s", config.Jobs.Store)
+	}
+	switch config.Database.Driver {
+	case "", "sqlite", "postgres":
+	default:
+		return fmt.Errorf("invalid database driver: %s", config.Database.Driver)
+	}
+	switch config.Queue.Driver {
+	case "", "memory", "redis":
+	default:
+		return fmt.Errorf("invalid queue driver: %s", config.Queue.Driver)
+	}
+	// Without a keys provider, the secrets of queued jobs are sealed with a
+	// key only the instance that accepted them holds
+	if config.Keys.Provider == "" && (config.Queue.Driver == "redis" || !config.Jobs.Embedded) {
+		return fmt.Errorf("a shared queue or dedicated workers require a keys provider to seal the secrets of jobs")
+	}
+	if config.Jobs.Workers < 0 || config.Jobs.MaxAttempts < 0 {
+		return fmt.Errorf("job settings cannot be negative")
+	}
+	if config.Retention.Interval < 0 {
+		return fmt.Errorf("retention interval cannot be negative")
+	}
+	for key, policy := range config.Retention.Keys {
+		if policy.ArchiveDays < 0 || policy.HistoryDays < 0 {
+			return fmt.Errorf("retention days cannot be negative (key %s)", key)
+		}
+	}
+	if config.Retention.Default.ArchiveDays < 0 || config.Retention.Default.HistoryDays < 0 || config.Retention.AuditDays < 0 {
+		return fmt.Errorf("retention days cannot be negative")
+	}
+	if err := validateAuth(&config.Auth); err != nil {
+		return err
+	}
+	if err := validateTenancy(&config.Tenancy); err != nil {
+		return err
+	}
+	if err := validateAccessLog(&config.AccessLog); err != nil {
+		return err
+	}
+	if err := validateMiddleware(config); err != nil {
+		return err
+	}
+	if config.Metrics.Enabled && !strings.HasPrefix(config.Metrics.Path, "/") {
+		return fmt.Errorf("metrics path must start with /: %s", config.Metrics.Path)
+	}
+	if config.Health.CacheTTL < 0 || config.Health.Timeout < 0 {
+		return fmt.Errorf("health cache ttl and timeout cannot be negative")
+	}
+	for name := range config.Features {
+		if !slices.Contains(knownFeatures, name) {
+			return fmt.Errorf("unknown feature: %s", name)
+		}
+	}
 	if config.Server.ShutdownTimeout <= 0 || config.Server.ReadTimeout <= 0 || config.Server.WriteTimeout <= 0 || config.Server.IdleTimeout <= 0 {
 		return fmt.Errorf("all server timeouts must be positive")
 	}
+	if config.Server.ReadHeaderTimeout < 0 || config.Server.MaxHeaderBytes < 0 || config.Server.MaxConnections < 0 {
+		return fmt.Errorf("server header timeout and connection limits must not be negative")
+	}
+	if err := validateListeners(config.Server.Listeners); err != nil {
+		return err
+	}
+	for _, proxy := range config.Server.TrustedProxies {
+		if _, errPrefix := netip.ParsePrefix(proxy); errPrefix != nil {
+			if _, errAddr := netip.ParseAddr(proxy); errAddr != nil {
+				return fmt.Errorf("invalid trusted proxy: %s", proxy)
+			}
+		}
+	}
+	return nil
+}
+
+func validateMiddleware(config *Config) error {
+	groups := []struct {
+		name  string
+		names []string
+	}{
+		{"server", config.Middleware.Server},
+		{"api", config.Middleware.API},
+		{"public", config.Middleware.Public},
+		{"admin", config.Middleware.Admin},
+	}
+	for _, group := range groups {
+		seen := make(map[string]bool, len(group.names))
+		for _, name := range group.names {
+			if !slices.Contains(knownMiddlewares, name) {
+				return fmt.Errorf("unknown middleware in %s group: %s", group.name, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("duplicate middleware in %s group: %s", group.name, name)
+			}
+			seen[name] = true
+
+			switch name {
+			case MiddlewareAuth, MiddlewareTenant:
+				if group.name == "server" {
+					return fmt.Errorf("middleware %s cannot be used in the server group", name)
+				}
+			case MiddlewareRateLimit:
+				if config.Middleware.RateLimit.Rate <= 0 || config.Middleware.RateLimit.Burst < 0 {
+					return fmt.Errorf("rate_limit middleware requires a positive rate")
+				}
+			case MiddlewareCORS:
+				if len(config.Middleware.CORS.AllowedOrigins) == 0 {
+					return fmt.Errorf("cors middleware requires allowed origins")
+				}
+			}
+		}
+	}
+
+	// Dropping these would expose routes that are meant to be protected
+	if config.Auth.Enabled && (!slices.Contains(config.Middleware.API, MiddlewareAuth) || !slices.Contains(config.Middleware.Admin, MiddlewareAuth)) {
+		return fmt.Errorf("auth is enabled, so the api and admin groups must use the auth middleware")
+	}
+	if config.Tenancy.Enabled && !slices.Contains(config.Middleware.API, MiddlewareTenant) {
+		return fmt.Errorf("tenancy is enabled, so the api group must use the tenant middleware")
+	}
+	return nil
+}
+
+func validateListeners(listeners []ListenerConfig) error {
+	addresses := make(map[string]bool, len(listeners))
+	for i, listener := range listeners {
+		if listener.Address == "" {
+			return fmt.Errorf("server listener %d has no address", i)
+		}
+		if addresses[listener.Address] {
+			return fmt.Errorf("duplicate server listener address: %s", listener.Address)
+		}
+		addresses[listener.Address] = true
+
+		if listener.TLS.Enabled() && (listener.TLS.CertFile == "" || listener.TLS.KeyFile == "") {
+			return fmt.Errorf("server listener %s needs both a tls cert_file and key_file", listener.Address)
+		}
+	}
+	return nil
+}
+
+func validateAuth(auth *AuthConfig) error {
+	seen := make(map[string]bool, len(auth.APIKeys))
+	for i, key := range auth.APIKeys {
+		if key.Key == "" {
+			return fmt.Errorf("api key %d has no key", i)
+		}
+		if seen[key.Key] {
+			return fmt.Errorf("api key %d is listed more than once", i)
+		}
+		seen[key.Key] = true
+		switch key.Role {
+		case "viewer", "sender", "admin":
+		default:
+			return fmt.Errorf("invalid role for api key %d: %s", i, key.Role)
+		}
+	}
+	if auth.OIDC.Issuer != "" && auth.OIDC.Audience == "" {
+		return fmt.Errorf("oidc requires an audience")
+	}
+	for value, role := range auth.OIDC.Roles {
+		switch role {
+		case "viewer", "sender", "admin":
+		default:
+			return fmt.Errorf("invalid role for oidc claim %s: %s", value, role)
+		}
+	}
+	clients := make(map[string]bool, len(auth.HMAC.Clients))
+	for i, client := range auth.HMAC.Clients {
+		if client.ID == "" || client.Secret == "" {
+			return fmt.Errorf("hmac client %d requires an id and a secret", i)
+		}
+		if clients[client.ID] {
+			return fmt.Errorf("hmac client %s is listed more than once", client.ID)
+		}
+		clients[client.ID] = true
+		switch client.Role {
+		case "viewer", "sender", "admin":
+		default:
+			return fmt.Errorf("invalid role for hmac client %s: %s", client.ID, client.Role)
+		}
+	}
+	if auth.HMAC.MaxSkew < 0 {
+		return fmt.Errorf("hmac max skew cannot be negative")
+	}
+	if auth.Enabled && len(auth.APIKeys) == 0 && auth.OIDC.Issuer == "" && len(auth.HMAC.Clients) == 0 {
+		return fmt.Errorf("auth requires at least one api key, hmac client or an oidc issuer")
+	}
+	return nil
+}
+
+// tenantIDRegex restricts tenant ids so they can be used as storage prefixes
+var tenantIDRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+func validateTenancy(tenancy *TenancyConfig) error {
+	keys := make(map[string]string)
+	for id, tenant := range tenancy.Tenants {
+		if !tenantIDRegex.MatchString(id) {
+			return fmt.Errorf("invalid tenant id: %s", id)
+		}
+		if tenant.RateLimit < 0 || tenant.Burst < 0 || tenant.DailyQuota < 0 {
+			return fmt.Errorf("tenant limits cannot be negative (tenant %s)", id)
+		}
+		for _, key := range tenant.APIKeys {
+			if other, ok := keys[key]; ok && other != id {
+				return fmt.Errorf("api key %s belongs to tenants %s and %s", key, other, id)
+			}
+			keys[key] = id
+		}
+	}
+	if tenancy.Default != "" {
+		if _, ok := tenancy.Tenants[tenancy.Default]; !ok {
+			return fmt.Errorf("unknown default tenant: %s", tenancy.Default)
+		}
+	}
+	if tenancy.Enabled && len(tenancy.Tenants) == 0 {
+		return fmt.Errorf("tenancy requires at least one tenant")
+	}
+	return nil
+}
+
+func validateAccessLog(accessLog *AccessLogConfig) error {
+	if !accessLog.Enabled {
+		return nil
+	}
+	switch accessLog.Output {
+	case "stdout", "stderr", "syslog":
+	case "file":
+		if accessLog.Path == "" {
+			return fmt.Errorf("access log file output requires a path")
+		}
+	default:
+		return fmt.Errorf("invalid access log output: %s", accessLog.Output)
+	}
+	switch accessLog.Format {
+	case "combined", "common", "json":
+	default:
+		return fmt.Errorf("invalid access log format: %s", accessLog.Format)
+	}
+	return nil
+}
+
+func validateWebhooks(webhooks *WebhooksConfig) error {
+	if webhooks.Workers < 0 || webhooks.QueueSize < 0 {
+		return fmt.Errorf("webhook workers and queue size cannot be negative")
+	}
+	for i, endpoint := range webhooks.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook endpoint %d requires an http or https url", i)
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("webhook endpoint %s requires a secret", endpoint.URL)
+		}
+		for _, event := range endpoint.Events {
+			if !slices.Contains(eventTypes, event) {
+				return fmt.Errorf("invalid event for webhook endpoint %s: %s", endpoint.URL, event)
+			}
+		}
+	}
+	return nil
+}
+
+// eventTypes are the types of the events published to webhooks and the bus
+var eventTypes = []string{
+	"archive.created", "archive.downloaded",
+	"job.succeeded", "job.failed",
+	"mail.sent", "mail.failed",
+}
+
+func validateEvents(events *EventsConfig) error {
+	switch events.Driver {
+	case "":
+		return nil
+	case "nats":
+		if events.NATS.URL == "" {
+			return fmt.Errorf("nats events require a url")
+		}
+	case "kafka":
+		if len(events.Kafka.Brokers) == 0 {
+			return fmt.Errorf("kafka events require at least one broker")
+		}
+	default:
+		return fmt.Errorf("invalid events driver: %s", events.Driver)
+	}
+	if events.Topic == "" {
+		return fmt.Errorf("events require a topic")
+	}
+	if events.Timeout < 0 || events.QueueSize < 0 {
+		return fmt.Errorf("events timeout and queue size cannot be negative")
+	}
+	for _, event := range events.Events {
+		if !slices.Contains(eventTypes, event) {
+			return fmt.Errorf("invalid event type: %s", event)
+		}
+	}
+	return nil
+}
+
+func validateAuditExport(export *AuditExportConfig) error {
+	switch export.Sink {
+	case "":
+		return nil
+	case "syslog":
+	case "kafka":
+		if len(export.Kafka.Brokers) == 0 || export.Topic == "" {
+			return fmt.Errorf("kafka audit export requires brokers and a topic")
+		}
+	case "https":
+		u, err := url.Parse(export.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("https audit export requires an http or https url")
+		}
+	default:
+		return fmt.Errorf("invalid audit export sink: %s", export.Sink)
+	}
+	if export.BatchSize < 0 || export.FlushInterval < 0 || export.QueueSize < 0 || export.Retries < 0 || export.Timeout < 0 {
+		return fmt.Errorf("audit export settings cannot be negative")
+	}
 	return nil
 }
 
@@ -128,6 +1626,13 @@ func isValidEnvironment(env string) bool {
 	return valid
 }
 
+// validEntryName reports whether name is a clean relative path inside an
+// archive
+func validEntryName(name string) bool {
+	return name != "" && !path.IsAbs(name) && path.Clean(name) == name &&
+		name != ".." && !strings.HasPrefix(name, "../")
+}
+
 // String returns a string representation of the config for debugging
 func (c *Config) String() string {
 	return fmt.Sprintf(
@@ -141,8 +1646,73 @@ func (c *Config) String() string {
 	Read Timeout:          %s
 	Write Timeout:         %s
 	Idling Timeout:        %s
+	Read Header Timeout:   %s
+	Max Header Bytes:      %d
+	Max Connections:       %d
+	Listeners:             %d
+	Trusted Proxies:       %d
 	SMTP Host:             %s
 	SMTP Port:             %s
+	SMTP Fallbacks:        %d
+	SMTP HELO Hostname:    %s
+	SMTP Timeouts:         dial %s, command %s, data %s
+	SMTP Punycode Domains: %t
+	Mail Transport:        %s
+	Mail From:             %s
+	Mail Return Path:      %s
+	Mail Templates Dir:    %s
+	Mail Fan-out:          %d recipients, %d workers
+	Mail PGP:              %d keys, required %t
+	Mail Zip:              %t, encrypted %t
+	Mail Attachment Max:   %d
+	Mail Upload Max:       %d bytes, %d inline
+	Mail Outbox:           stale after %s, kept %s
+	Mail Recipients:       %s, %s timeout, cached %s
+	Archive Password Min:  %d
+	Remote Archives:       %t, %d bytes, %s
+	Entry Processors:      %s
+	Special Entries:       %s
+	Hidden Files:          excluded %t, %s
+	Archive Grep:          %d files of %d bytes, %d bytes, %d lines
+	Archive Contents:      %t, %s
+	Archive Checksums:     %t, %s
+	Archive Signing:       %t
+	Archive Names:         %s, falling back to %s, unicode path %t, legacy %s
+	Archive Compression:   %d workers, %d byte buffers
+	Archive Information:   %d bytes, async from %d bytes
+	Max Files per Upload:  %d
+	Temp Dir:              %s, %d bytes max
+	Load Shedding:         %t, %d free disk, %d heap, %d in flight
+	Archive Concurrency:   %d, %d queued for %s
+	Outbound Requests:     %s, %d redirects, %d retries, %d allowed
+	Webhooks:              %d endpoints, %d workers
+	Events:                %s, %s
+	Audit Export:          %s, batches of %d
+	Blocklist:             %d extensions, executables %t
+	Validation:            %d bytes, %d mime types, %d name bytes
+	Scan Cache:            %s, %d files, %d trusted keys
+	Middleware:            server [%s], api [%s], public [%s], admin [%s]
+	Storage Driver:        %s
+	Storage Dir:           %s
+	Storage Encrypted:     %t
+	Keys Provider:         %s, %s
+	Job Workers:           %d
+	Job Max Attempts:      %d
+	Job Store:             %s
+	Job Embedded:          %t
+	Database Driver:       %s
+	Queue Driver:          %s
+	Retention Overrides:   %d keys
+	Audit Retention:       %d days
+	Tenancy:               %t, %d tenants
+	Auth:                  %t, %d api keys
+	OIDC Issuer:           %s
+	HMAC Clients:          %d
+	Access Log:            %t, %s, %s
+	Metrics:               %t, %s
+	Health Probes:         cached %s, %s timeout
+	Demo UI:               %t
+	Disabled Features:     %s
 	`,
 		c.App.Name,
 		c.App.Version,
@@ -153,8 +1723,122 @@ func (c *Config) String() string {
 		c.Server.ReadTimeout,
 		c.Server.WriteTimeout,
 		c.Server.IdleTimeout,
+		c.Server.ReadHeaderTimeout,
+		c.Server.MaxHeaderBytes,
+		c.Server.MaxConnections,
+		len(c.Server.Listeners),
+		len(c.Server.TrustedProxies),
 		c.SMTP.Host,
 		c.SMTP.Port,
+		len(c.SMTP.Fallbacks),
+		c.SMTP.HeloHostname,
+		c.SMTP.DialTimeout,
+		c.SMTP.CommandTimeout,
+		c.SMTP.DataTimeout,
+		c.SMTP.PunycodeDomains,
+		c.Mail.Transport,
+		c.Mail.From,
+		c.Mail.ReturnPath,
+		c.Mail.TemplatesDir,
+		c.Mail.FanOutThreshold,
+		c.Mail.FanOutWorkers,
+		len(c.Mail.PGP.Keys),
+		c.Mail.PGP.Require,
+		c.Mail.Zip.Enabled,
+		c.Mail.Zip.Encrypt,
+		c.Mail.MaxAttachmentSize,
+		c.Mail.Upload.MaxFileSize,
+		c.Mail.Upload.MaxInlineSize,
+		c.Mail.Outbox.StaleAfter,
+		c.Mail.Outbox.Retention,
+		c.Mail.RecipientValidation.Level,
+		c.Mail.RecipientValidation.Timeout,
+		c.Mail.RecipientValidation.CacheTTL,
+		c.Archive.PasswordPolicy.MinLength,
+		c.Archive.Remote.Enabled,
+		c.Archive.Remote.MaxSize,
+		c.Archive.Remote.Timeout,
+		strings.Join(c.Archive.Processors, ", "),
+		c.Archive.SpecialEntries,
+		c.Archive.Hidden.Exclude,
+		strings.Join(c.Archive.Hidden.Names, ", "),
+		c.Archive.Grep.MaxFiles,
+		c.Archive.Grep.MaxFileSize,
+		c.Archive.Grep.MaxBytes,
+		c.Archive.Grep.MaxLines,
+		c.Archive.Contents.Enabled,
+		c.Archive.Contents.Name,
+		c.Archive.Checksums.Enabled,
+		c.Archive.Checksums.Name,
+		c.Archive.Signing.Enabled,
+		strings.Join(c.Archive.Names.Encodings, ", "),
+		c.Archive.Names.Fallback,
+		c.Archive.Names.UnicodePath,
+		c.Archive.Names.LegacyEncoding,
+		c.Archive.Compression.Workers,
+		c.Archive.Compression.BufferSize,
+		c.Archive.Information.MaxFileSize,
+		c.Archive.Information.AsyncThreshold,
+		c.Limits.MaxFiles,
+		c.Temp.Dir,
+		c.Temp.MaxSize,
+		c.Shedding.Enabled,
+		c.Shedding.MinFreeDisk,
+		c.Shedding.MaxHeap,
+		c.Shedding.MaxInflight,
+		c.Concurrency.MaxArchives,
+		c.Concurrency.MaxQueued,
+		c.Concurrency.QueueTimeout,
+		c.Outbound.Timeout,
+		c.Outbound.MaxRedirects,
+		c.Outbound.Retries,
+		len(c.Outbound.Allow),
+		len(c.Webhooks.Endpoints),
+		c.Webhooks.Workers,
+		c.Events.Driver,
+		c.Events.Topic,
+		c.Audit.Export.Sink,
+		c.Audit.Export.BatchSize,
+		len(c.Blocklist.Extensions),
+		c.Blocklist.Executables,
+		c.Validation.MaxFileSize,
+		len(c.Validation.MIMETypes),
+		c.Validation.MaxNameLength,
+		c.Scan.CacheTTL,
+		c.Scan.CacheSize,
+		len(c.Scan.TrustedAPIKeys),
+		strings.Join(c.Middleware.Server, ", "),
+		strings.Join(c.Middleware.API, ", "),
+		strings.Join(c.Middleware.Public, ", "),
+		strings.Join(c.Middleware.Admin, ", "),
+		c.Storage.Driver,
+		c.Storage.Dir,
+		c.Storage.Encrypt,
+		c.Keys.Provider,
+		c.Keys.KeyID,
+		c.Jobs.Workers,
+		c.Jobs.MaxAttempts,
+		c.Jobs.Store,
+		c.Jobs.Embedded,
+		c.Database.Driver,
+		c.Queue.Driver,
+		len(c.Retention.Keys),
+		c.Retention.AuditDays,
+		c.Tenancy.Enabled,
+		len(c.Tenancy.Tenants),
+		c.Auth.Enabled,
+		len(c.Auth.APIKeys),
+		c.Auth.OIDC.Issuer,
+		len(c.Auth.HMAC.Clients),
+		c.AccessLog.Enabled,
+		c.AccessLog.Output,
+		c.AccessLog.Format,
+		c.Metrics.Enabled,
+		c.Metrics.Path,
+		c.Health.CacheTTL,
+		c.Health.Timeout,
+		c.UI.Enabled,
+		strings.Join(c.Features.Disabled(), ", "),
 	)
 }
 
@@ -162,3 +1846,41 @@ func (c *Config) String() string {
 func (c *Config) GetAddress() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 }
+
+// redactedSettings are the settings holding secrets, by the last part of
+// their key
+var redactedSettings = map[string]bool{
+	"password":        true,
+	"secret":          true,
+	"previous_secret": true,
+	"token":           true,
+	"access_key":      true,
+	"secret_key":      true,
+	"dsn":             true,
+	"key":             true,
+}
+
+// RedactedSettings returns the settings of the last load, merged from the
+// defaults, the config file, the environment and the overrides, with the
+// secrets that are set replaced by "<redacted>"
+func RedactedSettings() map[string]any {
+	return redactSettings(viper.AllSettings()).(map[string]any)
+}
+
+func redactSettings(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, setting := range value {
+			if redactedSettings[key] && setting != "" && setting != nil {
+				value[key] = "<redacted>"
+				continue
+			}
+			value[key] = redactSettings(setting)
+		}
+	case []any:
+		for i, setting := range value {
+			value[i] = redactSettings(setting)
+		}
+	}
+	return value
+}
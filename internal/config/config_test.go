@@ -36,6 +36,10 @@ server:
 smtp:
   host: "smtp.test.com"
   port: "587"
+  fallbacks:
+    - host: "smtp.backup.test.com"
+mail:
+  templates_dir: "./templates"
 `,
 			envVars:     map[string]string{},
 			expectedErr: false,
@@ -44,7 +48,26 @@ smtp:
 				assert.Equal(t, "1.0.0", cfg.App.Version)
 				assert.Equal(t, "development", cfg.Env)
 				assert.Equal(t, 8080, cfg.Server.Port)
+				assert.Equal(t, 2*time.Second, cfg.Server.ReadHeaderTimeout)
+				assert.Equal(t, 1024, cfg.Server.MaxConnections)
 				assert.Equal(t, "smtp.test.com", cfg.SMTP.Host)
+				assert.Equal(t, "./templates", cfg.Mail.TemplatesDir)
+				require.Len(t, cfg.SMTP.Fallbacks, 1)
+				assert.Equal(t, "smtp.backup.test.com", cfg.SMTP.Fallbacks[0].Host)
+				assert.Equal(t, time.Minute, cfg.SMTP.UnhealthyCooldown)
+				assert.Equal(t, 10*time.Second, cfg.SMTP.DialTimeout)
+				assert.Equal(t, 5*time.Minute, cfg.SMTP.DataTimeout)
+				assert.Equal(t, "syntax", cfg.Mail.RecipientValidation.Level)
+				assert.Equal(t, 8, cfg.Archive.PasswordPolicy.MinLength)
+				assert.True(t, cfg.Archive.PasswordPolicy.DenyCommon)
+				assert.Equal(t, "MANIFEST.json", cfg.Archive.Contents.Name)
+				assert.Equal(t, "sqlite", cfg.Database.Driver)
+				assert.Equal(t, "database", cfg.Jobs.Store)
+				assert.Equal(t, "memory", cfg.Queue.Driver)
+				assert.Equal(t, "local", cfg.Storage.Driver)
+				assert.True(t, cfg.Database.AutoMigrate)
+				assert.False(t, cfg.Tenancy.Enabled)
+				assert.Equal(t, "X-Tenant-ID", cfg.Tenancy.Header)
 			},
 		},
 		{
@@ -124,6 +147,31 @@ server:
 	}
 }
 
+func TestSample(t *testing.T) {
+	for _, env := range []string{"development", "production"} {
+		t.Run(env, func(t *testing.T) {
+			viper.Reset()
+			sample, err := Sample(env)
+			require.NoError(t, err)
+
+			// The sample must load as is, given the SMTP credentials
+			setupTest(t, string(sample), map[string]string{
+				"SMTP_USERNAME": "test@example.com",
+				"SMTP_PASSWORD": "password",
+			})
+			defer cleanupTest(t)
+
+			cfg, err := LoadConfig()
+			require.NoError(t, err)
+			assert.Equal(t, env, cfg.Env)
+			assert.Equal(t, 8080, cfg.Server.Port)
+		})
+	}
+
+	_, err := Sample("staging")
+	assert.Error(t, err)
+}
+
 func TestConfig_GetAddress(t *testing.T) {
 	cfg := &Config{
 		Server: ServerConfig{
@@ -212,6 +260,7 @@ func TestValidateConfig(t *testing.T) {
 					WriteTimeout:    10 * time.Second,
 					IdleTimeout:     60 * time.Second,
 				},
+				Jobs: JobsConfig{Embedded: true},
 			},
 			expectedErr: false,
 		},
@@ -242,6 +291,412 @@ func TestValidateConfig(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			name: "Unknown api key role",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Auth: AuthConfig{
+					Enabled: true,
+					APIKeys: []APIKeyConfig{{Key: "secret", Role: "owner"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Unknown default tenant",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Tenancy: TenancyConfig{
+					Enabled: true,
+					Default: "marketing",
+					Tenants: map[string]TenantConfig{"finance": {}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "TLS listener without key",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+					Listeners: []ListenerConfig{
+						{Address: "127.0.0.1:8080"},
+						{Address: ":8443", TLS: TLSConfig{CertFile: "cert.pem"}},
+					},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Invalid trusted proxy",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+					TrustedProxies:  []string{"10.0.0.0/8", "proxy.internal"},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Unknown access log format",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				AccessLog: AccessLogConfig{
+					Enabled: true,
+					Output:  "stdout",
+					Format:  "apache",
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Remote archives without size limit",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Archive: ArchiveConfig{
+					Remote: RemoteArchiveConfig{Enabled: true, Timeout: 30 * time.Second},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Negative maximum files",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Limits: LimitsConfig{MaxFiles: -1},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Blocklist extension without dot",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Blocklist: BlocklistConfig{Extensions: []string{"exe"}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Empty archive processor name",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Archive: ArchiveConfig{Processors: []string{"strip_exif", ""}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Unknown archive name encoding",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Archive: ArchiveConfig{Names: ArchiveNamesConfig{Encodings: []string{"cp866", "utf-16"}}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Negative archive information async threshold",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Archive: ArchiveConfig{Information: ArchiveInformationConfig{AsyncThreshold: -1}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Negative scan cache ttl",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Scan: ScanConfig{CacheTTL: -time.Hour},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "PGP key without address",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Mail: MailConfig{PGP: PGPConfig{Keys: []PGPKeyConfig{{File: "bob.asc"}}}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Auth without auth middleware",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Auth: AuthConfig{
+					Enabled: true,
+					APIKeys: []APIKeyConfig{{Key: "secret", Role: "admin"}},
+				},
+				Middleware: MiddlewareConfig{
+					API:   []string{"logging"},
+					Admin: []string{"auth"},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Validation mime type without subtype",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Validation: ValidationConfig{MIMETypes: []string{"image"}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Unknown feature",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Features: FeaturesConfig{"encrypton": false},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Webhook endpoint without secret",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Webhooks: WebhooksConfig{Endpoints: []WebhookEndpointConfig{{URL: "https://hooks.example.com/doozip"}}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Shared queue without keys provider",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Jobs:  JobsConfig{Embedded: true},
+				Queue: QueueConfig{Driver: "redis"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Dedicated workers without keys provider",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Jobs: JobsConfig{Embedded: false},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Shared queue with keys provider",
+			config: &Config{
+				App: AppConfig{
+					Name:    "testapp",
+					Version: "1.0.0",
+				},
+				Env: "development",
+				Server: ServerConfig{
+					Port:            8080,
+					ShutdownTimeout: 5 * time.Second,
+					ReadTimeout:     5 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+				},
+				Jobs:  JobsConfig{Embedded: false},
+				Queue: QueueConfig{Driver: "redis"},
+				Keys:  KeysConfig{Provider: "local", KeyID: "main"},
+			},
+			expectedErr: false,
+		},
 	}
 
 	for _, tt := range tests {
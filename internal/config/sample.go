@@ -0,0 +1,243 @@
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configSource is the source of the configuration types, whose doc
+// comments document the keys of the sample config file
+//
+//go:embed config.go
+var configSource string
+
+// goNameRegex matches the Go names of fields in doc comments
+var goNameRegex = regexp.MustCompile(`\b[A-Z][A-Za-z0-9]*\b`)
+
+// environmentDefaults are the settings of a sample config file that differ
+// from the defaults, by environment
+var environmentDefaults = map[string]map[string]any{
+	"production": {
+		"server.host":        "0.0.0.0",
+		"access_log.enabled": true,
+	},
+}
+
+// Sample returns a config file setting every supported key to its default,
+// documented with the comments of its field in the configuration types. env
+// is "development" or "production", where the server listens on every
+// interface and the access log is enabled.
+func Sample(env string) ([]byte, error) {
+	if !isValidEnvironment(env) {
+		return nil, fmt.Errorf("invalid environment: %s", env)
+	}
+
+	docs, err := parseDocs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config docs: %w", err)
+	}
+
+	setDefaults()
+	viper.SetDefault("environment", env)
+	for key, value := range environmentDefaults[env] {
+		viper.SetDefault(key, value)
+	}
+	for _, name := range knownFeatures {
+		viper.SetDefault("features."+name, true)
+	}
+
+	root := sampleMapping(reflect.TypeOf(Config{}), "", docs)
+	doc := &yaml.Node{
+		Kind: yaml.DocumentNode,
+		HeadComment: "doozip configuration, generated with every key set to its default.\n" +
+			"Every key can also be set with an environment variable named after it,\n" +
+			"such as SERVER_PORT for server.port. SMTP credentials are read from\n" +
+			"SMTP_USERNAME and SMTP_PASSWORD.",
+		Content: []*yaml.Node{root},
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode sample config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode sample config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sampleMapping returns the keys of a configuration type under prefix with
+// their defaults and docs
+func sampleMapping(t reflect.Type, prefix string, docs map[string]string) *yaml.Node {
+	// Fields named in the docs are replaced by their keys
+	keys := make(map[string]string, t.NumField())
+	for i := range t.NumField() {
+		if name := t.Field(i).Tag.Get("mapstructure"); name != "" && name != "-" {
+			keys[t.Field(i).Name] = name
+		}
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		comment := docComment(docs[t.Name()+"."+field.Name], keys)
+		var value *yaml.Node
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if comment == "" {
+				comment = docComment(docs[field.Type.Name()], map[string]string{field.Type.Name(): name})
+			}
+			value = sampleMapping(field.Type, key, docs)
+		case (field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Map) && field.Type.Elem().Kind() == reflect.Struct:
+			entries := sampleEntryKeys(field.Type.Elem())
+			if comment != "" {
+				comment += "\n"
+			}
+			comment += "Each entry sets " + strings.Join(entries, ", ")
+			value = sampleValue(field.Type, viper.Get(key))
+		default:
+			value = sampleValue(field.Type, viper.Get(key))
+		}
+
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name, HeadComment: comment},
+			value,
+		)
+	}
+	return mapping
+}
+
+// sampleValue encodes the default of a key, or the zero value of its type
+// when it has none
+func sampleValue(t reflect.Type, value any) *yaml.Node {
+	if value == nil {
+		value = reflect.Zero(t).Interface()
+	}
+	if d, ok := value.(time.Duration); ok {
+		value = formatDuration(d)
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		node = &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(value)}
+	}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 || t.Elem().Kind() != reflect.Struct {
+			node.Style = yaml.FlowStyle
+		}
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+	case yaml.ScalarNode:
+		// Empty lists and maps are encoded as null
+		if node.Tag == "!!null" {
+			switch t.Kind() {
+			case reflect.Slice:
+				node = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			case reflect.Map:
+				node = &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+			}
+		}
+	}
+	return node
+}
+
+// sampleEntryKeys returns the keys of the entries of a list or map
+func sampleEntryKeys(t reflect.Type) []string {
+	var keys []string
+	for i := range t.NumField() {
+		if name := t.Field(i).Tag.Get("mapstructure"); name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// docComment turns the doc comment of a field or type into the comment of
+// its key, replacing the Go names of keys by the keys
+func docComment(doc string, keys map[string]string) string {
+	return goNameRegex.ReplaceAllStringFunc(strings.TrimSpace(doc), func(name string) string {
+		if key, ok := keys[name]; ok {
+			return key
+		}
+		return name
+	})
+}
+
+// formatDuration formats a duration without its zero minutes and seconds,
+// as in "1h" rather than "1h0m0s"
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// parseDocs returns the doc comments of the configuration types, by type
+// name, and of their fields, by type and field name joined with a dot
+func parseDocs() (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", configSource, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[string]string)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			doc := typeSpec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			if doc != nil {
+				docs[typeSpec.Name.Name] = doc.Text()
+			}
+
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			for _, field := range structType.Fields.List {
+				if field.Doc == nil {
+					continue
+				}
+				for _, name := range field.Names {
+					docs[typeSpec.Name.Name+"."+name.Name] = field.Doc.Text()
+				}
+			}
+		}
+	}
+	return docs, nil
+}
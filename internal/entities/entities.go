@@ -1,10 +1,18 @@
 package entities
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"net/mail"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
 var (
@@ -13,7 +21,12 @@ var (
 	ErrEmptyFiles       = errors.New("files list cannot be empty")
 	ErrInvalidMimeType  = errors.New("invalid mime type")
 	ErrContentRequired  = errors.New("file content is required")
+	ErrContentLength    = errors.New("file content does not match its length")
 	ErrFilepathRequired = errors.New("file path is required")
+	ErrNoRecipients     = errors.New("at least one recipient is required")
+	ErrSendAtRequired   = errors.New("send time is required")
+	ErrContentIDMissing = errors.New("content id is required for inline attachments")
+	ErrInvalidSender    = errors.New("invalid sender address")
 )
 
 // AllowedMimeTypes contains the mime types that are allowed for file operations
@@ -23,15 +36,45 @@ var AllowedMimeTypes = map[string]bool{
 	"image/jpeg":      true,
 	"image/png":       true,
 	"application/pdf": true,
+	// Plain text, such as the README of an archive manifest
+	"text/plain; charset=utf-8": true,
 }
 
 // ArchiveInfo represents detailed information about an archive and its contents
 type ArchiveInfo struct {
-	Filename    string        `json:"filename"`
-	ArchiveSize int64         `json:"archive_size"`
-	TotalSize   int64         `json:"total_size"`
-	TotalFiles  uint          `json:"total_files"`
-	Files       []FileDetails `json:"files"`
+	Filename    string        `json:"filename" xml:"filename" yaml:"filename"`
+	ArchiveSize int64         `json:"archive_size" xml:"archive_size" yaml:"archive_size"`
+	TotalSize   int64         `json:"total_size" xml:"total_size" yaml:"total_size"`
+	TotalFiles  uint          `json:"total_files" xml:"total_files" yaml:"total_files"`
+	Files       []FileDetails `json:"files" xml:"files>file" yaml:"files"`
+	// Directories sums up the files of each top-level directory, largest
+	// first, so the ones making an archive large stand out
+	Directories []DirectorySummary `json:"directories,omitempty" xml:"directories>directory,omitempty" yaml:"directories,omitempty"`
+	// NameEncoding is the code page the names not marked as UTF-8 were
+	// decoded from, if the archive has any
+	NameEncoding string `json:"name_encoding,omitempty" xml:"name_encoding,omitempty" yaml:"name_encoding,omitempty"`
+	// Container is set for zip based package formats: jar, apk and epub
+	Container *ContainerInfo `json:"container,omitempty" xml:"container,omitempty" yaml:"container,omitempty"`
+	// Skipped names the fields left out because only the central directory
+	// was read, see ArchiveFastSkipped
+	Skipped []string `json:"skipped,omitempty" xml:"skipped>field,omitempty" yaml:"skipped,omitempty"`
+}
+
+// ArchiveFastSkipped are the fields of an ArchiveInfo read from the content
+// of the entries, which a listing of the central directory only leaves out
+var ArchiveFastSkipped = []string{"detected_mimetype", "mimetype_mismatch", "container"}
+
+// ContainerInfo describes the package a zip archive holds, read from its
+// manifest. Fields the package doesn't record are left empty.
+type ContainerInfo struct {
+	Type        string `json:"type" xml:"type" yaml:"type"`
+	MainClass   string `json:"main_class,omitempty" xml:"main_class,omitempty" yaml:"main_class,omitempty"`
+	Package     string `json:"package,omitempty" xml:"package,omitempty" yaml:"package,omitempty"`
+	VersionCode string `json:"version_code,omitempty" xml:"version_code,omitempty" yaml:"version_code,omitempty"`
+	VersionName string `json:"version_name,omitempty" xml:"version_name,omitempty" yaml:"version_name,omitempty"`
+	Title       string `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty"`
+	Creator     string `json:"creator,omitempty" xml:"creator,omitempty" yaml:"creator,omitempty"`
+	Language    string `json:"language,omitempty" xml:"language,omitempty" yaml:"language,omitempty"`
 }
 
 // Validate checks if the ArchiveInfo instance is valid
@@ -59,7 +102,8 @@ func (a *ArchiveInfo) Validate() error {
 	return nil
 }
 
-// CalculateTotals updates the total size and files count
+// CalculateTotals updates the total size and files count, and the summaries
+// of the directories
 func (a *ArchiveInfo) CalculateTotals() {
 	var totalSize int64
 	for _, file := range a.Files {
@@ -67,15 +111,202 @@ func (a *ArchiveInfo) CalculateTotals() {
 	}
 	a.TotalSize = totalSize
 	a.TotalFiles = uint(len(a.Files))
+	a.Directories = summarizeDirectories(a.Files)
+}
+
+// DirectorySummary sums up the files under a top-level directory of an
+// archive, or at its root when Path is "."
+type DirectorySummary struct {
+	Path        string `json:"path" xml:"path" yaml:"path"`
+	TotalSize   int64  `json:"total_size" xml:"total_size" yaml:"total_size"`
+	TotalFiles  uint   `json:"total_files" xml:"total_files" yaml:"total_files"`
+	LargestFile string `json:"largest_file" xml:"largest_file" yaml:"largest_file"`
+	LargestSize int64  `json:"largest_size" xml:"largest_size" yaml:"largest_size"`
+}
+
+// summarizeDirectories sums up files by top-level directory, largest first
+func summarizeDirectories(files []FileDetails) []DirectorySummary {
+	if len(files) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int)
+	var summaries []DirectorySummary
+	for _, file := range files {
+		dir, _, ok := strings.Cut(file.FilePath, "/")
+		if !ok {
+			dir = "."
+		}
+		i, ok := index[dir]
+		if !ok {
+			i = len(summaries)
+			index[dir] = i
+			summaries = append(summaries, DirectorySummary{Path: dir, LargestSize: -1})
+		}
+
+		summary := &summaries[i]
+		summary.TotalSize += file.Size
+		summary.TotalFiles++
+		if file.Size > summary.LargestSize {
+			summary.LargestFile, summary.LargestSize = file.FilePath, file.Size
+		}
+	}
+
+	slices.SortStableFunc(summaries, func(a, b DirectorySummary) int {
+		return cmp.Compare(b.TotalSize, a.TotalSize)
+	})
+	return summaries
+}
+
+// ArchiveQuery selects the entries of an archive by path. An entry matches
+// when any of Globs or Regexes does. A glob without a slash matches the base
+// name of entries, such as "*.pdf"; with one, it matches their whole path.
+// Regexes match anywhere in the path unless anchored. With Grep, entries
+// further need a line of their content to contain it, or to match it as a
+// regex with GrepRegex; Grep alone searches every entry.
+type ArchiveQuery struct {
+	Globs     []string
+	Regexes   []string
+	Grep      string
+	GrepRegex bool
+	// Limit is the most matches returned; zero returns them all
+	Limit int
+}
+
+// ArchiveSearch lists the entries of an archive matching a query
+type ArchiveSearch struct {
+	Filename    string `json:"filename"`
+	ArchiveSize int64  `json:"archive_size"`
+	// TotalFiles is the number of files searched
+	TotalFiles   uint  `json:"total_files"`
+	MatchedFiles uint  `json:"matched_files"`
+	MatchedSize  int64 `json:"matched_size"`
+	// Truncated reports that more entries matched than the limit of the
+	// query; MatchedFiles and MatchedSize count them all. When grepping, it
+	// also reports that the matching lines reached their limit, which ends
+	// the search early.
+	Truncated bool `json:"truncated"`
+	// SkippedFiles is the number of entries whose content wasn't searched:
+	// encrypted ones, those past the grep limits and those failing to
+	// decompress
+	SkippedFiles uint          `json:"skipped_files,omitempty"`
+	Files        []SearchMatch `json:"files"`
+	Lines        []LineMatch   `json:"lines,omitempty"`
+}
+
+// LineMatch is a line of an entry matching the grep of a query. Line counts
+// from 1, and Text is cut when the line is long.
+type LineMatch struct {
+	FilePath string `json:"file_path"`
+	Line     int    `json:"line"`
+	Text     string `json:"text"`
+}
+
+// SearchMatch is an entry of an archive matching a query. Its compressed
+// data starts at Offset in the archive, so it can be fetched alone with a
+// range request.
+type SearchMatch struct {
+	FilePath       string `json:"file_path"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+	Offset         int64  `json:"offset"`
+}
+
+// ArchiveEstimate is the predicted result of creating an archive from a set
+// of files, computed without building it
+type ArchiveEstimate struct {
+	Filename      string        `json:"filename"`
+	EstimatedSize int64         `json:"estimated_size"`
+	TotalSize     int64         `json:"total_size"`
+	TotalFiles    uint          `json:"total_files"`
+	Encrypted     bool          `json:"encrypted"`
+	Files         []FileDetails `json:"files"`
+	// Skipped lists the files left out of a lenient request
+	Skipped []FileError `json:"skipped,omitempty"`
+}
+
+// Codes of FileError, telling apart why a file was left out
+const (
+	FileErrorInvalid        = "invalid"
+	FileErrorBlocked        = "blocked"
+	FileErrorRejected       = "rejected"
+	FileErrorTypeNotAllowed = "type_not_allowed"
+	FileErrorNameReserved   = "name_reserved"
+	FileErrorUnreadable     = "unreadable"
+)
+
+// FileError reports a file left out of a multi-file operation, so the rest
+// of the files can go through without it
+type FileError struct {
+	File  string `json:"file"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// DocumentInfo describes an office document, which is a zip archive
+// underneath. Counts are only set when the document records them.
+type DocumentInfo struct {
+	Filename       string     `json:"filename" xml:"filename" yaml:"filename"`
+	Format         string     `json:"format" xml:"format" yaml:"format"`
+	Size           int64      `json:"size" xml:"size" yaml:"size"`
+	Title          string     `json:"title,omitempty" xml:"title,omitempty" yaml:"title,omitempty"`
+	Subject        string     `json:"subject,omitempty" xml:"subject,omitempty" yaml:"subject,omitempty"`
+	Description    string     `json:"description,omitempty" xml:"description,omitempty" yaml:"description,omitempty"`
+	Keywords       string     `json:"keywords,omitempty" xml:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Creator        string     `json:"creator,omitempty" xml:"creator,omitempty" yaml:"creator,omitempty"`
+	LastModifiedBy string     `json:"last_modified_by,omitempty" xml:"last_modified_by,omitempty" yaml:"last_modified_by,omitempty"`
+	Created        *time.Time `json:"created,omitempty" xml:"created,omitempty" yaml:"created,omitempty"`
+	Modified       *time.Time `json:"modified,omitempty" xml:"modified,omitempty" yaml:"modified,omitempty"`
+	Application    string     `json:"application,omitempty" xml:"application,omitempty" yaml:"application,omitempty"`
+	Pages          int        `json:"pages,omitempty" xml:"pages,omitempty" yaml:"pages,omitempty"`
+	Words          int        `json:"words,omitempty" xml:"words,omitempty" yaml:"words,omitempty"`
+	Characters     int        `json:"characters,omitempty" xml:"characters,omitempty" yaml:"characters,omitempty"`
+	Paragraphs     int        `json:"paragraphs,omitempty" xml:"paragraphs,omitempty" yaml:"paragraphs,omitempty"`
+	Slides         int        `json:"slides,omitempty" xml:"slides,omitempty" yaml:"slides,omitempty"`
+	Sheets         int        `json:"sheets,omitempty" xml:"sheets,omitempty" yaml:"sheets,omitempty"`
 }
 
 // FileDetails contains information about a single file within an archive
 type FileDetails struct {
-	FilePath string `json:"file_path"`
-	Size     int64  `json:"size"`
-	MimeType string `json:"mimetype"`
+	FilePath string `json:"file_path" xml:"file_path" yaml:"file_path"`
+	Size     int64  `json:"size" xml:"size" yaml:"size"`
+	MimeType string `json:"mimetype" xml:"mimetype" yaml:"mimetype"`
+	// DetectedMimeType is the type sniffed from the content, when it is
+	// recognized. MimeTypeMismatch reports that it contradicts MimeType,
+	// such as an executable named .pdf.
+	DetectedMimeType string `json:"detected_mimetype,omitempty" xml:"detected_mimetype,omitempty" yaml:"detected_mimetype,omitempty"`
+	MimeTypeMismatch bool   `json:"mimetype_mismatch,omitempty" xml:"mimetype_mismatch,omitempty" yaml:"mimetype_mismatch,omitempty"`
+	// EntryType is the type of an entry of an inspected archive
+	EntryType string `json:"entry_type,omitempty" xml:"entry_type,omitempty" yaml:"entry_type,omitempty"`
+	// Hidden and System are the DOS attributes of an entry of an inspected
+	// archive. Dotfile reports that a part of its path starts with a dot,
+	// hiding it on Unix systems.
+	Hidden  bool `json:"hidden,omitempty" xml:"hidden,omitempty" yaml:"hidden,omitempty"`
+	System  bool `json:"system,omitempty" xml:"system,omitempty" yaml:"system,omitempty"`
+	Dotfile bool `json:"dotfile,omitempty" xml:"dotfile,omitempty" yaml:"dotfile,omitempty"`
+}
+
+// IsDotfile reports whether a part of a slash separated path starts with a
+// dot, as dotfiles and the files of dot directories such as .git do
+func IsDotfile(path string) bool {
+	for _, part := range strings.Split(path, "/") {
+		if len(part) > 1 && part[0] == '.' && part != ".." {
+			return true
+		}
+	}
+	return false
 }
 
+// Types of archive entries. Entries other than files are special: extracting
+// them creates links or devices rather than files.
+const (
+	EntryTypeFile    = "file"
+	EntryTypeSymlink = "symlink"
+	EntryTypeDevice  = "device"
+	EntryTypeFIFO    = "fifo"
+	EntryTypeSocket  = "socket"
+)
+
 // Validate checks if the FileDetails instance is valid
 func (f *FileDetails) Validate() error {
 	if f.FilePath == "" {
@@ -97,9 +328,72 @@ func (f *FileDetails) IsAllowedMimeType() bool {
 
 // FileData represents a file's content and metadata
 type FileData struct {
-	Name     string
-	Content  []byte
+	Name    string
+	Content []byte
+	// Reader replaces Content for uploads, which are streamed into the
+	// archive instead of being copied into memory first. It yields Length
+	// bytes and can be read only once. Files only known by their metadata,
+	// such as archive entries being validated, have Length alone.
+	Reader   io.Reader `json:"-"`
+	Length   int64     `json:"-"`
 	MIMEType string
+	// SkipScan is set on files of trusted uploaders, which virus scanners
+	// accept without reading them. It is kept with queued jobs and mail.
+	SkipScan bool `json:",omitempty"`
+	// CompressionTime is the time taken to add the file to an archive
+	CompressionTime time.Duration `json:"-"`
+	// SHA256 is the hex encoded hash of the content added to an archive
+	SHA256 string `json:"-"`
+	// Signature is the detached signature of a created archive, made with
+	// the algorithm SignatureAlgorithm, when signing is enabled
+	Signature          []byte `json:"-"`
+	SignatureAlgorithm string `json:"-"`
+}
+
+// Open returns a reader of the file content. A streamed file can only be
+// read once, so Open must not be called again after reading it.
+func (f *FileData) Open() io.Reader {
+	if f.Reader != nil {
+		return f.Reader
+	}
+	return bytes.NewReader(f.Content)
+}
+
+// Peek returns the first n bytes of the content, or all of it when it is
+// shorter, without consuming them from a streamed file
+func (f *FileData) Peek(n int) ([]byte, error) {
+	if f.Reader == nil {
+		return f.Content[:min(n, len(f.Content))], nil
+	}
+
+	head := make([]byte, n)
+	read, err := io.ReadFull(f.Reader, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:read]
+	f.Reader = io.MultiReader(bytes.NewReader(head), f.Reader)
+
+	return head, nil
+}
+
+// Load reads the content of a streamed file into Content, for files that
+// are kept or serialized rather than archived right away
+func (f *FileData) Load() error {
+	if f.Reader == nil {
+		return nil
+	}
+
+	content, err := io.ReadAll(f.Reader)
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) != f.Length {
+		return fmt.Errorf("%w: read %d of %d bytes", ErrContentLength, len(content), f.Length)
+	}
+
+	f.Content, f.Reader, f.Length = content, nil, 0
+	return nil
 }
 
 // Validate checks if the FileData instance is valid
@@ -107,7 +401,7 @@ func (f *FileData) Validate() error {
 	if f.Name == "" {
 		return ErrEmptyFilename
 	}
-	if len(f.Content) == 0 {
+	if f.Size() == 0 {
 		return ErrContentRequired
 	}
 	if f.MIMEType == "" {
@@ -129,5 +423,740 @@ func (f *FileData) IsAllowedMimeType() bool {
 
 // Size returns the size of the file content in bytes
 func (f *FileData) Size() int64 {
+	if f.Content == nil {
+		return f.Length
+	}
 	return int64(len(f.Content))
 }
+
+// Attachment is a file attached to a mail message. Inline attachments are
+// referenced from the HTML body by their content id (cid:<ContentID>).
+type Attachment struct {
+	File      *FileData
+	Inline    bool
+	ContentID string
+}
+
+// Validate checks if the Attachment instance is valid
+func (a *Attachment) Validate() error {
+	if a.File == nil {
+		return ErrContentRequired
+	}
+	if a.Inline && a.ContentID == "" {
+		return ErrContentIDMissing
+	}
+	return a.File.Validate()
+}
+
+// MailMessage represents a composed mail message with its bodies and attachments
+type MailMessage struct {
+	// From replaces the configured sender address when set
+	From        string
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []*Attachment
+	// PGPKeys are public keys uploaded with the message. Recipients named by
+	// their identities receive the attachments encrypted to them.
+	PGPKeys [][]byte
+	// Zip wraps the attachments into a zip archive when set
+	Zip *AttachmentZip
+	// TenantID is the tenant that sent the message, which alone can see its
+	// outbox entry
+	TenantID string `json:",omitempty"`
+}
+
+// AttachmentZip wraps the attachments of a message into a zip archive before
+// it is sent, encrypted with Password when it is set. The password is never
+// part of the message: messages kept in the outbox or queued only carry it
+// sealed by a SecretSealer.
+type AttachmentZip struct {
+	Password       string `json:"-"`
+	SealedPassword []byte `json:"sealed_password,omitempty"`
+}
+
+// Validate checks if the MailMessage instance is valid
+func (m *MailMessage) Validate() error {
+	if len(m.To) == 0 {
+		return ErrNoRecipients
+	}
+	if m.From != "" {
+		if _, err := mail.ParseAddress(m.From); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSender, err)
+		}
+	}
+	for _, attachment := range m.Attachments {
+		if attachment == nil {
+			return ErrContentRequired
+		}
+		if err := attachment.Validate(); err != nil {
+			return fmt.Errorf("invalid attachment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delivery statuses of a recipient. Rejected recipients won't get the
+// message as it is, such as invalid or suppressed addresses and permanent
+// refusals of the server, while deferred ones failed for a reason that may
+// pass, such as an unreachable server, so resending may reach them.
+const (
+	RecipientAccepted = "accepted"
+	RecipientRejected = "rejected"
+	RecipientDeferred = "deferred"
+)
+
+// RecipientResult reports the delivery outcome for a single recipient
+type RecipientResult struct {
+	Recipient string `json:"recipient"`
+	// Address is the address of Recipient without its display name, with
+	// its domain in lower case
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Suppressed marks a recipient on the suppression list, who was skipped
+	Suppressed bool `json:"suppressed,omitempty"`
+}
+
+// NormalizeAddress returns the address of a recipient such as
+// "Bob <bob@Example.COM>" as "bob@example.com", keeping the case of the
+// local part, which servers may tell apart. Recipients that don't parse are
+// only trimmed.
+func NormalizeAddress(recipient string) string {
+	recipient = strings.TrimSpace(recipient)
+	parsed, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return recipient
+	}
+	at := strings.LastIndex(parsed.Address, "@")
+	if at < 0 {
+		return parsed.Address
+	}
+	return parsed.Address[:at+1] + strings.ToLower(parsed.Address[at+1:])
+}
+
+// DeliveryReport summarizes the delivery of a message to each of its recipients
+type DeliveryReport struct {
+	Recipients []RecipientResult `json:"recipients"`
+	Sent       int               `json:"sent"`
+	Failed     int               `json:"failed"`
+	// Suppressed is the number of recipients skipped as they are on the
+	// suppression list; they count as neither sent nor failed
+	Suppressed int `json:"suppressed,omitempty"`
+	// Parts is the number of messages every recipient was sent, when
+	// oversized attachments were split into volumes
+	Parts int `json:"parts,omitempty"`
+	// ID is the outbox entry of the message, when it was stored
+	ID string `json:"id,omitempty"`
+}
+
+// Add records the outcome for a recipient, treating a nil error as success
+// and any other as a rejection
+func (r *DeliveryReport) Add(recipient string, err error) {
+	status := RecipientAccepted
+	if err != nil {
+		status = RecipientRejected
+	}
+	r.AddStatus(recipient, status, err)
+}
+
+// AddStatus records the outcome for a recipient with the status of its
+// delivery, which failed with err unless it is nil
+func (r *DeliveryReport) AddStatus(recipient, status string, err error) {
+	result := RecipientResult{
+		Recipient: recipient,
+		Address:   NormalizeAddress(recipient),
+		Status:    status,
+		Success:   err == nil,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		r.Failed++
+	} else {
+		r.Sent++
+	}
+	r.Recipients = append(r.Recipients, result)
+}
+
+// AddSuppressed records a recipient skipped as it is on the suppression list
+func (r *DeliveryReport) AddSuppressed(recipient string) {
+	r.Suppressed++
+	r.Recipients = append(r.Recipients, RecipientResult{
+		Recipient:  recipient,
+		Address:    NormalizeAddress(recipient),
+		Status:     RecipientRejected,
+		Suppressed: true,
+	})
+}
+
+// MailBatchItem represents a single message within a batch mail request
+type MailBatchItem struct {
+	Index      int
+	Recipients []string
+	Subject    string
+	File       *FileData
+	// From replaces the configured sender address when set
+	From string
+	// TenantID is the tenant that sent the batch
+	TenantID string
+}
+
+// MailBatchResult reports the outcome of a single batch mail item
+type MailBatchResult struct {
+	Index      int      `json:"index"`
+	Recipients []string `json:"recipients"`
+	File       string   `json:"file"`
+	Success    bool     `json:"success"`
+	Error      string   `json:"error,omitempty"`
+	// Code tells apart why the file of the item was refused, as for
+	// FileError; it is empty when sending failed
+	Code string `json:"code,omitempty"`
+	// Suppressed lists the recipients skipped as they are on the suppression list
+	Suppressed []string `json:"suppressed,omitempty"`
+	// ID is the outbox entry of the message, when it was stored
+	ID string `json:"id,omitempty"`
+	// ZipPassword encrypts the zip archive the attachment was sent in. It is
+	// only given to the client that sent the batch, never stored.
+	ZipPassword string `json:"-"`
+	// Duration is the time taken to send the item
+	Duration time.Duration `json:"-"`
+}
+
+// OutboxMessage represents a mail message held for delivery at a later time
+type OutboxMessage struct {
+	ID        string    `json:"id"`
+	To        []string  `json:"recipients"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"-"`
+	File      *FileData `json:"-"`
+	SendAt    time.Time `json:"send_at"`
+	CreatedAt time.Time `json:"created_at"`
+	// From replaces the configured sender address when set
+	From string `json:"-"`
+	// PGPKeys are uploaded public keys, as in MailMessage
+	PGPKeys [][]byte `json:"-"`
+	// Zip wraps the attachment into a zip archive when set, as in MailMessage
+	Zip *AttachmentZip `json:"-"`
+	// TenantID is the tenant that scheduled the message
+	TenantID string `json:"-"`
+}
+
+// Validate checks if the OutboxMessage instance is valid
+func (m *OutboxMessage) Validate() error {
+	if len(m.To) == 0 {
+		return ErrNoRecipients
+	}
+	if m.File == nil {
+		return ErrContentRequired
+	}
+	if m.SendAt.IsZero() {
+		return ErrSendAtRequired
+	}
+	return m.File.Validate()
+}
+
+// OutboxStatus is the delivery state of a message in the outbox
+type OutboxStatus string
+
+const (
+	// OutboxStatusSending marks a message being delivered. One left in this
+	// state was interrupted, such as by a crash, and is sent again.
+	OutboxStatusSending OutboxStatus = "sending"
+	// OutboxStatusSent marks a message delivered to every recipient
+	OutboxStatusSent OutboxStatus = "sent"
+	// OutboxStatusFailed marks a message that failed for some recipient
+	OutboxStatusFailed OutboxStatus = "failed"
+)
+
+// OutboxEntry is a composed message kept in the outbox together with the
+// state of its delivery, so it can be sent again
+type OutboxEntry struct {
+	ID         string       `json:"id"`
+	Status     OutboxStatus `json:"status"`
+	Recipients []string     `json:"recipients"`
+	Subject    string       `json:"subject"`
+	Attempts   int          `json:"attempts"`
+	Sent       int          `json:"sent"`
+	Failed     int          `json:"failed"`
+	Error      string       `json:"error,omitempty"`
+	TenantID   string       `json:"-"`
+	// Message is the JSON encoded MailMessage, attachments included
+	Message   []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SuppressionReason is why an address is on the suppression list
+type SuppressionReason string
+
+const (
+	// SuppressionReasonBounce marks an address that hard bounced
+	SuppressionReasonBounce SuppressionReason = "bounce"
+	// SuppressionReasonUnsubscribe marks a recipient who asked not to be sent mail
+	SuppressionReasonUnsubscribe SuppressionReason = "unsubscribe"
+	// SuppressionReasonManual marks an address suppressed for another reason
+	SuppressionReasonManual SuppressionReason = "manual"
+)
+
+// Suppression is an address mail is never sent to. Addresses are suppressed
+// per tenant.
+type Suppression struct {
+	Address   string            `json:"address"`
+	Reason    SuppressionReason `json:"reason"`
+	TenantID  string            `json:"-"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// RecipientGroup is a named list of addresses, such as "finance-team", mail
+// may be sent to instead of listing the addresses. Groups are kept per
+// tenant.
+type RecipientGroup struct {
+	Name      string    `json:"name"`
+	Addresses []string  `json:"addresses"`
+	TenantID  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MailTemplateData holds the values available to mail templates
+type MailTemplateData struct {
+	Filename   string
+	Recipients []string
+	Date       time.Time
+}
+
+// RenderedMail contains the subject and bodies produced by a mail template
+type RenderedMail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// TestMailResult reports the outcome of an administrative test message
+// together with the transcript of its delivery
+type TestMailResult struct {
+	Recipient  string    `json:"recipient"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Transcript []string  `json:"transcript"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// PasswordViolation describes a single password policy rule that was not met
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// StoredArchive is a created archive kept on the server and shared by link
+type StoredArchive struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	// TenantID is the tenant owning the archive when tenancy is enabled
+	TenantID string `json:"tenant_id,omitempty"`
+	// APIKeyID identifies the API key that stored the archive, see utils.KeyID
+	APIKeyID string `json:"api_key_id,omitempty"`
+	// PassphraseHash is the bcrypt hash of the passphrase protecting the download link
+	PassphraseHash string `json:"passphrase_hash,omitempty"`
+	// Signature is the base64 encoded detached signature of the archive,
+	// made with SignatureAlgorithm, when signing is enabled
+	Signature          string `json:"signature,omitempty"`
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+}
+
+// Protected reports whether downloading the archive requires a passphrase
+func (a *StoredArchive) Protected() bool {
+	return a.PassphraseHash != ""
+}
+
+// ArchiveAccess records a single request to a share link
+type ArchiveAccess struct {
+	Time        time.Time `json:"time"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	Status      int       `json:"status"`
+	BytesServed int64     `json:"bytes_served"`
+}
+
+// JobType identifies the kind of work a job performs
+type JobType string
+
+const (
+	JobTypeArchive     JobType = "archive"
+	JobTypeMail        JobType = "mail"
+	JobTypeInformation JobType = "information"
+)
+
+// JobStatus is the lifecycle state of a job
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// Job is a unit of asynchronous archive or mail work
+type Job struct {
+	ID     string    `json:"id"`
+	Type   JobType   `json:"type"`
+	Status JobStatus `json:"status"`
+	// TenantID is the tenant that submitted the job when tenancy is enabled
+	TenantID string `json:"tenant_id,omitempty"`
+	// APIKeyID identifies the API key that submitted the job, see utils.KeyID
+	APIKeyID   string          `json:"api_key_id,omitempty"`
+	Attempts   int             `json:"attempts"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Input      json.RawMessage `json:"-"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// JobFilter selects jobs when listing them. Zero values match everything.
+type JobFilter struct {
+	Status        JobStatus
+	Type          JobType
+	TenantID      string
+	APIKeyID      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+// Matches reports whether the job satisfies every criterion of the filter
+func (f *JobFilter) Matches(job *Job) bool {
+	if f.Status != "" && job.Status != f.Status {
+		return false
+	}
+	if f.Type != "" && job.Type != f.Type {
+		return false
+	}
+	if f.TenantID != "" && job.TenantID != f.TenantID {
+		return false
+	}
+	if f.APIKeyID != "" && job.APIKeyID != f.APIKeyID {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && job.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !job.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// JobPage is a page of jobs matching a filter
+type JobPage struct {
+	Jobs   []*Job `json:"jobs"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// EventType names what happened in an Event
+type EventType string
+
+const (
+	EventArchiveCreated    EventType = "archive.created"
+	EventArchiveDownloaded EventType = "archive.downloaded"
+	EventJobSucceeded      EventType = "job.succeeded"
+	EventJobFailed         EventType = "job.failed"
+	EventMailSent          EventType = "mail.sent"
+	EventMailFailed        EventType = "mail.failed"
+)
+
+// Event is something that happened in the service that other systems may
+// react to, such as an archive being stored or a job finishing. Data holds
+// the archive, job, delivery report or other subject of the event.
+type Event struct {
+	ID   string    `json:"id"`
+	Type EventType `json:"type"`
+	// TenantID is the tenant the event belongs to when tenancy is enabled
+	TenantID  string    `json:"tenant_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// ArchiveManifest describes the layout of an archive assembled from a
+// request. Entries are archived in order.
+type ArchiveManifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ArchiveContents lists the files of a created archive with their sizes and
+// hashes. It is embedded into the archive so recipients can check offline
+// that it is complete.
+type ArchiveContents struct {
+	Archive   string                 `json:"archive"`
+	Creator   string                 `json:"creator"`
+	CreatedAt time.Time              `json:"created_at"`
+	FileCount int                    `json:"file_count"`
+	TotalSize int64                  `json:"total_size"`
+	Files     []ArchiveContentsEntry `json:"files"`
+}
+
+// ArchiveContentsEntry describes a file of a created archive
+type ArchiveContentsEntry struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	MIMEType string `json:"mimetype"`
+}
+
+// ManifestEntry is a file at Path in the archive. Its content is the
+// uploaded part named Part, the text Content, or the file fetched from URL;
+// exactly one of them is set.
+type ManifestEntry struct {
+	Path    string `json:"path"`
+	Part    string `json:"part,omitempty"`
+	Content string `json:"content,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// ArchiveJobInput holds the inputs of an asynchronous archive job. The
+// files are kept as uploads and the secrets are sealed, so neither is stored
+// with the job, which drops them once it succeeds or has used its last
+// attempt.
+type ArchiveJobInput struct {
+	Files []ArchiveJobFile `json:"files"`
+	// Password and Passphrase are sealed by a SecretSealer
+	Password   []byte `json:"password,omitempty"`
+	Passphrase []byte `json:"passphrase,omitempty"`
+	// Recipients are the public keys the archive is encrypted to with age
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// ArchiveJobFile is a file of an asynchronous archive job, kept as an upload
+type ArchiveJobFile struct {
+	UploadID string `json:"upload_id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	MIMEType string `json:"mime_type,omitempty"`
+	SkipScan bool   `json:"skip_scan,omitempty"`
+}
+
+// ArchiveJobResult is the result of an asynchronous archive job
+type ArchiveJobResult struct {
+	ArchiveID string `json:"archive_id"`
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	Protected bool   `json:"protected"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// InformationJobInput holds the inputs of an asynchronous archive
+// information job. The archive is kept as an upload until the job succeeds.
+type InformationJobInput struct {
+	UploadID string `json:"upload_id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// UploadKind identifies the operation an upload was processed by
+type UploadKind string
+
+const (
+	UploadKindInformation UploadKind = "information"
+	UploadKindArchive     UploadKind = "archive"
+	UploadKindStore       UploadKind = "store"
+	UploadKindMail        UploadKind = "mail"
+)
+
+// UploadResult is the outcome of processing an upload
+type UploadResult string
+
+const (
+	UploadResultSucceeded UploadResult = "succeeded"
+	UploadResultFailed    UploadResult = "failed"
+)
+
+// HistoryEntry records the metadata of a processed upload. Contents are
+// never kept.
+type HistoryEntry struct {
+	ID       string     `json:"id"`
+	Kind     UploadKind `json:"kind"`
+	Filename string     `json:"filename"`
+	// Size is the total size of the uploaded files in bytes
+	Size int64 `json:"size"`
+	// EntryCount is the number of files archived or found in the archive
+	EntryCount int          `json:"entry_count"`
+	Recipients int          `json:"recipients,omitempty"`
+	Result     UploadResult `json:"result"`
+	Error      string       `json:"error,omitempty"`
+	// TenantID is the tenant of the client when tenancy is enabled
+	TenantID string `json:"tenant_id,omitempty"`
+	// APIKeyID identifies the API key of the client, see utils.KeyID
+	APIKeyID   string    `json:"api_key_id,omitempty"`
+	JobID      string    `json:"job_id,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// HistoryFilter selects history entries when listing them. Zero values match
+// everything.
+type HistoryFilter struct {
+	Kind     UploadKind
+	Result   UploadResult
+	TenantID string
+	APIKeyID string
+	// ExcludeAPIKeyIDs skips the entries of these API keys
+	ExcludeAPIKeyIDs []string
+	// Filename matches entries whose filename contains it, ignoring case
+	Filename      string
+	StartedAfter  time.Time
+	StartedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+// Matches reports whether the entry satisfies every criterion of the filter
+func (f *HistoryFilter) Matches(entry *HistoryEntry) bool {
+	if f.Kind != "" && entry.Kind != f.Kind {
+		return false
+	}
+	if f.Result != "" && entry.Result != f.Result {
+		return false
+	}
+	if f.TenantID != "" && entry.TenantID != f.TenantID {
+		return false
+	}
+	if f.APIKeyID != "" && entry.APIKeyID != f.APIKeyID {
+		return false
+	}
+	if slices.Contains(f.ExcludeAPIKeyIDs, entry.APIKeyID) {
+		return false
+	}
+	if f.Filename != "" && !strings.Contains(strings.ToLower(entry.Filename), strings.ToLower(f.Filename)) {
+		return false
+	}
+	if !f.StartedAfter.IsZero() && entry.StartedAt.Before(f.StartedAfter) {
+		return false
+	}
+	if !f.StartedBefore.IsZero() && !entry.StartedAt.Before(f.StartedBefore) {
+		return false
+	}
+	return true
+}
+
+// HistoryPage is a page of history entries matching a filter
+type HistoryPage struct {
+	Entries []*HistoryEntry `json:"entries"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+// AuditEntry records a mail sent, with the fingerprints of its attachments
+// as they were uploaded, before being zipped or encrypted
+type AuditEntry struct {
+	ID string `json:"id"`
+	// MessageID is the outbox entry of the message, when it was stored
+	MessageID string `json:"message_id,omitempty"`
+	// Recipients lists the addresses the message reached
+	Recipients  []string          `json:"recipients"`
+	Subject     string            `json:"subject"`
+	Attachments []AuditAttachment `json:"attachments"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	SentAt      time.Time         `json:"sent_at"`
+}
+
+// AuditAttachment fingerprints an attachment of an audited mail
+type AuditAttachment struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// SHA256 is the hex encoded SHA-256 hash of the content
+	SHA256 string `json:"sha256"`
+}
+
+// AuditFilter selects audit entries when listing them. Zero values match
+// everything.
+type AuditFilter struct {
+	// SHA256 matches the entries with an attachment of this hash
+	SHA256     string
+	TenantID   string
+	SentAfter  time.Time
+	SentBefore time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditPage is a page of audit entries with the total number of matches
+type AuditPage struct {
+	Entries []*AuditEntry `json:"entries"`
+	Total   int           `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+}
+
+// Role grants access to a group of routes. Each role includes the access of
+// the roles before it.
+type Role string
+
+const (
+	// RoleViewer may inspect archives and read jobs and history
+	RoleViewer Role = "viewer"
+	// RoleSender may also create and store archives and send mail
+	RoleSender Role = "sender"
+	// RoleAdmin may also use the admin endpoints
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders the roles from least to most privileged
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleSender: 2,
+	RoleAdmin:  3,
+}
+
+// Valid reports whether the role is known
+func (r Role) Valid() bool {
+	return roleRanks[r] > 0
+}
+
+// Includes reports whether the role grants the access of required
+func (r Role) Includes(required Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[required]
+}
+
+// Principal is the authenticated client of a request
+type Principal struct {
+	// ID identifies the client, e.g. the KeyID of its API key
+	ID   string
+	Role Role
+}
+
+// HealthStatus is the state of the service or of one of its dependencies
+type HealthStatus string
+
+const (
+	HealthUp   HealthStatus = "up"
+	HealthDown HealthStatus = "down"
+	// HealthDegraded is the state of the service while a dependency is down
+	HealthDegraded HealthStatus = "degraded"
+)
+
+// DependencyHealth is the result of the latest probe of a dependency.
+// LastError is kept once the dependency recovers, so flapping can be seen.
+type DependencyHealth struct {
+	Status      HealthStatus `json:"status"`
+	LatencyMS   int64        `json:"latency_ms"`
+	CheckedAt   time.Time    `json:"checked_at"`
+	LastError   string       `json:"last_error,omitempty"`
+	LastErrorAt *time.Time   `json:"last_error_at,omitempty"`
+}
+
+// HealthReport is the state of the service and of each dependency it was
+// configured with, by name
+type HealthReport struct {
+	Status       HealthStatus                 `json:"status"`
+	Dependencies map[string]*DependencyHealth `json:"dependencies"`
+}
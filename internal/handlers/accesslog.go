@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accessLogTimeFormat is the timestamp layout of the common and combined formats
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogEntry is a served request in the json format
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	IP         string    `json:"ip"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// AccessLog writes a line for every served request in the common or
+// combined log format of Apache and nginx, or as JSON, so access logs can be
+// fed to existing HTTP analytics
+type AccessLog struct {
+	out    io.Writer
+	format string
+	log    *slog.Logger
+}
+
+// NewAccessLog creates a new AccessLog writing to out in format, one of
+// common, combined or json. out must be safe for concurrent writes.
+func NewAccessLog(out io.Writer, format string, log *slog.Logger) (*AccessLog, error) {
+	if format != "common" && format != "combined" && format != "json" {
+		return nil, fmt.Errorf("unknown access log format: %s", format)
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &AccessLog{out: out, format: format, log: log}, nil
+}
+
+// Wrap returns a handler that logs every request served by next
+func (a *AccessLog) Wrap(next http.Handler) http.Handler {
+	const op = "AccessLog.Wrap"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		counter := &countingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(counter, r)
+
+		entry := accessLogEntry{
+			Time:       start,
+			IP:         clientIP(r),
+			Method:     r.Method,
+			URI:        r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     counter.status,
+			Bytes:      counter.bytes,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+		// Each line is written at once, so concurrent requests don't interleave
+		if _, err := a.out.Write(a.formatEntry(entry)); err != nil {
+			a.log.Error("failed to write access log", "op", op, "error", err)
+		}
+	})
+}
+
+// formatEntry returns the log line of a request, including its newline
+func (a *AccessLog) formatEntry(entry accessLogEntry) []byte {
+	if a.format == "json" {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil
+		}
+		return append(line, '\n')
+	}
+
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - - [%s] %s %d %s",
+		entry.IP,
+		entry.Time.Format(accessLogTimeFormat),
+		quoteLogField(entry.Method+" "+entry.URI+" "+entry.Proto),
+		entry.Status,
+		bytes,
+	)
+	if a.format == "combined" {
+		fmt.Fprintf(&b, " %s %s", quoteLogField(entry.Referer), quoteLogField(entry.UserAgent))
+	}
+	b.WriteByte('\n')
+
+	return []byte(b.String())
+}
+
+// quoteLogField quotes a client supplied field, escaping quotes, backslashes
+// and control characters so it cannot forge log lines. Empty fields are "-".
+func quoteLogField(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
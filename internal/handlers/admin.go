@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// testMailRequest is the body of an administrative test email request
+type testMailRequest struct {
+	To         string `json:"to"`
+	Attachment bool   `json:"attachment"`
+}
+
+// AdminHandler handles administrative operations.
+type AdminHandler struct {
+	mail services.MailService
+	log  *slog.Logger
+}
+
+// NewAdminHandler creates a new AdminHandler instance.
+func NewAdminHandler(mail services.MailService, log *slog.Logger) (*AdminHandler, error) {
+	if mail == nil {
+		return nil, services.ErrMailServiceNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &AdminHandler{mail: mail, log: log}, nil
+}
+
+// TestMail sends a canned message to the given address using the live mail
+// configuration. On failure the response includes the delivery transcript.
+func (h *AdminHandler) TestMail(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminHandler.TestMail"
+
+	var req testMailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if limit, ok := bodyTooLarge(err); ok {
+			writeBodyTooLarge(w, r, limit)
+			return
+		}
+		h.log.Error("invalid request body", "op", op, "error", err)
+		writeError(w, r, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	start := time.Now()
+	result, err := h.mail.SendTestMail(req.To, req.Attachment)
+	if err == nil {
+		var sendErr error
+		if !result.Success {
+			sendErr = errors.New(result.Error)
+		}
+		metrics.ObserveMailSend("admin", time.Since(start), sendErr)
+	}
+	if err != nil {
+		h.log.Error("invalid test mail request", "op", op, "error", err)
+		status := http.StatusBadRequest
+		if !errors.Is(err, services.ErrNoRecipients) && !errors.Is(err, services.ErrInvalidEmail) {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, r, status, err)
+		return
+	}
+
+	if !result.Success {
+		h.log.Error("test mail failed", "op", op, "recipient", result.Recipient, "error", result.Error)
+		writeErrorDetails(w, r, http.StatusBadGateway, errors.New(result.Error), result)
+		return
+	}
+
+	h.log.Info("test mail sent", "op", op, "recipient", result.Recipient)
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: result})
+}
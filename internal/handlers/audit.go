@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// AuditHandler handles requests for the audit trail of mail sent.
+type AuditHandler struct {
+	audit *services.AuditService
+	log   *slog.Logger
+}
+
+// NewAuditHandler creates a new AuditHandler instance.
+func NewAuditHandler(audit *services.AuditService, log *slog.Logger) (*AuditHandler, error) {
+	if audit == nil {
+		return nil, errors.New("audit service is nil")
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &AuditHandler{audit: audit, log: log}, nil
+}
+
+// List handles requests to list the mail sent. Supported query parameters
+// are sha256, the hash of an attachment, sent_after, sent_before (RFC 3339),
+// limit and offset.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	const op = "AuditHandler.List"
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	filter.TenantID = tenantID(r)
+
+	page, err := h.audit.List(filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuditFilter) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		h.log.Error("failed to list audit trail", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to list audit trail"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: page})
+}
+
+// parseAuditFilter reads the audit filter from the query string
+func parseAuditFilter(r *http.Request) (entities.AuditFilter, error) {
+	q := r.URL.Query()
+
+	filter := entities.AuditFilter{SHA256: q.Get("sha256")}
+
+	for name, dst := range map[string]*time.Time{
+		"sent_after":  &filter.SentAfter,
+		"sent_before": &filter.SentBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = t
+		}
+	}
+
+	for name, dst := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// Headers of signed requests, see services.SignaturePayload
+const (
+	clientIDHeader  = "X-Client-ID"
+	timestampHeader = "X-Timestamp"
+	signatureHeader = "X-Signature"
+)
+
+// maxSignedBodySize limits the body read to verify a request signature
+const maxSignedBodySize = 64 << 20 // 64 MB
+
+// signedBodyMemory is how much of a signed body is held in memory; larger
+// bodies are spooled to a temporary file
+const signedBodyMemory = 1 << 20 // 1 MB
+
+// AuthMiddleware authenticates API requests and checks the role required by
+// each route group
+type AuthMiddleware struct {
+	auth *services.AuthService
+	log  *slog.Logger
+}
+
+// NewAuthMiddleware creates a new AuthMiddleware instance. auth is optional;
+// without it requests pass through untouched.
+func NewAuthMiddleware(auth *services.AuthService, log *slog.Logger) *AuthMiddleware {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &AuthMiddleware{auth: auth, log: log}
+}
+
+// Require returns a handler that runs next only for clients holding role,
+// with the authenticated principal in the request context
+func (m *AuthMiddleware) Require(role entities.Role, next http.Handler) http.Handler {
+	const op = "AuthMiddleware.Require"
+
+	if m.auth == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			principal *entities.Principal
+			err       error
+		)
+		if signature := r.Header.Get(signatureHeader); signature != "" && m.auth.SupportsSignatures() {
+			var (
+				bodyHash []byte
+				release  func()
+			)
+			bodyHash, release, err = hashBody(w, r)
+			if err == nil {
+				defer release()
+			}
+			if err != nil {
+				if limit, ok := bodyTooLarge(err); ok {
+					writeBodyTooLarge(w, r, limit)
+					return
+				}
+				m.log.Error("failed to read request body", "op", op, "error", err)
+				writeError(w, r, http.StatusBadRequest, errors.New("failed to read request body"))
+				return
+			}
+			principal, err = m.auth.AuthenticateSignature(r.Header.Get(clientIDHeader), r.Header.Get(timestampHeader),
+				signature, r.Method, r.URL.RequestURI(), bodyHash)
+		} else if token, ok := bearerToken(r); ok && m.auth.SupportsBearer() {
+			principal, err = m.auth.AuthenticateBearer(r.Context(), token)
+		} else {
+			principal, err = m.auth.AuthenticateAPIKey(r.Header.Get(apiKeyHeader))
+		}
+		if err == nil {
+			err = m.auth.Authorize(principal, role)
+		}
+
+		switch {
+		case errors.Is(err, services.ErrStaleRequest):
+			writeError(w, r, http.StatusUnauthorized, services.ErrStaleRequest)
+			return
+		case errors.Is(err, services.ErrReplayedRequest):
+			writeError(w, r, http.StatusUnauthorized, services.ErrReplayedRequest)
+			return
+		case errors.Is(err, services.ErrUnauthenticated):
+			if m.auth.SupportsBearer() {
+				w.Header().Add("WWW-Authenticate", "Bearer")
+			}
+			w.Header().Add("WWW-Authenticate", `ApiKey header="`+apiKeyHeader+`"`)
+			writeError(w, r, http.StatusUnauthorized, services.ErrUnauthenticated)
+			return
+		case errors.Is(err, services.ErrForbidden):
+			m.log.Warn("request denied",
+				"op", op,
+				"principal", principal.ID,
+				"role", principal.Role,
+				"required", role,
+				"ip", clientIP(r),
+			)
+			writeError(w, r, http.StatusForbidden, services.ErrForbidden)
+			return
+		case err != nil:
+			m.log.Error("failed to authenticate request", "op", op, "error", err)
+			writeError(w, r, http.StatusInternalServerError, errors.New("failed to authenticate request"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(services.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// hashBody reads the request body and returns its SHA-256, leaving the body
+// in place for the handler. Bodies above signedBodyMemory are spooled to a
+// temporary file, which release removes once the request has been served.
+func hashBody(w http.ResponseWriter, r *http.Request) (sum []byte, release func(), err error) {
+	hash := sha256.New()
+	body := io.TeeReader(http.MaxBytesReader(w, r.Body, maxSignedBodySize), hash)
+
+	head, err := io.ReadAll(io.LimitReader(body, signedBodyMemory+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(head) <= signedBodyMemory {
+		r.Body = io.NopCloser(bytes.NewReader(head))
+		return hash.Sum(nil), func() {}, nil
+	}
+
+	file, err := os.CreateTemp("", "signed-body-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	release = func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	if _, err = io.Copy(file, io.MultiReader(bytes.NewReader(head), body)); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	r.Body = file
+
+	return hash.Sum(nil), release, nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashBody(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "Empty body", size: 0},
+		{name: "Body held in memory", size: signedBodyMemory},
+		{name: "Body spooled to a file", size: signedBodyMemory + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte("x"), tt.size)
+			r := httptest.NewRequest(http.MethodPost, "/api/mail/file", bytes.NewReader(body))
+
+			sum, release, err := hashBody(httptest.NewRecorder(), r)
+			require.NoError(t, err)
+			expected := sha256.Sum256(body)
+			assert.Equal(t, expected[:], sum)
+
+			// The handler still reads the whole body
+			spooled, isFile := r.Body.(*os.File)
+			read, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, body, read)
+
+			release()
+			if tt.size > signedBodyMemory {
+				require.True(t, isFile)
+				_, err := os.Stat(spooled.Name())
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			}
+		})
+	}
+}
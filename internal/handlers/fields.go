@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidFields = errors.New("invalid fields")
+
+// fieldSet is a parsed fields parameter. It maps the selected names of an
+// object to the fields selected within them; a nil fieldSet selects all.
+type fieldSet map[string]fieldSet
+
+// parseFields parses a comma separated list of dotted field paths, such as
+// "filename,total_size,files.file_path". An empty list selects everything.
+func parseFields(param string) (fieldSet, error) {
+	if strings.TrimSpace(param) == "" {
+		return nil, nil
+	}
+
+	set := fieldSet{}
+	for _, path := range strings.Split(param, ",") {
+		names := strings.Split(strings.TrimSpace(path), ".")
+		current := set
+		for i, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("%w: %q is not a field path", ErrInvalidFields, path)
+			}
+			sub, ok := current[name]
+			if ok && sub == nil {
+				// Already selected as a whole
+				break
+			}
+			if i == len(names)-1 {
+				current[name] = nil
+				break
+			}
+			if !ok {
+				sub = fieldSet{}
+				current[name] = sub
+			}
+			current = sub
+		}
+	}
+	return set, nil
+}
+
+// selects reports whether name, a field of the object set applies to, is
+// selected as a whole or in part
+func (s fieldSet) selects(name string) bool {
+	if s == nil {
+		return true
+	}
+	_, ok := s[name]
+	return ok
+}
+
+// selectFields returns the fields of v selected by set, named and ordered
+// as they are serialized. Slices have set applied to each element.
+func selectFields(v any, set fieldSet) (any, error) {
+	if set == nil {
+		return v, nil
+	}
+	return selectValue(reflect.ValueOf(v), set, "")
+}
+
+func selectValue(v reflect.Value, set fieldSet, path string) (any, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		elems := make([]any, v.Len())
+		for i := range elems {
+			elem, err := selectValue(v.Index(i), set, path)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return elems, nil
+	case reflect.Struct:
+	default:
+		return nil, fmt.Errorf("%w: %s has no fields", ErrInvalidFields, strings.TrimSuffix(path, "."))
+	}
+
+	t := v.Type()
+	known := make(map[string]bool, t.NumField())
+	var object orderedObject
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, omitEmpty, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		known[name] = true
+		sub, selected := set[name]
+		value := v.Field(i)
+		if !selected || (omitEmpty && value.IsZero()) {
+			continue
+		}
+
+		var selectedValue any = value.Interface()
+		if sub != nil {
+			var err error
+			if selectedValue, err = selectValue(value, sub, path+name+"."); err != nil {
+				return nil, err
+			}
+		}
+		object = append(object, objectField{
+			name:    name,
+			xmlName: xmlFieldName(field, name),
+			value:   selectedValue,
+		})
+	}
+
+	for name := range set {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown field %s%s", ErrInvalidFields, path, name)
+		}
+	}
+
+	return object, nil
+}
+
+// jsonFieldName returns the serialized name of a field and whether it is
+// left out when empty. ok is false for fields that are not serialized.
+func jsonFieldName(field reflect.StructField) (name string, omitEmpty, ok bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" || !field.IsExported() {
+		return "", false, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(options, "omitempty"), true
+}
+
+// xmlFieldName returns the XML element name of a field, such as "files>file"
+// for a wrapped list
+func xmlFieldName(field reflect.StructField, name string) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("xml"), ",")
+	if tag == "" || tag == "-" {
+		return name
+	}
+	return tag
+}
+
+// objectField is a selected field of an orderedObject
+type objectField struct {
+	name    string
+	xmlName string
+	value   any
+}
+
+// orderedObject is an object whose fields are serialized in order, as
+// those of the struct it was selected from
+type orderedObject []objectField
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o orderedObject) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range o {
+		value := &yaml.Node{}
+		if err := value.Encode(field.value); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.name}, value)
+	}
+	return node, nil
+}
+
+func (o orderedObject) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, field := range o {
+		parent, child, wrapped := strings.Cut(field.xmlName, ">")
+		if !wrapped {
+			if err := e.EncodeElement(field.value, xml.StartElement{Name: xml.Name{Local: field.xmlName}}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		wrapper := xml.StartElement{Name: xml.Name{Local: parent}}
+		if err := e.EncodeToken(wrapper); err != nil {
+			return err
+		}
+		if elems := reflect.ValueOf(field.value); elems.Kind() == reflect.Slice {
+			for i := range elems.Len() {
+				if err := e.EncodeElement(elems.Index(i).Interface(), xml.StartElement{Name: xml.Name{Local: child}}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := e.EncodeToken(wrapper.End()); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"gopkg.in/yaml.v3"
+)
+
+// Response formats of the information endpoint, chosen by the Accept header
+const (
+	formatJSON = "application/json"
+	formatXML  = "application/xml"
+	formatYAML = "application/yaml"
+	formatCSV  = "text/csv"
+)
+
+var ErrNotAcceptable = errors.New("none of the accepted formats is supported: use application/json, application/xml, application/yaml or text/csv")
+
+// formatAliases maps the media types accepted for each response format
+var formatAliases = map[string]string{
+	"application/json":   formatJSON,
+	"application/xml":    formatXML,
+	"text/xml":           formatXML,
+	"application/yaml":   formatYAML,
+	"application/x-yaml": formatYAML,
+	"text/yaml":          formatYAML,
+	"text/csv":           formatCSV,
+}
+
+// negotiateFormat returns the response format preferred by the Accept
+// header, which defaults to JSON when it is missing or accepts anything
+func negotiateFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON, true
+	}
+
+	type candidate struct {
+		format string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		switch format, ok := formatAliases[mediaType]; {
+		case ok:
+			candidates = append(candidates, candidate{format, q})
+		case mediaType == "*/*", mediaType == "application/*":
+			candidates = append(candidates, candidate{formatJSON, q})
+		case mediaType == "text/*":
+			candidates = append(candidates, candidate{formatCSV, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	// The first listed wins among equal preferences
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].format, true
+}
+
+// writeFormatted writes a successful response holding the fields of data
+// selected by the fields query parameter, in format
+func (h *ArchiveHandler) writeFormatted(w http.ResponseWriter, r *http.Request, format string, data any) {
+	const op = "ArchiveHandler.writeFormatted"
+
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	selected, err := selectFields(data, fields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	response := Response{Success: true, Data: selected}
+
+	var body []byte
+	switch format {
+	case formatXML:
+		body, err = xml.MarshalIndent(response, "", "  ")
+		body = append([]byte(xml.Header), body...)
+	case formatYAML:
+		body, err = yaml.Marshal(response)
+	case formatCSV:
+		body, err = marshalCSV(data, fields)
+	default:
+		h.writeJSONResponse(w, http.StatusOK, response)
+		return
+	}
+	if errors.Is(err, ErrInvalidFields) {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to encode response", "op", op, "format", format, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to encode response"))
+		return
+	}
+
+	contentType := format
+	if format != formatYAML {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// marshalCSV flattens archive information into one row per file, and
+// document information into a single row, with the columns selected by
+// fields
+func marshalCSV(data any, fields fieldSet) ([]byte, error) {
+	var rows [][]string
+	switch data := data.(type) {
+	case *entities.ArchiveInfo:
+		if fields != nil {
+			var ok bool
+			if fields, ok = fields["files"]; !ok {
+				return nil, fmt.Errorf("%w: csv lists files, so fields must select them", ErrInvalidFields)
+			}
+		}
+		rows = append(rows, []string{"file_path", "size", "mimetype", "detected_mimetype", "mimetype_mismatch"})
+		for _, file := range data.Files {
+			rows = append(rows, []string{
+				csvCell(file.FilePath),
+				strconv.FormatInt(file.Size, 10),
+				file.MimeType,
+				file.DetectedMimeType,
+				strconv.FormatBool(file.MimeTypeMismatch),
+			})
+		}
+	case *entities.DocumentInfo:
+		rows = [][]string{
+			{"filename", "format", "size", "title", "subject", "description", "keywords", "creator",
+				"last_modified_by", "created", "modified", "application", "pages", "words", "characters",
+				"paragraphs", "slides", "sheets"},
+			{csvCell(data.Filename), data.Format, strconv.FormatInt(data.Size, 10), csvCell(data.Title),
+				csvCell(data.Subject), csvCell(data.Description), csvCell(data.Keywords), csvCell(data.Creator),
+				csvCell(data.LastModifiedBy), formatTime(data.Created),
+				formatTime(data.Modified), csvCell(data.Application), strconv.Itoa(data.Pages), strconv.Itoa(data.Words),
+				strconv.Itoa(data.Characters), strconv.Itoa(data.Paragraphs), strconv.Itoa(data.Slides),
+				strconv.Itoa(data.Sheets)},
+		}
+	default:
+		return nil, fmt.Errorf("cannot write %T as csv", data)
+	}
+
+	if fields != nil {
+		var columns []int
+		for i, name := range rows[0] {
+			if fields.selects(name) {
+				columns = append(columns, i)
+			}
+		}
+		for i, row := range rows {
+			selected := make([]string, len(columns))
+			for j, column := range columns {
+				selected[j] = row[column]
+			}
+			rows[i] = selected
+		}
+	}
+
+	var sb strings.Builder
+	writer := csv.NewWriter(&sb)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return []byte(sb.String()), nil
+}
+
+// csvCell quotes text taken from an upload that spreadsheets would
+// otherwise run as a formula
+func csvCell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// formatTime formats an optional time as RFC 3339, or "" when it is nil
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// groupRequest is the body of a request to create or update a recipient
+// group. The name of an update comes from the path.
+type groupRequest struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+}
+
+// GroupHandler handles requests to manage the recipient groups of the
+// tenant of the request.
+type GroupHandler struct {
+	groups *services.GroupService
+	log    *slog.Logger
+}
+
+// NewGroupHandler creates a new GroupHandler instance.
+func NewGroupHandler(groups *services.GroupService, log *slog.Logger) (*GroupHandler, error) {
+	if groups == nil {
+		return nil, errors.New("group service is nil")
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &GroupHandler{groups: groups, log: log}, nil
+}
+
+// List handles requests to list the recipient groups
+func (h *GroupHandler) List(w http.ResponseWriter, r *http.Request) {
+	const op = "GroupHandler.List"
+
+	groups, err := h.groups.List(tenantID(r))
+	if err != nil {
+		h.log.Error("failed to list groups", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to list groups"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: groups})
+}
+
+// Get handles requests to get a recipient group
+func (h *GroupHandler) Get(w http.ResponseWriter, r *http.Request) {
+	const op = "GroupHandler.Get"
+
+	group, err := h.groups.Get(tenantID(r), r.PathValue("name"))
+	if err != nil {
+		if errors.Is(err, services.ErrGroupNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrGroupNotFound)
+			return
+		}
+		h.log.Error("failed to get group", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to get group"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: group})
+}
+
+// Create handles requests to create a recipient group
+func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
+	const op = "GroupHandler.Create"
+
+	req, ok := decodeGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.Create(tenantID(r), req.Name, req.Addresses)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidGroup):
+			writeError(w, r, http.StatusBadRequest, err)
+		case errors.Is(err, services.ErrGroupExists):
+			writeError(w, r, http.StatusConflict, err)
+		default:
+			h.log.Error("failed to create group", "op", op, "error", err)
+			writeError(w, r, http.StatusInternalServerError, errors.New("failed to create group"))
+		}
+		return
+	}
+
+	h.log.Info("recipient group created", "op", op, "group", group.Name, "addresses", len(group.Addresses))
+	WriteJSON(w, http.StatusCreated, Response{Success: true, Data: group})
+}
+
+// Update handles requests to replace the addresses of a recipient group
+func (h *GroupHandler) Update(w http.ResponseWriter, r *http.Request) {
+	const op = "GroupHandler.Update"
+
+	req, ok := decodeGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.Update(tenantID(r), r.PathValue("name"), req.Addresses)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidGroup):
+			writeError(w, r, http.StatusBadRequest, err)
+		case errors.Is(err, services.ErrGroupNotFound):
+			writeError(w, r, http.StatusNotFound, err)
+		default:
+			h.log.Error("failed to update group", "op", op, "error", err)
+			writeError(w, r, http.StatusInternalServerError, errors.New("failed to update group"))
+		}
+		return
+	}
+
+	h.log.Info("recipient group updated", "op", op, "group", group.Name, "addresses", len(group.Addresses))
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: group})
+}
+
+// Delete handles requests to delete a recipient group
+func (h *GroupHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	const op = "GroupHandler.Delete"
+
+	name := r.PathValue("name")
+	if err := h.groups.Delete(tenantID(r), name); err != nil {
+		if errors.Is(err, services.ErrGroupNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrGroupNotFound)
+			return
+		}
+		h.log.Error("failed to delete group", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to delete group"))
+		return
+	}
+
+	h.log.Info("recipient group deleted", "op", op, "group", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeGroupRequest reads the body of a request to create or update a
+// group, writing the error response when it fails
+func decodeGroupRequest(w http.ResponseWriter, r *http.Request) (groupRequest, bool) {
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if limit, ok := bodyTooLarge(err); ok {
+			writeBodyTooLarge(w, r, limit)
+			return req, false
+		}
+		writeError(w, r, http.StatusBadRequest, errors.New("invalid request body"))
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// HealthHandler handles requests for the state of the service and its
+// dependencies.
+type HealthHandler struct {
+	health *services.HealthService
+}
+
+// NewHealthHandler creates a new HealthHandler instance.
+func NewHealthHandler(health *services.HealthService) (*HealthHandler, error) {
+	if health == nil {
+		return nil, errors.New("health service is nil")
+	}
+
+	return &HealthHandler{health: health}, nil
+}
+
+// Get handles requests for the state of every dependency, with the latency
+// and error of its latest probe. It answers 503 Service Unavailable while a
+// dependency is down, so load balancers and monitors can act on the status
+// alone.
+func (h *HealthHandler) Get(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Check(r.Context())
+
+	status := http.StatusOK
+	if report.Status != entities.HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, Response{Success: report.Status == entities.HealthUp, Data: report})
+}
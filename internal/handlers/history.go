@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+// HistoryHandler handles requests for the upload history.
+type HistoryHandler struct {
+	history *services.HistoryService
+	log     *slog.Logger
+}
+
+// NewHistoryHandler creates a new HistoryHandler instance.
+func NewHistoryHandler(history *services.HistoryService, log *slog.Logger) (*HistoryHandler, error) {
+	if history == nil {
+		return nil, errors.New("history service is nil")
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &HistoryHandler{history: history, log: log}, nil
+}
+
+// List handles requests to list processed uploads. Supported query parameters
+// are kind, result, filename, api_key, started_after, started_before
+// (RFC 3339), limit and offset.
+func (h *HistoryHandler) List(w http.ResponseWriter, r *http.Request) {
+	const op = "HistoryHandler.List"
+
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	filter.TenantID = tenantID(r)
+
+	page, err := h.history.List(filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidHistoryFilter) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		h.log.Error("failed to list history", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to list history"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: page})
+}
+
+// parseHistoryFilter reads the history filter from the query string
+func parseHistoryFilter(r *http.Request) (entities.HistoryFilter, error) {
+	q := r.URL.Query()
+
+	filter := entities.HistoryFilter{
+		Kind:     entities.UploadKind(q.Get("kind")),
+		Result:   entities.UploadResult(q.Get("result")),
+		APIKeyID: utils.KeyID(q.Get("api_key")),
+		Filename: q.Get("filename"),
+	}
+
+	switch filter.Kind {
+	case "", entities.UploadKindInformation, entities.UploadKindArchive, entities.UploadKindStore, entities.UploadKindMail:
+	default:
+		return filter, fmt.Errorf("invalid kind: %s", filter.Kind)
+	}
+
+	switch filter.Result {
+	case "", entities.UploadResultSucceeded, entities.UploadResultFailed:
+	default:
+		return filter, fmt.Errorf("invalid result: %s", filter.Result)
+	}
+
+	for name, dst := range map[string]*time.Time{
+		"started_after":  &filter.StartedAfter,
+		"started_before": &filter.StartedBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = t
+		}
+	}
+
+	for name, dst := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+
+	return filter, nil
+}
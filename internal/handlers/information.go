@@ -1,44 +1,82 @@
 package handlers
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ab-dauletkhan/doozip/internal/config"
 	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
 	"github.com/ab-dauletkhan/doozip/internal/services"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
 )
 
 const (
 	maxFileSize     = 10 << 20 // 10 MB
 	maxTotalSize    = 50 << 20 // 50 MB
 	defaultFileName = "archive.zip"
+
+	// interpretOffice returns the metadata of office documents instead of their entries
+	interpretOffice = "office"
+
+	// skippedFilesHeader lists, as JSON, the files left out of an archive
+	// created with strict=false
+	skippedFilesHeader = "X-Archive-Skipped-Files"
 )
 
 var (
 	ErrFileSizeTooLarge    = errors.New("file size exceeds maximum allowed size")
 	ErrTotalSizeTooLarge   = errors.New("total size exceeds maximum allowed size")
 	ErrNoFiles             = errors.New("no files provided")
+	ErrOnlyHiddenFiles     = errors.New("every file provided is hidden")
+	ErrNoValidFiles        = errors.New("every file provided is invalid")
 	ErrServiceNil          = errors.New("archive service is nil")
 	ErrInvalidContentType  = errors.New("invalid content type")
 	ErrFileProcessingError = errors.New("error processing file")
+	ErrInvalidInterpret    = errors.New("invalid interpret option")
+	ErrTooManyFiles        = errors.New("too many files")
 )
 
 // ArchiveHandler handles HTTP requests for archive operations
 type ArchiveHandler struct {
-	service services.ArchiveService
-	log     *slog.Logger
+	service  services.ArchiveService
+	shares   services.ShareService
+	jobs     *services.JobManager
+	history  *services.HistoryService
+	builds   *services.WorkLimiter
+	uploads  *services.UploadService
+	secrets  *services.SecretSealer
+	info     config.ArchiveInformationConfig
+	maxFiles int
+	log      *slog.Logger
 }
 
-// NewArchiveHandler creates a new instance of ArchiveHandler
-func NewArchiveHandler(svc services.ArchiveService, log *slog.Logger) (*ArchiveHandler, error) {
-	if svc == nil {
+// NewArchiveHandler creates a new instance of ArchiveHandler.
+// shares is optional; without it archives cannot be stored and shared.
+// jobs is optional; without it archives are always created synchronously.
+// history is optional; without it uploads are not recorded.
+// builds is optional; without it archives are built and read as soon as
+// they are uploaded.
+// uploads is optional; without it, or without jobs, archives are always
+// inspected and created synchronously. secrets seals the passwords of
+// archive jobs and is required with uploads. info sizes the archives
+// inspected.
+// maxFiles is the number of files accepted per upload; zero is unlimited.
+func NewArchiveHandler(svc services.ArchiveService, shares services.ShareService, jobs *services.JobManager, history *services.HistoryService, builds *services.WorkLimiter, uploads *services.UploadService, secrets *services.SecretSealer, info config.ArchiveInformationConfig, maxFiles int, log *slog.Logger) (*ArchiveHandler, error) {
+	if svc == nil || (uploads != nil && secrets == nil) {
 		return nil, ErrServiceNil
 	}
 
@@ -47,8 +85,16 @@ func NewArchiveHandler(svc services.ArchiveService, log *slog.Logger) (*ArchiveH
 	}
 
 	return &ArchiveHandler{
-		service: svc,
-		log:     log,
+		service:  svc,
+		shares:   shares,
+		jobs:     jobs,
+		history:  history,
+		builds:   builds,
+		uploads:  uploads,
+		secrets:  secrets,
+		info:     info,
+		maxFiles: maxFiles,
+		log:      log,
 	}, nil
 }
 
@@ -57,87 +103,655 @@ func (h *ArchiveHandler) GetInformation(w http.ResponseWriter, r *http.Request)
 	const op = "ArchiveHandler.GetInformation"
 
 	if err := h.validateRequest(r, "multipart/form-data"); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, err)
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	format, ok := negotiateFormat(r.Header.Get("Accept"))
+	if !ok {
+		writeError(w, r, http.StatusNotAcceptable, ErrNotAcceptable)
+		return
+	}
+
+	interpret := r.FormValue("interpret")
+	if interpret != "" && interpret != interpretOffice {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrInvalidInterpret, interpret))
+		return
+	}
+
+	fast := false
+	if value := r.FormValue("fast"); value != "" {
+		var err error
+		if fast, err = strconv.ParseBool(value); err != nil {
+			writeError(w, r, http.StatusBadRequest, errors.New("fast must be true or false"))
+			return
+		}
+	}
+	if fast && interpret != "" {
+		writeError(w, r, http.StatusBadRequest, errors.New("fast cannot be combined with interpret"))
+		return
+	}
+
+	if remoteURL := r.FormValue("url"); remoteURL != "" {
+		h.getRemoteInformation(w, r, format, remoteURL)
 		return
 	}
 
 	file, header, err := r.FormFile("file")
+	if limit, ok := bodyTooLarge(err); ok {
+		writeBodyTooLarge(w, r, limit)
+		return
+	}
 	if err != nil {
 		h.log.Error("failed to get form file",
 			"op", op,
 			"error", err,
 		)
-		h.writeErrorResponse(w, http.StatusBadRequest, errors.New("file is required"))
+		writeError(w, r, http.StatusBadRequest, errors.New("file is required"))
 		return
 	}
 	defer file.Close()
 
-	if header.Size > maxFileSize {
-		h.writeErrorResponse(w, http.StatusBadRequest, ErrFileSizeTooLarge)
+	if header.Size > informationMaxFileSize(&h.info) {
+		writeError(w, r, http.StatusBadRequest, ErrFileSizeTooLarge)
+		return
+	}
+
+	if !requestTenant(r).AllowsMIMEType(mime.TypeByExtension(filepath.Ext(header.Filename))) {
+		writeError(w, r, http.StatusBadRequest, services.ErrFileTypeNotAllowed)
+		return
+	}
+
+	if !fast && interpret == "" && h.inspectAsync(header.Size) {
+		h.submitInformationJob(w, r, file, header)
+		return
+	}
+
+	entry := entities.HistoryEntry{
+		Kind:      entities.UploadKindInformation,
+		Filename:  header.Filename,
+		Size:      header.Size,
+		TenantID:  tenantID(r),
+		APIKeyID:  utils.KeyID(r.Header.Get(apiKeyHeader)),
+		StartedAt: time.Now(),
+	}
+
+	release, ok := h.acquireBuild(w, r)
+	if !ok {
 		return
 	}
+	defer release()
 
-	result, err := h.service.GetArchiveInformation(file, header.Filename)
+	if interpret == interpretOffice && h.writeDocumentInformation(w, r, format, file, header, entry) {
+		return
+	}
+
+	var result *entities.ArchiveInfo
+	if fast {
+		result, err = h.service.GetArchiveDirectory(file, header.Size, header.Filename)
+	} else {
+		result, err = h.service.GetArchiveInformation(file, header.Filename)
+	}
+	metrics.ObserveInput(entities.UploadKindInformation, header.Size, err)
+	if result != nil {
+		entry.EntryCount = int(result.TotalFiles)
+	}
+	h.history.Record(entry, err)
+	if errors.Is(err, services.ErrFileRejected) {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		h.log.Error("failed to get archive information",
 			"op", op,
 			"error", err,
 			"filename", header.Filename,
 		)
-		h.writeErrorResponse(w, http.StatusInternalServerError, errors.New("failed to process archive"))
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to process archive"))
 		return
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, Response{
-		Success: true,
-		Data:    result,
+	h.writeFormatted(w, r, format, result)
+}
+
+// inspectAsync reports whether an upload of size bytes is inspected by a job
+func (h *ArchiveHandler) inspectAsync(size int64) bool {
+	return h.jobs != nil && h.uploads != nil && h.info.AsyncThreshold > 0 && size >= h.info.AsyncThreshold
+}
+
+// submitInformationJob keeps the upload and submits a job inspecting it,
+// responding with 202 Accepted and the job to poll
+func (h *ArchiveHandler) submitInformationJob(w http.ResponseWriter, r *http.Request, file multipart.File, header *multipart.FileHeader) {
+	const op = "ArchiveHandler.submitInformationJob"
+
+	uploadID, err := h.uploads.Save(r.Context(), file, header.Size)
+	if err != nil {
+		h.log.Error("failed to keep upload", "op", op, "error", err, "filename", header.Filename)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to process archive"))
+		return
+	}
+
+	job, err := h.jobs.Submit(entities.JobTypeInformation, tenantID(r), r.Header.Get(apiKeyHeader), entities.InformationJobInput{
+		UploadID: uploadID,
+		Filename: header.Filename,
+		Size:     header.Size,
 	})
+	if err != nil {
+		h.uploads.Discard(uploadID)
+		h.log.Error("failed to submit information job", "op", op, "error", err, "filename", header.Filename)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to submit job"))
+		return
+	}
+
+	writeJobAccepted(w, job, nil)
+}
+
+// informationMaxFileSize returns the largest archive uploaded for inspection
+func informationMaxFileSize(cfg *config.ArchiveInformationConfig) int64 {
+	if cfg.MaxFileSize > 0 {
+		return cfg.MaxFileSize
+	}
+	return maxFileSize
+}
+
+// writeDocumentInformation writes the metadata of an office document and
+// reports whether the upload was one. Other archives are left to be listed.
+func (h *ArchiveHandler) writeDocumentInformation(w http.ResponseWriter, r *http.Request, format string, file multipart.File, header *multipart.FileHeader, entry entities.HistoryEntry) bool {
+	const op = "ArchiveHandler.writeDocumentInformation"
+
+	document, err := h.service.GetDocumentInformation(file, header.Size, header.Filename)
+	if errors.Is(err, services.ErrNotADocument) {
+		return false
+	}
+	metrics.ObserveInput(entities.UploadKindInformation, header.Size, err)
+	h.history.Record(entry, err)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidArchiveZip) {
+			writeError(w, r, http.StatusBadRequest, services.ErrInvalidArchiveZip)
+			return true
+		}
+		h.log.Error("failed to get document information",
+			"op", op,
+			"error", err,
+			"filename", header.Filename,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to process document"))
+		return true
+	}
+
+	h.writeFormatted(w, r, format, document)
+	return true
+}
+
+// getRemoteInformation handles requests to get information about an archive
+// hosted elsewhere instead of an uploaded one
+func (h *ArchiveHandler) getRemoteInformation(w http.ResponseWriter, r *http.Request, format, remoteURL string) {
+	const op = "ArchiveHandler.getRemoteInformation"
+
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, services.ErrInvalidRemoteURL)
+		return
+	}
+	filename := path.Base(u.Path)
+	if !requestTenant(r).AllowsMIMEType(mime.TypeByExtension(path.Ext(filename))) {
+		writeError(w, r, http.StatusBadRequest, services.ErrFileTypeNotAllowed)
+		return
+	}
+
+	entry := entities.HistoryEntry{
+		Kind:      entities.UploadKindInformation,
+		Filename:  filename,
+		TenantID:  tenantID(r),
+		APIKeyID:  utils.KeyID(r.Header.Get(apiKeyHeader)),
+		StartedAt: time.Now(),
+	}
+
+	release, ok := h.acquireBuild(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	result, err := h.service.GetRemoteArchiveInformation(r.Context(), remoteURL)
+	if result != nil {
+		entry.Size = result.ArchiveSize
+		entry.EntryCount = int(result.TotalFiles)
+	}
+	metrics.ObserveInput(entities.UploadKindInformation, entry.Size, err)
+	h.history.Record(entry, err)
+	if err != nil {
+		if !h.writeRemoteError(w, r, op, err) {
+			h.log.Error("failed to get remote archive information",
+				"op", op,
+				"error", err,
+			)
+			writeError(w, r, http.StatusInternalServerError, errors.New("failed to process archive"))
+		}
+		return
+	}
+
+	h.writeFormatted(w, r, format, result)
+}
+
+// writeRemoteError writes the response to an error of fetching a remote
+// file and reports whether err was one
+func (h *ArchiveHandler) writeRemoteError(w http.ResponseWriter, r *http.Request, op string, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrRemoteArchivesDisabled):
+		writeError(w, r, http.StatusNotImplemented, services.ErrRemoteArchivesDisabled)
+	case errors.Is(err, services.ErrInvalidRemoteURL):
+		writeError(w, r, http.StatusBadRequest, services.ErrInvalidRemoteURL)
+	case errors.Is(err, services.ErrRemoteArchiveTooLarge):
+		writeError(w, r, http.StatusBadRequest, services.ErrRemoteArchiveTooLarge)
+	case errors.Is(err, services.ErrInvalidArchiveZip):
+		writeError(w, r, http.StatusBadRequest, services.ErrInvalidArchiveZip)
+	case errors.Is(err, services.ErrFileRejected):
+		writeError(w, r, http.StatusBadRequest, err)
+	case errors.Is(err, services.ErrRemoteFetchFailed):
+		h.log.Warn("failed to fetch remote file", "op", op, "error", err)
+		writeError(w, r, http.StatusBadGateway, services.ErrRemoteFetchFailed)
+	default:
+		return false
+	}
+	return true
 }
 
 // CreateArchive handles requests to create a new archive
 func (h *ArchiveHandler) CreateArchive(w http.ResponseWriter, r *http.Request) {
-	const op = "ArchiveHandler.CreateArchive"
-
-	if err := h.validateRequest(r, "multipart/form-data"); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, err)
+	zipFile, skipped, entry, ok := h.buildArchive(w, r, "ArchiveHandler.CreateArchive", entities.UploadKindArchive)
+	if !ok {
 		return
 	}
+	h.history.Record(entry, nil)
 
-	if err := r.ParseMultipartForm(maxTotalSize); err != nil {
-		h.log.Error("failed to parse multipart form",
-			"op", op,
+	// The body is the archive, so the skipped files are listed in a header
+	if len(skipped) > 0 {
+		if skippedJSON, err := json.Marshal(skipped); err == nil {
+			w.Header().Set(skippedFilesHeader, string(skippedJSON))
+		}
+	}
+	h.writeFileResponse(w, partialStatus(http.StatusOK, skipped), zipFile)
+}
+
+// SigningKey serves the public key verifying the signatures of created
+// archives, as PEM for Ed25519 or armored for PGP
+func (h *ArchiveHandler) SigningKey(w http.ResponseWriter, r *http.Request) {
+	key, algorithm, err := h.service.SigningKey()
+	if err != nil {
+		h.log.Error("failed to encode signing key",
+			"op", "ArchiveHandler.SigningKey",
 			"error", err,
 		)
-		h.writeErrorResponse(w, http.StatusBadRequest, errors.New("failed to parse request"))
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to encode signing key"))
 		return
 	}
+	if key == nil {
+		writeError(w, r, http.StatusNotFound, errors.New("archive signing is not enabled"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set(signatureAlgorithmHeader, algorithm)
+	w.Write(key)
+}
 
-	files, err := h.processUploadedFiles(r)
+// ValidateArchive handles requests to check the files of an archive without
+// creating it. Every check of CreateArchive runs, and the predicted entries
+// and compressed size are returned, so large submissions can be pre-flighted.
+func (h *ArchiveHandler) ValidateArchive(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.ValidateArchive"
+
+	files, skipped, ok := h.parseArchiveRequest(w, r, op)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ValidateFiles(files); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	password := r.FormValue("password")
+	if password != "" {
+		if !h.service.EncryptionEnabled() {
+			writeError(w, r, http.StatusForbidden, services.ErrEncryptionDisabled)
+			return
+		}
+		if err := h.service.ValidatePassword(password); err != nil {
+			h.writePolicyError(w, r, err)
+			return
+		}
+	}
+
+	estimate, err := h.service.EstimateArchive(files, defaultFileName, password != "")
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, err)
+		h.log.Error("failed to estimate archive",
+			"op", op,
+			"error", err,
+			"filesCount", len(files),
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to validate archive"))
 		return
 	}
 
-	zipFile, err := h.service.CreateZipArchive(files, defaultFileName)
+	estimate.Skipped = skipped
+	h.writeJSONResponse(w, partialStatus(http.StatusOK, skipped), Response{
+		Success: true,
+		Data:    estimate,
+	})
+}
+
+// buildArchive parses the uploaded files and creates the archive, encrypted
+// when a password is given and encrypted to the public keys of recipients[]
+// when any are given. It writes the error response and returns false
+// on failure. Failures to create the archive are recorded in the history;
+// on success the caller records the returned entry once it is done. The
+// files left out of a request with strict=false are returned as skipped.
+func (h *ArchiveHandler) buildArchive(w http.ResponseWriter, r *http.Request, op string, kind entities.UploadKind) (*entities.FileData, []entities.FileError, entities.HistoryEntry, bool) {
+	files, skipped, ok := h.parseArchiveRequest(w, r, op)
+	if !ok {
+		return nil, nil, entities.HistoryEntry{}, false
+	}
+
+	recipients := archiveRecipients(r)
+	if len(recipients) > 0 && !h.writeRecipientsError(w, r, h.service.ValidateRecipients(recipients)) {
+		return nil, nil, entities.HistoryEntry{}, false
+	}
+
+	release, ok := h.acquireBuild(w, r)
+	if !ok {
+		return nil, nil, entities.HistoryEntry{}, false
+	}
+	defer release()
+
+	entry := services.NewUploadEntry(kind, tenantID(r), r.Header.Get(apiKeyHeader), files)
+
+	var (
+		zipFile *entities.FileData
+		err     error
+	)
+	if password := r.FormValue("password"); password != "" {
+		zipFile, err = h.service.CreateEncryptedZipArchive(files, defaultFileName, password)
+	} else {
+		zipFile, err = h.service.CreateZipArchive(files, defaultFileName)
+	}
+	if err == nil && len(recipients) > 0 {
+		zipFile, err = h.service.EncryptToRecipients(zipFile, recipients)
+	}
+	metrics.ObserveArchive(kind, files, zipFile, err)
 	if err != nil {
+		if h.writePolicyError(w, r, err) {
+			return nil, nil, entry, false
+		}
+		if errors.Is(err, services.ErrEncryptionDisabled) {
+			writeError(w, r, http.StatusForbidden, services.ErrEncryptionDisabled)
+			return nil, nil, entry, false
+		}
+		if errors.Is(err, services.ErrFileBlocked) || errors.Is(err, services.ErrFileRejected) || errors.Is(err, services.ErrEntryProcessing) || errors.Is(err, services.ErrInvalidMimeType) ||
+			errors.Is(err, services.ErrContentsNameTaken) {
+			h.history.Record(entry, err)
+			writeError(w, r, http.StatusBadRequest, err)
+			return nil, nil, entry, false
+		}
+		h.history.Record(entry, err)
 		h.log.Error("failed to create zip archive",
 			"op", op,
 			"error", err,
 			"filesCount", len(files),
 		)
-		h.writeErrorResponse(w, http.StatusInternalServerError, errors.New("failed to create archive"))
-		return
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to create archive"))
+		return nil, nil, entry, false
+	}
+
+	return zipFile, skipped, entry, true
+}
+
+// acquireBuild takes a slot to build or read an archive in, queueing behind
+// the builds already running. It writes the error response and returns
+// false when no slot is released in time.
+func (h *ArchiveHandler) acquireBuild(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	release, err := h.builds.Acquire(r.Context())
+	if errors.Is(err, services.ErrTooBusy) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusServiceUnavailable, services.ErrTooBusy)
+		return nil, false
+	}
+	if err != nil {
+		// The client went away while queued
+		return nil, false
+	}
+	return release, true
+}
+
+// archiveRecipients returns the public keys of the recipients[] form values
+func archiveRecipients(r *http.Request) []string {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.Value["recipients[]"]
+}
+
+// writeRecipientsError writes the response to invalid recipients and
+// returns false, or returns true when err is nil
+func (h *ArchiveHandler) writeRecipientsError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrEncryptionDisabled):
+		writeError(w, r, http.StatusForbidden, services.ErrEncryptionDisabled)
+	default:
+		writeError(w, r, http.StatusBadRequest, err)
+	}
+	return false
+}
+
+// parseArchiveRequest parses the uploaded files of an archive request,
+// flattening their names with flatten=true. With strict=false, invalid
+// files are left out and returned as skipped instead of failing the
+// request. It writes the error response and returns false on failure.
+func (h *ArchiveHandler) parseArchiveRequest(w http.ResponseWriter, r *http.Request, op string) ([]*entities.FileData, []entities.FileError, bool) {
+	if err := h.validateRequest(r, "multipart/form-data"); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	if err := r.ParseMultipartForm(maxTotalSize); err != nil {
+		if limit, ok := bodyTooLarge(err); ok {
+			writeBodyTooLarge(w, r, limit)
+			return nil, nil, false
+		}
+		h.log.Error("failed to parse multipart form",
+			"op", op,
+			"error", err,
+		)
+		writeError(w, r, http.StatusBadRequest, errors.New("failed to parse request"))
+		return nil, nil, false
+	}
+
+	var excludeHidden *bool
+	if value := r.FormValue("exclude_hidden"); value != "" {
+		exclude, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, errors.New("exclude_hidden must be true or false"))
+			return nil, nil, false
+		}
+		excludeHidden = &exclude
+	}
+
+	flatten := false
+	if value := r.FormValue("flatten"); value != "" {
+		var err error
+		if flatten, err = strconv.ParseBool(value); err != nil {
+			writeError(w, r, http.StatusBadRequest, errors.New("flatten must be true or false"))
+			return nil, nil, false
+		}
+	}
+
+	strict := true
+	if value := r.FormValue("strict"); value != "" {
+		var err error
+		if strict, err = strconv.ParseBool(value); err != nil {
+			writeError(w, r, http.StatusBadRequest, errors.New("strict must be true or false"))
+			return nil, nil, false
+		}
+	}
+	var skipped *[]entities.FileError
+	if !strict {
+		skipped = &[]entities.FileError{}
+	}
+
+	var (
+		files []*entities.FileData
+		err   error
+	)
+	if manifest := r.FormValue("manifest"); manifest != "" {
+		files, err = h.processManifest(r, manifest, excludeHidden, skipped)
+		if err != nil {
+			if !h.writeRemoteError(w, r, op, err) {
+				writeError(w, r, http.StatusBadRequest, err)
+			}
+			return nil, nil, false
+		}
+	} else {
+		files, err = h.processUploadedFiles(r, excludeHidden, skipped)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return nil, nil, false
+		}
+	}
+
+	if skipped == nil {
+		if flatten {
+			services.FlattenNames(files)
+		}
+		return files, nil, true
+	}
+
+	// Files are screened before their names are flattened, so the errors
+	// name them as they were uploaded
+	files, screened := h.service.ScreenFiles(files)
+	*skipped = append(*skipped, screened...)
+	if len(files) == 0 {
+		writeErrorDetails(w, r, http.StatusBadRequest, ErrNoValidFiles, *skipped)
+		return nil, nil, false
+	}
+	if flatten {
+		services.FlattenNames(files)
+	}
+
+	return files, *skipped, true
+}
+
+// processManifest returns the files laid out by a JSON archive manifest,
+// whose entries refer to the uploaded files by part name, without the
+// hidden files excluded. Invalid files are appended to skipped when it is
+// not nil, instead of failing.
+func (h *ArchiveHandler) processManifest(r *http.Request, raw string, excludeHidden *bool, skipped *[]entities.FileError) ([]*entities.FileData, error) {
+	var manifest entities.ArchiveManifest
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", services.ErrInvalidManifest, err)
+	}
+	if h.maxFiles > 0 && len(manifest.Entries) > h.maxFiles {
+		return nil, fmt.Errorf("%w: %d entries listed, at most %d are accepted per request", ErrTooManyFiles, len(manifest.Entries), h.maxFiles)
+	}
+
+	var totalSize int64
+	parts := make(map[string]*entities.FileData, len(r.MultipartForm.File))
+	for name, headers := range r.MultipartForm.File {
+		fileHeader := headers[0]
+		totalSize += fileHeader.Size
+		if totalSize > maxTotalSize {
+			return nil, ErrTotalSizeTooLarge
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %s: %w", fileHeader.Filename, err)
+		}
+		context.AfterFunc(r.Context(), func() { file.Close() })
+
+		parts[name] = &entities.FileData{
+			Name:     fileHeader.Filename,
+			Reader:   file,
+			Length:   fileHeader.Size,
+			MIMEType: mime.TypeByExtension(filepath.Ext(fileHeader.Filename)),
+			SkipScan: skipScan(r),
+		}
+	}
+
+	resolved, err := h.service.ResolveManifest(r.Context(), &manifest, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*entities.FileData, 0, len(resolved))
+	for _, file := range resolved {
+		if h.service.IsExcluded(file.Name, excludeHidden) {
+			continue
+		}
+		if err := checkUploadedFile(r, file); err != nil {
+			if skipped == nil {
+				return nil, err
+			}
+			*skipped = append(*skipped, services.NewFileError(file.Name, err))
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 && (skipped == nil || len(*skipped) == 0) {
+		return nil, ErrOnlyHiddenFiles
 	}
 
-	h.writeFileResponse(w, zipFile)
+	return files, nil
+}
+
+// partialStatus returns status, or 207 Multi-Status when some files were
+// skipped
+func partialStatus(status int, skipped []entities.FileError) int {
+	if len(skipped) > 0 {
+		return http.StatusMultiStatus
+	}
+	return status
 }
 
-// processUploadedFiles processes uploaded files and returns FileData slice
-func (h *ArchiveHandler) processUploadedFiles(r *http.Request) ([]*entities.FileData, error) {
+// checkUploadedFile checks a file to be archived against the tenant of the
+// request
+func checkUploadedFile(r *http.Request, file *entities.FileData) error {
+	if err := file.Validate(); err != nil {
+		return fmt.Errorf("invalid file %s: %w", file.Name, err)
+	}
+	if !requestTenant(r).AllowsMIMEType(file.MIMEType) {
+		return fmt.Errorf("invalid file %s: %w", file.Name, services.ErrFileTypeNotAllowed)
+	}
+	return nil
+}
+
+// writePolicyError writes the violated rules when err is a password policy
+// error and reports whether it did
+func (h *ArchiveHandler) writePolicyError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	writeErrorDetails(w, r, http.StatusBadRequest, services.ErrWeakPassword, policyErr.Violations)
+	return true
+}
+
+// processUploadedFiles processes uploaded files and returns FileData slice,
+// without the hidden files excluded. The files are streamed from the parsed
+// form rather than copied, and stay open until the request is done. Invalid
+// files are appended to skipped when it is not nil, instead of failing.
+func (h *ArchiveHandler) processUploadedFiles(r *http.Request, excludeHidden *bool, skipped *[]entities.FileError) ([]*entities.FileData, error) {
 	formFiles := r.MultipartForm.File["files[]"]
 	if len(formFiles) == 0 {
 		return nil, ErrNoFiles
 	}
+	if h.maxFiles > 0 && len(formFiles) > h.maxFiles {
+		return nil, fmt.Errorf("%w: %d files uploaded, at most %d are accepted per request", ErrTooManyFiles, len(formFiles), h.maxFiles)
+	}
 
 	var totalSize int64
 	files := make([]*entities.FileData, 0, len(formFiles))
@@ -147,30 +761,42 @@ func (h *ArchiveHandler) processUploadedFiles(r *http.Request) ([]*entities.File
 		if totalSize > maxTotalSize {
 			return nil, ErrTotalSizeTooLarge
 		}
-
-		file, err := fileHeader.Open()
-		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s: %w", fileHeader.Filename, err)
+		if h.service.IsExcluded(fileHeader.Filename, excludeHidden) {
+			continue
 		}
-		defer file.Close()
 
-		content, err := io.ReadAll(file)
+		file, err := fileHeader.Open()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s: %w", fileHeader.Filename, err)
+			err = fmt.Errorf("failed to open file %s: %w", fileHeader.Filename, err)
+			if skipped == nil {
+				return nil, err
+			}
+			*skipped = append(*skipped, entities.FileError{File: fileHeader.Filename, Code: entities.FileErrorUnreadable, Error: err.Error()})
+			continue
 		}
+		context.AfterFunc(r.Context(), func() { file.Close() })
 
 		fileData := &entities.FileData{
 			Name:     fileHeader.Filename,
-			Content:  content,
+			Reader:   file,
+			Length:   fileHeader.Size,
 			MIMEType: mime.TypeByExtension(filepath.Ext(fileHeader.Filename)),
+			SkipScan: skipScan(r),
 		}
 
-		if err := fileData.Validate(); err != nil {
-			return nil, fmt.Errorf("invalid file %s: %w", fileHeader.Filename, err)
+		if err := checkUploadedFile(r, fileData); err != nil {
+			if skipped == nil {
+				return nil, err
+			}
+			*skipped = append(*skipped, services.NewFileError(fileData.Name, err))
+			continue
 		}
 
 		files = append(files, fileData)
 	}
+	if len(files) == 0 && (skipped == nil || len(*skipped) == 0) {
+		return nil, ErrOnlyHiddenFiles
+	}
 
 	return files, nil
 }
@@ -200,21 +826,16 @@ func (h *ArchiveHandler) writeJSONResponse(w http.ResponseWriter, status int, da
 	}
 }
 
-// writeErrorResponse writes an error response
-func (h *ArchiveHandler) writeErrorResponse(w http.ResponseWriter, status int, err error) {
-	response := Response{
-		Success: false,
-		Error:   err.Error(),
-	}
-	h.writeJSONResponse(w, status, response)
-}
-
-// writeFileResponse writes a file response
-func (h *ArchiveHandler) writeFileResponse(w http.ResponseWriter, file *entities.FileData) {
+// writeFileResponse writes a file response with status
+func (h *ArchiveHandler) writeFileResponse(w http.ResponseWriter, status int, file *entities.FileData) {
 	w.Header().Set("Content-Type", file.MIMEType)
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(file.Content)))
+	if len(file.Signature) > 0 {
+		setSignatureHeaders(w, base64.StdEncoding.EncodeToString(file.Signature), file.SignatureAlgorithm)
+	}
 
+	w.WriteHeader(status)
 	if _, err := w.Write(file.Content); err != nil {
 		h.log.Error("failed to write file response",
 			"error", err,
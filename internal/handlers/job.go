@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+// apiKeyHeader carries the API key of the client, used to attribute jobs
+const apiKeyHeader = "X-API-Key"
+
+// JobHandler handles requests for asynchronous jobs.
+type JobHandler struct {
+	jobs *services.JobManager
+	log  *slog.Logger
+}
+
+// NewJobHandler creates a new JobHandler instance.
+func NewJobHandler(jobs *services.JobManager, log *slog.Logger) (*JobHandler, error) {
+	if jobs == nil {
+		return nil, errors.New("job manager is nil")
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &JobHandler{jobs: jobs, log: log}, nil
+}
+
+// List handles requests to list jobs. Supported query parameters are status,
+// type, created_after, created_before (RFC 3339), api_key, limit and offset.
+func (h *JobHandler) List(w http.ResponseWriter, r *http.Request) {
+	const op = "JobHandler.List"
+
+	filter, err := parseJobFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	filter.TenantID = tenantID(r)
+
+	page, err := h.jobs.List(filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidJobFilter) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		h.log.Error("failed to list jobs", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to list jobs"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: newJobPageView(page)})
+}
+
+// Get handles requests for the state of a single job
+func (h *JobHandler) Get(w http.ResponseWriter, r *http.Request) {
+	const op = "JobHandler.Get"
+
+	job, err := h.getJob(r)
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrJobNotFound)
+			return
+		}
+		h.log.Error("failed to get job", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to get job"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: job, Links: jobLinks(job)})
+}
+
+// Retry handles requests to requeue a failed job
+func (h *JobHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	const op = "JobHandler.Retry"
+
+	job, err := h.getJob(r)
+	if err == nil {
+		job, err = h.jobs.Retry(job.ID)
+	}
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		writeError(w, r, http.StatusNotFound, services.ErrJobNotFound)
+		return
+	case errors.Is(err, services.ErrJobNotRetryable), errors.Is(err, services.ErrRetryLimit):
+		writeError(w, r, http.StatusConflict, err)
+		return
+	case err != nil:
+		h.log.Error("failed to retry job", "op", op, "error", err)
+		writeError(w, r, http.StatusServiceUnavailable, errors.New("failed to requeue job"))
+		return
+	}
+
+	writeJobAccepted(w, job, nil)
+}
+
+// getJob returns the job named by the request path. Jobs of other tenants
+// are not found.
+func (h *JobHandler) getJob(r *http.Request) (*entities.Job, error) {
+	job, err := h.jobs.Get(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant := tenantID(r); tenant != "" && job.TenantID != tenant {
+		return nil, services.ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+// parseJobFilter reads the job filter from the query string
+func parseJobFilter(r *http.Request) (entities.JobFilter, error) {
+	q := r.URL.Query()
+
+	filter := entities.JobFilter{
+		Status:   entities.JobStatus(q.Get("status")),
+		Type:     entities.JobType(q.Get("type")),
+		APIKeyID: utils.KeyID(q.Get("api_key")),
+	}
+
+	switch filter.Status {
+	case "", entities.JobStatusQueued, entities.JobStatusRunning, entities.JobStatusSucceeded, entities.JobStatusFailed:
+	default:
+		return filter, fmt.Errorf("invalid status: %s", filter.Status)
+	}
+
+	switch filter.Type {
+	case "", entities.JobTypeArchive, entities.JobTypeMail, entities.JobTypeInformation:
+	default:
+		return filter, fmt.Errorf("invalid type: %s", filter.Type)
+	}
+
+	for name, dst := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = t
+		}
+	}
+
+	for name, dst := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+
+	return filter, nil
+}
+
+// writeJobAccepted responds to a request that was turned into a job. fields
+// are added to the response data.
+func writeJobAccepted(w http.ResponseWriter, job *entities.Job, fields map[string]any) {
+	data := map[string]any{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": "/jobs/" + job.ID,
+	}
+	for name, value := range fields {
+		data[name] = value
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	WriteJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Data:    data,
+		Links:   jobLinks(job),
+	})
+}
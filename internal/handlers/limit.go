@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// multipartOverhead is the room left above the file size limits of uploads
+// for the multipart encoding and the other form fields
+const multipartOverhead = 1 << 20 // 1 MB
+
+// Request body limits of the routes, applied by LimitBody
+const (
+	InformationBodyLimit = maxFileSize + multipartOverhead
+	ArchiveBodyLimit     = maxTotalSize + multipartOverhead
+	MailBodyLimit        = maxTotalSize + multipartOverhead
+	AdminBodyLimit       = 1 << 10 // 1 KB
+	DefaultBodyLimit     = 1 << 20 // 1 MB
+)
+
+// InformationUploadLimit returns the request body limit of
+// /api/archive/information, which follows the largest archive inspected
+func InformationUploadLimit(cfg *config.ArchiveInformationConfig) int64 {
+	return informationMaxFileSize(cfg) + multipartOverhead
+}
+
+// bodyLimitDetails is the data of the response to a request body over its limit
+type bodyLimitDetails struct {
+	LimitBytes int64 `json:"limit_bytes"`
+}
+
+// LimitBody returns a handler that rejects requests declaring a body larger
+// than limit bytes before next runs, and stops next from reading more than
+// limit bytes of a body of unknown length
+func LimitBody(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			writeBodyTooLarge(w, r, limit)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReserveTemp returns a middleware answering large uploads that do not fit
+// in the temp space budget with 507 Insufficient Storage. Bodies of unknown
+// length are reserved at limit, their largest size. Files the upload was
+// spooled to are removed once the request is handled, as the server only
+// removes those of the request it created itself.
+func ReserveTemp(space *services.TempSpace, limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			size := r.ContentLength
+			if size < 0 {
+				size = limit
+			}
+
+			release, err := space.Reserve(size)
+			if errors.Is(err, services.ErrTempSpaceExhausted) {
+				w.Header().Set("Retry-After", "60")
+				writeError(w, r, http.StatusInsufficientStorage, services.ErrTempSpaceExhausted)
+				return
+			}
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, errors.New("failed to check temporary storage"))
+				return
+			}
+			defer release()
+			defer func() {
+				if r.MultipartForm != nil {
+					r.MultipartForm.RemoveAll()
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyTooLarge returns the limit of the request body when err was caused by
+// reading past it
+func bodyTooLarge(err error) (int64, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return 0, false
+	}
+	return maxBytesErr.Limit, true
+}
+
+// writeBodyTooLarge writes the response to a request body over limit bytes
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	writeErrorDetails(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, bodyLimitDetails{LimitBytes: limit})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// Links names the URLs a client can follow from a response, such as the
+// status of a job or the download of an archive, so it needs no URL
+// templates of its own. URLs are relative to the API root.
+type Links map[string]string
+
+// archiveLinks returns the links of a stored archive. share is the link to
+// hand out: downloads need no API key, only the passphrase of protected
+// archives.
+func archiveLinks(id string) Links {
+	download := "/archives/" + id + "/download"
+	return Links{
+		"download": download,
+		"share":    download,
+		"accesses": "/archives/" + id + "/accesses",
+	}
+}
+
+// jobLinks returns the links of a job: its status, its retry while it
+// failed, and the archive a succeeded archive job stored
+func jobLinks(job *entities.Job) Links {
+	links := Links{"self": "/jobs/" + job.ID}
+
+	switch job.Status {
+	case entities.JobStatusFailed:
+		links["retry"] = "/jobs/" + job.ID + "/retry"
+	case entities.JobStatusSucceeded:
+		var result entities.ArchiveJobResult
+		if job.Type == entities.JobTypeArchive && json.Unmarshal(job.Result, &result) == nil && result.ArchiveID != "" {
+			for name, link := range archiveLinks(result.ArchiveID) {
+				links[name] = link
+			}
+		}
+	}
+
+	return links
+}
+
+// jobView is a job listed with its links
+type jobView struct {
+	*entities.Job
+	Links Links `json:"links"`
+}
+
+// jobPageView is a page of jobs listed with their links
+type jobPageView struct {
+	Jobs   []jobView `json:"jobs"`
+	Total  int       `json:"total"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
+
+// newJobPageView adds the links of every job of page
+func newJobPageView(page *entities.JobPage) jobPageView {
+	jobs := make([]jobView, len(page.Jobs))
+	for i, job := range page.Jobs {
+		jobs[i] = jobView{Job: job, Links: jobLinks(job)}
+	}
+	return jobPageView{Jobs: jobs, Total: page.Total, Limit: page.Limit, Offset: page.Offset}
+}
@@ -1,26 +1,86 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
 	"github.com/ab-dauletkhan/doozip/internal/services"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
 )
 
+// maxBatchItems limits the number of messages accepted in a single batch request
+const maxBatchItems = 50
+
+var (
+	// ErrInvalidBatchFiles refuses a strict batch referring to invalid files
+	ErrInvalidBatchFiles = errors.New("batch refers to invalid files")
+
+	// ErrInvalidMimeTypeOverride refuses a mime_type field that isn't a MIME type
+	ErrInvalidMimeTypeOverride = errors.New("invalid mime_type")
+	// ErrMimeTypeMismatch refuses a mime_type field the content contradicts
+	ErrMimeTypeMismatch = errors.New("mime_type does not match the file content")
+
+	// ErrRecipientsRequired refuses mail without emails or a group
+	ErrRecipientsRequired = errors.New("emails or group are required")
+
+	ErrUploadTooLarge   = errors.New("file exceeds the upload size limit")
+	ErrIncompleteUpload = errors.New("file was not received whole")
+	ErrInvalidChecksum  = errors.New("sha256 must be 64 hexadecimal characters")
+	ErrChecksumMismatch = errors.New("file does not match its sha256")
+)
+
+// batchMailRequest describes a single batch item as submitted by the client.
+// File references the name of a multipart part carrying the attachment.
+type batchMailRequest struct {
+	Recipients []string `json:"recipients"`
+	File       string   `json:"file"`
+	Subject    string   `json:"subject"`
+	// SHA256 is the hex encoded hash the file must match, when set
+	SHA256 string `json:"sha256"`
+	// MIMEType overrides the type detected for the file, when set
+	MIMEType string `json:"mime_type"`
+}
+
+// batchMailResult is a batch item result as sent to the client, the only
+// one given the password of its zip archive
+type batchMailResult struct {
+	entities.MailBatchResult
+	ZipPassword string `json:"zip_password,omitempty"`
+}
+
 // MailHandler handles mail-related operations.
 type MailHandler struct {
 	service services.MailService
+	outbox  *services.Outbox
+	jobs    *services.JobManager
+	history *services.HistoryService
+	groups  *services.GroupService
+	upload  config.MailUploadConfig
 	log     *slog.Logger
 }
 
-// NewMailHandler creates a new MailHandler instance.
-func NewMailHandler(svc services.MailService, log *slog.Logger) *MailHandler {
-	return &MailHandler{service: svc, log: log}
+// NewMailHandler creates a new MailHandler instance. outbox and jobs are
+// optional and enable scheduled and asynchronous delivery; history is
+// optional and records every delivery; groups is optional and lets mail be
+// sent to a recipient group. upload limits the files uploaded.
+func NewMailHandler(svc services.MailService, outbox *services.Outbox, jobs *services.JobManager, history *services.HistoryService, groups *services.GroupService, upload config.MailUploadConfig, log *slog.Logger) *MailHandler {
+	return &MailHandler{service: svc, outbox: outbox, jobs: jobs, history: history, groups: groups, upload: upload, log: log}
 }
 
 // SendMail handles the mail sending request.
@@ -28,46 +88,622 @@ func (h *MailHandler) SendMail(w http.ResponseWriter, r *http.Request) {
 	const op = "MailHandler.SendMail"
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		if limit, ok := bodyTooLarge(err); ok {
+			writeBodyTooLarge(w, r, limit)
+			return
+		}
 		h.logError(op, "failed to parse multipart form", err)
-		WriteError(w, http.StatusBadRequest, "failed to parse multipart form")
+		writeError(w, r, http.StatusBadRequest, errors.New("failed to parse multipart form"))
+		return
+	}
+
+	if batch := r.FormValue("batch"); batch != "" {
+		h.sendBatch(w, r, batch)
 		return
 	}
 
 	file, fileHeader, err := r.FormFile("file")
 	if err != nil {
 		h.logError(op, "file is required", err)
-		WriteError(w, http.StatusBadRequest, "file is required")
+		writeError(w, r, http.StatusBadRequest, errors.New("file is required"))
 		return
 	}
 	defer file.Close()
 
-	if err := h.validateFileType(fileHeader.Filename); err != nil {
-		h.logError(op, "invalid file type", err)
-		WriteError(w, http.StatusBadRequest, err.Error())
+	mailList, err := h.recipients(r)
+	if err != nil {
+		h.logError(op, "invalid recipients", err)
+		if errors.Is(err, ErrRecipientsRequired) || errors.Is(err, services.ErrGroupNotFound) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to resolve recipient group"))
 		return
 	}
 
-	mailList := h.getMailList(r.FormValue("emails"))
-	if len(mailList) == 0 {
-		h.logError(op, "emails are required", nil)
-		WriteError(w, http.StatusBadRequest, "emails are required")
+	subject, body := r.FormValue("subject"), r.FormValue("body")
+	if strings.ContainsAny(subject, "\r\n") {
+		writeError(w, r, http.StatusBadRequest, errors.New("subject cannot contain line breaks"))
 		return
 	}
 
-	content, err := h.readFileContent(file, fileHeader.Size)
+	sendAt, err := parseSendAt(r.FormValue("send_at"))
+	if err != nil {
+		h.logError(op, "invalid send_at", err)
+		writeError(w, r, http.StatusBadRequest, errors.New("send_at must be an RFC 3339 timestamp"))
+		return
+	}
+
+	content, err := readUpload(file, fileHeader, h.upload.MaxFileSize, r.FormValue("sha256"))
 	if err != nil {
 		h.logError(op, "failed to read file", err)
-		WriteError(w, http.StatusInternalServerError, "failed to read file")
+		if isUploadError(err) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to read file"))
+		return
+	}
+
+	mimeType, err := h.attachmentType(r, fileHeader.Filename, r.FormValue("mime_type"), content)
+	if err != nil {
+		h.logError(op, "invalid file type", err)
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	pgpKeys, err := readPGPKeys(r)
+	if err != nil {
+		h.logError(op, "invalid pgp key", err)
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	zip, ok := h.attachmentZip(w, r)
+	if !ok {
+		return
+	}
+
+	if !sendAt.IsZero() {
+		h.scheduleMail(w, r, mailList, subject, body, fileHeader.Filename, mimeType, content, pgpKeys, zip, sendAt)
+		return
+	}
+
+	msg := &entities.MailMessage{
+		From: mailFrom(r),
+		To:   mailList,
+		Attachments: []*entities.Attachment{{
+			File: &entities.FileData{
+				Name:     fileHeader.Filename,
+				Content:  content,
+				MIMEType: mimeType,
+				SkipScan: skipScan(r),
+			},
+		}},
+		PGPKeys:  pgpKeys,
+		Zip:      zip,
+		TenantID: tenantID(r),
+	}
+
+	if templateName := r.FormValue("template"); templateName != "" {
+		inline, err := h.readInlineAttachments(r)
+		if err != nil {
+			h.logError(op, "invalid inline attachment", err)
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		msg.Attachments = append(msg.Attachments, inline...)
+
+		if err := h.service.ApplyTemplate(msg, templateName); err != nil {
+			h.logError(op, "failed to apply template", err)
+			if errors.Is(err, services.ErrTemplateNotFound) || errors.Is(err, services.ErrTemplatesDisabled) {
+				writeError(w, r, http.StatusBadRequest, err)
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, errors.New("failed to render template"))
+			return
+		}
+	}
+	// The fields of the request override the template and the defaults
+	if subject != "" {
+		msg.Subject = subject
+	}
+	if body != "" {
+		msg.Text, msg.HTML = body, ""
+	}
+
+	if r.FormValue("async") == "true" {
+		h.submitMailJob(w, r, msg)
+		return
+	}
+
+	entry := services.NewUploadEntry(entities.UploadKindMail, tenantID(r), r.Header.Get(apiKeyHeader), []*entities.FileData{msg.Attachments[0].File})
+	entry.Recipients = len(mailList)
+
+	start := time.Now()
+	report, err := h.service.DeliverMessage(msg)
+	deliveryErr := err
+	if err == nil && report.Sent == 0 && report.Failed > 0 {
+		deliveryErr = fmt.Errorf("%w: delivery failed for all %d recipients", services.ErrMailSendFailed, report.Failed)
+	}
+	metrics.ObserveMailSend(string(entities.UploadKindMail), time.Since(start), deliveryErr)
+	h.history.Record(entry, deliveryErr)
+	if err != nil {
+		if errors.Is(err, services.ErrOutboxUnavailable) {
+			h.logError(op, "failed to store mail", err)
+			writeError(w, r, http.StatusServiceUnavailable, services.ErrOutboxUnavailable)
+			return
+		}
+		h.logError(op, "invalid mail message", err)
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	h.writeReport(w, r, op, report, zipPasswordField(zip))
+}
+
+// GetMessage handles requests for the delivery state of a message kept in
+// the outbox
+func (h *MailHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	const op = "MailHandler.GetMessage"
+
+	entry, err := h.outboxEntry(r)
+	if err != nil {
+		if errors.Is(err, services.ErrOutboxEntryNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrOutboxEntryNotFound)
+			return
+		}
+		h.logError(op, "failed to get message", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to get message"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: entry})
+}
+
+// Resend handles requests to deliver a message kept in the outbox again
+func (h *MailHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	const op = "MailHandler.Resend"
+
+	entry, err := h.outboxEntry(r)
+	if err != nil {
+		if errors.Is(err, services.ErrOutboxEntryNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrOutboxEntryNotFound)
+			return
+		}
+		h.logError(op, "failed to get message", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to get message"))
+		return
+	}
+
+	history := services.NewUploadEntry(entities.UploadKindMail, tenantID(r), r.Header.Get(apiKeyHeader), nil)
+	history.Recipients = len(entry.Recipients)
+
+	start := time.Now()
+	report, err := h.service.Resend(entry.ID)
+	switch {
+	case errors.Is(err, services.ErrOutboxEntryNotFound):
+		writeError(w, r, http.StatusNotFound, services.ErrOutboxEntryNotFound)
+		return
+	case errors.Is(err, services.ErrOutboxEntrySending):
+		writeError(w, r, http.StatusConflict, services.ErrOutboxEntrySending)
+		return
+	}
+
+	deliveryErr := err
+	if err == nil && report.Sent == 0 && report.Failed > 0 {
+		deliveryErr = fmt.Errorf("%w: delivery failed for all %d recipients", services.ErrMailSendFailed, report.Failed)
+	}
+	metrics.ObserveMailSend(string(entities.UploadKindMail), time.Since(start), deliveryErr)
+	h.history.Record(history, deliveryErr)
+	if err != nil {
+		h.logError(op, "failed to resend mail", err)
+		if errors.Is(err, services.ErrNoPGPKey) || errors.Is(err, services.ErrInvalidPGPKey) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to resend mail"))
+		return
+	}
+
+	h.writeReport(w, r, op, report, nil)
+}
+
+// outboxEntry returns the outbox entry named by the request path. Messages
+// of other tenants are not found.
+func (h *MailHandler) outboxEntry(r *http.Request) (*entities.OutboxEntry, error) {
+	entry, err := h.service.OutboxEntry(r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant := tenantID(r); tenant != "" && entry.TenantID != tenant {
+		return nil, services.ErrOutboxEntryNotFound
+	}
+
+	return entry, nil
+}
+
+// writeReport writes the outcome of a delivery: 200 when every recipient got
+// the message, 207 when some did and 500 when none did. The Location header
+// names the outbox entry of the message, from which it can be resent.
+func (h *MailHandler) writeReport(w http.ResponseWriter, r *http.Request, op string, report *entities.DeliveryReport, fields map[string]any) {
+	if report.ID != "" {
+		w.Header().Set("Location", "/mail/"+report.ID)
+	}
+
+	switch {
+	case report.Failed == 0:
+		response := map[string]any{
+			"message":    "Emails sent successfully.",
+			"recipients": report.Recipients,
+			"sent":       report.Sent,
+		}
+		if report.Suppressed > 0 {
+			response["suppressed"] = report.Suppressed
+		}
+		if report.ID != "" {
+			response["id"] = report.ID
+		}
+		if report.Parts > 0 {
+			response["parts"] = report.Parts
+		}
+		for name, value := range fields {
+			response[name] = value
+		}
+		WriteJSON(w, http.StatusOK, response)
+	case report.Sent == 0:
+		h.logError(op, "failed to send mail", errors.New(report.Recipients[0].Error))
+		writeErrorDetails(w, r, http.StatusInternalServerError, errors.New("failed to send mail"), report.Recipients)
+	default:
+		h.logError(op, fmt.Sprintf("failed to send mail to %d of %d recipients", report.Failed, len(report.Recipients)), nil)
+		writeErrorDetails(w, r, http.StatusMultiStatus,
+			fmt.Errorf("failed to send mail to %d of %d recipients", report.Failed, len(report.Recipients)), report.Recipients)
+	}
+}
+
+// readPGPKeys reads the "pgp_keys[]" parts, public keys of recipients to
+// encrypt the attachments to
+func readPGPKeys(r *http.Request) ([][]byte, error) {
+	headers := r.MultipartForm.File["pgp_keys[]"]
+	keys := make([][]byte, 0, len(headers))
+
+	for _, fileHeader := range headers {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pgp key %s: %w", fileHeader.Filename, err)
+		}
+
+		key, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pgp key %s: %w", fileHeader.Filename, err)
+		}
+		if _, err := services.ParsePGPKeys(key); err != nil {
+			return nil, fmt.Errorf("pgp key %s: %w", fileHeader.Filename, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// readInlineAttachments reads the "inline[]" parts, which the HTML body of a
+// template references by filename (e.g. <img src="cid:logo.png">)
+func (h *MailHandler) readInlineAttachments(r *http.Request) ([]*entities.Attachment, error) {
+	headers := r.MultipartForm.File["inline[]"]
+	attachments := make([]*entities.Attachment, 0, len(headers))
+
+	for _, fileHeader := range headers {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open inline file %s: %w", fileHeader.Filename, err)
+		}
+
+		content, err := readUpload(file, fileHeader, h.upload.MaxInlineSize, "")
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inline file %s: %w", fileHeader.Filename, err)
+		}
+
+		mimeType := mime.TypeByExtension(filepath.Ext(fileHeader.Filename))
+		if !requestTenant(r).AllowsMIMEType(mimeType) {
+			return nil, fmt.Errorf("inline file %s: %w", fileHeader.Filename, services.ErrFileTypeNotAllowed)
+		}
+
+		attachments = append(attachments, &entities.Attachment{
+			File: &entities.FileData{
+				Name:     fileHeader.Filename,
+				Content:  content,
+				MIMEType: mimeType,
+				SkipScan: skipScan(r),
+			},
+			Inline:    true,
+			ContentID: fileHeader.Filename,
+		})
+	}
+
+	return attachments, nil
+}
+
+// submitMailJob delivers the message in a background job and responds with the job id
+func (h *MailHandler) submitMailJob(w http.ResponseWriter, r *http.Request, msg *entities.MailMessage) {
+	const op = "MailHandler.submitMailJob"
+
+	if h.jobs == nil {
+		writeError(w, r, http.StatusNotImplemented, errors.New("asynchronous delivery is not available"))
+		return
+	}
+
+	// The job input is stored, so the zip password is sealed rather than put in it
+	if err := h.service.SealZip(r.Context(), msg.Zip); err != nil {
+		h.logError(op, "failed to seal zip password", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to queue mail job"))
+		return
+	}
+
+	job, err := h.jobs.Submit(entities.JobTypeMail, tenantID(r), r.Header.Get(apiKeyHeader), msg)
+	if err != nil {
+		h.logError(op, "failed to submit mail job", err)
+		writeError(w, r, http.StatusServiceUnavailable, errors.New("failed to queue mail job"))
+		return
+	}
+	metrics.MailQueued("job")
+
+	writeJobAccepted(w, job, zipPasswordField(msg.Zip))
+}
+
+// scheduleMail queues the message in the outbox for delivery at sendAt
+func (h *MailHandler) scheduleMail(w http.ResponseWriter, r *http.Request, to []string, subject, body, filename, mimeType string, content []byte, pgpKeys [][]byte, zip *entities.AttachmentZip, sendAt time.Time) {
+	const op = "MailHandler.scheduleMail"
+
+	if h.outbox == nil {
+		writeError(w, r, http.StatusNotImplemented, errors.New("scheduled delivery is not available"))
 		return
 	}
 
-	if err := h.service.SendMail(mailList, fileHeader.Filename, mime.TypeByExtension(filepath.Ext(fileHeader.Filename)), content); err != nil {
-		h.logError(op, "failed to send mail", err)
-		WriteError(w, http.StatusInternalServerError, "failed to send mail")
+	msg, err := h.outbox.Schedule(&entities.OutboxMessage{
+		From:    mailFrom(r),
+		To:      to,
+		Subject: subject,
+		Body:    body,
+		File: &entities.FileData{
+			Name:     filename,
+			Content:  content,
+			MIMEType: mimeType,
+			SkipScan: skipScan(r),
+		},
+		PGPKeys:  pgpKeys,
+		Zip:      zip,
+		TenantID: tenantID(r),
+		SendAt:   sendAt,
+	})
+	if err != nil {
+		h.logError(op, "failed to schedule mail", err)
+		if errors.Is(err, services.ErrSendAtInPast) {
+			writeError(w, r, http.StatusBadRequest, services.ErrSendAtInPast)
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, errors.New("failed to schedule mail"))
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]string{"message": "Emails sent successfully."})
+	response := map[string]any{
+		"message": "Email scheduled successfully.",
+		"id":      msg.ID,
+		"send_at": msg.SendAt.Format(time.RFC3339),
+	}
+	for name, value := range zipPasswordField(zip) {
+		response[name] = value
+	}
+	WriteJSON(w, http.StatusAccepted, response)
+}
+
+// zipPasswordHeader carries the password of an encrypted zip archive
+const zipPasswordHeader = "X-Zip-Password"
+
+// attachmentZip reads the optional zip and zip_encrypt fields into the zip
+// options of the message. It writes the error response and returns false
+// on failure.
+func (h *MailHandler) attachmentZip(w http.ResponseWriter, r *http.Request) (*entities.AttachmentZip, bool) {
+	var choices [2]*bool
+	for i, name := range []string{"zip", "zip_encrypt"} {
+		value := r.FormValue(name)
+		if value == "" {
+			continue
+		}
+		choice, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("%s must be true or false", name))
+			return nil, false
+		}
+		choices[i] = &choice
+	}
+
+	zip, err := h.service.AttachmentZip(choices[0], choices[1])
+	switch {
+	case errors.Is(err, services.ErrEncryptionDisabled):
+		writeError(w, r, http.StatusForbidden, services.ErrEncryptionDisabled)
+		return nil, false
+	case errors.Is(err, services.ErrZipUnavailable):
+		writeError(w, r, http.StatusNotImplemented, services.ErrZipUnavailable)
+		return nil, false
+	case err != nil:
+		h.logError("MailHandler.attachmentZip", "failed to prepare zip", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to prepare zip"))
+		return nil, false
+	}
+
+	// Also carried by error responses, as some recipients may have received the archive
+	if zip != nil && zip.Password != "" {
+		w.Header().Set(zipPasswordHeader, zip.Password)
+	}
+
+	return zip, true
+}
+
+// zipPasswordField returns the response field carrying the password of an
+// encrypted zip archive, which is never sent with the message
+func zipPasswordField(zip *entities.AttachmentZip) map[string]any {
+	if zip == nil || zip.Password == "" {
+		return nil
+	}
+	return map[string]any{"zip_password": zip.Password}
+}
+
+// parseSendAt parses the optional send_at field, returning the zero time when absent
+func parseSendAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// sendBatch handles batch mode, where the "batch" form field carries a JSON array
+// of items and each item is sent independently of the others. With
+// strict=true, a batch referring to an invalid file is refused as a whole
+// before any item is sent.
+func (h *MailHandler) sendBatch(w http.ResponseWriter, r *http.Request, batch string) {
+	const op = "MailHandler.sendBatch"
+
+	strict := false
+	if value := r.FormValue("strict"); value != "" {
+		var err error
+		if strict, err = strconv.ParseBool(value); err != nil {
+			writeError(w, r, http.StatusBadRequest, errors.New("strict must be true or false"))
+			return
+		}
+	}
+
+	var requests []batchMailRequest
+	if err := json.Unmarshal([]byte(batch), &requests); err != nil {
+		h.logError(op, "invalid batch payload", err)
+		writeError(w, r, http.StatusBadRequest, errors.New("invalid batch payload"))
+		return
+	}
+
+	if len(requests) == 0 {
+		writeError(w, r, http.StatusBadRequest, errors.New("batch is empty"))
+		return
+	}
+	if len(requests) > maxBatchItems {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("batch exceeds the maximum of %d items", maxBatchItems))
+		return
+	}
+
+	results := make([]entities.MailBatchResult, len(requests))
+	items := make([]entities.MailBatchItem, 0, len(requests))
+	var invalid []entities.FileError
+
+	for i, req := range requests {
+		recipients := normalizeRecipients(req.Recipients)
+
+		fileData, err := h.resolveBatchFile(r, req.File, req.SHA256, req.MIMEType)
+		if err != nil {
+			fileErr := services.NewFileError(req.File, err)
+			invalid = append(invalid, fileErr)
+			results[i] = entities.MailBatchResult{
+				Index:      i,
+				Recipients: recipients,
+				File:       req.File,
+				Error:      fileErr.Error,
+				Code:       fileErr.Code,
+			}
+			continue
+		}
+
+		items = append(items, entities.MailBatchItem{
+			Index:      i,
+			Recipients: recipients,
+			Subject:    req.Subject,
+			File:       fileData,
+			From:       mailFrom(r),
+			TenantID:   tenantID(r),
+		})
+	}
+
+	if strict && len(invalid) > 0 {
+		writeErrorDetails(w, r, http.StatusBadRequest, ErrInvalidBatchFiles, invalid)
+		return
+	}
+
+	tenant, apiKey := tenantID(r), r.Header.Get(apiKeyHeader)
+	for _, result := range h.service.SendBatch(items) {
+		results[result.Index] = result
+	}
+	for _, item := range items {
+		entry := services.NewUploadEntry(entities.UploadKindMail, tenant, apiKey, []*entities.FileData{item.File})
+		entry.Recipients = len(item.Recipients)
+		var err error
+		result := results[item.Index]
+		if !result.Success {
+			err = errors.New(result.Error)
+		}
+		if result.Duration > 0 {
+			metrics.ObserveMailSend(string(entities.UploadKindMail), result.Duration, err)
+		}
+		h.history.Record(entry, err)
+	}
+
+	status := http.StatusOK
+	response := make([]batchMailResult, len(results))
+	for i, result := range results {
+		if !result.Success {
+			status = http.StatusMultiStatus
+		}
+		response[i] = batchMailResult{MailBatchResult: result, ZipPassword: result.ZipPassword}
+	}
+
+	WriteJSON(w, status, Response{Success: status == http.StatusOK, Data: response})
+}
+
+// resolveBatchFile reads the multipart part referenced by a batch item,
+// checking it against checksum when it is set
+func (h *MailHandler) resolveBatchFile(r *http.Request, name, checksum, mimeTypeOverride string) (*entities.FileData, error) {
+	if name == "" {
+		return nil, fmt.Errorf("file reference is required")
+	}
+
+	headers := r.MultipartForm.File[name]
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("file %q not found in request", name)
+	}
+	fileHeader := headers[0]
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", fileHeader.Filename, err)
+	}
+	defer file.Close()
+
+	content, err := readUpload(file, fileHeader, h.upload.MaxFileSize, checksum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", fileHeader.Filename, err)
+	}
+
+	mimeType, err := h.attachmentType(r, fileHeader.Filename, mimeTypeOverride, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.FileData{
+		Name:     fileHeader.Filename,
+		Content:  content,
+		MIMEType: mimeType,
+		SkipScan: skipScan(r),
+	}, nil
+}
+
+// normalizeRecipients trims whitespace and drops empty addresses
+func normalizeRecipients(recipients []string) []string {
+	normalized := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			normalized = append(normalized, recipient)
+		}
+	}
+	return normalized
 }
 
 func (h *MailHandler) logError(op, message string, err error) {
@@ -78,12 +714,67 @@ func (h *MailHandler) logError(op, message string, err error) {
 	}
 }
 
-func (h *MailHandler) validateFileType(filename string) error {
-	mimeType := mime.TypeByExtension(filepath.Ext(filename))
-	if mimeType == "" || (mimeType != "application/pdf" && mimeType != "application/vnd.openxmlformats-officedocument.wordprocessingml.document") {
-		return fmt.Errorf("invalid file type")
+// attachmentType returns the MIME type of an attachment: override when it
+// is set, or else the type detected from the content, falling back to the
+// one of the extension. An override must agree with the detected type. The
+// type must be one mail may carry and one the tenant allows.
+func (h *MailHandler) attachmentType(r *http.Request, filename, override string, content []byte) (string, error) {
+	detected := utils.DocumentType(content)
+
+	var mimeType string
+	switch {
+	case override != "":
+		parsed, _, err := mime.ParseMediaType(override)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidMimeTypeOverride, override)
+		}
+		if detected != "" && parsed != detected {
+			return "", fmt.Errorf("%w: %s is %s", ErrMimeTypeMismatch, filename, detected)
+		}
+		mimeType = parsed
+	case detected != "":
+		mimeType = detected
+	default:
+		mimeType, _, _ = mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(filename)))
 	}
-	return nil
+
+	if err := h.service.ValidateFileType(mimeType); err != nil {
+		return "", fmt.Errorf("invalid file type: %w", err)
+	}
+	if !requestTenant(r).AllowsMIMEType(mimeType) {
+		return "", services.ErrFileTypeNotAllowed
+	}
+	return mimeType, nil
+}
+
+// recipients returns the addresses of the emails field followed by those
+// of the recipient group named by the group field, without duplicates
+func (h *MailHandler) recipients(r *http.Request) ([]string, error) {
+	recipients := h.getMailList(r.FormValue("emails"))
+
+	if name := strings.TrimSpace(r.FormValue("group")); name != "" {
+		if h.groups == nil {
+			return nil, services.ErrGroupNotFound
+		}
+		group, err := h.groups.Get(tenantID(r), name)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(recipients))
+		for _, recipient := range recipients {
+			seen[strings.ToLower(entities.NormalizeAddress(recipient))] = true
+		}
+		for _, address := range group.Addresses {
+			if !seen[strings.ToLower(address)] {
+				recipients = append(recipients, address)
+			}
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil, ErrRecipientsRequired
+	}
+	return recipients, nil
 }
 
 func (h *MailHandler) getMailList(emails string) []string {
@@ -93,10 +784,48 @@ func (h *MailHandler) getMailList(emails string) []string {
 	return strings.Split(emails, ",")
 }
 
-func (h *MailHandler) readFileContent(file multipart.File, size int64) ([]byte, error) {
-	content := make([]byte, size)
-	if _, err := file.Read(content); err != nil {
+// readUpload reads the whole content of an uploaded file, refusing files
+// larger than limit bytes unless it is zero, files shorter than their
+// header declares and, when checksum is set, content whose SHA-256 differs
+// from it
+func readUpload(file multipart.File, header *multipart.FileHeader, limit int64, checksum string) ([]byte, error) {
+	var want []byte
+	if checksum != "" {
+		var err error
+		if want, err = hex.DecodeString(checksum); err != nil || len(want) != sha256.Size {
+			return nil, ErrInvalidChecksum
+		}
+	}
+	if limit > 0 && header.Size > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrUploadTooLarge, limit)
+	}
+
+	var reader io.Reader = file
+	if limit > 0 {
+		// One byte past the limit tells a file growing past it from one
+		// ending there
+		reader = io.LimitReader(file, limit+1)
+	}
+	hash := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(reader, hash))
+	if err != nil {
 		return nil, err
 	}
+	if limit > 0 && int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrUploadTooLarge, limit)
+	}
+	if int64(len(content)) != header.Size {
+		return nil, fmt.Errorf("%w: read %d of %d bytes", ErrIncompleteUpload, len(content), header.Size)
+	}
+	if want != nil && !bytes.Equal(hash.Sum(nil), want) {
+		return nil, ErrChecksumMismatch
+	}
 	return content, nil
 }
+
+// isUploadError reports whether err refuses an upload, rather than failing
+// to read it
+func isUploadError(err error) bool {
+	return errors.Is(err, ErrUploadTooLarge) || errors.Is(err, ErrIncompleteUpload) ||
+		errors.Is(err, ErrInvalidChecksum) || errors.Is(err, ErrChecksumMismatch)
+}
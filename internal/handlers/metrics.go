@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+)
+
+// RequestMetrics returns a handler that records the route, status and
+// duration of every request served by next, which must be the ServeMux or
+// one of its routes so the matched route is known once it returns
+func RequestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		counter := &countingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(counter, r)
+
+		metrics.ObserveRequest(r.Pattern, r.Method, counter.status, time.Since(start))
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// Middleware wraps a handler with behavior of its own
+type Middleware func(next http.Handler) http.Handler
+
+// Chain returns h wrapped by middlewares, the first of which runs first
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for _, middleware := range slices.Backward(middlewares) {
+		h = middleware(h)
+	}
+	return h
+}
+
+// Recover returns a middleware answering requests whose handler panics with
+// 500 Internal Server Error, logging the panic with its stack instead of
+// dropping the connection
+func Recover(log *slog.Logger) Middleware {
+	const op = "Recover"
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				// Handlers abort responses on purpose this way
+				if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(recovered)
+				}
+
+				log.Error("handler panicked",
+					"op", op,
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", recovered,
+					"stack", string(debug.Stack()),
+				)
+				writeError(w, r, http.StatusInternalServerError, errors.New("internal server error"))
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit returns a middleware answering clients over their limit with
+// 429 Too Many Requests. Clients are told apart by IP address.
+func RateLimit(limiter *services.RateLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status, err := limiter.Allow(clientIP(r))
+			setRateLimitHeaders(w, status, err != nil)
+			if err != nil {
+				writeError(w, r, http.StatusTooManyRequests, services.ErrRateLimited)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders tells the client the state of its limit in the
+// RateLimit headers and, when the request was refused, when to retry it in
+// Retry-After
+func setRateLimitHeaders(w http.ResponseWriter, status services.RateLimitStatus, refused bool) {
+	header := w.Header()
+	if status.Limit > 0 {
+		header.Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(max(0, status.Remaining)))
+		header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(status.Reset.Seconds()))))
+	}
+	if refused {
+		header.Set("Retry-After", retryAfter(status.RetryAfter))
+	}
+}
+
+// retryAfter returns the Retry-After value of a delay, in whole seconds
+// rounded up so clients do not retry too early
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(d.Seconds()))))
+}
+
+// ShedLoad returns a middleware answering requests with 503 Service
+// Unavailable and a Retry-After header while the shedder is overloaded.
+// Bodies of unknown length count at limit, their largest size.
+func ShedLoad(shedder *services.LoadShedder, limit int64) Middleware {
+	delay := retryAfter(shedder.RetryAfter())
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			size := r.ContentLength
+			if size < 0 {
+				size = limit
+			}
+
+			release, err := shedder.Admit(size)
+			if err != nil {
+				var shed *services.ShedError
+				if errors.As(err, &shed) {
+					metrics.RequestShed(shed.Reason)
+				}
+				w.Header().Set("Retry-After", delay)
+				writeError(w, r, http.StatusServiceUnavailable, services.ErrOverloaded)
+				return
+			}
+			defer release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORS returns a middleware allowing browsers on the origins of cfg to read
+// responses. It answers preflight requests itself, so it must run before the
+// request is routed for them to be seen.
+func CORS(cfg *config.CORSConfig) Middleware {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!anyOrigin && !slices.Contains(cfg.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Expose-Headers", "Content-Disposition, X-Archive-Skipped-Files, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				header.Set("Access-Control-Allow-Headers", allowedHeaders)
+				header.Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// trustedUploadContextKey marks requests whose uploads are not scanned
+type trustedUploadContextKey struct{}
+
+// TrustScans returns a middleware marking the uploads of requests with an
+// API key trusted by scans, which virus scanners then accept unread
+func TrustScans(scans *services.ScanCache) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scans != nil && scans.Trusts(r.Header.Get(apiKeyHeader)) {
+				r = r.WithContext(context.WithValue(r.Context(), trustedUploadContextKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// skipScan reports whether the uploads of the request are not scanned
+func skipScan(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedUploadContextKey{}).(bool)
+	return trusted
+}
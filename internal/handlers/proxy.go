@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPContextKey is the context key of the request's client IP
+type clientIPContextKey struct{}
+
+// ProxyMiddleware resolves the IP of the client behind trusted reverse
+// proxies. The forwarding headers of other peers are ignored, so clients
+// cannot choose the IP they are seen with.
+type ProxyMiddleware struct {
+	trusted []netip.Prefix
+}
+
+// NewProxyMiddleware creates a new ProxyMiddleware trusting the proxies in
+// the given CIDR ranges or single addresses
+func NewProxyMiddleware(trustedProxies []string) (*ProxyMiddleware, error) {
+	m := &ProxyMiddleware{trusted: make([]netip.Prefix, 0, len(trustedProxies))}
+	for _, proxy := range trustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		m.trusted = append(m.trusted, prefix)
+	}
+
+	return m, nil
+}
+
+// parsePrefix parses a CIDR range, treating a single address as a range of one
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Wrap returns a handler that runs next with the client IP in the request context
+func (m *ProxyMiddleware) Wrap(next http.Handler) http.Handler {
+	if len(m.trusted) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := m.resolve(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip)))
+	})
+}
+
+// resolve returns the client IP of a request. When the peer is a trusted
+// proxy, X-Forwarded-For is walked from the nearest hop back to the first
+// address not belonging to a trusted proxy; X-Real-IP is used without it.
+func (m *ProxyMiddleware) resolve(r *http.Request) string {
+	peer := remoteIP(r)
+	if !m.isTrusted(peer) {
+		return peer
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			client = hop
+			if !m.isTrusted(hop) {
+				break
+			}
+		}
+		return client
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+
+	return peer
+}
+
+// isTrusted reports whether ip belongs to a trusted proxy
+func (m *ProxyMiddleware) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range m.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns the IP address of the peer connected to the server
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
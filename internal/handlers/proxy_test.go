@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyMiddleware(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8::1"}
+
+	tests := []struct {
+		name string
+		// untrusting runs the middleware without trusted proxies
+		untrusting bool
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		expected   string
+	}{
+		{
+			name:       "No trusted proxies",
+			untrusting: true,
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Untrusted peer",
+			remoteAddr: "198.51.100.7:4000",
+			forwarded:  []string{"203.0.113.5"},
+			realIP:     "203.0.113.6",
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "Single proxy",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "Spoofed left-most entry",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"1.1.1.1, 203.0.113.5"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "Chain of trusted proxies",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"1.1.1.1, 203.0.113.5, 10.0.0.3, 10.0.0.2"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "Entries split across headers",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"1.1.1.1, 203.0.113.5", "10.0.0.2"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "All entries trusted",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "Malformed nearest entry",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5, not-an-ip"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Malformed entry behind the client",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"not-an-ip, 203.0.113.5"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "Malformed entry between trusted proxies",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5, garbage, 10.0.0.2"},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "Entry with a port",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5:1234"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Empty entry",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5,"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "IPv6 client behind IPv6 proxy",
+			remoteAddr: "[2001:db8::1]:4000",
+			forwarded:  []string{"2001:db8::42"},
+			expected:   "2001:db8::42",
+		},
+		{
+			name:       "IPv4-mapped trusted proxy",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5, ::ffff:10.0.0.2"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "X-Real-IP without X-Forwarded-For",
+			remoteAddr: "10.0.0.1:4000",
+			realIP:     "203.0.113.5",
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "X-Forwarded-For over X-Real-IP",
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.5"},
+			realIP:     "203.0.113.6",
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "Malformed X-Real-IP",
+			remoteAddr: "10.0.0.1:4000",
+			realIP:     "not-an-ip",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Peer address without port",
+			remoteAddr: "10.0.0.1",
+			forwarded:  []string{"203.0.113.5"},
+			expected:   "203.0.113.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if tt.untrusting {
+				proxies = nil
+			}
+			m, err := NewProxyMiddleware(proxies)
+			require.NoError(t, err)
+
+			var got string
+			handler := m.Wrap(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/mail/file", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestNewProxyMiddleware(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.1:80", ""} {
+		_, err := NewProxyMiddleware([]string{proxy})
+		assert.Error(t, err, proxy)
+	}
+}
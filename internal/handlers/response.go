@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"net/http"
 )
 
 // Response represents a standardized API response.
 type Response struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	XMLName xml.Name    `json:"-" xml:"response" yaml:"-"`
+	Success bool        `json:"success" xml:"success" yaml:"success"`
+	Data    interface{} `json:"data,omitempty" xml:"data,omitempty" yaml:"data,omitempty"`
+	Error   string      `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+	Links   Links       `json:"links,omitempty" xml:"-" yaml:"links,omitempty"`
 }
 
 // WriteJSON writes a successful JSON response.
@@ -24,7 +29,65 @@ func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Write(resp)
 }
 
-// WriteError writes an error JSON response.
-func WriteError(w http.ResponseWriter, status int, err string) {
-	WriteJSON(w, status, Response{Success: false, Error: err})
+// StatusError is the error of a failed request, answered with Status.
+// Details, when set, describe the failure, such as the rules a password
+// violated.
+type StatusError struct {
+	Status  int
+	Err     error
+	Details any
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler writes the response to a failed request. err is a
+// *StatusError with the status chosen by the route. Client errors wrap the
+// service error, such as services.ErrFileBlocked, so they can be told apart
+// with errors.Is; internal failures only carry a generic message.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+type errorHandlerContextKey struct{}
+
+// DefaultErrorHandler writes err as a JSON Response with the message of err
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	var details any
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		status = statusErr.Status
+		details = statusErr.Details
+	}
+
+	WriteJSON(w, status, Response{Success: false, Error: err.Error(), Data: details})
+}
+
+// HandleErrors returns a middleware making h write the error responses of
+// the requests it wraps, instead of DefaultErrorHandler
+func HandleErrors(h ErrorHandler) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), errorHandlerContextKey{}, h)))
+		})
+	}
+}
+
+// writeError answers a failed request with status and err through the
+// error handler of the request
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeErrorDetails(w, r, status, err, nil)
+}
+
+// writeErrorDetails is writeError with details about the failure
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, status int, err error, details any) {
+	h, ok := r.Context().Value(errorHandlerContextKey{}).(ErrorHandler)
+	if !ok {
+		h = DefaultErrorHandler
+	}
+	h(w, r, &StatusError{Status: status, Err: err, Details: details})
 }
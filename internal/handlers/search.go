@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// SearchArchive handles requests to list the entries of an uploaded archive
+// matching the globs[] and regexes[] patterns, up to limit of them. Only the
+// central directory is read, so large archives are searched without
+// returning their whole listing, unless grep searches the lines of the
+// entries for a string, or a regex with grep_regex.
+func (h *ArchiveHandler) SearchArchive(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.SearchArchive"
+
+	if err := h.validateRequest(r, "multipart/form-data"); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if limit, ok := bodyTooLarge(err); ok {
+		writeBodyTooLarge(w, r, limit)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errors.New("file is required"))
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxFileSize {
+		writeError(w, r, http.StatusBadRequest, ErrFileSizeTooLarge)
+		return
+	}
+
+	query := entities.ArchiveQuery{
+		Globs:   r.MultipartForm.Value["globs[]"],
+		Regexes: r.MultipartForm.Value["regexes[]"],
+		Grep:    r.FormValue("grep"),
+	}
+	if value := r.FormValue("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			writeError(w, r, http.StatusBadRequest, errors.New("limit must be a non-negative integer"))
+			return
+		}
+		query.Limit = limit
+	}
+	if value := r.FormValue("grep_regex"); value != "" {
+		grepRegex, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, errors.New("grep_regex must be true or false"))
+			return
+		}
+		query.GrepRegex = grepRegex
+	}
+
+	release, ok := h.acquireBuild(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	result, err := h.service.SearchArchive(file, header.Size, header.Filename, query)
+	if errors.Is(err, services.ErrNoSearchPatterns) || errors.Is(err, services.ErrInvalidPattern) || errors.Is(err, services.ErrInvalidArchiveZip) ||
+		errors.Is(err, services.ErrFileRejected) {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to search archive",
+			"op", op,
+			"error", err,
+			"filename", header.Filename,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to search archive"))
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, Response{
+		Success: true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// passphraseHeader carries the passphrase of a protected share link
+const passphraseHeader = "X-Archive-Passphrase"
+
+// Headers carrying the base64 encoded detached signature of an archive and
+// its algorithm
+const (
+	archiveSignatureHeader   = "X-Archive-Signature"
+	signatureAlgorithmHeader = "X-Archive-Signature-Algorithm"
+)
+
+// setSignatureHeaders sets the signature headers of an archive response,
+// unless it is not signed
+func setSignatureHeaders(w http.ResponseWriter, signature, algorithm string) {
+	if signature == "" {
+		return
+	}
+	w.Header().Set(archiveSignatureHeader, signature)
+	w.Header().Set(signatureAlgorithmHeader, algorithm)
+}
+
+// passphraseForm is shown to browsers opening a protected share link
+var passphraseForm = template.Must(template.New("passphrase").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Filename}}</title></head>
+<body>
+<h1>{{.Filename}}</h1>
+<p>This download is protected by a passphrase.</p>
+{{if .Invalid}}<p style="color: #b00">The passphrase is incorrect.</p>{{end}}
+<form method="post">
+<input type="password" name="passphrase" autofocus required>
+<button type="submit">Download</button>
+</form>
+</body>
+</html>
+`))
+
+// storedArchiveResponse describes a stored archive and its share link
+type storedArchiveResponse struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	Protected   bool   `json:"protected"`
+	DownloadURL string `json:"download_url"`
+	Signature   string `json:"signature,omitempty"`
+	// Skipped lists the files left out with strict=false
+	Skipped []entities.FileError `json:"skipped,omitempty"`
+}
+
+// StoreArchive handles requests to create an archive and keep it on the
+// server, returning a share link instead of the archive itself
+func (h *ArchiveHandler) StoreArchive(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.StoreArchive"
+
+	if h.shares == nil {
+		writeError(w, r, http.StatusNotImplemented, errors.New("archive sharing is not enabled"))
+		return
+	}
+
+	if h.jobs != nil && h.uploads != nil && r.URL.Query().Get("async") == "true" {
+		h.submitArchiveJob(w, r)
+		return
+	}
+
+	zipFile, skipped, entry, ok := h.buildArchive(w, r, op, entities.UploadKindStore)
+	if !ok {
+		return
+	}
+
+	stored, err := h.shares.Store(zipFile, r.FormValue("passphrase"), entry.TenantID, entry.APIKeyID)
+	if err != nil {
+		if h.writePolicyError(w, r, err) {
+			return
+		}
+		h.history.Record(entry, err)
+		h.log.Error("failed to store archive",
+			"op", op,
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to store archive"))
+		return
+	}
+
+	h.history.Record(entry, nil)
+
+	h.writeJSONResponse(w, partialStatus(http.StatusCreated, skipped), Response{
+		Success: true,
+		Data: storedArchiveResponse{
+			ID:          stored.ID,
+			Filename:    stored.Filename,
+			Size:        stored.Size,
+			Protected:   stored.Protected(),
+			DownloadURL: "/archives/" + stored.ID + "/download",
+			Signature:   stored.Signature,
+			Skipped:     skipped,
+		},
+		Links: archiveLinks(stored.ID),
+	})
+}
+
+// submitArchiveJob validates the request and creates and stores the archive
+// in a background job, responding with the job id
+func (h *ArchiveHandler) submitArchiveJob(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.submitArchiveJob"
+
+	files, skipped, ok := h.parseArchiveRequest(w, r, op)
+	if !ok {
+		return
+	}
+
+	password, passphrase := r.FormValue("password"), r.FormValue("passphrase")
+	recipients := archiveRecipients(r)
+
+	if err := h.service.ValidateFiles(files); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if password != "" && !h.service.EncryptionEnabled() {
+		writeError(w, r, http.StatusForbidden, services.ErrEncryptionDisabled)
+		return
+	}
+	if len(recipients) > 0 && !h.writeRecipientsError(w, r, h.service.ValidateRecipients(recipients)) {
+		return
+	}
+	for _, secret := range []string{password, passphrase} {
+		if secret == "" {
+			continue
+		}
+		if err := h.service.ValidatePassword(secret); err != nil {
+			h.writePolicyError(w, r, err)
+			return
+		}
+	}
+
+	// The job input is stored, so the uploads are kept apart and the
+	// secrets sealed rather than put in it
+	input := entities.ArchiveJobInput{
+		Files:      make([]entities.ArchiveJobFile, 0, len(files)),
+		Recipients: recipients,
+	}
+	discard := func() {
+		for _, file := range input.Files {
+			h.uploads.Discard(file.UploadID)
+		}
+	}
+	for _, file := range files {
+		uploadID, err := h.uploads.Save(r.Context(), file.Open(), file.Size())
+		if err != nil {
+			discard()
+			h.log.Error("failed to keep uploaded file",
+				"op", op,
+				"file", file.Name,
+				"error", err,
+			)
+			writeError(w, r, http.StatusInternalServerError, ErrFileProcessingError)
+			return
+		}
+		input.Files = append(input.Files, entities.ArchiveJobFile{
+			UploadID: uploadID,
+			Name:     file.Name,
+			Size:     file.Size(),
+			MIMEType: file.MIMEType,
+			SkipScan: file.SkipScan,
+		})
+	}
+	var err error
+	if input.Password, err = h.secrets.Seal(r.Context(), password); err == nil {
+		input.Passphrase, err = h.secrets.Seal(r.Context(), passphrase)
+	}
+	if err != nil {
+		discard()
+		h.log.Error("failed to seal archive job secrets",
+			"op", op,
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to queue archive job"))
+		return
+	}
+
+	job, err := h.jobs.Submit(entities.JobTypeArchive, tenantID(r), r.Header.Get(apiKeyHeader), input)
+	if err != nil {
+		discard()
+		h.log.Error("failed to submit archive job",
+			"op", op,
+			"error", err,
+		)
+		writeError(w, r, http.StatusServiceUnavailable, errors.New("failed to queue archive job"))
+		return
+	}
+
+	var fields map[string]any
+	if len(skipped) > 0 {
+		fields = map[string]any{"skipped": skipped}
+	}
+	writeJobAccepted(w, job, fields)
+}
+
+// DownloadArchive serves a stored archive. Protected archives require the
+// passphrase in the X-Archive-Passphrase header or a posted passphrase form
+// field; browsers are shown a form to enter it.
+func (h *ArchiveHandler) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.DownloadArchive"
+
+	if h.shares == nil {
+		writeError(w, r, http.StatusNotImplemented, errors.New("archive sharing is not enabled"))
+		return
+	}
+
+	passphrase := r.Header.Get(passphraseHeader)
+	if passphrase == "" && r.Method == http.MethodPost {
+		passphrase = r.PostFormValue("passphrase")
+	}
+
+	id := r.PathValue("id")
+	meta, file, err := h.shares.Open(id, passphrase)
+	if meta != nil {
+		// Record every request to an existing link, including rejected ones
+		counter := &countingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		w = counter
+		defer func() {
+			access := entities.ArchiveAccess{
+				Time:      time.Now(),
+				IP:        clientIP(r),
+				UserAgent: r.UserAgent(),
+				Status:    counter.status,
+			}
+			// Only archive content counts as served, not error pages
+			if counter.status < http.StatusMultipleChoices {
+				access.BytesServed = counter.bytes
+			}
+			h.shares.RecordAccess(id, access)
+		}()
+	}
+
+	switch {
+	case errors.Is(err, services.ErrArchiveNotFound):
+		writeError(w, r, http.StatusNotFound, services.ErrArchiveNotFound)
+		return
+	case errors.Is(err, services.ErrPassphraseRequired), errors.Is(err, services.ErrInvalidPassphrase):
+		invalid := errors.Is(err, services.ErrInvalidPassphrase)
+		if wantsHTML(r) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			passphraseForm.Execute(w, struct {
+				Filename string
+				Invalid  bool
+			}{meta.Filename, invalid})
+			return
+		}
+		if invalid {
+			writeError(w, r, http.StatusForbidden, services.ErrInvalidPassphrase)
+			return
+		}
+		writeError(w, r, http.StatusUnauthorized, services.ErrPassphraseRequired)
+		return
+	case err != nil:
+		h.log.Error("failed to open stored archive",
+			"op", op,
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to open archive"))
+		return
+	}
+	defer file.Close()
+
+	// Archives encrypted to recipients are not zip files
+	contentType := "application/zip"
+	if path.Ext(meta.Filename) != ".zip" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": meta.Filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	setSignatureHeaders(w, meta.Signature, meta.SignatureAlgorithm)
+	http.ServeContent(w, r, meta.Filename, meta.CreatedAt, file)
+}
+
+// Accesses lists the recorded requests to the share link of a stored archive
+func (h *ArchiveHandler) Accesses(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.Accesses"
+
+	if h.shares == nil {
+		writeError(w, r, http.StatusNotImplemented, errors.New("archive sharing is not enabled"))
+		return
+	}
+
+	accesses, err := h.shares.Accesses(r.PathValue("id"), tenantID(r))
+	if err != nil {
+		if errors.Is(err, services.ErrArchiveNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrArchiveNotFound)
+			return
+		}
+		h.log.Error("failed to list archive accesses",
+			"op", op,
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to list accesses"))
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, Response{
+		Success: true,
+		Data:    accesses,
+	})
+}
+
+// countingResponseWriter records the status code and the number of body bytes written
+type countingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (c *countingResponseWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// wantsHTML reports whether the request comes from a browser
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// SubsetArchive handles requests to extract the entries of an uploaded
+// archive matching the globs[] and regexes[] patterns into a new archive.
+// Their compressed data is copied without being decompressed, so the subset
+// of a large archive costs little more than reading it.
+func (h *ArchiveHandler) SubsetArchive(w http.ResponseWriter, r *http.Request) {
+	const op = "ArchiveHandler.SubsetArchive"
+
+	if err := h.validateRequest(r, "multipart/form-data"); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if limit, ok := bodyTooLarge(err); ok {
+		writeBodyTooLarge(w, r, limit)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errors.New("file is required"))
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxFileSize {
+		writeError(w, r, http.StatusBadRequest, ErrFileSizeTooLarge)
+		return
+	}
+
+	query := entities.ArchiveQuery{
+		Globs:   r.MultipartForm.Value["globs[]"],
+		Regexes: r.MultipartForm.Value["regexes[]"],
+	}
+
+	release, ok := h.acquireBuild(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	zipFile, err := h.service.SubsetArchive(file, header.Size, header.Filename, query)
+	if errors.Is(err, services.ErrNoSearchPatterns) || errors.Is(err, services.ErrInvalidPattern) || errors.Is(err, services.ErrInvalidArchiveZip) ||
+		errors.Is(err, services.ErrNoMatchingEntries) || errors.Is(err, services.ErrFileRejected) {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to subset archive",
+			"op", op,
+			"error", err,
+			"filename", header.Filename,
+		)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to subset archive"))
+		return
+	}
+
+	h.writeFileResponse(w, http.StatusOK, zipFile)
+}
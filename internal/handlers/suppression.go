@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// suppressionRequest is the body of a request to suppress an address
+type suppressionRequest struct {
+	Address string                     `json:"address"`
+	Reason  entities.SuppressionReason `json:"reason"`
+}
+
+// SuppressionHandler handles requests to manage the suppression list of
+// the tenant of the request.
+type SuppressionHandler struct {
+	suppressions *services.SuppressionService
+	log          *slog.Logger
+}
+
+// NewSuppressionHandler creates a new SuppressionHandler instance.
+func NewSuppressionHandler(suppressions *services.SuppressionService, log *slog.Logger) (*SuppressionHandler, error) {
+	if suppressions == nil {
+		return nil, errors.New("suppression service is nil")
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &SuppressionHandler{suppressions: suppressions, log: log}, nil
+}
+
+// List handles requests to list the suppressed addresses
+func (h *SuppressionHandler) List(w http.ResponseWriter, r *http.Request) {
+	const op = "SuppressionHandler.List"
+
+	entries, err := h.suppressions.List(tenantID(r))
+	if err != nil {
+		h.log.Error("failed to list suppressions", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to list suppressions"))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: entries})
+}
+
+// Add handles requests to suppress an address
+func (h *SuppressionHandler) Add(w http.ResponseWriter, r *http.Request) {
+	const op = "SuppressionHandler.Add"
+
+	var req suppressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if limit, ok := bodyTooLarge(err); ok {
+			writeBodyTooLarge(w, r, limit)
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	entry, err := h.suppressions.Add(tenantID(r), req.Address, req.Reason)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSuppression) {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		h.log.Error("failed to add suppression", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to add suppression"))
+		return
+	}
+
+	h.log.Info("address suppressed", "op", op, "address", entry.Address, "reason", entry.Reason)
+	WriteJSON(w, http.StatusCreated, Response{Success: true, Data: entry})
+}
+
+// Remove handles requests to take an address off the suppression list
+func (h *SuppressionHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	const op = "SuppressionHandler.Remove"
+
+	address := r.PathValue("address")
+	if err := h.suppressions.Remove(tenantID(r), address); err != nil {
+		if errors.Is(err, services.ErrSuppressionNotFound) {
+			writeError(w, r, http.StatusNotFound, services.ErrSuppressionNotFound)
+			return
+		}
+		h.log.Error("failed to remove suppression", "op", op, "error", err)
+		writeError(w, r, http.StatusInternalServerError, errors.New("failed to remove suppression"))
+		return
+	}
+
+	h.log.Info("address unsuppressed", "op", op, "address", address)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// TenantMiddleware resolves the tenant of API requests and enforces its rate
+// limit and daily quota before passing them on
+type TenantMiddleware struct {
+	tenants *services.TenantService
+	log     *slog.Logger
+}
+
+// NewTenantMiddleware creates a new TenantMiddleware instance. tenants is
+// optional; without it requests pass through untouched.
+func NewTenantMiddleware(tenants *services.TenantService, log *slog.Logger) *TenantMiddleware {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &TenantMiddleware{tenants: tenants, log: log}
+}
+
+// Wrap returns a handler that runs next with the tenant of the request in its context
+func (m *TenantMiddleware) Wrap(next http.Handler) http.Handler {
+	const op = "TenantMiddleware.Wrap"
+
+	if m.tenants == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := m.tenants.Resolve(r.Header.Get(apiKeyHeader), r.Header.Get(m.tenants.Header()))
+		switch {
+		case errors.Is(err, services.ErrTenantRequired):
+			writeError(w, r, http.StatusUnauthorized, services.ErrTenantRequired)
+			return
+		case errors.Is(err, services.ErrUnknownTenant), errors.Is(err, services.ErrTenantMismatch):
+			m.log.Warn("tenant rejected", "op", op, "ip", clientIP(r), "error", err)
+			writeError(w, r, http.StatusForbidden, errors.Unwrap(err))
+			return
+		case err != nil:
+			m.log.Error("failed to resolve tenant", "op", op, "error", err)
+			writeError(w, r, http.StatusInternalServerError, errors.New("failed to resolve tenant"))
+			return
+		}
+
+		// The quota is charged up front, so the size must be known
+		if r.ContentLength < 0 && m.tenants.LimitsQuota(tenant) {
+			writeError(w, r, http.StatusLengthRequired, errors.New("content length is required"))
+			return
+		}
+
+		status, err := m.tenants.Allow(tenant, max(r.ContentLength, 0))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrRateLimited):
+				setRateLimitHeaders(w, status, true)
+				writeError(w, r, http.StatusTooManyRequests, services.ErrRateLimited)
+			case errors.Is(err, services.ErrQuotaExceeded):
+				setRateLimitHeaders(w, status, true)
+				writeError(w, r, http.StatusTooManyRequests, services.ErrQuotaExceeded)
+			default:
+				m.log.Error("failed to apply tenant limits", "op", op, "error", err)
+				writeError(w, r, http.StatusInternalServerError, errors.New("failed to apply tenant limits"))
+			}
+			return
+		}
+		setRateLimitHeaders(w, status, false)
+
+		next.ServeHTTP(w, r.WithContext(services.WithTenant(r.Context(), tenant)))
+	})
+}
+
+// requestTenant returns the tenant of the request, or nil without tenancy
+func requestTenant(r *http.Request) *services.Tenant {
+	return services.TenantFromContext(r.Context())
+}
+
+// tenantID returns the id of the request's tenant, or "" without tenancy
+func tenantID(r *http.Request) string {
+	if tenant := requestTenant(r); tenant != nil {
+		return tenant.ID
+	}
+	return ""
+}
+
+// mailFrom returns the sender address of the request's tenant, or "" for the default
+func mailFrom(r *http.Request) string {
+	if tenant := requestTenant(r); tenant != nil {
+		return tenant.MailFrom
+	}
+	return ""
+}
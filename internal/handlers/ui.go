@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// uiPage is the single page of the demo UI. Its styles and scripts are
+// inline, so it needs nothing but the API.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// uiContentSecurityPolicy only allows the page's own inline styles and
+// scripts and requests to the API
+const uiContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; connect-src 'self'; img-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// UIHandler serves a demo page uploading files to the archive and mail
+// endpoints, for demos and manual testing.
+type UIHandler struct{}
+
+// NewUIHandler creates a new UIHandler instance.
+func NewUIHandler() *UIHandler {
+	return &UIHandler{}
+}
+
+// Index handles requests for the demo page.
+func (h *UIHandler) Index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", uiContentSecurityPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(uiPage)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/buildinfo"
+)
+
+// VersionHandler handles requests for the build of the running server.
+type VersionHandler struct {
+	info buildinfo.Info
+}
+
+// NewVersionHandler creates a new VersionHandler reporting the build of the
+// running binary under the configured name and version.
+func NewVersionHandler(name, version string) *VersionHandler {
+	info := buildinfo.Get(name)
+	if version != "" {
+		info.Version = version
+	}
+
+	return &VersionHandler{info: info}
+}
+
+// Get handles requests for the app name, version, git commit, build date and
+// Go runtime version.
+func (h *VersionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, Response{Success: true, Data: h.info})
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// nopCloser is a writer that must not be closed, such as stdout
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// OpenAccessLog opens the destination of the access log described by cfg.
+// The caller must close it once the server has stopped.
+func OpenAccessLog(cfg *config.AccessLogConfig) (io.WriteCloser, error) {
+	switch cfg.Output {
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "file":
+		file, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log: %w", err)
+		}
+		return file, nil
+	case "syslog":
+		writer, err := openSyslog(&cfg.Syslog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return writer, nil
+	default:
+		return nil, fmt.Errorf("unknown access log output: %s", cfg.Output)
+	}
+}
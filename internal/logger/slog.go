@@ -28,8 +28,9 @@ func SourceRelativeToRoot(projectRoot string) func(groups []string, a slog.Attr)
 	}
 }
 
-// SetupLogger configures and returns a logger based on the environment
-func SetupLogger(env string) *slog.Logger {
+// SetupLogger configures and returns a logger based on the environment.
+// level is optional; without it the level of the environment is used.
+func SetupLogger(env string, level slog.Leveler) *slog.Logger {
 	projectRoot := utils.GetProjectRoot()
 
 	var handler slog.Handler
@@ -42,6 +43,9 @@ func SetupLogger(env string) *slog.Logger {
 			AddSource:   true,
 			ReplaceAttr: SourceRelativeToRoot(projectRoot),
 		}
+		if level != nil {
+			opts.Level = level
+		}
 		handler = slog.NewTextHandler(os.Stdout, opts)
 
 	case EnvProd:
@@ -56,6 +60,9 @@ func SetupLogger(env string) *slog.Logger {
 				return a
 			},
 		}
+		if level != nil {
+			opts.Level = level
+		}
 		handler = slog.NewJSONHandler(os.Stdout, opts)
 
 	default:
@@ -63,6 +70,9 @@ func SetupLogger(env string) *slog.Logger {
 		opts := &slog.HandlerOptions{
 			Level: slog.LevelWarn,
 		}
+		if level != nil {
+			opts.Level = level
+		}
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// openSyslog connects to the syslog daemon of cfg, logging at the info
+// level of the local0 facility
+func openSyslog(cfg *config.SyslogConfig) (io.WriteCloser, error) {
+	writer, err := syslog.Dial(cfg.Network, cfg.Address, syslog.LOG_INFO|syslog.LOG_LOCAL0, cfg.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// openSyslog is not supported here, as there is no syslog daemon
+func openSyslog(*config.SyslogConfig) (io.WriteCloser, error) {
+	return nil, errors.ErrUnsupported
+}
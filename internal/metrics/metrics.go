@@ -0,0 +1,225 @@
+// Package metrics records Prometheus metrics of the served requests, the
+// archives created and the mail sent, for capacity planning and alerting
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+const namespace = "doozip"
+
+// Outcomes of the observed operations
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Reasons a mail delivery failed
+const (
+	FailureAuth       = "auth"
+	FailureConnection = "connection"
+	Failure4xx        = "4xx"
+	Failure5xx        = "5xx"
+	FailureValidation = "validation"
+	FailureOther      = "other"
+)
+
+var (
+	// sizeBuckets span 1 KB to 256 MB
+	sizeBuckets = prometheus.ExponentialBuckets(1<<10, 4, 10)
+	// compressionBuckets span 0.1 ms to 26 s
+	compressionBuckets = prometheus.ExponentialBuckets(0.0001, 4, 10)
+	// sendBuckets span quick local relays to slow remote ones
+	sendBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	archiveInputSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_input_size_bytes",
+		Help:      "Size of the uploaded files or archive, by endpoint and outcome.",
+		Buckets:   sizeBuckets,
+	}, []string{"endpoint", "outcome"})
+
+	archiveOutputSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_output_size_bytes",
+		Help:      "Size of the created archives, by endpoint and outcome.",
+		Buckets:   sizeBuckets,
+	}, []string{"endpoint", "outcome"})
+
+	fileCompression = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_file_compression_seconds",
+		Help:      "Time taken to compress each file into an archive, by endpoint and outcome.",
+		Buckets:   compressionBuckets,
+	}, []string{"endpoint", "outcome"})
+
+	smtpSend = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "smtp_send_duration_seconds",
+		Help:      "Time taken to deliver a message to its recipients, by endpoint and outcome.",
+		Buckets:   sendBuckets,
+	}, []string{"endpoint", "outcome"})
+
+	mailQueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_queued_total",
+		Help:      "Messages queued for later delivery, by queue (outbox or job).",
+	}, []string{"queue"})
+
+	mailSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Recipients a message was delivered to, by recipient domain.",
+	}, []string{"domain"})
+
+	mailRetried = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_retried_total",
+		Help:      "Deliveries retried through the next relay, by the reason the previous relay failed.",
+	}, []string{"reason"})
+
+	mailBounced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_bounced_total",
+		Help:      "Recipients a message could not be delivered to, by failure reason and recipient domain.",
+	}, []string{"reason", "domain"})
+
+	requestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_shed_total",
+		Help:      "Archive and extraction requests rejected while overloaded, by the threshold crossed.",
+	}, []string{"reason"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		archiveInputSize,
+		archiveOutputSize,
+		fileCompression,
+		smtpSend,
+		mailQueued,
+		mailSent,
+		mailRetried,
+		mailBounced,
+		requestsShed,
+	)
+}
+
+// Handler returns the handler exposing the metrics to Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Outcome returns the outcome label of an operation that returned err
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
+
+// ObserveRequest records a served request. route is the pattern that
+// matched it, so paths with ids don't create a series each.
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveInput records the size of the files uploaded to endpoint
+func ObserveInput(endpoint entities.UploadKind, size int64, err error) {
+	archiveInputSize.WithLabelValues(string(endpoint), Outcome(err)).Observe(float64(size))
+}
+
+// ObserveArchive records an archive created for endpoint from files: the
+// input size, the size of the archive and the compression time of each file
+func ObserveArchive(endpoint entities.UploadKind, files []*entities.FileData, archive *entities.FileData, err error) {
+	outcome := Outcome(err)
+
+	var size int64
+	for _, file := range files {
+		if file == nil {
+			continue
+		}
+		size += file.Size()
+		if file.CompressionTime > 0 {
+			fileCompression.WithLabelValues(string(endpoint), outcome).Observe(file.CompressionTime.Seconds())
+		}
+	}
+	archiveInputSize.WithLabelValues(string(endpoint), outcome).Observe(float64(size))
+
+	if archive != nil {
+		archiveOutputSize.WithLabelValues(string(endpoint), outcome).Observe(float64(archive.Size()))
+	}
+}
+
+// ObserveMailSend records the time taken to deliver a message for endpoint
+func ObserveMailSend(endpoint string, duration time.Duration, err error) {
+	smtpSend.WithLabelValues(endpoint, Outcome(err)).Observe(duration.Seconds())
+}
+
+// MailQueued records a message queued for later delivery in queue
+func MailQueued(queue string) {
+	mailQueued.WithLabelValues(queue).Inc()
+}
+
+// MailSent records the delivery of a message to recipient
+func MailSent(recipient string) {
+	mailSent.WithLabelValues(recipientDomain(recipient)).Inc()
+}
+
+// MailRetried records a delivery retried after a relay failed for reason
+func MailRetried(reason string) {
+	mailRetried.WithLabelValues(reason).Inc()
+}
+
+// MailBounced records a message that could not be delivered to recipient for reason
+func MailBounced(reason, recipient string) {
+	mailBounced.WithLabelValues(reason, recipientDomain(recipient)).Inc()
+}
+
+// RequestShed records a request rejected while overloaded for reason
+func RequestShed(reason string) {
+	requestsShed.WithLabelValues(reason).Inc()
+}
+
+// recipientDomain returns the lower case domain of an address, or "unknown"
+func recipientDomain(recipient string) string {
+	at := strings.LastIndexByte(recipient, '@')
+	if at < 0 || at == len(recipient)-1 {
+		return "unknown"
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(recipient[at+1:]), ">"))
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// ErrSMTPUTF8Unsupported marks a relay that cannot deliver to or from an
+// internationalized address, as it doesn't announce SMTPUTF8
+var ErrSMTPUTF8Unsupported = errors.New("relay does not support internationalized addresses (SMTPUTF8)")
+
+// parseAddress checks that s is a bare email address, whose local part may
+// be UTF-8, and whose domain is a valid, possibly internationalized, domain
+// name with at least two labels. It returns the local part and the domain
+// in its ASCII (punycode) form.
+func parseAddress(s string) (local, domain string, err error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return "", "", fmt.Errorf("invalid email format: %s", s)
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	domain, err = idna.Lookup.ToASCII(addr.Address[at+1:])
+	if err != nil || !strings.Contains(strings.Trim(domain, "."), ".") {
+		return "", "", fmt.Errorf("invalid email domain: %s", s)
+	}
+
+	return addr.Address[:at], domain, nil
+}
+
+// asciiDomains returns the addresses with their domains converted to
+// punycode, so relays without SMTPUTF8 can deliver to internationalized
+// domains as long as the local part is ASCII
+func asciiDomains(addresses []string) []string {
+	converted := make([]string, len(addresses))
+	for i, address := range addresses {
+		converted[i] = address
+		if local, domain, err := parseAddress(address); err == nil {
+			converted[i] = local + "@" + domain
+		}
+	}
+	return converted
+}
+
+// withASCIIDomains returns a copy of msg sent to the recipients with their
+// domains converted to punycode
+func withASCIIDomains(msg *entities.MailMessage) *entities.MailMessage {
+	converted := *msg
+	converted.To = asciiDomains(msg.To)
+	return &converted
+}
+
+// needsSMTPUTF8 reports whether any of the envelope addresses is not ASCII,
+// which relays only accept with the SMTPUTF8 extension
+func needsSMTPUTF8(from string, to []string) bool {
+	for _, address := range append([]string{from}, to...) {
+		for i := 0; i < len(address); i++ {
+			if address[i] >= utf8.RuneSelf {
+				return true
+			}
+		}
+	}
+	return false
+}
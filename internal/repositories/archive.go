@@ -3,14 +3,22 @@ package repositories
 import (
 	"archive/zip"
 	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"log/slog"
 	"mime"
 	"mime/multipart"
 	"path/filepath"
+	"runtime"
+	"time"
 
+	"github.com/ab-dauletkhan/doozip/internal/config"
 	"github.com/ab-dauletkhan/doozip/internal/entities"
 )
 
@@ -18,21 +26,104 @@ var (
 	ErrEmptyFile      = errors.New("file is empty")
 	ErrInvalidZip     = errors.New("invalid zip file")
 	ErrEmptyFilesList = errors.New("files list is empty")
+	ErrEmptyPassword  = errors.New("password is empty")
+)
+
+// zipFlagEncrypted marks an entry as encrypted in its general purpose flags
+const zipFlagEncrypted = 0x1
+
+// DOS attributes, in the low byte of the external attributes of an entry
+const (
+	zipAttrHidden = 0x02
+	zipAttrSystem = 0x04
+)
+
+// estimateSampleSize is the prefix of a file compressed to estimate how well
+// the whole file compresses
+const estimateSampleSize = 64 << 10
+
+// defaultCopyBufferSize is the size of the buffer files are read through
+// when none is configured, that of io.Copy
+const defaultCopyBufferSize = 32 << 10
+
+// Sizes of the records archive/zip writes for every entry and archive
+const (
+	zipLocalHeaderSize    = 30
+	zipCentralHeaderSize  = 46
+	zipDataDescriptorSize = 16
+	zipEndRecordSize      = 22
 )
 
 // ArchiveRepository defines the interface for archive operations
 type ArchiveRepository interface {
 	GetArchiveInfo(file multipart.File, filename string) (*entities.ArchiveInfo, error)
-	CreateZipArchive(files []*entities.FileData) (*bytes.Buffer, error)
+	GetArchiveInfoAt(reader io.ReaderAt, size int64, filename string) (*entities.ArchiveInfo, error)
+	// GetArchiveDirectory lists an archive from its central directory only,
+	// without reading the content of any entry
+	GetArchiveDirectory(reader io.ReaderAt, size int64, filename string) (*entities.ArchiveInfo, error)
+	GetDocumentInfo(reader io.ReaderAt, size int64, filename string) (*entities.DocumentInfo, error)
+	// SearchArchive lists the files of an archive of size bytes selected by
+	// opts. Only the central directory and the local headers of the matches
+	// are read, unless opts searches the content of the entries.
+	SearchArchive(reader io.ReaderAt, size int64, filename string, opts SearchOptions) (*entities.ArchiveSearch, error)
+	// SubsetArchive copies the files of an archive of size bytes whose path
+	// match accepts into a new archive, and returns it with the number of
+	// files copied. Their compressed data is copied raw. Entries that are
+	// not regular files are submitted to special when it is not nil.
+	SubsetArchive(reader io.ReaderAt, size int64, match func(path string) bool, special SpecialFunc) (*bytes.Buffer, int, error)
+	// CreateZipArchive archives the files, followed by the entries built by
+	// contents when it is not nil
+	CreateZipArchive(files []*entities.FileData, contents ContentsFunc) (*bytes.Buffer, error)
+	CreateEncryptedZipArchive(files []*entities.FileData, password string, contents ContentsFunc) (*bytes.Buffer, error)
+	EstimateZipArchive(files []*entities.FileData, encrypted bool) (*entities.ArchiveEstimate, error)
+}
+
+// ContentsFunc builds the entries added to an archive after the files, once
+// their SHA256 is set, such as a listing of them
+type ContentsFunc func(files []*entities.FileData) ([]*entities.FileData, error)
+
+// SpecialFunc decides what is done with an entry of an archive that is not a
+// regular file, such as a symlink: it is left out when skip is true, and the
+// archive is refused when an error is returned
+type SpecialFunc func(path, entryType string) (skip bool, err error)
+
+// skip reports whether the entry f named name is left out by special, which
+// is only consulted for entries that are not regular files
+func (special SpecialFunc) skip(f *zip.File, name string) (bool, error) {
+	if special == nil {
+		return false, nil
+	}
+	if typ := entryType(f.Mode()); typ != entities.EntryTypeFile {
+		return special(name, typ)
+	}
+	return false, nil
 }
 
 type archiveRepositoryImpl struct {
-	log *slog.Logger
+	workers    int
+	bufferSize int
+	names      *nameDecoder
+	entryNames *nameEncoder
+	log        *slog.Logger
 }
 
-// NewArchiveRepository creates a new instance of ArchiveRepository
-func NewArchiveRepository(log *slog.Logger) ArchiveRepository {
-	return &archiveRepositoryImpl{log: log}
+// NewArchiveRepository creates a new instance of ArchiveRepository,
+// compressing files and decoding entry names as cfg sets
+func NewArchiveRepository(cfg *config.ArchiveConfig, log *slog.Logger) ArchiveRepository {
+	r := &archiveRepositoryImpl{
+		workers:    cfg.Compression.Workers,
+		bufferSize: cfg.Compression.BufferSize,
+		names:      newNameDecoder(&cfg.Names),
+		entryNames: newNameEncoder(&cfg.Names),
+		log:        log,
+	}
+	if r.workers <= 0 {
+		r.workers = runtime.GOMAXPROCS(0)
+	}
+	if r.bufferSize <= 0 {
+		r.bufferSize = defaultCopyBufferSize
+	}
+	return r
 }
 
 // GetArchiveInfo extracts and returns information about a zip archive
@@ -52,12 +143,43 @@ func (r *archiveRepositoryImpl) GetArchiveInfo(file multipart.File, filename str
 		return nil, fmt.Errorf("%s: failed to read file: %w", op, err)
 	}
 
-	if len(content) == 0 {
+	// The content is in memory, so the entries are cheap to sniff
+	return r.getArchiveInfo(op, bytes.NewReader(content), int64(len(content)), filename, true, true)
+}
+
+// GetArchiveInfoAt extracts and returns information about a zip archive of
+// size bytes. Only the central directory and package manifests are read, so
+// reader may fetch its content lazily.
+func (r *archiveRepositoryImpl) GetArchiveInfoAt(reader io.ReaderAt, size int64, filename string) (*entities.ArchiveInfo, error) {
+	const op = "archiveRepositoryImpl.GetArchiveInfoAt"
+
+	return r.getArchiveInfo(op, reader, size, filename, false, true)
+}
+
+// GetArchiveDirectory lists a zip archive of size bytes from its central
+// directory only. Entries are neither sniffed nor decompressed, and package
+// manifests are not read, so the time taken doesn't depend on the size of
+// the entries.
+func (r *archiveRepositoryImpl) GetArchiveDirectory(reader io.ReaderAt, size int64, filename string) (*entities.ArchiveInfo, error) {
+	const op = "archiveRepositoryImpl.GetArchiveDirectory"
+
+	return r.getArchiveInfo(op, reader, size, filename, false, false)
+}
+
+// getArchiveInfo reads the archive information, sniffing the content type
+// of small entries when sniff is set and reading package manifests when
+// manifests is set
+func (r *archiveRepositoryImpl) getArchiveInfo(op string, reader io.ReaderAt, size int64, filename string, sniff, manifests bool) (*entities.ArchiveInfo, error) {
+	if size == 0 {
 		return nil, fmt.Errorf("%s: %w", op, ErrEmptyFile)
 	}
 
-	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	zipReader, err := zip.NewReader(reader, size)
 	if err != nil {
+		// Errors of a lazy reader are not about the archive itself
+		if !errors.Is(err, zip.ErrFormat) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: failed to read archive: %w", op, err)
+		}
 		r.log.Error("failed to create zip reader",
 			"op", op,
 			"error", err,
@@ -67,16 +189,29 @@ func (r *archiveRepositoryImpl) GetArchiveInfo(file multipart.File, filename str
 
 	archiveInfo := &entities.ArchiveInfo{
 		Filename:    filename,
-		ArchiveSize: int64(len(content)),
-		Files:       make([]entities.FileDetails, 0, len(reader.File)),
+		ArchiveSize: size,
+		Files:       make([]entities.FileDetails, 0, len(zipReader.File)),
 	}
 
-	if err := r.processZipFiles(reader, archiveInfo); err != nil {
+	if err := r.processZipFiles(zipReader, archiveInfo, sniff); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	archiveInfo.CalculateTotals()
 
+	if manifests {
+		// A broken manifest doesn't make the listing wrong, so it is only logged
+		container, err := readContainerInfo(zipReader)
+		if err != nil {
+			r.log.Warn("failed to read container metadata",
+				"op", op,
+				"filename", filename,
+				"error", err,
+			)
+		}
+		archiveInfo.Container = container
+	}
+
 	if err := archiveInfo.Validate(); err != nil {
 		return nil, fmt.Errorf("%s: invalid archive info: %w", op, err)
 	}
@@ -84,17 +219,188 @@ func (r *archiveRepositoryImpl) GetArchiveInfo(file multipart.File, filename str
 	return archiveInfo, nil
 }
 
-// processZipFiles processes files within the zip archive and populates archive info
-func (r *archiveRepositoryImpl) processZipFiles(reader *zip.Reader, archiveInfo *entities.ArchiveInfo) error {
-	for _, f := range reader.File {
+// SearchArchive lists the files of an archive matching a query
+func (r *archiveRepositoryImpl) SearchArchive(reader io.ReaderAt, size int64, filename string, opts SearchOptions) (*entities.ArchiveSearch, error) {
+	const op = "archiveRepositoryImpl.SearchArchive"
+
+	if size == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrEmptyFile)
+	}
+
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		if !errors.Is(err, zip.ErrFormat) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: failed to read archive: %w", op, err)
+		}
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidZip)
+	}
+
+	search := &entities.ArchiveSearch{
+		Filename:    filename,
+		ArchiveSize: size,
+		Files:       []entities.SearchMatch{},
+	}
+	var grep *grepState
+	if opts.Grep != nil {
+		grep = &grepState{opts: opts.Grep}
+	}
+	names, _ := r.names.decode(zipReader.File)
+	for i, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Clean(names[i])
+		skip, err := opts.Special.skip(f, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if skip {
+			continue
+		}
+		search.TotalFiles++
+
+		if opts.Match != nil && !opts.Match(name) {
+			continue
+		}
+		if grep != nil {
+			if grep.full || !grep.allows(f) {
+				if !grep.full {
+					search.SkippedFiles++
+				}
+				continue
+			}
+			matched, searched := grep.grep(f, name, search)
+			if !searched {
+				search.SkippedFiles++
+			}
+			if !matched {
+				continue
+			}
+		}
+		search.MatchedFiles++
+		search.MatchedSize += int64(f.UncompressedSize64)
+		if opts.Limit > 0 && len(search.Files) == opts.Limit {
+			search.Truncated = true
+			continue
+		}
+
+		// The data offset is read from the local header of the entry
+		offset, err := f.DataOffset()
+		if errors.Is(err, zip.ErrFormat) {
+			return nil, fmt.Errorf("%s: %w: %s", op, ErrInvalidZip, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read entry %s: %w", op, name, err)
+		}
+		search.Files = append(search.Files, entities.SearchMatch{
+			FilePath:       name,
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			Offset:         offset,
+		})
+	}
+
+	return search, nil
+}
+
+// SubsetArchive copies the matching files of an archive into a new one.
+// Entries keep their header, name bytes and flags included, and their
+// compressed data is never decompressed, so encrypted entries are copied
+// too and the copy costs little more than reading them.
+func (r *archiveRepositoryImpl) SubsetArchive(reader io.ReaderAt, size int64, match func(path string) bool, special SpecialFunc) (*bytes.Buffer, int, error) {
+	const op = "archiveRepositoryImpl.SubsetArchive"
+
+	if size == 0 {
+		return nil, 0, fmt.Errorf("%s: %w", op, ErrEmptyFile)
+	}
+
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		if !errors.Is(err, zip.ErrFormat) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, 0, fmt.Errorf("%s: failed to read archive: %w", op, err)
+		}
+		return nil, 0, fmt.Errorf("%s: %w", op, ErrInvalidZip)
+	}
+
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	copied := 0
+	names, _ := r.names.decode(zipReader.File)
+	for i, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Clean(names[i])
+		skip, err := special.skip(f, name)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if skip || !match(name) {
+			continue
+		}
+		if err := r.copyRawEntry(writer, f); err != nil {
+			// A truncated archive ends within the data of an entry
+			if errors.Is(err, zip.ErrFormat) || errors.Is(err, entities.ErrContentLength) {
+				return nil, 0, fmt.Errorf("%s: %w: %s", op, ErrInvalidZip, name)
+			}
+			return nil, 0, fmt.Errorf("%s: failed to copy entry %s: %w", op, name, err)
+		}
+		copied++
+	}
+	if err := writer.Close(); err != nil {
+		return nil, 0, fmt.Errorf("%s: failed to close zip writer: %w", op, err)
+	}
+
+	return buf, copied, nil
+}
+
+// copyRawEntry copies an entry of another archive into writer without
+// decompressing it
+func (r *archiveRepositoryImpl) copyRawEntry(writer *zip.Writer, f *zip.File) error {
+	src, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	header := f.FileHeader
+	dst, err := writer.CreateRaw(&header)
+	if err != nil {
+		return fmt.Errorf("failed to create file in zip: %w", err)
+	}
+	n, err := r.copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+	if uint64(n) != f.CompressedSize64 {
+		return fmt.Errorf("%w: copied %d of %d bytes", entities.ErrContentLength, n, f.CompressedSize64)
+	}
+	return nil
+}
+
+// processZipFiles processes files within the zip archive and populates archive
+// info. With sniff, the content of entries below sniffMaxEntrySize is checked
+// against the type their extension claims.
+func (r *archiveRepositoryImpl) processZipFiles(reader *zip.Reader, archiveInfo *entities.ArchiveInfo, sniff bool) error {
+	names, encoding := r.names.decode(reader.File)
+	archiveInfo.NameEncoding = encoding
+
+	for i, f := range reader.File {
 		if f.FileInfo().IsDir() {
 			continue
 		}
 
 		fileDetails := entities.FileDetails{
-			FilePath: filepath.Clean(f.Name),
-			Size:     f.FileInfo().Size(),
-			MimeType: r.detectMimeType(f.Name),
+			FilePath:  filepath.Clean(names[i]),
+			Size:      f.FileInfo().Size(),
+			MimeType:  r.detectMimeType(names[i]),
+			EntryType: entryType(f.Mode()),
+			Hidden:    f.ExternalAttrs&zipAttrHidden != 0,
+			System:    f.ExternalAttrs&zipAttrSystem != 0,
+		}
+		fileDetails.Dotfile = entities.IsDotfile(fileDetails.FilePath)
+		// The content of special entries, such as the target of a symlink,
+		// is not what their name claims
+		if sniff && fileDetails.EntryType == entities.EntryTypeFile {
+			r.sniffEntry(f, &fileDetails)
 		}
 
 		if err := fileDetails.Validate(); err != nil {
@@ -112,9 +418,39 @@ func (r *archiveRepositoryImpl) processZipFiles(reader *zip.Reader, archiveInfo
 }
 
 // CreateZipArchive creates a new zip archive from the provided files
-func (r *archiveRepositoryImpl) CreateZipArchive(files []*entities.FileData) (*bytes.Buffer, error) {
+func (r *archiveRepositoryImpl) CreateZipArchive(files []*entities.FileData, contents ContentsFunc) (*bytes.Buffer, error) {
 	const op = "archiveRepositoryImpl.CreateZipArchive"
 
+	if r.workers == 1 {
+		return r.createZipArchive(op, files, contents, r.streamedEntry)
+	}
+	return r.createZipArchive(op, files, contents, r.deflatedEntry)
+}
+
+// CreateEncryptedZipArchive creates a new zip archive from the provided files,
+// encrypting every entry with the given password
+func (r *archiveRepositoryImpl) CreateEncryptedZipArchive(files []*entities.FileData, password string, contents ContentsFunc) (*bytes.Buffer, error) {
+	const op = "archiveRepositoryImpl.CreateEncryptedZipArchive"
+
+	if password == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrEmptyPassword)
+	}
+
+	return r.createZipArchive(op, files, contents, func(file *entities.FileData) (entryWriter, error) {
+		return r.encryptedEntry(file, password)
+	})
+}
+
+// entryWriter writes a prepared entry into the archive
+type entryWriter func(writer *zip.Writer) error
+
+// prepareFunc does the work of adding file to an archive that can run in
+// parallel with other files, and returns the writer of the entry
+type prepareFunc func(file *entities.FileData) (entryWriter, error)
+
+// createZipArchive validates the files and adds each of them using prepare,
+// followed by the entries built by contents, if any
+func (r *archiveRepositoryImpl) createZipArchive(op string, files []*entities.FileData, contents ContentsFunc, prepare prepareFunc) (*bytes.Buffer, error) {
 	if len(files) == 0 {
 		return nil, fmt.Errorf("%s: %w", op, ErrEmptyFilesList)
 	}
@@ -137,29 +473,331 @@ func (r *archiveRepositoryImpl) CreateZipArchive(files []*entities.FileData) (*b
 		}
 	}()
 
-	for _, file := range files {
-		if err := r.addFileToZip(writer, file); err != nil {
-			return nil, fmt.Errorf("%s: failed to add file %s: %w", op, file.Name, err)
+	if err := r.addFiles(writer, files, prepare); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if contents != nil {
+		entries, err := contents(files)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to build archive contents: %w", op, err)
+		}
+		for _, entry := range entries {
+			write, err := prepare(entry)
+			if err == nil {
+				err = write(writer)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: failed to add file %s: %w", op, entry.Name, err)
+			}
 		}
 	}
 
 	return buf, nil
 }
 
-// addFileToZip adds a single file to the zip archive
+// addFiles adds the files to the archive in order, preparing up to workers
+// of them at once. Prepared entries wait in memory for their turn, so no
+// more than workers are prepared ahead of the entry being written.
+func (r *archiveRepositoryImpl) addFiles(writer *zip.Writer, files []*entities.FileData, prepare prepareFunc) error {
+	if r.workers == 1 {
+		for _, file := range files {
+			start := time.Now()
+			write, err := prepare(file)
+			if err == nil {
+				err = write(writer)
+			}
+			file.CompressionTime = time.Since(start)
+			if err != nil {
+				return fmt.Errorf("failed to add file %s: %w", file.Name, err)
+			}
+		}
+		return nil
+	}
+
+	type prepared struct {
+		write entryWriter
+		err   error
+	}
+	results := make([]chan prepared, len(files))
+	for i := range results {
+		results[i] = make(chan prepared, 1)
+	}
+	slots := make(chan struct{}, r.workers)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for i, file := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func() {
+				start := time.Now()
+				write, err := prepare(file)
+				file.CompressionTime = time.Since(start)
+				results[i] <- prepared{write: write, err: err}
+			}()
+		}
+	}()
+
+	for i, file := range files {
+		result := <-results[i]
+		err := result.err
+		if err == nil {
+			start := time.Now()
+			err = result.write(writer)
+			file.CompressionTime += time.Since(start)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add file %s: %w", file.Name, err)
+		}
+		<-slots
+	}
+	return nil
+}
+
+// streamedEntry adds a file by streaming its content through the archive's
+// compressor, all of it when the entry is written
+func (r *archiveRepositoryImpl) streamedEntry(file *entities.FileData) (entryWriter, error) {
+	return func(writer *zip.Writer) error {
+		return r.addFileToZip(writer, file)
+	}, nil
+}
+
+// deflatedEntry compresses a file into memory, leaving only the compressed
+// data to be copied when the entry is written
+func (r *archiveRepositoryImpl) deflatedEntry(file *entities.FileData) (entryWriter, error) {
+	compressed, err := r.deflate(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(writer *zip.Writer) error {
+		header := compressed.header(r.entryNames, file)
+		header.CompressedSize64 = uint64(len(compressed.data))
+		// Like the entries of zip.Writer.Create, without a modification time
+		w, err := writer.CreateRaw(header)
+		if err != nil {
+			return fmt.Errorf("failed to create file in zip: %w", err)
+		}
+		if _, err := w.Write(compressed.data); err != nil {
+			return fmt.Errorf("failed to write file content: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// encryptedEntry compresses and encrypts a file into memory
+func (r *archiveRepositoryImpl) encryptedEntry(file *entities.FileData, password string) (entryWriter, error) {
+	compressed, err := r.deflate(file)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := zipAESEncrypt(compressed.data, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt file content: %w", err)
+	}
+
+	return func(writer *zip.Writer) error {
+		header := compressed.header(r.entryNames, file)
+		header.Flags |= zipFlagEncrypted
+		header.Extra = append(header.Extra, zipAESExtra(header.Method)...)
+		header.Method = zipMethodAES
+		// AE-2 leaves the CRC out, as it would give away the plaintext
+		header.CRC32 = 0
+		header.CompressedSize64 = uint64(len(encrypted))
+		// CreateRaw does not derive the MS-DOS timestamp from Modified
+		header.SetModTime(time.Now())
+
+		w, err := writer.CreateRaw(header)
+		if err != nil {
+			return fmt.Errorf("failed to create file in zip: %w", err)
+		}
+		if _, err := w.Write(encrypted); err != nil {
+			return fmt.Errorf("failed to write file content: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// addFileToZip adds a single file to the zip archive, streaming its content
 func (r *archiveRepositoryImpl) addFileToZip(writer *zip.Writer, file *entities.FileData) error {
-	w, err := writer.Create(filepath.Clean(file.Name))
+	header := r.entryNames.header(filepath.Clean(file.Name))
+	header.Method = zip.Deflate
+	w, err := writer.CreateHeader(header)
 	if err != nil {
 		return fmt.Errorf("failed to create file in zip: %w", err)
 	}
 
-	if _, err := w.Write(file.Content); err != nil {
+	hash := sha256.New()
+	n, err := r.copy(io.MultiWriter(w, hash), file.Open())
+	if err != nil {
 		return fmt.Errorf("failed to write file content: %w", err)
 	}
+	if n != file.Size() {
+		return fmt.Errorf("%w: wrote %d of %d bytes", entities.ErrContentLength, n, file.Size())
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
 
 	return nil
 }
 
+// deflatedFile is the content of a file compressed into memory
+type deflatedFile struct {
+	data []byte
+	crc  uint32
+	size int64
+}
+
+// header returns the header of the entry of file, named by names, without
+// its compressed size
+func (d *deflatedFile) header(names *nameEncoder, file *entities.FileData) *zip.FileHeader {
+	header := names.header(filepath.Clean(file.Name))
+	header.Method = zip.Deflate
+	header.CRC32 = d.crc
+	header.UncompressedSize64 = uint64(d.size)
+	return header
+}
+
+// deflate compresses the content of a file into memory. The checksum is
+// computed while compressing, as entries written raw need it before their
+// data.
+func (r *archiveRepositoryImpl) deflate(file *entities.FileData) (*deflatedFile, error) {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compressor: %w", err)
+	}
+	checksum := crc32.NewIEEE()
+	hash := sha256.New()
+	n, err := r.copy(io.MultiWriter(fw, checksum, hash), file.Open())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress file content: %w", err)
+	}
+	if n != file.Size() {
+		return nil, fmt.Errorf("%w: read %d of %d bytes", entities.ErrContentLength, n, file.Size())
+	}
+	if err := fw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress file content: %w", err)
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	return &deflatedFile{data: compressed.Bytes(), crc: checksum.Sum32(), size: n}, nil
+}
+
+// copy copies src to dst through a buffer of the configured size
+func (r *archiveRepositoryImpl) copy(dst io.Writer, src io.Reader) (int64, error) {
+	// Hide WriterTo, which would bypass the buffer
+	return io.CopyBuffer(dst, struct{ io.Reader }{src}, make([]byte, r.bufferSize))
+}
+
+// EstimateZipArchive predicts the entries and size of the archive that would
+// be created from files. Each file's compressed size is extrapolated from its
+// first estimateSampleSize bytes, so large files are never fully compressed.
+// Streamed files are consumed by the estimate.
+func (r *archiveRepositoryImpl) EstimateZipArchive(files []*entities.FileData, encrypted bool) (*entities.ArchiveEstimate, error) {
+	const op = "archiveRepositoryImpl.EstimateZipArchive"
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrEmptyFilesList)
+	}
+
+	estimate := &entities.ArchiveEstimate{
+		EstimatedSize: zipEndRecordSize,
+		Encrypted:     encrypted,
+		Files:         make([]entities.FileDetails, 0, len(files)),
+	}
+	for _, file := range files {
+		if err := file.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: invalid file %s: %w", op, file.Name, err)
+		}
+
+		name := filepath.Clean(file.Name)
+		compressed, err := estimateCompressedSize(file.Open(), file.Size())
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to compress file %s: %w", op, file.Name, err)
+		}
+
+		// Entries compressed ahead of writing are written raw, without a
+		// data descriptor, and encrypted ones carry the AES extra field in
+		// both headers and the salt, verifier and MAC around their data
+		overhead := int64(zipLocalHeaderSize + zipCentralHeaderSize + 2*r.entryNames.size(name))
+		switch {
+		case encrypted:
+			overhead += 2*zipAESExtraLen + zipAESOverhead
+		case r.workers == 1:
+			overhead += zipDataDescriptorSize
+		}
+
+		estimate.EstimatedSize += compressed + overhead
+		estimate.TotalSize += file.Size()
+		estimate.Files = append(estimate.Files, entities.FileDetails{
+			FilePath: name,
+			Size:     file.Size(),
+			MimeType: file.MIMEType,
+		})
+	}
+	estimate.TotalFiles = uint(len(estimate.Files))
+
+	return estimate, nil
+}
+
+// estimateCompressedSize returns the deflated size of the size bytes of
+// content, extrapolated from the first estimateSampleSize bytes when it is
+// larger. Only the sample is read.
+func estimateCompressedSize(content io.Reader, size int64) (int64, error) {
+	sample := make([]byte, min(size, estimateSampleSize))
+	if _, err := io.ReadFull(content, sample); err != nil {
+		return 0, err
+	}
+
+	var counter countingWriter
+	fw, err := flate.NewWriter(&counter, flate.DefaultCompression)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fw.Write(sample); err != nil {
+		return 0, err
+	}
+	if err := fw.Close(); err != nil {
+		return 0, err
+	}
+
+	if int64(len(sample)) == size {
+		return counter.n, nil
+	}
+	return counter.n * size / int64(len(sample)), nil
+}
+
+// countingWriter discards what is written to it, counting the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// entryType returns the type of an entry with mode, set by the Unix tools
+// that wrote it
+func entryType(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return entities.EntryTypeSymlink
+	case mode&fs.ModeDevice != 0:
+		return entities.EntryTypeDevice
+	case mode&fs.ModeNamedPipe != 0:
+		return entities.EntryTypeFIFO
+	case mode&fs.ModeSocket != 0:
+		return entities.EntryTypeSocket
+	}
+	return entities.EntryTypeFile
+}
+
 // detectMimeType attempts to detect the MIME type of a file
 func (r *archiveRepositoryImpl) detectMimeType(filename string) string {
 	mimeType := mime.TypeByExtension(filepath.Ext(filename))
@@ -0,0 +1,221 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var (
+	ErrArtifactNotFound      = errors.New("artifact not found")
+	ErrInvalidArtifactKey    = errors.New("invalid artifact key")
+	ErrInvalidArtifactConfig = errors.New("invalid artifact store configuration")
+)
+
+// Artifact is an open stored object. It can be seeked so it may be served
+// with range requests.
+type Artifact interface {
+	io.ReadSeekCloser
+	Size() int64
+	ModTime() time.Time
+}
+
+// ArtifactStore persists the outputs of jobs and requests under slash
+// separated keys, so that any instance sharing the store can read them
+type ArtifactStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Open(ctx context.Context, key string) (Artifact, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// PingArtifactStore checks the store can be reached with its credentials,
+// by listing a prefix no artifact is stored under
+func PingArtifactStore(ctx context.Context, store ArtifactStore) error {
+	_, err := store.List(ctx, "ping/")
+	return err
+}
+
+// NewArtifactStore creates the artifact store selected by the storage configuration
+func NewArtifactStore(cfg *config.StorageConfig) (ArtifactStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalArtifactStore(cfg.Dir)
+	case "s3":
+		return NewS3ArtifactStore(&cfg.S3)
+	default:
+		return nil, fmt.Errorf("%w: unknown driver %q", ErrInvalidArtifactConfig, cfg.Driver)
+	}
+}
+
+// validArtifactKey reports whether key is a clean relative path that cannot
+// escape the store
+func validArtifactKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key &&
+		key != ".." && !strings.HasPrefix(key, "../") && !strings.Contains(key, "\\")
+}
+
+// LocalArtifactStore keeps artifacts as files in a local directory
+type LocalArtifactStore struct {
+	dir string
+}
+
+// NewLocalArtifactStore creates a new instance of LocalArtifactStore,
+// creating the directory if it does not exist
+func NewLocalArtifactStore(dir string) (*LocalArtifactStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("%w: directory is required", ErrInvalidArtifactConfig)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%w: failed to create %s: %v", ErrInvalidArtifactConfig, dir, err)
+	}
+
+	return &LocalArtifactStore{dir: dir}, nil
+}
+
+// Put writes the artifact to a temporary file and renames it into place, so
+// readers never see a partial artifact
+func (s *LocalArtifactStore) Put(_ context.Context, key string, r io.Reader, _ int64) error {
+	const op = "LocalArtifactStore.Put"
+
+	if !validArtifactKey(key) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidArtifactKey)
+	}
+
+	name := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Open opens the artifact for reading
+func (s *LocalArtifactStore) Open(_ context.Context, key string) (Artifact, error) {
+	const op = "LocalArtifactStore.Open"
+
+	if !validArtifactKey(key) {
+		return nil, fmt.Errorf("%s: %w", op, ErrArtifactNotFound)
+	}
+
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", op, ErrArtifactNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &localArtifact{File: f, info: info}, nil
+}
+
+// Delete removes the artifact. Deleting a missing artifact is not an error.
+func (s *LocalArtifactStore) Delete(_ context.Context, key string) error {
+	const op = "LocalArtifactStore.Delete"
+
+	if !validArtifactKey(key) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidArtifactKey)
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Drop the directory once its last artifact is gone; this fails
+	// harmlessly while it still has entries
+	if dir := filepath.Dir(s.path(key)); dir != filepath.Clean(s.dir) {
+		os.Remove(dir)
+	}
+
+	return nil
+}
+
+// List returns the keys of the artifacts starting with prefix
+func (s *LocalArtifactStore) List(_ context.Context, prefix string) ([]string, error) {
+	const op = "LocalArtifactStore.List"
+
+	// Only the directory holding the prefix needs to be walked
+	root := s.dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = s.path(prefix[:i])
+	}
+
+	var keys []string
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, name)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *LocalArtifactStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+// localArtifact is an open artifact file
+type localArtifact struct {
+	*os.File
+	info fs.FileInfo
+}
+
+func (a *localArtifact) Size() int64        { return a.info.Size() }
+func (a *localArtifact) ModTime() time.Time { return a.info.ModTime() }
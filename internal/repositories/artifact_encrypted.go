@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EncryptedArtifactStore encrypts the artifacts of another store at rest,
+// each with its own data key wrapped by the key provider. Artifacts are
+// sealed and opened whole, in memory. Artifacts written before encryption
+// was enabled are read as they are.
+type EncryptedArtifactStore struct {
+	ArtifactStore
+	keys KeyProvider
+}
+
+// NewEncryptedArtifactStore creates a new instance of EncryptedArtifactStore
+func NewEncryptedArtifactStore(artifacts ArtifactStore, keys KeyProvider) (*EncryptedArtifactStore, error) {
+	if artifacts == nil || keys == nil {
+		return nil, fmt.Errorf("%w: encryption requires an artifact store and a key provider", ErrInvalidArtifactConfig)
+	}
+	return &EncryptedArtifactStore{ArtifactStore: artifacts, keys: keys}, nil
+}
+
+// Put encrypts and writes the artifact
+func (s *EncryptedArtifactStore) Put(ctx context.Context, key string, r io.Reader, _ int64) error {
+	const op = "EncryptedArtifactStore.Put"
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	sealed, err := SealEnvelope(ctx, s.keys, data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.ArtifactStore.Put(ctx, key, bytes.NewReader(sealed), int64(len(sealed)))
+}
+
+// Open reads and decrypts the artifact
+func (s *EncryptedArtifactStore) Open(ctx context.Context, key string) (Artifact, error) {
+	const op = "EncryptedArtifactStore.Open"
+
+	data, modTime, err := s.read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsEnvelope(data) {
+		if data, err = OpenEnvelope(ctx, s.keys, data); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, key, err)
+		}
+	}
+
+	return &memoryArtifact{Reader: bytes.NewReader(data), modTime: modTime}, nil
+}
+
+// Rewrap rewrites the artifacts under prefix whose data key is not wrapped
+// by the current master key, and encrypts those written before encryption
+// was enabled. It returns the number of artifacts rewritten.
+func (s *EncryptedArtifactStore) Rewrap(ctx context.Context, prefix string) (int, error) {
+	const op = "EncryptedArtifactStore.Rewrap"
+
+	keys, err := s.ArtifactStore.List(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rewritten := 0
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return rewritten, err
+		}
+
+		data, _, err := s.read(ctx, key)
+		if err != nil {
+			return rewritten, err
+		}
+
+		var (
+			sealed  []byte
+			changed = true
+		)
+		if IsEnvelope(data) {
+			sealed, changed, err = RewrapEnvelope(ctx, s.keys, data)
+		} else {
+			sealed, err = SealEnvelope(ctx, s.keys, data)
+		}
+		if err != nil {
+			return rewritten, fmt.Errorf("%s: %s: %w", op, key, err)
+		}
+		if !changed {
+			continue
+		}
+
+		if err := s.ArtifactStore.Put(ctx, key, bytes.NewReader(sealed), int64(len(sealed))); err != nil {
+			return rewritten, fmt.Errorf("%s: %w", op, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// read returns the stored content of an artifact and its modification time
+func (s *EncryptedArtifactStore) read(ctx context.Context, key string) ([]byte, time.Time, error) {
+	f, err := s.ArtifactStore.Open(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", key, err)
+	}
+	return data, f.ModTime(), nil
+}
+
+// memoryArtifact is an artifact held in memory
+type memoryArtifact struct {
+	*bytes.Reader
+	modTime time.Time
+}
+
+func (a *memoryArtifact) Close() error       { return nil }
+func (a *memoryArtifact) ModTime() time.Time { return a.modTime }
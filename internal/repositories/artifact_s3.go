@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// S3ArtifactStore keeps artifacts as objects in an S3 compatible bucket
+type S3ArtifactStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3ArtifactStore creates a new instance of S3ArtifactStore. Without an
+// access key, credentials are taken from the environment.
+func NewS3ArtifactStore(cfg *config.S3Config) (*S3ArtifactStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("%w: s3 endpoint and bucket are required", ErrInvalidArtifactConfig)
+	}
+
+	creds := credentials.NewEnvAWS()
+	if cfg.AccessKey != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArtifactConfig, err)
+	}
+
+	return &S3ArtifactStore{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: cfg.Prefix,
+	}, nil
+}
+
+// Put uploads the artifact. size may be -1 if unknown.
+func (s *S3ArtifactStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	const op = "S3ArtifactStore.Put"
+
+	if !validArtifactKey(key) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidArtifactKey)
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Open opens the artifact for reading. Reads are fetched lazily with range
+// requests, so seeking does not download the whole object.
+func (s *S3ArtifactStore) Open(ctx context.Context, key string) (Artifact, error) {
+	const op = "S3ArtifactStore.Open"
+
+	if !validArtifactKey(key) {
+		return nil, fmt.Errorf("%s: %w", op, ErrArtifactNotFound)
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%s: %w", op, ErrArtifactNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &s3Artifact{Object: obj, info: info}, nil
+}
+
+// Delete removes the artifact. Deleting a missing artifact is not an error.
+func (s *S3ArtifactStore) Delete(ctx context.Context, key string) error {
+	const op = "S3ArtifactStore.Delete"
+
+	if !validArtifactKey(key) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidArtifactKey)
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// List returns the keys of the artifacts starting with prefix
+func (s *S3ArtifactStore) List(ctx context.Context, prefix string) ([]string, error) {
+	const op = "S3ArtifactStore.List"
+
+	var keys []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("%s: %w", op, obj.Err)
+		}
+		keys = append(keys, strings.TrimPrefix(obj.Key, s.prefix))
+	}
+
+	return keys, nil
+}
+
+// s3Artifact is an open artifact object
+type s3Artifact struct {
+	*minio.Object
+	info minio.ObjectInfo
+}
+
+func (a *s3Artifact) Size() int64        { return a.info.Size }
+func (a *s3Artifact) ModTime() time.Time { return a.info.LastModified }
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// AuditRepository stores the audit trail of mail sent
+type AuditRepository interface {
+	Add(entry *entities.AuditEntry) error
+	// List returns the entries matching the filter, newest first, and the
+	// total number of matches
+	List(filter entities.AuditFilter) ([]*entities.AuditEntry, int, error)
+	// Delete removes every entry matching the filter, ignoring its limit and
+	// offset, and returns the number removed
+	Delete(filter entities.AuditFilter) (int, error)
+}
+
+// MemoryAuditRepository keeps the audit trail in memory
+type MemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []*entities.AuditEntry
+}
+
+// NewMemoryAuditRepository creates a new instance of MemoryAuditRepository
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+// Add stores a copy of the entry
+func (r *MemoryAuditRepository) Add(entry *entities.AuditEntry) error {
+	c := cloneAuditEntry(entry)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, c)
+	return nil
+}
+
+// List returns the entries matching the filter, newest first
+func (r *MemoryAuditRepository) List(filter entities.AuditFilter) ([]*entities.AuditEntry, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches := make([]*entities.AuditEntry, 0)
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if auditMatches(&filter, r.entries[i]) {
+			matches = append(matches, r.entries[i])
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b *entities.AuditEntry) int { return b.SentAt.Compare(a.SentAt) })
+
+	total := len(matches)
+	start := min(filter.Offset, total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+
+	page := make([]*entities.AuditEntry, 0, end-start)
+	for _, entry := range matches[start:end] {
+		page = append(page, cloneAuditEntry(entry))
+	}
+	return page, total, nil
+}
+
+// Delete removes every entry matching the filter
+func (r *MemoryAuditRepository) Delete(filter entities.AuditFilter) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.entries[:0]
+	for _, entry := range r.entries {
+		if !auditMatches(&filter, entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(r.entries) - len(kept)
+	clear(r.entries[len(kept):])
+	r.entries = kept
+
+	return removed, nil
+}
+
+// auditMatches reports whether the entry satisfies every criterion of the filter
+func auditMatches(filter *entities.AuditFilter, entry *entities.AuditEntry) bool {
+	if filter.TenantID != "" && entry.TenantID != filter.TenantID {
+		return false
+	}
+	if !filter.SentAfter.IsZero() && entry.SentAt.Before(filter.SentAfter) {
+		return false
+	}
+	if !filter.SentBefore.IsZero() && !entry.SentAt.Before(filter.SentBefore) {
+		return false
+	}
+	if filter.SHA256 != "" {
+		return slices.ContainsFunc(entry.Attachments, func(a entities.AuditAttachment) bool {
+			return a.SHA256 == filter.SHA256
+		})
+	}
+	return true
+}
+
+// cloneAuditEntry copies an entry so callers can't modify the stored state
+func cloneAuditEntry(entry *entities.AuditEntry) *entities.AuditEntry {
+	c := *entry
+	c.Recipients = slices.Clone(entry.Recipients)
+	c.Attachments = slices.Clone(entry.Attachments)
+	return &c
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var (
+	ErrInvalidAuditSinkConfig = errors.New("invalid audit export configuration")
+	ErrAuditCollectorRejected = errors.New("audit collector rejected the entries")
+)
+
+// AuditSink receives the audit trail exported off the server
+type AuditSink interface {
+	// Export sends a batch of entries, failing unless every entry was sent.
+	// A failed batch may be sent again, so entries may arrive twice.
+	Export(ctx context.Context, entries []*entities.AuditEntry) error
+	Close() error
+}
+
+// NewAuditSink creates the audit sink selected by the configuration, posting
+// to collectors with outbound. It returns nil when no sink is set.
+func NewAuditSink(cfg *config.AuditExportConfig, outbound *config.OutboundConfig) (AuditSink, error) {
+	switch cfg.Sink {
+	case "":
+		return nil, nil
+	case "syslog":
+		return NewSyslogAuditSink(&cfg.Syslog)
+	case "kafka":
+		return NewKafkaAuditSink(&cfg.Kafka, cfg.Topic)
+	case "https":
+		client, err := NewOutboundClient(outbound)
+		if err != nil {
+			return nil, err
+		}
+		return NewHTTPAuditSink(client, cfg.URL, cfg.Token), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported sink %q", ErrInvalidAuditSinkConfig, cfg.Sink)
+	}
+}
+
+// KafkaAuditSink writes every entry as a JSON record of a Kafka topic,
+// keyed by the entry id
+type KafkaAuditSink struct {
+	client *kgo.Client
+	topic  string
+}
+
+// NewKafkaAuditSink creates a new instance of KafkaAuditSink. Brokers are
+// connected to on the first export.
+func NewKafkaAuditSink(cfg *config.KafkaConfig, topic string) (*KafkaAuditSink, error) {
+	opts := []kgo.Opt{kgo.SeedBrokers(cfg.Brokers...)}
+	if cfg.ClientID != "" {
+		opts = append(opts, kgo.ClientID(cfg.ClientID))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuditSinkConfig, err)
+	}
+
+	return &KafkaAuditSink{client: client, topic: topic}, nil
+}
+
+// Export writes the entries and waits for the brokers to acknowledge them
+func (s *KafkaAuditSink) Export(ctx context.Context, entries []*entities.AuditEntry) error {
+	const op = "KafkaAuditSink.Export"
+
+	records := make([]*kgo.Record, 0, len(entries))
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		records = append(records, &kgo.Record{Topic: s.topic, Key: []byte(entry.ID), Value: data})
+	}
+
+	if err := s.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *KafkaAuditSink) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// HTTPAuditSink posts batches of entries to a collector as a JSON array
+type HTTPAuditSink struct {
+	client *OutboundClient
+	url    string
+	token  string
+}
+
+// NewHTTPAuditSink creates a new instance of HTTPAuditSink. token is sent
+// as a bearer token unless empty.
+func NewHTTPAuditSink(client *OutboundClient, url, token string) *HTTPAuditSink {
+	return &HTTPAuditSink{client: client, url: url, token: token}
+}
+
+// Export posts the entries, failing unless the collector answers with a
+// 2xx status
+func (s *HTTPAuditSink) Export(ctx context.Context, entries []*entities.AuditEntry) error {
+	const op = "HTTPAuditSink.Export"
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %w: %s", op, ErrAuditCollectorRejected, resp.Status)
+	}
+	return nil
+}
+
+func (s *HTTPAuditSink) Close() error {
+	return nil
+}
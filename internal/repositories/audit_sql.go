@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SQLAuditRepository keeps the audit trail in an SQL database. Attachments
+// are stored in their own table, indexed by hash.
+type SQLAuditRepository struct {
+	db *Database
+}
+
+// NewSQLAuditRepository creates a new instance of SQLAuditRepository
+func NewSQLAuditRepository(db *Database) (*SQLAuditRepository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is nil", ErrInvalidDatabaseConfig)
+	}
+	return &SQLAuditRepository{db: db}, nil
+}
+
+const auditColumns = `id, message_id, recipients, subject, tenant_id, sent_at`
+
+// Add stores a new entry with its attachments
+func (r *SQLAuditRepository) Add(entry *entities.AuditEntry) error {
+	const op = "SQLAuditRepository.Add"
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(r.db.rebind(`INSERT INTO audit (`+auditColumns+`) VALUES (?, ?, ?, ?, ?, ?)`),
+		entry.ID, entry.MessageID, strings.Join(entry.Recipients, ","), entry.Subject, entry.TenantID,
+		entry.SentAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, attachment := range entry.Attachments {
+		_, err := tx.Exec(r.db.rebind(`INSERT INTO audit_attachments (audit_id, position, name, size, sha256) VALUES (?, ?, ?, ?, ?)`),
+			entry.ID, i, attachment.Name, attachment.Size, attachment.SHA256)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Delete removes the entries matching the filter with their attachments
+func (r *SQLAuditRepository) Delete(filter entities.AuditFilter) (int, error) {
+	const op = "SQLAuditRepository.Delete"
+
+	where, args := auditConditions(filter)
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(r.db.rebind(`DELETE FROM audit_attachments WHERE audit_id IN (SELECT id FROM audit`+where+`)`), args...); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.Exec(r.db.rebind(`DELETE FROM audit`+where), args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(n), nil
+}
+
+// List returns the entries matching the filter, newest first, and the total number of matches
+func (r *SQLAuditRepository) List(filter entities.AuditFilter) ([]*entities.AuditEntry, int, error) {
+	const op = "SQLAuditRepository.List"
+
+	where, args := auditConditions(filter)
+
+	var total int
+	if err := r.db.QueryRow(r.db.rebind(`SELECT COUNT(*) FROM audit`+where), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query, args := r.db.paginate(`SELECT `+auditColumns+` FROM audit`+where+` ORDER BY sent_at DESC, id DESC`,
+		args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(r.db.rebind(query), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := make([]*entities.AuditEntry, 0)
+	byID := make(map[string]*entities.AuditEntry)
+	for rows.Next() {
+		var (
+			entry      = entities.AuditEntry{Attachments: []entities.AuditAttachment{}}
+			recipients string
+			sentAt     int64
+		)
+		if err := rows.Scan(&entry.ID, &entry.MessageID, &recipients, &entry.Subject, &entry.TenantID, &sentAt); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if recipients != "" {
+			entry.Recipients = strings.Split(recipients, ",")
+		}
+		entry.SentAt = time.Unix(0, sentAt)
+		entries = append(entries, &entry)
+		byID[entry.ID] = &entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	rows.Close()
+
+	if err := r.loadAttachments(byID); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, total, nil
+}
+
+// loadAttachments fills in the attachments of the entries, by id
+func (r *SQLAuditRepository) loadAttachments(entries map[string]*entities.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(entries))
+	for id := range entries {
+		args = append(args, id)
+	}
+
+	rows, err := r.db.Query(r.db.rebind(`SELECT audit_id, name, size, sha256 FROM audit_attachments
+		WHERE audit_id IN (?`+strings.Repeat(", ?", len(args)-1)+`) ORDER BY audit_id, position`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id         string
+			attachment entities.AuditAttachment
+		)
+		if err := rows.Scan(&id, &attachment.Name, &attachment.Size, &attachment.SHA256); err != nil {
+			return err
+		}
+		if entry := entries[id]; entry != nil {
+			entry.Attachments = append(entry.Attachments, attachment)
+		}
+	}
+	return rows.Err()
+}
+
+// auditConditions builds the WHERE clause selecting the entries matching
+// the filter, without its limit and offset
+func auditConditions(filter entities.AuditFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if filter.SHA256 != "" {
+		conds = append(conds, "id IN (SELECT audit_id FROM audit_attachments WHERE sha256 = ?)")
+		args = append(args, filter.SHA256)
+	}
+	if filter.TenantID != "" {
+		conds = append(conds, "tenant_id = ?")
+		args = append(args, filter.TenantID)
+	}
+	if !filter.SentAfter.IsZero() {
+		conds = append(conds, "sent_at >= ?")
+		args = append(args, filter.SentAfter.UnixNano())
+	}
+	if !filter.SentBefore.IsZero() {
+		conds = append(conds, "sent_at < ?")
+		args = append(args, filter.SentBefore.UnixNano())
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,48 @@
+//go:build !windows && !plan9
+
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SyslogAuditSink writes every entry as a JSON syslog message
+type SyslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogAuditSink connects to the syslog daemon of cfg
+func NewSyslogAuditSink(cfg *config.SyslogConfig) (*SyslogAuditSink, error) {
+	writer, err := syslog.Dial(cfg.Network, cfg.Address, syslog.LOG_NOTICE|syslog.LOG_AUTH, cfg.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to syslog: %v", ErrInvalidAuditSinkConfig, err)
+	}
+	return &SyslogAuditSink{writer: writer}, nil
+}
+
+// Export writes the entries in order. The writer reconnects to the daemon
+// when a write fails.
+func (s *SyslogAuditSink) Export(_ context.Context, entries []*entities.AuditEntry) error {
+	const op = "SyslogAuditSink.Export"
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := s.writer.Notice(string(data)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+func (s *SyslogAuditSink) Close() error {
+	return s.writer.Close()
+}
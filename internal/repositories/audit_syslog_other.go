@@ -0,0 +1,28 @@
+//go:build windows || plan9
+
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SyslogAuditSink is not supported here, as there is no syslog daemon
+type SyslogAuditSink struct{}
+
+// NewSyslogAuditSink always fails, as syslog is not supported here
+func NewSyslogAuditSink(*config.SyslogConfig) (*SyslogAuditSink, error) {
+	return nil, fmt.Errorf("%w: syslog: %w", ErrInvalidAuditSinkConfig, errors.ErrUnsupported)
+}
+
+func (*SyslogAuditSink) Export(context.Context, []*entities.AuditEntry) error {
+	return errors.ErrUnsupported
+}
+
+func (*SyslogAuditSink) Close() error {
+	return nil
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+// base64LineLength is the maximum encoded line length allowed by RFC 2045
+const base64LineLength = 76
+
+// Used to derive a plain text fallback from HTML bodies
+var (
+	htmlBreakRegex  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr)>`)
+	htmlTagRegex    = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLinesRegex = regexp.MustCompile(`\n{3,}`)
+	htmlHiddenRegex = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+)
+
+// messageComposer builds MIME messages for the mail repositories
+type messageComposer struct {
+	from *mail.Address
+	// fallbackDomain is used in Message-IDs when the from address has no domain
+	fallbackDomain string
+}
+
+// createEmailContent builds the MIME message as multipart/mixed: the body
+// comes first (see writeMessageBody), followed by the regular attachments.
+func (c *messageComposer) createEmailContent(msg *entities.MailMessage) (*bytes.Buffer, error) {
+	from := c.from
+	if msg.From != "" {
+		address, err := mail.ParseAddress(msg.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from address %q: %w", msg.From, err)
+		}
+		from = address
+	}
+
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	// Write email headers
+	headers := map[string]string{
+		"From":         from.String(),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   c.newMessageID(from),
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"To":           strings.Join(msg.To, ", "),
+		"MIME-Version": "1.0",
+		"Content-Type": fmt.Sprintf("multipart/mixed; boundary=%s", writer.Boundary()),
+	}
+
+	for key, value := range headers {
+		if _, err := fmt.Fprintf(buf, "%s: %s\r\n", key, value); err != nil {
+			return nil, fmt.Errorf("failed to write header %s: %w", key, err)
+		}
+	}
+
+	if _, err := buf.WriteString("\r\n"); err != nil {
+		return nil, fmt.Errorf("failed to write header separator: %w", err)
+	}
+
+	// Write body
+	if err := c.writeMessageBody(writer, msg); err != nil {
+		return nil, err
+	}
+
+	// Write attachments, skipping inline ones already embedded next to the HTML body
+	embedded := msg.HTML != ""
+	for _, attachment := range msg.Attachments {
+		if attachment.Inline && embedded {
+			continue
+		}
+		if err := c.writeAttachment(writer, attachment); err != nil {
+			return nil, err
+		}
+	}
+
+	// Close boundary
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close boundary: %w", err)
+	}
+
+	return buf, nil
+}
+
+// newMessageID generates a unique Message-ID using the domain of the sender
+func (c *messageComposer) newMessageID(from *mail.Address) string {
+	domain := c.fallbackDomain
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", utils.NewID(), domain)
+}
+
+// writeMessageBody writes the email body part. When an HTML body is present
+// it is sent in multipart/alternative together with a plain text fallback.
+func (c *messageComposer) writeMessageBody(writer *multipart.Writer, msg *entities.MailMessage) error {
+	if msg.HTML == "" {
+		return c.writeTextPart(writer, "text/plain", msg.Text)
+	}
+
+	text := msg.Text
+	if text == "" {
+		text = htmlToText(msg.HTML)
+	}
+
+	alternative, err := c.createNestedWriter(writer, "multipart/alternative", nil)
+	if err != nil {
+		return err
+	}
+
+	// Clients pick the last alternative they support, so the plain text goes first
+	if err := c.writeTextPart(alternative, "text/plain", text); err != nil {
+		return err
+	}
+	if err := c.writeHTMLBody(alternative, msg); err != nil {
+		return err
+	}
+
+	if err := alternative.Close(); err != nil {
+		return fmt.Errorf("failed to close alternative boundary: %w", err)
+	}
+
+	return nil
+}
+
+// writeHTMLBody writes the HTML body, wrapped in multipart/related together
+// with the inline attachments it references when there are any
+func (c *messageComposer) writeHTMLBody(writer *multipart.Writer, msg *entities.MailMessage) error {
+	var inline []*entities.Attachment
+	for _, attachment := range msg.Attachments {
+		if attachment.Inline {
+			inline = append(inline, attachment)
+		}
+	}
+
+	if len(inline) == 0 {
+		return c.writeTextPart(writer, "text/html", msg.HTML)
+	}
+
+	related, err := c.createNestedWriter(writer, "multipart/related", map[string]string{"type": "text/html"})
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeTextPart(related, "text/html", msg.HTML); err != nil {
+		return err
+	}
+
+	for _, attachment := range inline {
+		if err := c.writeAttachment(related, attachment); err != nil {
+			return err
+		}
+	}
+
+	if err := related.Close(); err != nil {
+		return fmt.Errorf("failed to close related boundary: %w", err)
+	}
+
+	return nil
+}
+
+// createNestedWriter creates a multipart part of the given media type and
+// returns a writer for its children. The caller must close the returned writer.
+func (c *messageComposer) createNestedWriter(writer *multipart.Writer, mediaType string, params map[string]string) (*multipart.Writer, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	contentParams := map[string]string{"boundary": boundary}
+	for key, value := range params {
+		contentParams[key] = value
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, contentParams))
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s part: %w", mediaType, err)
+	}
+
+	nested := multipart.NewWriter(part)
+	if err := nested.SetBoundary(boundary); err != nil {
+		return nil, fmt.Errorf("failed to set %s boundary: %w", mediaType, err)
+	}
+
+	return nested, nil
+}
+
+// writeTextPart writes a quoted-printable encoded text part
+func (c *messageComposer) writeTextPart(writer *multipart.Writer, contentType, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", contentType))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create %s part: %w", contentType, err)
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return fmt.Errorf("failed to write %s content: %w", contentType, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to flush %s content: %w", contentType, err)
+	}
+
+	return nil
+}
+
+// writeAttachment writes the file attachment part
+func (c *messageComposer) writeAttachment(writer *multipart.Writer, attachment *entities.Attachment) error {
+	file := attachment.File
+
+	disposition := "attachment"
+	if attachment.Inline {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", file.MIMEType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", fmt.Sprintf("<%s>", attachment.ContentID))
+	}
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment part %s: %w", file.Name, err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(file.Content)
+	for len(encoded) > 0 {
+		n := min(len(encoded), base64LineLength)
+		if _, err := io.WriteString(part, encoded[:n]+"\r\n"); err != nil {
+			return fmt.Errorf("failed to write attachment content: %w", err)
+		}
+		encoded = encoded[n:]
+	}
+
+	return nil
+}
+
+// htmlToText produces a readable plain text version of an HTML body
+func htmlToText(body string) string {
+	text := htmlHiddenRegex.ReplaceAllString(body, "")
+	text = htmlBreakRegex.ReplaceAllString(text, "\n")
+	text = htmlTagRegex.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+
+	text = blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,342 @@
+package repositories
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var errInvalidBinaryXML = errors.New("invalid binary xml")
+
+// Resource ids of the manifest attributes, used when an APK's string pool
+// leaves attribute names empty
+const (
+	androidVersionCodeID = 0x0101021b
+	androidVersionNameID = 0x0101021c
+)
+
+// Chunk types of Android binary XML
+const (
+	axmlStringPool   = 0x0001
+	axmlResourceMap  = 0x0180
+	axmlStartElement = 0x0102
+)
+
+// epubContainer is META-INF/container.xml of an EPUB
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the package document of an EPUB
+type epubPackage struct {
+	Metadata struct {
+		Titles    []string `xml:"title"`
+		Creators  []string `xml:"creator"`
+		Languages []string `xml:"language"`
+	} `xml:"metadata"`
+}
+
+// readContainerInfo returns the metadata of a JAR, APK or EPUB, or nil for
+// other archives
+func readContainerInfo(reader *zip.Reader) (*entities.ContainerInfo, error) {
+	parts := make(map[string]*zip.File, len(reader.File))
+	for _, f := range reader.File {
+		parts[f.Name] = f
+	}
+
+	switch {
+	case parts["mimetype"] != nil && parts["META-INF/container.xml"] != nil:
+		return readEPUBInfo(parts)
+	case parts["AndroidManifest.xml"] != nil:
+		return readAPKInfo(parts["AndroidManifest.xml"])
+	case parts["META-INF/MANIFEST.MF"] != nil:
+		return readJARInfo(parts["META-INF/MANIFEST.MF"])
+	}
+	return nil, nil
+}
+
+// readJARInfo reads the main attributes of a Java archive's manifest
+func readJARInfo(manifest *zip.File) (*entities.ContainerInfo, error) {
+	content, err := readDocumentPartContent(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := parseJARManifest(content)
+	return &entities.ContainerInfo{
+		Type:        "jar",
+		MainClass:   attributes["Main-Class"],
+		Title:       attributes["Implementation-Title"],
+		VersionName: attributes["Implementation-Version"],
+	}, nil
+}
+
+// parseJARManifest returns the attributes of the main section of a JAR
+// manifest. Lines starting with a space continue the previous value.
+func parseJARManifest(content []byte) map[string]string {
+	attributes := make(map[string]string)
+
+	var last string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, " ") {
+			if last != "" {
+				attributes[last] += line[1:]
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		last = strings.TrimSpace(name)
+		attributes[last] = strings.TrimSpace(value)
+	}
+
+	return attributes
+}
+
+// readEPUBInfo reads the title, author and language from an EPUB's package document
+func readEPUBInfo(parts map[string]*zip.File) (*entities.ContainerInfo, error) {
+	info := &entities.ContainerInfo{Type: "epub"}
+
+	var container epubContainer
+	if err := readDocumentPart(parts["META-INF/container.xml"], &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return info, nil
+	}
+
+	var pkg epubPackage
+	if err := readDocumentPart(parts[path.Clean(container.Rootfiles[0].FullPath)], &pkg); err != nil {
+		return nil, err
+	}
+	if len(pkg.Metadata.Titles) > 0 {
+		info.Title = strings.TrimSpace(pkg.Metadata.Titles[0])
+	}
+	info.Creator = strings.TrimSpace(strings.Join(pkg.Metadata.Creators, ", "))
+	if len(pkg.Metadata.Languages) > 0 {
+		info.Language = strings.TrimSpace(pkg.Metadata.Languages[0])
+	}
+
+	return info, nil
+}
+
+// readAPKInfo reads the package name and version from an APK's binary manifest
+func readAPKInfo(manifest *zip.File) (*entities.ContainerInfo, error) {
+	content, err := readDocumentPartContent(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := readAXMLRootAttributes(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidZip, manifest.Name, err)
+	}
+
+	return &entities.ContainerInfo{
+		Type:        "apk",
+		Package:     attributes["package"],
+		VersionCode: attributes["versionCode"],
+		VersionName: attributes["versionName"],
+	}, nil
+}
+
+// readAXMLRootAttributes returns the attributes of the root element of an
+// Android binary XML document, keyed by their name without namespace
+func readAXMLRootAttributes(content []byte) (map[string]string, error) {
+	if len(content) < 8 || binary.LittleEndian.Uint16(content) != 0x0003 {
+		return nil, errInvalidBinaryXML
+	}
+
+	var (
+		pool        []string
+		resourceIDs []uint32
+	)
+	for offset := int(binary.LittleEndian.Uint16(content[2:])); offset+8 <= len(content); {
+		chunkType := binary.LittleEndian.Uint16(content[offset:])
+		headerSize := int(binary.LittleEndian.Uint16(content[offset+2:]))
+		size := int(binary.LittleEndian.Uint32(content[offset+4:]))
+		if size < 8 || offset+size > len(content) || headerSize > size {
+			return nil, errInvalidBinaryXML
+		}
+		chunk := content[offset : offset+size]
+
+		switch chunkType {
+		case axmlStringPool:
+			var err error
+			if pool, err = parseAXMLStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case axmlResourceMap:
+			for i := headerSize; i+4 <= size; i += 4 {
+				resourceIDs = append(resourceIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case axmlStartElement:
+			return parseAXMLAttributes(chunk, headerSize, pool, resourceIDs)
+		}
+
+		offset += size
+	}
+
+	return nil, errInvalidBinaryXML
+}
+
+// parseAXMLStringPool decodes the strings of a string pool chunk
+func parseAXMLStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errInvalidBinaryXML
+	}
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	utf8Pool := binary.LittleEndian.Uint32(chunk[16:])&0x100 != 0
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	if count < 0 || headerSize+4*count > len(chunk) || stringsStart > len(chunk) {
+		return nil, errInvalidBinaryXML
+	}
+
+	pool := make([]string, count)
+	for i := range pool {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+4*i:]))
+		if offset >= len(chunk) {
+			return nil, errInvalidBinaryXML
+		}
+		var ok bool
+		if utf8Pool {
+			pool[i], ok = decodeAXMLUTF8(chunk[offset:])
+		} else {
+			pool[i], ok = decodeAXMLUTF16(chunk[offset:])
+		}
+		if !ok {
+			return nil, errInvalidBinaryXML
+		}
+	}
+
+	return pool, nil
+}
+
+// decodeAXMLUTF8 decodes a string of a UTF-8 pool: its length in UTF-16
+// units, its length in bytes, then the bytes
+func decodeAXMLUTF8(b []byte) (string, bool) {
+	_, n := axmlLength8(b)
+	if n == 0 {
+		return "", false
+	}
+	length, m := axmlLength8(b[n:])
+	if m == 0 || n+m+length > len(b) {
+		return "", false
+	}
+	return string(b[n+m : n+m+length]), true
+}
+
+// axmlLength8 reads a length of one byte, or two when the high bit is set
+func axmlLength8(b []byte) (int, int) {
+	if len(b) < 1 {
+		return 0, 0
+	}
+	if b[0]&0x80 == 0 {
+		return int(b[0]), 1
+	}
+	if len(b) < 2 {
+		return 0, 0
+	}
+	return int(b[0]&0x7f)<<8 | int(b[1]), 2
+}
+
+// decodeAXMLUTF16 decodes a string of a UTF-16 pool: its length in units,
+// one unit or two when the high bit is set, then the units
+func decodeAXMLUTF16(b []byte) (string, bool) {
+	if len(b) < 2 {
+		return "", false
+	}
+	length, n := int(binary.LittleEndian.Uint16(b)), 2
+	if length&0x8000 != 0 {
+		if len(b) < 4 {
+			return "", false
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(b[2:]))
+		n = 4
+	}
+	if n+2*length > len(b) {
+		return "", false
+	}
+
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[n+2*i:])
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// parseAXMLAttributes decodes the attributes of a start element chunk
+func parseAXMLAttributes(chunk []byte, headerSize int, pool []string, resourceIDs []uint32) (map[string]string, error) {
+	ext := headerSize
+	if ext+20 > len(chunk) {
+		return nil, errInvalidBinaryXML
+	}
+	attributeStart := int(binary.LittleEndian.Uint16(chunk[ext+8:]))
+	attributeSize := int(binary.LittleEndian.Uint16(chunk[ext+10:]))
+	attributeCount := int(binary.LittleEndian.Uint16(chunk[ext+12:]))
+	if attributeSize < 20 || ext+attributeStart+attributeCount*attributeSize > len(chunk) {
+		return nil, errInvalidBinaryXML
+	}
+
+	str := func(index uint32) string {
+		if int64(index) < int64(len(pool)) {
+			return pool[index]
+		}
+		return ""
+	}
+
+	attributes := make(map[string]string, attributeCount)
+	for i := range attributeCount {
+		attr := chunk[ext+attributeStart+i*attributeSize:]
+		nameIndex := binary.LittleEndian.Uint32(attr[4:])
+		rawValue := binary.LittleEndian.Uint32(attr[8:])
+		dataType := attr[15]
+		data := binary.LittleEndian.Uint32(attr[16:])
+
+		name := str(nameIndex)
+		if int64(nameIndex) < int64(len(resourceIDs)) {
+			switch resourceIDs[nameIndex] {
+			case androidVersionCodeID:
+				name = "versionCode"
+			case androidVersionNameID:
+				name = "versionName"
+			}
+		}
+
+		var value string
+		switch {
+		case rawValue != 0xffffffff:
+			value = str(rawValue)
+		case dataType == 0x03:
+			value = str(data)
+		case dataType == 0x10:
+			value = strconv.FormatInt(int64(int32(data)), 10)
+		case dataType == 0x11:
+			value = "0x" + strconv.FormatUint(uint64(data), 16)
+		case dataType == 0x12:
+			value = strconv.FormatBool(data != 0)
+		}
+		attributes[name] = value
+	}
+
+	return attributes, nil
+}
@@ -0,0 +1,340 @@
+package repositories
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// axmlAttribute is an attribute of the root element of a test manifest
+type axmlAttribute struct {
+	name     uint32
+	rawValue uint32
+	dataType byte
+	data     uint32
+}
+
+// axmlLayout holds the offsets of the chunks of a test manifest
+type axmlLayout struct {
+	pool, resourceMap, element int
+}
+
+// testManifest is the root element of the binary AndroidManifest.xml of
+// com.example.app 1.2, version code 42. The names of the version attributes
+// are resolved through the resource map.
+var (
+	testManifestStrings    = []string{"versionCode", "versionName", "package", "com.example.app", "1.2"}
+	testManifestResources  = []uint32{androidVersionCodeID, androidVersionNameID}
+	testManifestAttributes = []axmlAttribute{
+		{name: 0, rawValue: 0xffffffff, dataType: 0x10, data: 42},
+		{name: 1, rawValue: 4, dataType: 0x03, data: 4},
+		{name: 2, rawValue: 3, dataType: 0x03, data: 3},
+	}
+	testManifestExpected = map[string]string{
+		"package":     "com.example.app",
+		"versionCode": "42",
+		"versionName": "1.2",
+	}
+)
+
+// buildAXML encodes an Android binary XML document with a string pool, a
+// resource map and a root element with attrs
+func buildAXML(pool []string, utf8Pool bool, resourceIDs []uint32, attrs []axmlAttribute) ([]byte, axmlLayout) {
+	le := binary.LittleEndian
+	chunk := func(chunkType, headerSize int, header, body []byte) []byte {
+		c := make([]byte, 8, 8+len(header)+len(body))
+		le.PutUint16(c, uint16(chunkType))
+		le.PutUint16(c[2:], uint16(headerSize))
+		le.PutUint32(c[4:], uint32(8+len(header)+len(body)))
+		return append(append(c, header...), body...)
+	}
+
+	var offsets, data []byte
+	for _, s := range pool {
+		offsets = le.AppendUint32(offsets, uint32(len(data)))
+		if utf8Pool {
+			data = append(data, byte(len(utf16.Encode([]rune(s)))), byte(len(s)))
+			data = append(append(data, s...), 0)
+			continue
+		}
+		units := utf16.Encode([]rune(s))
+		data = le.AppendUint16(data, uint16(len(units)))
+		for _, u := range units {
+			data = le.AppendUint16(data, u)
+		}
+		data = le.AppendUint16(data, 0)
+	}
+	var flags uint32
+	if utf8Pool {
+		flags = 0x100
+	}
+	poolHeader := make([]byte, 20)
+	le.PutUint32(poolHeader[0:], uint32(len(pool)))
+	le.PutUint32(poolHeader[8:], flags)
+	le.PutUint32(poolHeader[12:], uint32(28+len(offsets)))
+	poolChunk := chunk(axmlStringPool, 28, poolHeader, append(offsets, data...))
+
+	var ids []byte
+	for _, id := range resourceIDs {
+		ids = le.AppendUint32(ids, id)
+	}
+	resourceChunk := chunk(axmlResourceMap, 8, nil, ids)
+
+	// Line number and comment, then the element: namespace, name,
+	// attribute start, size and count, and the id, class and style indexes
+	elementHeader := make([]byte, 8+20)
+	le.PutUint32(elementHeader[8:], 0xffffffff)
+	le.PutUint32(elementHeader[12:], 2)
+	le.PutUint16(elementHeader[16:], 20)
+	le.PutUint16(elementHeader[18:], 20)
+	le.PutUint16(elementHeader[20:], uint16(len(attrs)))
+	var attributes []byte
+	for _, attr := range attrs {
+		a := make([]byte, 20)
+		le.PutUint32(a[0:], 0xffffffff)
+		le.PutUint32(a[4:], attr.name)
+		le.PutUint32(a[8:], attr.rawValue)
+		le.PutUint16(a[12:], 8)
+		a[15] = attr.dataType
+		le.PutUint32(a[16:], attr.data)
+		attributes = append(attributes, a...)
+	}
+	elementChunk := chunk(axmlStartElement, 16, elementHeader, attributes)
+
+	layout := axmlLayout{pool: 8}
+	layout.resourceMap = layout.pool + len(poolChunk)
+	layout.element = layout.resourceMap + len(resourceChunk)
+	body := append(append(poolChunk, resourceChunk...), elementChunk...)
+	return chunk(0x0003, 8, nil, body), layout
+}
+
+func TestReadAXMLRootAttributes(t *testing.T) {
+	for _, utf8Pool := range []bool{false, true} {
+		doc, _ := buildAXML(testManifestStrings, utf8Pool, testManifestResources, testManifestAttributes)
+		attributes, err := readAXMLRootAttributes(doc)
+		require.NoError(t, err)
+		assert.Equal(t, testManifestExpected, attributes)
+	}
+}
+
+func TestReadAXMLRootAttributesTruncated(t *testing.T) {
+	for _, utf8Pool := range []bool{false, true} {
+		doc, _ := buildAXML(testManifestStrings, utf8Pool, testManifestResources, testManifestAttributes)
+		for n := range len(doc) {
+			_, err := readAXMLRootAttributes(doc[:n])
+			assert.ErrorIs(t, err, errInvalidBinaryXML, "truncated to %d bytes", n)
+		}
+	}
+}
+
+func TestReadAXMLRootAttributesMalformed(t *testing.T) {
+	le := binary.LittleEndian
+
+	tests := []struct {
+		name string
+		// mutate corrupts a valid document laid out as layout
+		mutate func(doc []byte, layout axmlLayout) []byte
+		// expected is the outcome of a document that remains readable
+		expected map[string]string
+	}{
+		{
+			name:   "Not binary XML",
+			mutate: func(doc []byte, _ axmlLayout) []byte { return []byte("<manifest/>") },
+		},
+		{
+			name: "Header past the end",
+			mutate: func(doc []byte, _ axmlLayout) []byte {
+				le.PutUint16(doc[2:], 0xffff)
+				return doc
+			},
+		},
+		{
+			name: "Chunk shorter than its header",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint32(doc[l.pool+4:], 4)
+				return doc
+			},
+		},
+		{
+			name: "Chunk past the end",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint32(doc[l.pool+4:], 0xffffffff)
+				return doc
+			},
+		},
+		{
+			name: "Chunk header larger than the chunk",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint16(doc[l.element+2:], 0xffff)
+				return doc
+			},
+		},
+		{
+			name: "String pool shorter than its header",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				// An 8 byte pool chunk followed by the rest of the document
+				pool := []byte{0x01, 0x00, 0x08, 0x00, 0x08, 0x00, 0x00, 0x00}
+				return append(append(doc[:l.pool:l.pool], pool...), doc[l.resourceMap:]...)
+			},
+		},
+		{
+			name: "String count past the pool",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint32(doc[l.pool+8:], 0xffffffff)
+				return doc
+			},
+		},
+		{
+			name: "Strings start past the pool",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint32(doc[l.pool+20:], 0xffffffff)
+				return doc
+			},
+		},
+		{
+			name: "String offset past the pool",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint32(doc[l.pool+28:], 0x7fffffff)
+				return doc
+			},
+		},
+		{
+			name: "String length past the pool",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				// The UTF-16 length of the first string, with the high bit set
+				// for a two unit length
+				start := l.pool + int(le.Uint32(doc[l.pool+20:]))
+				le.PutUint16(doc[start:], 0xffff)
+				le.PutUint16(doc[start+2:], 0xffff)
+				return doc
+			},
+		},
+		{
+			name: "Attribute size below the minimum",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint16(doc[l.element+16+10:], 4)
+				return doc
+			},
+		},
+		{
+			name: "Attributes past the element",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint16(doc[l.element+16+12:], 0xffff)
+				return doc
+			},
+		},
+		{
+			name: "Attribute start past the element",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				le.PutUint16(doc[l.element+16+8:], 0xffff)
+				return doc
+			},
+		},
+		{
+			name: "Element header past the element",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				// The element chunk is cut to its 16 byte header
+				le.PutUint32(doc[l.element+4:], 16)
+				le.PutUint16(doc[l.element+2:], 16)
+				return doc[:l.element+16]
+			},
+		},
+		{
+			name: "No start element",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				return doc[:l.element]
+			},
+		},
+		{
+			name: "String indexes outside the pool",
+			mutate: func(doc []byte, l axmlLayout) []byte {
+				// The value of the package attribute
+				attributes := l.element + 16 + 20
+				le.PutUint32(doc[attributes+2*20+8:], 1000)
+				return doc
+			},
+			expected: map[string]string{
+				"package":     "",
+				"versionCode": "42",
+				"versionName": "1.2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, layout := buildAXML(testManifestStrings, false, testManifestResources, testManifestAttributes)
+			attributes, err := readAXMLRootAttributes(tt.mutate(doc, layout))
+			if tt.expected != nil {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, attributes)
+				return
+			}
+			assert.ErrorIs(t, err, errInvalidBinaryXML)
+		})
+	}
+}
+
+func FuzzReadAXMLRootAttributes(f *testing.F) {
+	for _, utf8Pool := range []bool{false, true} {
+		doc, _ := buildAXML(testManifestStrings, utf8Pool, testManifestResources, testManifestAttributes)
+		f.Add(doc)
+	}
+	f.Add([]byte{0x03, 0x00, 0x08, 0x00})
+
+	// Any input is either refused or decoded, without reading out of bounds
+	f.Fuzz(func(t *testing.T, doc []byte) {
+		attributes, err := readAXMLRootAttributes(doc)
+		if err != nil {
+			assert.ErrorIs(t, err, errInvalidBinaryXML)
+			assert.Nil(t, attributes)
+		}
+	})
+}
+
+func TestReadContainerInfo(t *testing.T) {
+	manifest, _ := buildAXML(testManifestStrings, true, testManifestResources, testManifestAttributes)
+
+	archive := func(files map[string][]byte) *zip.Reader {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for name, content := range files {
+			fw, err := w.Create(name)
+			require.NoError(t, err)
+			_, err = fw.Write(content)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		return r
+	}
+
+	info, err := readContainerInfo(archive(map[string][]byte{"AndroidManifest.xml": manifest}))
+	require.NoError(t, err)
+	assert.Equal(t, "apk", info.Type)
+	assert.Equal(t, "com.example.app", info.Package)
+	assert.Equal(t, "42", info.VersionCode)
+	assert.Equal(t, "1.2", info.VersionName)
+
+	// A truncated manifest makes the archive invalid rather than failing
+	// the request
+	_, err = readContainerInfo(archive(map[string][]byte{"AndroidManifest.xml": manifest[:len(manifest)/2]}))
+	assert.ErrorIs(t, err, ErrInvalidZip)
+
+	info, err = readContainerInfo(archive(map[string][]byte{
+		"META-INF/MANIFEST.MF": []byte("Manifest-Version: 1.0\r\nMain-Class: com.example.\r\n Main\r\n\r\nName: other\r\nMain-Class: Other\r\n"),
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "jar", info.Type)
+	assert.Equal(t, "com.example.Main", info.MainClass)
+
+	info, err = readContainerInfo(archive(map[string][]byte{"readme.txt": []byte("hello")}))
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
@@ -0,0 +1,341 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Database drivers selectable through the database.driver setting
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var ErrInvalidDatabaseConfig = errors.New("invalid database configuration")
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Database is an SQL connection together with the dialect of its driver
+type Database struct {
+	*sql.DB
+	driver string
+}
+
+// migrationFiles holds the schema history of every driver as
+// migrations/<driver>/<version>_<name>.sql files
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFileRegex matches migration file names such as 0001_create_jobs.sql
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.sql$`)
+
+// migration is a schema change applied once, in version order
+type migration struct {
+	version int
+	name    string
+	// statements are executed separately, in order
+	statements []string
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// Applied reports whether the migration has been applied
+func (s MigrationStatus) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// loadMigrations reads the embedded migrations of the driver in version order
+func loadMigrations(driver string) ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations/"+driver)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile("migrations/" + driver + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{
+			version:    version,
+			name:       strings.ReplaceAll(match[2], "_", " "),
+			statements: splitStatements(string(data)),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// splitStatements splits a migration file into statements at semicolons
+// ending a line
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// OpenDatabase connects to the configured database and, unless automatic
+// migrations are disabled, applies pending migrations
+func OpenDatabase(cfg *config.DatabaseConfig) (*Database, error) {
+	const op = "OpenDatabase"
+
+	db, err := ConnectDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.AutoMigrate {
+		return db, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := db.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return db, nil
+}
+
+// ConnectDatabase connects to the configured database without migrating it
+func ConnectDatabase(cfg *config.DatabaseConfig) (*Database, error) {
+	const op = "ConnectDatabase"
+
+	if cfg == nil || cfg.DSN == "" {
+		return nil, fmt.Errorf("%s: %w: dsn is required", op, ErrInvalidDatabaseConfig)
+	}
+
+	driver := cfg.Driver
+	if driver == "" {
+		driver = DriverSQLite
+	}
+
+	switch driver {
+	case DriverSQLite:
+		if dir := filepath.Dir(cfg.DSN); !strings.HasPrefix(cfg.DSN, "file:") && dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("%s: failed to create %s: %w", op, dir, err)
+			}
+		}
+	case DriverPostgres:
+	default:
+		return nil, fmt.Errorf("%s: %w: unsupported driver %q", op, ErrInvalidDatabaseConfig, driver)
+	}
+
+	sqlDB, err := sql.Open(driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if driver == DriverSQLite {
+		// SQLite allows a single writer; serializing connections avoids "database is locked"
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("%s: failed to connect: %w", op, err)
+	}
+
+	return &Database{DB: sqlDB, driver: driver}, nil
+}
+
+// Migrate applies every migration newer than the recorded schema version and
+// returns the migrations applied
+func (db *Database) Migrate(ctx context.Context) ([]MigrationStatus, error) {
+	const op = "Database.Migrate"
+
+	migrations, err := loadMigrations(db.driver)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	current, err := db.schemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var applied []MigrationStatus
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return applied, fmt.Errorf("%s: migration %d: %w", op, m.version, err)
+		}
+
+		for _, stmt := range m.statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				tx.Rollback()
+				return applied, fmt.Errorf("%s: migration %d (%s): %w", op, m.version, m.name, err)
+			}
+		}
+
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx, db.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			m.version, m.name, now.Unix()); err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("%s: migration %d: %w", op, m.version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return applied, fmt.Errorf("%s: migration %d: %w", op, m.version, err)
+		}
+
+		applied = append(applied, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: now})
+	}
+
+	return applied, nil
+}
+
+// MigrationStatuses lists the known migrations with the time each was applied
+func (db *Database) MigrationStatuses(ctx context.Context) ([]MigrationStatus, error) {
+	const op = "Database.MigrationStatuses"
+
+	migrations, err := loadMigrations(db.driver)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := db.schemaVersion(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		appliedAt[version] = time.Unix(at, 0)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		statuses = append(statuses, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: appliedAt[m.version]})
+	}
+
+	return statuses, nil
+}
+
+// schemaVersion creates the schema_migrations table if needed and returns
+// the version of the latest applied migration
+func (db *Database) schemaVersion(ctx context.Context) (int, error) {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return current, nil
+}
+
+// paginate appends the LIMIT and OFFSET clauses of a page to query. A limit
+// of zero means no limit.
+func (db *Database) paginate(query string, args []any, limit, offset int) (string, []any) {
+	switch {
+	case limit > 0:
+		return query + ` LIMIT ? OFFSET ?`, append(args, limit, offset)
+	case offset > 0 && db.driver == DriverPostgres:
+		return query + ` OFFSET ?`, append(args, offset)
+	case offset > 0:
+		// SQLite requires a LIMIT before OFFSET
+		return query + ` LIMIT -1 OFFSET ?`, append(args, offset)
+	default:
+		return query, args
+	}
+}
+
+// rebind converts ? placeholders to the $n form used by Postgres
+func (db *Database) rebind(query string) string {
+	if db.driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,247 @@
+package repositories
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var ErrNotADocument = errors.New("file is not an office document")
+
+// maxDocumentPartSize bounds the metadata parts read from a document, so a
+// crafted part cannot decompress to an arbitrary size
+const maxDocumentPartSize = 1 << 20
+
+// ooxmlMainParts identify the format of an Office Open XML document
+var ooxmlMainParts = map[string]string{
+	"word/document.xml":    "docx",
+	"xl/workbook.xml":      "xlsx",
+	"ppt/presentation.xml": "pptx",
+}
+
+// odfMIMETypes identify the format of an OpenDocument document
+var odfMIMETypes = map[string]string{
+	"application/vnd.oasis.opendocument.text":         "odt",
+	"application/vnd.oasis.opendocument.spreadsheet":  "ods",
+	"application/vnd.oasis.opendocument.presentation": "odp",
+}
+
+// ooxmlCoreProperties is docProps/core.xml of an Office Open XML document
+type ooxmlCoreProperties struct {
+	Title          string `xml:"title"`
+	Subject        string `xml:"subject"`
+	Description    string `xml:"description"`
+	Keywords       string `xml:"keywords"`
+	Creator        string `xml:"creator"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Created        string `xml:"created"`
+	Modified       string `xml:"modified"`
+}
+
+// ooxmlAppProperties is docProps/app.xml of an Office Open XML document
+type ooxmlAppProperties struct {
+	Application string `xml:"Application"`
+	Pages       int    `xml:"Pages"`
+	Words       int    `xml:"Words"`
+	Characters  int    `xml:"Characters"`
+	Paragraphs  int    `xml:"Paragraphs"`
+	Slides      int    `xml:"Slides"`
+}
+
+// odfMeta is meta.xml of an OpenDocument document
+type odfMeta struct {
+	Meta struct {
+		Generator      string   `xml:"generator"`
+		Title          string   `xml:"title"`
+		Subject        string   `xml:"subject"`
+		Description    string   `xml:"description"`
+		Keywords       []string `xml:"keyword"`
+		InitialCreator string   `xml:"initial-creator"`
+		Creator        string   `xml:"creator"`
+		CreationDate   string   `xml:"creation-date"`
+		Date           string   `xml:"date"`
+		Statistic      struct {
+			Pages      int `xml:"page-count,attr"`
+			Words      int `xml:"word-count,attr"`
+			Characters int `xml:"character-count,attr"`
+			Paragraphs int `xml:"paragraph-count,attr"`
+			Tables     int `xml:"table-count,attr"`
+		} `xml:"document-statistic"`
+	} `xml:"meta"`
+}
+
+// GetDocumentInfo returns the metadata of an Office Open XML or OpenDocument
+// document of size bytes. Only the metadata parts are read, never the
+// document body. ErrNotADocument is returned for other zip archives.
+func (r *archiveRepositoryImpl) GetDocumentInfo(reader io.ReaderAt, size int64, filename string) (*entities.DocumentInfo, error) {
+	const op = "archiveRepositoryImpl.GetDocumentInfo"
+
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidZip)
+	}
+
+	parts := make(map[string]*zip.File, len(zipReader.File))
+	for _, f := range zipReader.File {
+		parts[f.Name] = f
+	}
+
+	info := &entities.DocumentInfo{Filename: filename, Size: size}
+	switch {
+	case parts["[Content_Types].xml"] != nil:
+		err = readOOXMLInfo(parts, info)
+	case parts["mimetype"] != nil:
+		err = readODFInfo(parts, info)
+	default:
+		err = ErrNotADocument
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return info, nil
+}
+
+// readOOXMLInfo fills info from the core and app properties of an Office
+// Open XML document
+func readOOXMLInfo(parts map[string]*zip.File, info *entities.DocumentInfo) error {
+	for part, format := range ooxmlMainParts {
+		if parts[part] != nil {
+			info.Format = format
+			break
+		}
+	}
+	if info.Format == "" {
+		return ErrNotADocument
+	}
+
+	var core ooxmlCoreProperties
+	if err := readDocumentPart(parts["docProps/core.xml"], &core); err != nil {
+		return err
+	}
+	info.Title = core.Title
+	info.Subject = core.Subject
+	info.Description = core.Description
+	info.Keywords = core.Keywords
+	info.Creator = core.Creator
+	info.LastModifiedBy = core.LastModifiedBy
+	info.Created = parseDocumentTime(core.Created)
+	info.Modified = parseDocumentTime(core.Modified)
+
+	var app ooxmlAppProperties
+	if err := readDocumentPart(parts["docProps/app.xml"], &app); err != nil {
+		return err
+	}
+	info.Application = app.Application
+	info.Pages = app.Pages
+	info.Words = app.Words
+	info.Characters = app.Characters
+	info.Paragraphs = app.Paragraphs
+	info.Slides = app.Slides
+	if info.Format == "xlsx" {
+		info.Sheets = countSheets(parts)
+	}
+
+	return nil
+}
+
+// readODFInfo fills info from the metadata of an OpenDocument document
+func readODFInfo(parts map[string]*zip.File, info *entities.DocumentInfo) error {
+	mimeType, err := readDocumentPartContent(parts["mimetype"])
+	if err != nil {
+		return err
+	}
+	info.Format = odfMIMETypes[strings.TrimSpace(string(mimeType))]
+	if info.Format == "" {
+		return ErrNotADocument
+	}
+
+	var meta odfMeta
+	if err := readDocumentPart(parts["meta.xml"], &meta); err != nil {
+		return err
+	}
+	info.Title = meta.Meta.Title
+	info.Subject = meta.Meta.Subject
+	info.Description = meta.Meta.Description
+	info.Keywords = strings.Join(meta.Meta.Keywords, ", ")
+	info.Creator = meta.Meta.InitialCreator
+	info.LastModifiedBy = meta.Meta.Creator
+	info.Created = parseDocumentTime(meta.Meta.CreationDate)
+	info.Modified = parseDocumentTime(meta.Meta.Date)
+	info.Application = meta.Meta.Generator
+	info.Pages = meta.Meta.Statistic.Pages
+	info.Words = meta.Meta.Statistic.Words
+	info.Characters = meta.Meta.Statistic.Characters
+	info.Paragraphs = meta.Meta.Statistic.Paragraphs
+	if info.Format == "ods" {
+		info.Sheets = meta.Meta.Statistic.Tables
+	}
+
+	return nil
+}
+
+// readDocumentPart decodes an XML part into v. Missing parts are skipped,
+// since the metadata parts are optional.
+func readDocumentPart(part *zip.File, v any) error {
+	if part == nil {
+		return nil
+	}
+
+	content, err := readDocumentPartContent(part)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%w: invalid %s: %v", ErrInvalidZip, part.Name, err)
+	}
+
+	return nil
+}
+
+// readDocumentPartContent reads a part of at most maxDocumentPartSize bytes
+func readDocumentPartContent(part *zip.File) ([]byte, error) {
+	rc, err := part.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidZip, part.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxDocumentPartSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidZip, part.Name, err)
+	}
+	if len(content) > maxDocumentPartSize {
+		return nil, fmt.Errorf("%w: %s is too large", ErrInvalidZip, part.Name)
+	}
+
+	return content, nil
+}
+
+// countSheets returns the number of worksheets of a spreadsheet
+func countSheets(parts map[string]*zip.File) int {
+	sheets := 0
+	for name := range parts {
+		if strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml") && !strings.Contains(name[len("xl/worksheets/"):], "/") {
+			sheets++
+		}
+	}
+	return sheets
+}
+
+// parseDocumentTime parses a W3CDTF or ISO 8601 timestamp, as written by
+// office suites, returning nil when it is missing or malformed
+func parseDocumentTime(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
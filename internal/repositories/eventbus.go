@@ -0,0 +1,34 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var ErrInvalidEventBusConfig = errors.New("invalid event bus configuration")
+
+// EventBus publishes messages to the topics of a message broker
+type EventBus interface {
+	// Publish sends payload to topic, returning once the broker has it.
+	// key identifies the message, so the broker can discard duplicates.
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+	Close() error
+}
+
+// NewEventBus connects to the event bus selected by the configuration. It
+// returns nil when no driver is set.
+func NewEventBus(cfg *config.EventsConfig) (EventBus, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, nil
+	case "nats":
+		return NewNATSEventBus(&cfg.NATS)
+	case "kafka":
+		return NewKafkaEventBus(&cfg.Kafka)
+	default:
+		return nil, fmt.Errorf("%w: unsupported driver %q", ErrInvalidEventBusConfig, cfg.Driver)
+	}
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// KafkaEventBus publishes messages to Kafka topics, keyed by their key
+type KafkaEventBus struct {
+	client *kgo.Client
+}
+
+// NewKafkaEventBus creates a new instance of KafkaEventBus. Brokers are
+// connected to on the first publication.
+func NewKafkaEventBus(cfg *config.KafkaConfig) (*KafkaEventBus, error) {
+	opts := []kgo.Opt{kgo.SeedBrokers(cfg.Brokers...)}
+	if cfg.ClientID != "" {
+		opts = append(opts, kgo.ClientID(cfg.ClientID))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEventBusConfig, err)
+	}
+
+	return &KafkaEventBus{client: client}, nil
+}
+
+// Publish sends the message and waits for the in-sync replicas of its
+// partition to acknowledge it
+func (b *KafkaEventBus) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	const op = "KafkaEventBus.Publish"
+
+	record := &kgo.Record{Topic: topic, Key: []byte(key), Value: payload}
+	if err := b.client.ProduceSync(ctx, record).FirstErr(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Close flushes the records still buffered and closes the client
+func (b *KafkaEventBus) Close() error {
+	b.client.Close()
+	return nil
+}
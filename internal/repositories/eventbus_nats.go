@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// NATSEventBus publishes messages to NATS subjects. Messages carry their key
+// in the Nats-Msg-Id header, which JetStream streams use to drop duplicates.
+type NATSEventBus struct {
+	conn *nats.Conn
+}
+
+// NewNATSEventBus connects to the NATS servers of cfg. The connection is
+// kept up for as long as the bus is open, reconnecting whenever it is lost.
+func NewNATSEventBus(cfg *config.NATSConfig) (*NATSEventBus, error) {
+	opts := []nats.Option{
+		nats.Name("doozip"),
+		nats.MaxReconnects(-1),
+	}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredentialsFile))
+	}
+
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEventBusConfig, err)
+	}
+
+	return &NATSEventBus{conn: conn}, nil
+}
+
+// Publish sends the message and waits for the server to receive it
+func (b *NATSEventBus) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	const op = "NATSEventBus.Publish"
+
+	msg := nats.NewMsg(topic)
+	msg.Header.Set(nats.MsgIdHdr, key)
+	msg.Data = payload
+	if err := b.conn.PublishMsg(msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := b.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Close closes the connection. Messages are flushed as they are published,
+// so none are left buffered.
+func (b *NATSEventBus) Close() error {
+	b.conn.Close()
+	return nil
+}
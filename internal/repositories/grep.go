@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// grepMaxLineLength is the most bytes of a matching line returned; longer
+// lines are cut
+const grepMaxLineLength = 1 << 10
+
+// grepBufferSize is the size of the buffer entries are read through. Lines
+// longer than it are matched a buffer at a time.
+const grepBufferSize = 64 << 10
+
+// grepSniffSize is the prefix of an entry checked for NUL bytes, the mark of
+// binary content
+const grepSniffSize = 512
+
+// SearchOptions selects the entries of an archive searched by SearchArchive
+type SearchOptions struct {
+	// Match accepts the paths of the entries searched; nil accepts them all
+	Match func(path string) bool
+	// Limit is the most entries returned; zero returns them all
+	Limit int
+	// Grep searches the content of the entries when it is not nil, which
+	// then only match when a line of theirs does
+	Grep *GrepOptions
+	// Special decides what is done with the entries that are not regular
+	// files; nil lists them like the others
+	Special SpecialFunc
+}
+
+// GrepOptions searches the lines of the text entries of an archive, within
+// the limits of Limits
+type GrepOptions struct {
+	Match  func(line []byte) bool
+	Limits config.ArchiveGrepConfig
+}
+
+// grepState tracks the limits of a content search across the entries of an
+// archive
+type grepState struct {
+	opts  *GrepOptions
+	files int
+	bytes int64
+	// full is set once the matching lines reach their limit, which ends the
+	// search
+	full bool
+}
+
+// allows reports whether an entry can be searched within the limits, and
+// takes its share of them when it can
+func (g *grepState) allows(f *zip.File) bool {
+	limits := g.opts.Limits
+	size := int64(f.UncompressedSize64)
+	switch {
+	case f.Flags&zipFlagEncrypted != 0:
+		return false
+	case limits.MaxFileSize > 0 && size > limits.MaxFileSize:
+		return false
+	case limits.MaxFiles > 0 && g.files >= limits.MaxFiles:
+		return false
+	case limits.MaxBytes > 0 && g.bytes+size > limits.MaxBytes:
+		return false
+	}
+	g.files++
+	g.bytes += size
+	return true
+}
+
+// grep searches the lines of an entry named name, streaming its
+// decompressed content, and appends the matching ones to search. It reports
+// whether any line matched, and false for binary entries. An entry failing
+// to decompress is reported as not searched.
+func (g *grepState) grep(f *zip.File, name string, search *entities.ArchiveSearch) (matched, searched bool) {
+	rc, err := f.Open()
+	if err != nil {
+		return false, false
+	}
+	defer rc.Close()
+
+	reader := bufio.NewReaderSize(rc, grepBufferSize)
+	head, err := reader.Peek(grepSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, false
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false, true
+	}
+
+	maxLines := g.opts.Limits.MaxLines
+	line, reported := 1, false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 && !reported && g.opts.Match(chunk) {
+			matched, reported = true, true
+			if maxLines > 0 && len(search.Lines) >= maxLines {
+				g.full = true
+				search.Truncated = true
+				return matched, true
+			}
+			search.Lines = append(search.Lines, entities.LineMatch{
+				FilePath: name,
+				Line:     line,
+				Text:     lineText(chunk),
+			})
+		}
+		switch err {
+		case nil:
+			line++
+			reported = false
+		case bufio.ErrBufferFull:
+			// The rest of the line is matched with the next chunk
+		case io.EOF:
+			return matched, true
+		default:
+			return matched, false
+		}
+	}
+}
+
+// lineText returns a matching line as it is reported: without its line
+// ending, cut to grepMaxLineLength and made valid UTF-8
+func lineText(line []byte) string {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) > grepMaxLineLength {
+		line = line[:grepMaxLineLength]
+	}
+	return strings.ToValidUTF8(string(line), "�")
+}
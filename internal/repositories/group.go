@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var (
+	ErrGroupNotFound = errors.New("recipient group not found")
+	ErrGroupExists   = errors.New("recipient group already exists")
+)
+
+// GroupRepository stores the recipient groups, per tenant
+type GroupRepository interface {
+	// Create stores a new group, failing with ErrGroupExists when the tenant
+	// has a group of the name already
+	Create(group *entities.RecipientGroup) error
+	// Update replaces the addresses of an existing group
+	Update(group *entities.RecipientGroup) error
+	Get(tenantID, name string) (*entities.RecipientGroup, error)
+	// List returns the groups of a tenant, sorted by name
+	List(tenantID string) ([]*entities.RecipientGroup, error)
+	Delete(tenantID, name string) error
+}
+
+// groupKey identifies a group of a tenant
+type groupKey struct {
+	tenantID, name string
+}
+
+// MemoryGroupRepository keeps the recipient groups in memory; they are lost
+// on restart
+type MemoryGroupRepository struct {
+	mu     sync.RWMutex
+	groups map[groupKey]entities.RecipientGroup
+}
+
+// NewMemoryGroupRepository creates a new instance of MemoryGroupRepository
+func NewMemoryGroupRepository() *MemoryGroupRepository {
+	return &MemoryGroupRepository{groups: make(map[groupKey]entities.RecipientGroup)}
+}
+
+// Create stores a new group
+func (r *MemoryGroupRepository) Create(group *entities.RecipientGroup) error {
+	const op = "MemoryGroupRepository.Create"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := groupKey{group.TenantID, group.Name}
+	if _, exists := r.groups[key]; exists {
+		return fmt.Errorf("%s: %w", op, ErrGroupExists)
+	}
+	r.groups[key] = copyGroup(group)
+
+	return nil
+}
+
+// Update replaces the addresses of an existing group
+func (r *MemoryGroupRepository) Update(group *entities.RecipientGroup) error {
+	const op = "MemoryGroupRepository.Update"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := groupKey{group.TenantID, group.Name}
+	existing, exists := r.groups[key]
+	if !exists {
+		return fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+	}
+	updated := copyGroup(group)
+	updated.CreatedAt = existing.CreatedAt
+	r.groups[key] = updated
+
+	return nil
+}
+
+// Get returns a group of a tenant
+func (r *MemoryGroupRepository) Get(tenantID, name string) (*entities.RecipientGroup, error) {
+	const op = "MemoryGroupRepository.Get"
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	group, exists := r.groups[groupKey{tenantID, name}]
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+	}
+	c := copyGroup(&group)
+	return &c, nil
+}
+
+// List returns the groups of a tenant, sorted by name
+func (r *MemoryGroupRepository) List(tenantID string) ([]*entities.RecipientGroup, error) {
+	r.mu.RLock()
+	groups := make([]*entities.RecipientGroup, 0)
+	for key, group := range r.groups {
+		if key.tenantID == tenantID {
+			c := copyGroup(&group)
+			groups = append(groups, &c)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(groups, func(a, b *entities.RecipientGroup) int { return strings.Compare(a.Name, b.Name) })
+	return groups, nil
+}
+
+// Delete removes a group
+func (r *MemoryGroupRepository) Delete(tenantID, name string) error {
+	const op = "MemoryGroupRepository.Delete"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := groupKey{tenantID, name}
+	if _, exists := r.groups[key]; !exists {
+		return fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+	}
+	delete(r.groups, key)
+
+	return nil
+}
+
+// copyGroup copies a group so callers can't change the stored addresses
+func copyGroup(group *entities.RecipientGroup) entities.RecipientGroup {
+	c := *group
+	c.Addresses = slices.Clone(group.Addresses)
+	return c
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SQLGroupRepository keeps the recipient groups in an SQL database
+type SQLGroupRepository struct {
+	db *Database
+}
+
+// NewSQLGroupRepository creates a new instance of SQLGroupRepository
+func NewSQLGroupRepository(db *Database) (*SQLGroupRepository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is nil", ErrInvalidDatabaseConfig)
+	}
+	return &SQLGroupRepository{db: db}, nil
+}
+
+// Create stores a new group
+func (r *SQLGroupRepository) Create(group *entities.RecipientGroup) error {
+	const op = "SQLGroupRepository.Create"
+
+	res, err := r.db.Exec(r.db.rebind(`INSERT INTO recipient_groups (tenant_id, name, addresses, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, name) DO NOTHING`),
+		group.TenantID, group.Name, strings.Join(group.Addresses, ","), group.CreatedAt.UnixNano(), group.UpdatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrGroupExists)
+	}
+
+	return nil
+}
+
+// Update replaces the addresses of an existing group
+func (r *SQLGroupRepository) Update(group *entities.RecipientGroup) error {
+	const op = "SQLGroupRepository.Update"
+
+	res, err := r.db.Exec(r.db.rebind(`UPDATE recipient_groups SET addresses = ?, updated_at = ? WHERE tenant_id = ? AND name = ?`),
+		strings.Join(group.Addresses, ","), group.UpdatedAt.UnixNano(), group.TenantID, group.Name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+	}
+
+	return nil
+}
+
+// Get returns a group of a tenant
+func (r *SQLGroupRepository) Get(tenantID, name string) (*entities.RecipientGroup, error) {
+	const op = "SQLGroupRepository.Get"
+
+	row := r.db.QueryRow(r.db.rebind(`SELECT name, addresses, created_at, updated_at FROM recipient_groups
+		WHERE tenant_id = ? AND name = ?`), tenantID, name)
+	group, err := scanGroup(row, tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return group, nil
+}
+
+// List returns the groups of a tenant, sorted by name
+func (r *SQLGroupRepository) List(tenantID string) ([]*entities.RecipientGroup, error) {
+	const op = "SQLGroupRepository.List"
+
+	rows, err := r.db.Query(r.db.rebind(`SELECT name, addresses, created_at, updated_at FROM recipient_groups
+		WHERE tenant_id = ? ORDER BY name`), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	groups := make([]*entities.RecipientGroup, 0)
+	for rows.Next() {
+		group, err := scanGroup(rows, tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return groups, nil
+}
+
+// Delete removes a group
+func (r *SQLGroupRepository) Delete(tenantID, name string) error {
+	const op = "SQLGroupRepository.Delete"
+
+	res, err := r.db.Exec(r.db.rebind(`DELETE FROM recipient_groups WHERE tenant_id = ? AND name = ?`), tenantID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+	}
+
+	return nil
+}
+
+// scanGroup reads a group from a row of name, addresses, created_at and
+// updated_at
+func scanGroup(row rowScanner, tenantID string) (*entities.RecipientGroup, error) {
+	var (
+		group                = entities.RecipientGroup{TenantID: tenantID}
+		addresses            string
+		createdAt, updatedAt int64
+	)
+	if err := row.Scan(&group.Name, &addresses, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	group.Addresses = []string{}
+	if addresses != "" {
+		group.Addresses = strings.Split(addresses, ",")
+	}
+	group.CreatedAt = time.Unix(0, createdAt)
+	group.UpdatedAt = time.Unix(0, updatedAt)
+	return &group, nil
+}
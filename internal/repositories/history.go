@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// HistoryRepository stores the metadata of processed uploads
+type HistoryRepository interface {
+	Add(entry *entities.HistoryEntry) error
+	// List returns the entries matching the filter, newest first, and the
+	// total number of matches
+	List(filter entities.HistoryFilter) ([]*entities.HistoryEntry, int, error)
+	// Delete removes every entry matching the filter, ignoring its limit and
+	// offset, and returns the number removed
+	Delete(filter entities.HistoryFilter) (int, error)
+}
+
+// MemoryHistoryRepository keeps upload history in memory
+type MemoryHistoryRepository struct {
+	mu      sync.RWMutex
+	entries []*entities.HistoryEntry
+}
+
+// NewMemoryHistoryRepository creates a new instance of MemoryHistoryRepository
+func NewMemoryHistoryRepository() *MemoryHistoryRepository {
+	return &MemoryHistoryRepository{}
+}
+
+// Add stores a copy of the entry
+func (r *MemoryHistoryRepository) Add(entry *entities.HistoryEntry) error {
+	c := *entry
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, &c)
+	return nil
+}
+
+// Delete removes the entries matching the filter
+func (r *MemoryHistoryRepository) Delete(filter entities.HistoryFilter) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.entries[:0]
+	for _, entry := range r.entries {
+		if !filter.Matches(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(r.entries) - len(kept)
+	clear(r.entries[len(kept):])
+	r.entries = kept
+
+	return removed, nil
+}
+
+// List returns copies of the entries matching the filter, newest first
+func (r *MemoryHistoryRepository) List(filter entities.HistoryFilter) ([]*entities.HistoryEntry, int, error) {
+	r.mu.RLock()
+	matches := make([]*entities.HistoryEntry, 0)
+	for _, entry := range r.entries {
+		if filter.Matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].StartedAt.After(matches[j].StartedAt)
+	})
+
+	total := len(matches)
+	start := min(filter.Offset, total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+
+	page := make([]*entities.HistoryEntry, 0, end-start)
+	for _, entry := range matches[start:end] {
+		c := *entry
+		page = append(page, &c)
+	}
+
+	return page, total, nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SQLHistoryRepository keeps upload history in an SQL database
+type SQLHistoryRepository struct {
+	db *Database
+}
+
+// NewSQLHistoryRepository creates a new instance of SQLHistoryRepository
+func NewSQLHistoryRepository(db *Database) (*SQLHistoryRepository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is nil", ErrInvalidDatabaseConfig)
+	}
+	return &SQLHistoryRepository{db: db}, nil
+}
+
+const historyColumns = `id, kind, filename, size, entry_count, recipients, result, error, tenant_id, api_key_id, job_id, started_at, finished_at`
+
+// Add stores a new entry
+func (r *SQLHistoryRepository) Add(entry *entities.HistoryEntry) error {
+	const op = "SQLHistoryRepository.Add"
+
+	_, err := r.db.Exec(r.db.rebind(`INSERT INTO history (`+historyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		entry.ID, string(entry.Kind), entry.Filename, entry.Size, entry.EntryCount, entry.Recipients,
+		string(entry.Result), entry.Error, entry.TenantID, entry.APIKeyID, entry.JobID,
+		entry.StartedAt.UnixNano(), entry.FinishedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Delete removes the entries matching the filter
+func (r *SQLHistoryRepository) Delete(filter entities.HistoryFilter) (int, error) {
+	const op = "SQLHistoryRepository.Delete"
+
+	where, args := historyConditions(filter)
+	res, err := r.db.Exec(r.db.rebind(`DELETE FROM history`+where), args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(n), nil
+}
+
+// List returns the entries matching the filter, newest first, and the total number of matches
+func (r *SQLHistoryRepository) List(filter entities.HistoryFilter) ([]*entities.HistoryEntry, int, error) {
+	const op = "SQLHistoryRepository.List"
+
+	where, args := historyConditions(filter)
+
+	var total int
+	if err := r.db.QueryRow(r.db.rebind(`SELECT COUNT(*) FROM history`+where), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query, args := r.db.paginate(`SELECT `+historyColumns+` FROM history`+where+` ORDER BY started_at DESC, id DESC`,
+		args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(r.db.rebind(query), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := make([]*entities.HistoryEntry, 0)
+	for rows.Next() {
+		var (
+			entry                 entities.HistoryEntry
+			kind, result          string
+			startedAt, finishedAt int64
+		)
+		if err := rows.Scan(&entry.ID, &kind, &entry.Filename, &entry.Size, &entry.EntryCount, &entry.Recipients,
+			&result, &entry.Error, &entry.TenantID, &entry.APIKeyID, &entry.JobID, &startedAt, &finishedAt); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		entry.Kind = entities.UploadKind(kind)
+		entry.Result = entities.UploadResult(result)
+		entry.StartedAt = time.Unix(0, startedAt)
+		entry.FinishedAt = time.Unix(0, finishedAt)
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, total, nil
+}
+
+// historyConditions builds the WHERE clause selecting the entries matching
+// the filter, without its limit and offset
+func historyConditions(filter entities.HistoryFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if filter.Kind != "" {
+		conds = append(conds, "kind = ?")
+		args = append(args, string(filter.Kind))
+	}
+	if filter.Result != "" {
+		conds = append(conds, "result = ?")
+		args = append(args, string(filter.Result))
+	}
+	if filter.TenantID != "" {
+		conds = append(conds, "tenant_id = ?")
+		args = append(args, filter.TenantID)
+	}
+	if filter.APIKeyID != "" {
+		conds = append(conds, "api_key_id = ?")
+		args = append(args, filter.APIKeyID)
+	}
+	if len(filter.ExcludeAPIKeyIDs) > 0 {
+		conds = append(conds, "api_key_id NOT IN (?"+strings.Repeat(", ?", len(filter.ExcludeAPIKeyIDs)-1)+")")
+		for _, id := range filter.ExcludeAPIKeyIDs {
+			args = append(args, id)
+		}
+	}
+	if filter.Filename != "" {
+		conds = append(conds, "LOWER(filename) LIKE ?")
+		args = append(args, "%"+strings.ToLower(filter.Filename)+"%")
+	}
+	if !filter.StartedAfter.IsZero() {
+		conds = append(conds, "started_at >= ?")
+		args = append(args, filter.StartedAfter.UnixNano())
+	}
+	if !filter.StartedBefore.IsZero() {
+		conds = append(conds, "started_at < ?")
+		args = append(args, filter.StartedBefore.UnixNano())
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobNotClaimable = errors.New("job is not queued")
+)
+
+// JobRepository persists jobs and their state
+type JobRepository interface {
+	Create(job *entities.Job) error
+	Update(job *entities.Job) error
+	Get(id string) (*entities.Job, error)
+	// Claim atomically moves a queued job to running and counts the attempt,
+	// so a job popped by several workers runs only once
+	Claim(id string, now time.Time) (*entities.Job, error)
+	// List returns the jobs matching the filter, newest first, and the total number of matches
+	List(filter entities.JobFilter) ([]*entities.Job, int, error)
+}
+
+// MemoryJobRepository keeps jobs in memory; they are lost on restart
+type MemoryJobRepository struct {
+	mu   sync.RWMutex
+	jobs map[string]*entities.Job
+}
+
+// NewMemoryJobRepository creates a new instance of MemoryJobRepository
+func NewMemoryJobRepository() *MemoryJobRepository {
+	return &MemoryJobRepository{jobs: make(map[string]*entities.Job)}
+}
+
+// Create stores a new job
+func (r *MemoryJobRepository) Create(job *entities.Job) error {
+	const op = "MemoryJobRepository.Create"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.jobs[job.ID]; exists {
+		return fmt.Errorf("%s: job %s already exists", op, job.ID)
+	}
+	r.jobs[job.ID] = cloneJob(job)
+
+	return nil
+}
+
+// Update replaces the stored state of an existing job
+func (r *MemoryJobRepository) Update(job *entities.Job) error {
+	const op = "MemoryJobRepository.Update"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.jobs[job.ID]; !exists {
+		return fmt.Errorf("%s: %w", op, ErrJobNotFound)
+	}
+	r.jobs[job.ID] = cloneJob(job)
+
+	return nil
+}
+
+// Get returns a copy of the job
+func (r *MemoryJobRepository) Get(id string) (*entities.Job, error) {
+	const op = "MemoryJobRepository.Get"
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, ErrJobNotFound)
+	}
+
+	return cloneJob(job), nil
+}
+
+// Claim moves a queued job to running
+func (r *MemoryJobRepository) Claim(id string, now time.Time) (*entities.Job, error) {
+	const op = "MemoryJobRepository.Claim"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, ErrJobNotFound)
+	}
+	if job.Status != entities.JobStatusQueued {
+		return nil, fmt.Errorf("%s: %w", op, ErrJobNotClaimable)
+	}
+
+	job.Status = entities.JobStatusRunning
+	job.Attempts++
+	job.UpdatedAt = now
+
+	return cloneJob(job), nil
+}
+
+// List returns copies of the jobs matching the filter, newest first
+func (r *MemoryJobRepository) List(filter entities.JobFilter) ([]*entities.Job, int, error) {
+	r.mu.RLock()
+	matches := make([]*entities.Job, 0)
+	for _, job := range r.jobs {
+		if filter.Matches(job) {
+			matches = append(matches, job)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].ID > matches[j].ID
+		}
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	total := len(matches)
+	start := min(filter.Offset, total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+
+	page := make([]*entities.Job, 0, end-start)
+	for _, job := range matches[start:end] {
+		page = append(page, cloneJob(job))
+	}
+
+	return page, total, nil
+}
+
+// cloneJob copies a job so callers can't modify the stored state
+func cloneJob(job *entities.Job) *entities.Job {
+	c := *job
+	if job.FinishedAt != nil {
+		t := *job.FinishedAt
+		c.FinishedAt = &t
+	}
+	return &c
+}
@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SQLJobRepository keeps jobs in an SQL database so they survive restarts
+type SQLJobRepository struct {
+	db *Database
+}
+
+// NewSQLJobRepository creates a new instance of SQLJobRepository
+func NewSQLJobRepository(db *Database) (*SQLJobRepository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is nil", ErrInvalidDatabaseConfig)
+	}
+	return &SQLJobRepository{db: db}, nil
+}
+
+const jobColumns = `id, type, status, tenant_id, api_key_id, attempts, error, result, input, created_at, updated_at, finished_at`
+
+// Create stores a new job
+func (r *SQLJobRepository) Create(job *entities.Job) error {
+	const op = "SQLJobRepository.Create"
+
+	_, err := r.db.Exec(r.db.rebind(`INSERT INTO jobs (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		job.ID, string(job.Type), string(job.Status), job.TenantID, job.APIKeyID, job.Attempts, job.Error,
+		nullBytes(job.Result), nullBytes(job.Input),
+		job.CreatedAt.UnixNano(), job.UpdatedAt.UnixNano(), nullTime(job.FinishedAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Update replaces the stored state of an existing job
+func (r *SQLJobRepository) Update(job *entities.Job) error {
+	const op = "SQLJobRepository.Update"
+
+	res, err := r.db.Exec(r.db.rebind(`UPDATE jobs SET type = ?, status = ?, tenant_id = ?, api_key_id = ?, attempts = ?, error = ?,
+		result = ?, input = ?, created_at = ?, updated_at = ?, finished_at = ? WHERE id = ?`),
+		string(job.Type), string(job.Status), job.TenantID, job.APIKeyID, job.Attempts, job.Error,
+		nullBytes(job.Result), nullBytes(job.Input),
+		job.CreatedAt.UnixNano(), job.UpdatedAt.UnixNano(), nullTime(job.FinishedAt), job.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrJobNotFound)
+	}
+
+	return nil
+}
+
+// Get returns the job with the given id
+func (r *SQLJobRepository) Get(id string) (*entities.Job, error) {
+	const op = "SQLJobRepository.Get"
+
+	job, err := scanJob(r.db.QueryRow(r.db.rebind(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, ErrJobNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return job, nil
+}
+
+// Claim moves a queued job to running
+func (r *SQLJobRepository) Claim(id string, now time.Time) (*entities.Job, error) {
+	const op = "SQLJobRepository.Claim"
+
+	res, err := r.db.Exec(r.db.rebind(`UPDATE jobs SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?`),
+		string(entities.JobStatusRunning), now.UnixNano(), id, string(entities.JobStatusQueued))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	job, err := r.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrJobNotClaimable)
+	}
+
+	return job, nil
+}
+
+// List returns the jobs matching the filter, newest first, and the total number of matches
+func (r *SQLJobRepository) List(filter entities.JobFilter) ([]*entities.Job, int, error) {
+	const op = "SQLJobRepository.List"
+
+	var (
+		conds []string
+		args  []any
+	)
+	if filter.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, string(filter.Status))
+	}
+	if filter.Type != "" {
+		conds = append(conds, "type = ?")
+		args = append(args, string(filter.Type))
+	}
+	if filter.TenantID != "" {
+		conds = append(conds, "tenant_id = ?")
+		args = append(args, filter.TenantID)
+	}
+	if filter.APIKeyID != "" {
+		conds = append(conds, "api_key_id = ?")
+		args = append(args, filter.APIKeyID)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, filter.CreatedAfter.UnixNano())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, filter.CreatedBefore.UnixNano())
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(r.db.rebind(`SELECT COUNT(*) FROM jobs`+where), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query, args := r.db.paginate(`SELECT `+jobColumns+` FROM jobs`+where+` ORDER BY created_at DESC, id DESC`,
+		args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(r.db.rebind(query), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*entities.Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jobs, total, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*entities.Job, error) {
+	var (
+		job                  entities.Job
+		jobType, status      string
+		createdAt, updatedAt int64
+		finishedAt           sql.NullInt64
+		result, input        []byte
+	)
+
+	if err := row.Scan(&job.ID, &jobType, &status, &job.TenantID, &job.APIKeyID, &job.Attempts, &job.Error,
+		&result, &input, &createdAt, &updatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+
+	job.Type = entities.JobType(jobType)
+	job.Status = entities.JobStatus(status)
+	job.Result = result
+	job.Input = input
+	job.CreatedAt = time.Unix(0, createdAt)
+	job.UpdatedAt = time.Unix(0, updatedAt)
+	if finishedAt.Valid {
+		t := time.Unix(0, finishedAt.Int64)
+		job.FinishedAt = &t
+	}
+
+	return &job, nil
+}
+
+func nullBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,291 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var (
+	ErrInvalidKeysConfig = errors.New("invalid keys configuration")
+	ErrUnknownMasterKey  = errors.New("unknown master key")
+	ErrInvalidEnvelope   = errors.New("invalid encrypted envelope")
+)
+
+// KeyProvider holds the master keys wrapping the data keys that encrypt
+// data at rest. Master keys never leave the provider.
+type KeyProvider interface {
+	// Wrap encrypts a data key with the current master key and returns the
+	// id of that key, which Unwrap needs
+	Wrap(ctx context.Context, dataKey []byte) (wrapped []byte, keyID string, err error)
+	Unwrap(ctx context.Context, wrapped []byte, keyID string) ([]byte, error)
+	// KeyID returns the id of the current master key
+	KeyID() string
+}
+
+// NewKeyProvider creates the key provider selected by the keys
+// configuration, or returns nil when none is configured
+func NewKeyProvider(cfg *config.KeysConfig) (KeyProvider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "local":
+		return NewLocalKeyProvider(cfg.Local.Dir, cfg.KeyID)
+	case "aws_kms":
+		return NewAWSKMSKeyProvider(&cfg.AWS, cfg.KeyID)
+	case "gcp_kms":
+		return NewGCPKMSKeyProvider(&cfg.GCP, cfg.KeyID)
+	default:
+		return nil, fmt.Errorf("%w: unknown provider %q", ErrInvalidKeysConfig, cfg.Provider)
+	}
+}
+
+// localKeyIDRegex restricts local key ids so they can be used as file names
+var localKeyIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// LocalKeyProvider keeps 256 bit master keys in files named <id>.key. Every
+// key of the directory is loaded, so data wrapped with a retired key can
+// still be read after the key id is rotated.
+type LocalKeyProvider struct {
+	keys  map[string]cipher.AEAD
+	keyID string
+}
+
+// NewLocalKeyProvider loads the master keys of dir, which must include keyID
+func NewLocalKeyProvider(dir, keyID string) (*LocalKeyProvider, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.key"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeysConfig, err)
+	}
+
+	p := &LocalKeyProvider{keys: make(map[string]cipher.AEAD, len(names)), keyID: keyID}
+	for _, name := range names {
+		id := strings.TrimSuffix(filepath.Base(name), ".key")
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeysConfig, err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%w: %s must hold 32 base64 encoded bytes", ErrInvalidKeysConfig, name)
+		}
+		p.keys[id], err = newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeysConfig, err)
+		}
+	}
+
+	if _, ok := p.keys[keyID]; !ok {
+		return nil, fmt.Errorf("%w: %s/%s.key not found", ErrInvalidKeysConfig, dir, keyID)
+	}
+	return p, nil
+}
+
+// ephemeralKeyID is the id of the master key of NewEphemeralKeyProvider
+const ephemeralKeyID = "ephemeral"
+
+// NewEphemeralKeyProvider creates a provider holding a random master key in
+// memory only, so what it wraps can't be unwrapped by another process or
+// after a restart
+func NewEphemeralKeyProvider() (*LocalKeyProvider, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalKeyProvider{keys: map[string]cipher.AEAD{ephemeralKeyID: aead}, keyID: ephemeralKeyID}, nil
+}
+
+// GenerateLocalKey writes a new random master key named keyID into dir
+func GenerateLocalKey(dir, keyID string) (string, error) {
+	if !localKeyIDRegex.MatchString(keyID) {
+		return "", fmt.Errorf("%w: invalid key id %q", ErrInvalidKeysConfig, keyID)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, keyID+".key")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	return name, f.Close()
+}
+
+// Wrap encrypts the data key with the current master key using AES-GCM
+func (p *LocalKeyProvider) Wrap(_ context.Context, dataKey []byte) ([]byte, string, error) {
+	return sealGCM(p.keys[p.keyID], dataKey, []byte(p.keyID)), p.keyID, nil
+}
+
+// Unwrap decrypts a data key wrapped with the master key keyID
+func (p *LocalKeyProvider) Unwrap(_ context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	return openGCM(aead, wrapped, []byte(keyID))
+}
+
+// KeyID returns the id of the current master key
+func (p *LocalKeyProvider) KeyID() string {
+	return p.keyID
+}
+
+// envelopeMagic starts every envelope, so data written before encryption
+// was enabled can be told apart
+var envelopeMagic = []byte("DZE1")
+
+// IsEnvelope reports whether data is an envelope made by SealEnvelope
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// SealEnvelope encrypts data with a new AES-256-GCM data key, which is
+// wrapped by the key provider and kept in the envelope header:
+// "DZE1", the master key id and the wrapped data key, each prefixed by its
+// uvarint length, then the nonce and the ciphertext. The header is
+// authenticated along with the data.
+func SealEnvelope(ctx context.Context, keys KeyProvider, data []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrapped, keyID, err := keys.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	header := append([]byte{}, envelopeMagic...)
+	header = binary.AppendUvarint(header, uint64(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.AppendUvarint(header, uint64(len(wrapped)))
+	header = append(header, wrapped...)
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealGCM(aead, data, header)...), nil
+}
+
+// OpenEnvelope decrypts an envelope made by SealEnvelope
+func OpenEnvelope(ctx context.Context, keys KeyProvider, envelope []byte) ([]byte, error) {
+	keyID, wrapped, sealed, err := parseEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := keys.Unwrap(ctx, wrapped, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return openGCM(aead, sealed, envelope[:len(envelope)-len(sealed)])
+}
+
+// RewrapEnvelope returns the envelope with its data key wrapped by the
+// current master key, or the envelope itself when it already is
+func RewrapEnvelope(ctx context.Context, keys KeyProvider, envelope []byte) ([]byte, bool, error) {
+	keyID, _, _, err := parseEnvelope(envelope)
+	if err != nil {
+		return nil, false, err
+	}
+	if keyID == keys.KeyID() {
+		return envelope, false, nil
+	}
+
+	data, err := OpenEnvelope(ctx, keys, envelope)
+	if err != nil {
+		return nil, false, err
+	}
+	rewrapped, err := SealEnvelope(ctx, keys, data)
+	return rewrapped, err == nil, err
+}
+
+// parseEnvelope splits an envelope into the master key id, the wrapped data
+// key and the sealed data
+func parseEnvelope(envelope []byte) (keyID string, wrapped, sealed []byte, err error) {
+	if !IsEnvelope(envelope) {
+		return "", nil, nil, ErrInvalidEnvelope
+	}
+	rest := envelope[len(envelopeMagic):]
+
+	field := func() ([]byte, bool) {
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || n > uint64(len(rest)-size) {
+			return nil, false
+		}
+		value := rest[size : size+int(n)]
+		rest = rest[size+int(n):]
+		return value, true
+	}
+
+	id, ok := field()
+	if !ok {
+		return "", nil, nil, ErrInvalidEnvelope
+	}
+	if wrapped, ok = field(); !ok {
+		return "", nil, nil, ErrInvalidEnvelope
+	}
+	return string(id), wrapped, rest, nil
+}
+
+// newGCM returns AES-GCM with key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealGCM encrypts plaintext with a random nonce, which is prepended
+func sealGCM(aead cipher.AEAD, plaintext, additional []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional)
+}
+
+// openGCM decrypts the output of sealGCM
+func openGCM(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidEnvelope
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// awsKMSClient is the part of the AWS KMS client used by the provider
+type awsKMSClient interface {
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// AWSKMSKeyProvider wraps data keys with a symmetric AWS KMS key
+type AWSKMSKeyProvider struct {
+	keyID  string
+	client awsKMSClient
+}
+
+// NewAWSKMSKeyProvider creates a provider wrapping with the KMS key keyID,
+// a key id, ARN or alias. Without configured credentials, the default chain
+// of the SDK is used: environment variables, shared config and credentials
+// files, web identity tokens, and the ECS and EC2 instance roles.
+func NewAWSKMSKeyProvider(cfg *config.AWSKMSConfig, keyID string) (*AWSKMSKeyProvider, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeysConfig, err)
+	}
+	if awsCfg.Region == "" {
+		return nil, fmt.Errorf("%w: aws kms requires a region", ErrInvalidKeysConfig)
+	}
+
+	client := kms.NewFromConfig(awsCfg, func(o *kms.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+	return newAWSKMSKeyProvider(client, keyID), nil
+}
+
+func newAWSKMSKeyProvider(client awsKMSClient, keyID string) *AWSKMSKeyProvider {
+	return &AWSKMSKeyProvider{keyID: keyID, client: client}
+}
+
+// Wrap encrypts the data key with the KMS key
+func (p *AWSKMSKeyProvider) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	out, err := p.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(p.keyID),
+		Plaintext: dataKey,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("kms Encrypt: %w", err)
+	}
+	return out.CiphertextBlob, p.keyID, nil
+}
+
+// Unwrap decrypts a wrapped data key. The ciphertext identifies the KMS key
+// itself, so keys rotated by KMS or behind a retargeted alias still decrypt.
+func (p *AWSKMSKeyProvider) Unwrap(ctx context.Context, wrapped []byte, _ string) ([]byte, error) {
+	out, err := p.client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("kms Decrypt: %w", err)
+	}
+	return out.Plaintext, nil
+}
+
+// KeyID returns the configured KMS key
+func (p *AWSKMSKeyProvider) KeyID() string {
+	return p.keyID
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// gcpKMSClient is the part of the Cloud KMS client used by the provider
+type gcpKMSClient interface {
+	Encrypt(ctx context.Context, req *kmspb.EncryptRequest, opts ...gax.CallOption) (*kmspb.EncryptResponse, error)
+	Decrypt(ctx context.Context, req *kmspb.DecryptRequest, opts ...gax.CallOption) (*kmspb.DecryptResponse, error)
+}
+
+// GCPKMSKeyProvider wraps data keys with a Cloud KMS symmetric key. New data
+// keys are wrapped with the primary version of the key, and every version
+// still enabled can unwrap them.
+type GCPKMSKeyProvider struct {
+	keyID  string
+	client gcpKMSClient
+}
+
+// NewGCPKMSKeyProvider creates a provider wrapping with the key keyID, the
+// resource name projects/*/locations/*/keyRings/*/cryptoKeys/*. Without a
+// credentials file, Application Default Credentials are used: the
+// GOOGLE_APPLICATION_CREDENTIALS file, gcloud's credentials, or the
+// service account of the instance from the metadata server.
+func NewGCPKMSKeyProvider(cfg *config.GCPKMSConfig, keyID string) (*GCPKMSKeyProvider, error) {
+	if !strings.HasPrefix(keyID, "projects/") || !strings.Contains(keyID, "/cryptoKeys/") {
+		return nil, fmt.Errorf("%w: %q is not a cloud kms key name", ErrInvalidKeysConfig, keyID)
+	}
+
+	var opts []option.ClientOption
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+
+	client, err := kms.NewKeyManagementRESTClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeysConfig, err)
+	}
+	return newGCPKMSKeyProvider(client, keyID), nil
+}
+
+func newGCPKMSKeyProvider(client gcpKMSClient, keyID string) *GCPKMSKeyProvider {
+	return &GCPKMSKeyProvider{keyID: keyID, client: client}
+}
+
+// Wrap encrypts the data key with the primary version of the key
+func (p *GCPKMSKeyProvider) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	resp, err := p.client.Encrypt(ctx, &kmspb.EncryptRequest{Name: p.keyID, Plaintext: dataKey})
+	if err != nil {
+		return nil, "", fmt.Errorf("cloud kms: %w", err)
+	}
+	return resp.Ciphertext, p.keyID, nil
+}
+
+// Unwrap decrypts a data key wrapped with the key keyID
+func (p *GCPKMSKeyProvider) Unwrap(ctx context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	resp, err := p.client.Decrypt(ctx, &kmspb.DecryptRequest{Name: keyID, Ciphertext: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("cloud kms: %w", err)
+	}
+	return resp.Plaintext, nil
+}
+
+// KeyID returns the configured key name
+func (p *GCPKMSKeyProvider) KeyID() string {
+	return p.keyID
+}
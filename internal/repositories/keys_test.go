@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubKMS wraps data keys the way a KMS does as far as the providers can
+// tell: the ciphertext names the key that made it, and only enabled keys
+// decrypt
+type stubKMS struct {
+	disabled map[string]bool
+}
+
+func (s *stubKMS) encrypt(keyID string, plaintext []byte) ([]byte, error) {
+	if s.disabled[keyID] {
+		return nil, errors.New("key disabled")
+	}
+	ciphertext := append([]byte(keyID+"|"), plaintext...)
+	for i := len(keyID) + 1; i < len(ciphertext); i++ {
+		ciphertext[i] ^= 0x5a
+	}
+	return ciphertext, nil
+}
+
+func (s *stubKMS) decrypt(ciphertext []byte) (string, []byte, error) {
+	keyID, sealed, ok := bytes.Cut(ciphertext, []byte("|"))
+	if !ok || s.disabled[string(keyID)] {
+		return "", nil, errors.New("invalid ciphertext")
+	}
+	plaintext := make([]byte, len(sealed))
+	for i, b := range sealed {
+		plaintext[i] = b ^ 0x5a
+	}
+	return string(keyID), plaintext, nil
+}
+
+type stubAWSKMS struct {
+	*stubKMS
+	// aliases maps aliases to the keys they target
+	aliases map[string]string
+}
+
+func (s *stubAWSKMS) Encrypt(_ context.Context, params *kms.EncryptInput, _ ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+	if target, ok := s.aliases[keyID]; ok {
+		keyID = target
+	}
+	ciphertext, err := s.encrypt(keyID, params.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.EncryptOutput{CiphertextBlob: ciphertext, KeyId: aws.String(keyID)}, nil
+}
+
+func (s *stubAWSKMS) Decrypt(_ context.Context, params *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	keyID, plaintext, err := s.decrypt(params.CiphertextBlob)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{Plaintext: plaintext, KeyId: aws.String(keyID)}, nil
+}
+
+type stubGCPKMS struct {
+	*stubKMS
+}
+
+func (s *stubGCPKMS) Encrypt(_ context.Context, req *kmspb.EncryptRequest, _ ...gax.CallOption) (*kmspb.EncryptResponse, error) {
+	ciphertext, err := s.encrypt(req.Name, req.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.EncryptResponse{Name: req.Name, Ciphertext: ciphertext}, nil
+}
+
+func (s *stubGCPKMS) Decrypt(_ context.Context, req *kmspb.DecryptRequest, _ ...gax.CallOption) (*kmspb.DecryptResponse, error) {
+	keyID, plaintext, err := s.decrypt(req.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	// Cloud KMS only decrypts with the key that encrypted
+	if keyID != req.Name {
+		return nil, errors.New("decryption failed: wrong key")
+	}
+	return &kmspb.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+func TestKMSKeyProviders(t *testing.T) {
+	const (
+		awsOld = "alias/doozip-old"
+		awsNew = "alias/doozip"
+		gcpOld = "projects/p/locations/global/keyRings/r/cryptoKeys/old"
+		gcpNew = "projects/p/locations/global/keyRings/r/cryptoKeys/new"
+	)
+
+	tests := []struct {
+		name   string
+		oldKey string
+		newKey string
+		// setup returns a function creating a provider that wraps with a
+		// key, and one disabling the old key
+		setup func() (provider func(keyID string) KeyProvider, disableOld func())
+	}{
+		{
+			name:   "AWS KMS",
+			oldKey: awsOld,
+			newKey: awsNew,
+			setup: func() (func(string) KeyProvider, func()) {
+				stub := &stubKMS{disabled: map[string]bool{}}
+				client := &stubAWSKMS{stubKMS: stub, aliases: map[string]string{awsOld: "key-1", awsNew: "key-2"}}
+				return func(keyID string) KeyProvider { return newAWSKMSKeyProvider(client, keyID) },
+					func() { stub.disabled["key-1"] = true }
+			},
+		},
+		{
+			name:   "Cloud KMS",
+			oldKey: gcpOld,
+			newKey: gcpNew,
+			setup: func() (func(string) KeyProvider, func()) {
+				stub := &stubKMS{disabled: map[string]bool{}}
+				client := &stubGCPKMS{stubKMS: stub}
+				return func(keyID string) KeyProvider { return newGCPKMSKeyProvider(client, keyID) },
+					func() { stub.disabled[gcpOld] = true }
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider, disableOld := tt.setup()
+			old := provider(tt.oldKey)
+
+			dataKey := bytes.Repeat([]byte{7}, 32)
+			wrapped, keyID, err := old.Wrap(ctx, dataKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.oldKey, keyID)
+			assert.NotContains(t, string(wrapped), string(dataKey))
+			unwrapped, err := old.Unwrap(ctx, wrapped, keyID)
+			require.NoError(t, err)
+			assert.Equal(t, dataKey, unwrapped)
+
+			envelope, err := SealEnvelope(ctx, old, []byte("artifact"))
+			require.NoError(t, err)
+
+			// Rotating to the new key rewraps the envelope, which the old
+			// key is no longer needed for
+			current := provider(tt.newKey)
+			rewrapped, changed, err := RewrapEnvelope(ctx, current, envelope)
+			require.NoError(t, err)
+			assert.True(t, changed)
+			again, changed, err := RewrapEnvelope(ctx, current, rewrapped)
+			require.NoError(t, err)
+			assert.False(t, changed)
+			assert.Equal(t, rewrapped, again)
+
+			disableOld()
+			data, err := OpenEnvelope(ctx, current, rewrapped)
+			require.NoError(t, err)
+			assert.Equal(t, "artifact", string(data))
+
+			_, err = OpenEnvelope(ctx, current, envelope)
+			assert.ErrorContains(t, err, "failed to unwrap data key")
+		})
+	}
+}
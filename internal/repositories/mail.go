@@ -1,14 +1,11 @@
 package repositories
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"errors"
 	"fmt"
-	"mime/multipart"
-	"net/smtp"
-	"regexp"
-	"strings"
+	"net/mail"
+	"time"
 
 	"github.com/ab-dauletkhan/doozip/internal/config"
 	"github.com/ab-dauletkhan/doozip/internal/entities"
@@ -20,14 +17,18 @@ var (
 	ErrInvalidSubject    = errors.New("subject cannot be empty")
 	ErrInvalidFile       = errors.New("invalid file data")
 	ErrSMTPSendFailed    = errors.New("failed to send email")
-
-	// Email validation regex
-	emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 )
 
+// defaultRelayCooldown is how long a failed relay is skipped by default
+const defaultRelayCooldown = time.Minute
+
 // MailRepository defines the interface for email operations
 type MailRepository interface {
 	SendMail(to []string, subject, body string, file *entities.FileData) error
+	SendMessage(msg *entities.MailMessage) error
+	// SendMessageWithTranscript sends a composed message and returns a
+	// transcript of the delivery for diagnostics, also when it fails
+	SendMessageWithTranscript(msg *entities.MailMessage) ([]string, error)
 	ValidateConfig() error
 }
 
@@ -37,11 +38,20 @@ type MailRepositoryImpl struct {
 	smtpPort string
 	username string
 	password string
-	auth     smtp.Auth
+	messageComposer
+	// envelopeFrom is the SMTP envelope sender (MAIL FROM) where bounces are routed
+	envelopeFrom string
+	// relays holds the primary server followed by the fallbacks, in order
+	relays        []*smtpRelay
+	relayCooldown time.Duration
+	// punycode converts internationalized recipient domains to ASCII
+	punycode bool
 }
 
-// NewMailRepository creates a new instance of MailRepositoryImpl with validation
-func NewMailRepository(cfg *config.SMTP) (*MailRepositoryImpl, error) {
+// NewMailRepository creates a new instance of MailRepositoryImpl with validation.
+// Messages are sent from mailCfg.From, falling back to the SMTP username, and
+// bounces are routed to mailCfg.ReturnPath, also falling back to the username.
+func NewMailRepository(cfg *config.SMTP, mailCfg *config.MailConfig) (*MailRepositoryImpl, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("%w: configuration is nil", ErrInvalidSMTPConfig)
 	}
@@ -51,14 +61,65 @@ func NewMailRepository(cfg *config.SMTP) (*MailRepositoryImpl, error) {
 		smtpPort: cfg.Port,
 		username: cfg.Username,
 		password: cfg.Password,
+		punycode: cfg.PunycodeDomains,
 	}
 
 	if err := repo.ValidateConfig(); err != nil {
 		return nil, err
 	}
 
-	// Initialize SMTP auth
-	repo.auth = smtp.PlainAuth("", repo.username, repo.password, repo.smtpHost)
+	from := cfg.Username
+	if mailCfg != nil && mailCfg.From != "" {
+		from = mailCfg.From
+	}
+
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid from address %q: %v", ErrInvalidSMTPConfig, from, err)
+	}
+	repo.messageComposer = messageComposer{from: address, fallbackDomain: cfg.Host}
+
+	repo.envelopeFrom = cfg.Username
+	if mailCfg != nil && mailCfg.ReturnPath != "" {
+		returnPath, err := mail.ParseAddress(mailCfg.ReturnPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid return path %q: %v", ErrInvalidSMTPConfig, mailCfg.ReturnPath, err)
+		}
+		repo.envelopeFrom = returnPath.Address
+	}
+
+	opts := smtpClientOptions{
+		helo:           cfg.HeloHostname,
+		dialTimeout:    cfg.DialTimeout,
+		commandTimeout: cfg.CommandTimeout,
+		dataTimeout:    cfg.DataTimeout,
+	}
+	if opts.helo == "" {
+		opts.helo = defaultHeloHostname()
+	}
+
+	// Initialize SMTP relays, falling back to the primary credentials
+	repo.relays = append(repo.relays, newSMTPRelay(cfg.Host, cfg.Port, cfg.Username, cfg.Password, opts))
+	for i, fallback := range cfg.Fallbacks {
+		if fallback.Host == "" {
+			return nil, fmt.Errorf("%w: fallback %d: host is required", ErrInvalidSMTPConfig, i)
+		}
+
+		port, username, password := fallback.Port, fallback.Username, fallback.Password
+		if port == "" {
+			port = cfg.Port
+		}
+		if username == "" {
+			username, password = cfg.Username, cfg.Password
+		}
+
+		repo.relays = append(repo.relays, newSMTPRelay(fallback.Host, port, username, password, opts))
+	}
+
+	repo.relayCooldown = cfg.UnhealthyCooldown
+	if repo.relayCooldown <= 0 {
+		repo.relayCooldown = defaultRelayCooldown
+	}
 
 	return repo, nil
 }
@@ -80,140 +141,97 @@ func (m *MailRepositoryImpl) ValidateConfig() error {
 	return nil
 }
 
-// validateEmails checks if all email addresses are valid
-func validateEmails(emails []string) error {
-	if len(emails) == 0 {
-		return fmt.Errorf("%w: no recipients provided", ErrInvalidRecipients)
-	}
-
-	for _, email := range emails {
-		if !emailRegex.MatchString(email) {
-			return fmt.Errorf("%w: invalid email format: %s", ErrInvalidRecipients, email)
+// Ping connects and authenticates to the primary relay and every fallback,
+// failing with the errors of those that cannot be reached
+func (m *MailRepositoryImpl) Ping(ctx context.Context) error {
+	var errs []error
+	for _, relay := range m.relays {
+		if err := relay.ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", relay.address(), err))
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-// createEmailContent builds the email content with attachment
-func (m *MailRepositoryImpl) createEmailContent(to []string, subject, body string, file *entities.FileData) (*bytes.Buffer, error) {
-	buf := new(bytes.Buffer)
-
-	// Write email headers
-	headers := map[string]string{
-		"Subject":      subject,
-		"To":           strings.Join(to, ","),
-		"MIME-Version": "1.0",
-	}
-
-	for key, value := range headers {
-		if _, err := fmt.Fprintf(buf, "%s: %s\r\n", key, value); err != nil {
-			return nil, fmt.Errorf("failed to write header %s: %w", key, err)
-		}
-	}
-
-	// Create multipart writer
-	writer := multipart.NewWriter(buf)
-	boundary := writer.Boundary()
-
-	if _, err := fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", boundary); err != nil {
-		return nil, fmt.Errorf("failed to write content type: %w", err)
-	}
-
-	// Write body
-	if err := m.writeMessageBody(buf, boundary, body); err != nil {
-		return nil, err
+// validateMessage checks if the message can be composed and delivered
+func validateMessage(msg *entities.MailMessage) error {
+	if msg == nil {
+		return fmt.Errorf("%w: message is nil", ErrInvalidFile)
 	}
-
-	// Write attachment
-	if err := m.writeAttachment(buf, boundary, file); err != nil {
-		return nil, err
-	}
-
-	// Close boundary
-	if _, err := fmt.Fprintf(buf, "--%s--", boundary); err != nil {
-		return nil, fmt.Errorf("failed to close boundary: %w", err)
+	if err := validateEmails(msg.To); err != nil {
+		return err
 	}
-
-	return buf, nil
-}
-
-// writeMessageBody writes the email body part
-func (m *MailRepositoryImpl) writeMessageBody(buf *bytes.Buffer, boundary, body string) error {
-	if _, err := fmt.Fprintf(buf, "--%s\r\n", boundary); err != nil {
-		return fmt.Errorf("failed to write body boundary: %w", err)
+	if msg.Subject == "" {
+		return ErrInvalidSubject
 	}
-	if _, err := fmt.Fprintf(buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", body); err != nil {
-		return fmt.Errorf("failed to write body content: %w", err)
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFile, err)
 	}
 	return nil
 }
 
-// writeAttachment writes the file attachment part
-func (m *MailRepositoryImpl) writeAttachment(buf *bytes.Buffer, boundary string, file *entities.FileData) error {
-	if _, err := fmt.Fprintf(buf, "--%s\r\n", boundary); err != nil {
-		return fmt.Errorf("failed to write attachment boundary: %w", err)
-	}
-
-	headers := map[string]string{
-		"Content-Type":              file.MIMEType,
-		"Content-Transfer-Encoding": "base64",
-		"Content-Disposition":       fmt.Sprintf("attachment; filename=%s", file.Name),
+// validateEmails checks if all email addresses are valid. Local parts and
+// domains may be internationalized.
+func validateEmails(emails []string) error {
+	if len(emails) == 0 {
+		return fmt.Errorf("%w: no recipients provided", ErrInvalidRecipients)
 	}
 
-	for key, value := range headers {
-		if _, err := fmt.Fprintf(buf, "%s: %s\r\n", key, value); err != nil {
-			return fmt.Errorf("failed to write attachment header %s: %w", key, err)
+	for _, email := range emails {
+		if _, _, err := parseAddress(email); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRecipients, err)
 		}
 	}
+	return nil
+}
 
-	if _, err := buf.WriteString("\r\n"); err != nil {
-		return fmt.Errorf("failed to write attachment separator: %w", err)
+// SendMail sends an email with an attachment
+func (m *MailRepositoryImpl) SendMail(to []string, subject, body string, file *entities.FileData) error {
+	if file == nil {
+		return fmt.Errorf("%w: file is nil", ErrInvalidFile)
 	}
 
-	encoded := base64.StdEncoding.EncodeToString(file.Content)
-	if _, err := buf.WriteString(encoded); err != nil {
-		return fmt.Errorf("failed to write attachment content: %w", err)
-	}
+	return m.SendMessage(&entities.MailMessage{
+		To:          to,
+		Subject:     subject,
+		Text:        body,
+		Attachments: []*entities.Attachment{{File: file}},
+	})
+}
 
-	if _, err := buf.WriteString("\r\n"); err != nil {
-		return fmt.Errorf("failed to write attachment ending: %w", err)
-	}
+// SendMessage sends a composed message with its bodies and attachments
+func (m *MailRepositoryImpl) SendMessage(msg *entities.MailMessage) error {
+	return m.sendMessage(msg, nil)
+}
 
-	return nil
+// SendMessageWithTranscript sends a composed message and returns the SMTP
+// conversation with every relay tried. Credentials and traffic after STARTTLS
+// are not recorded verbatim.
+func (m *MailRepositoryImpl) SendMessageWithTranscript(msg *entities.MailMessage) ([]string, error) {
+	transcript := &smtpTranscript{}
+	err := m.sendMessage(msg, transcript)
+	return transcript.Lines(), err
 }
 
-// SendMail sends an email with an attachment
-func (m *MailRepositoryImpl) SendMail(to []string, subject, body string, file *entities.FileData) error {
+// sendMessage validates, composes and sends a message, optionally recording the transcript
+func (m *MailRepositoryImpl) sendMessage(msg *entities.MailMessage, transcript *smtpTranscript) error {
 	// Validate inputs
-	if err := validateEmails(to); err != nil {
+	if err := validateMessage(msg); err != nil {
 		return err
 	}
-	if subject == "" {
-		return ErrInvalidSubject
-	}
-	if file == nil {
-		return fmt.Errorf("%w: file is nil", ErrInvalidFile)
-	}
-	if err := file.Validate(); err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	if m.punycode {
+		msg = withASCIIDomains(msg)
 	}
 
 	// Create email content
-	content, err := m.createEmailContent(to, subject, body, file)
+	content, err := m.createEmailContent(msg)
 	if err != nil {
 		return fmt.Errorf("failed to create email content: %w", err)
 	}
 
 	// Send email
-	err = smtp.SendMail(
-		fmt.Sprintf("%s:%s", m.smtpHost, m.smtpPort),
-		m.auth,
-		m.username,
-		to,
-		content.Bytes(),
-	)
-	if err != nil {
-		return fmt.Errorf("%w: %v", ErrSMTPSendFailed, err)
+	if err := m.sendThroughRelays(msg.To, content.Bytes(), transcript); err != nil {
+		return fmt.Errorf("%w: %w", ErrSMTPSendFailed, err)
 	}
 
 	return nil
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+// defaultMaildirFrom is used when neither mail.from nor an SMTP username is configured
+const defaultMaildirFrom = "doozip@localhost"
+
+var ErrInvalidMaildirConfig = errors.New("invalid maildir configuration")
+
+// MaildirRepository implements the MailRepository interface by writing every
+// message as an .eml file into a local maildir instead of sending it, for
+// air-gapped environments and integration tests
+type MaildirRepository struct {
+	dir string
+	messageComposer
+}
+
+// NewMaildirRepository creates a new instance of MaildirRepository, creating
+// the maildir structure (tmp, new, cur) if it does not exist
+func NewMaildirRepository(mailCfg *config.MailConfig, smtpCfg *config.SMTP) (*MaildirRepository, error) {
+	if mailCfg == nil {
+		return nil, fmt.Errorf("%w: configuration is nil", ErrInvalidMaildirConfig)
+	}
+
+	from := mailCfg.From
+	if from == "" && smtpCfg != nil {
+		from = smtpCfg.Username
+	}
+	if from == "" {
+		from = defaultMaildirFrom
+	}
+
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid from address %q: %v", ErrInvalidMaildirConfig, from, err)
+	}
+
+	repo := &MaildirRepository{
+		dir:             mailCfg.Maildir,
+		messageComposer: messageComposer{from: address, fallbackDomain: "localhost"},
+	}
+
+	if err := repo.ValidateConfig(); err != nil {
+		return nil, err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(repo.dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("%w: failed to create %s: %v", ErrInvalidMaildirConfig, sub, err)
+		}
+	}
+
+	return repo, nil
+}
+
+// ValidateConfig checks if the maildir configuration is valid
+func (m *MaildirRepository) ValidateConfig() error {
+	if m.dir == "" {
+		return fmt.Errorf("%w: directory is required", ErrInvalidMaildirConfig)
+	}
+	return nil
+}
+
+// SendMail writes an email with an attachment to the maildir
+func (m *MaildirRepository) SendMail(to []string, subject, body string, file *entities.FileData) error {
+	if file == nil {
+		return fmt.Errorf("%w: file is nil", ErrInvalidFile)
+	}
+
+	return m.SendMessage(&entities.MailMessage{
+		To:          to,
+		Subject:     subject,
+		Text:        body,
+		Attachments: []*entities.Attachment{{File: file}},
+	})
+}
+
+// SendMessage writes a composed message to the maildir. The file is written to
+// tmp and then moved into new, so readers never observe partial messages.
+func (m *MaildirRepository) SendMessage(msg *entities.MailMessage) error {
+	_, err := m.writeMessage(msg)
+	return err
+}
+
+// SendMessageWithTranscript writes a composed message to the maildir and
+// returns a transcript naming the file it was written to
+func (m *MaildirRepository) SendMessageWithTranscript(msg *entities.MailMessage) ([]string, error) {
+	transcript := []string{"-- writing message to maildir " + m.dir + " --"}
+
+	path, err := m.writeMessage(msg)
+	if err != nil {
+		return append(transcript, "-- "+err.Error()+" --"), err
+	}
+
+	return append(transcript, "-- delivered to "+path+" --"), nil
+}
+
+// writeMessage writes the message into new and returns its path
+func (m *MaildirRepository) writeMessage(msg *entities.MailMessage) (string, error) {
+	if err := validateMessage(msg); err != nil {
+		return "", err
+	}
+
+	content, err := m.createEmailContent(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to create email content: %w", err)
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + utils.NewID() + ".eml"
+	tmpPath := filepath.Join(m.dir, "tmp", name)
+
+	if err := os.WriteFile(tmpPath, content.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write message: %w", err)
+	}
+
+	path := filepath.Join(m.dir, "new", name)
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to deliver message: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,17 @@
+CREATE TABLE history (
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	filename TEXT NOT NULL DEFAULT '',
+	size BIGINT NOT NULL DEFAULT 0,
+	entry_count INTEGER NOT NULL DEFAULT 0,
+	recipients INTEGER NOT NULL DEFAULT 0,
+	result TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	api_key_id TEXT NOT NULL DEFAULT '',
+	job_id TEXT NOT NULL DEFAULT '',
+	started_at BIGINT NOT NULL,
+	finished_at BIGINT NOT NULL
+);
+
+CREATE INDEX history_started_at_idx ON history (started_at);
+CREATE INDEX history_api_key_id_idx ON history (api_key_id);
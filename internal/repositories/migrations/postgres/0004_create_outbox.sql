@@ -0,0 +1,16 @@
+CREATE TABLE outbox (
+	id TEXT PRIMARY KEY,
+	status TEXT NOT NULL,
+	recipients TEXT NOT NULL DEFAULT '',
+	subject TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	sent INTEGER NOT NULL DEFAULT 0,
+	failed INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	tenant_id TEXT NOT NULL DEFAULT '',
+	message BYTEA,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX outbox_status_idx ON outbox (status, updated_at);
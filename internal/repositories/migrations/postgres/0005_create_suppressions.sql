@@ -0,0 +1,7 @@
+CREATE TABLE suppressions (
+	tenant_id TEXT NOT NULL DEFAULT '',
+	address TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	PRIMARY KEY (tenant_id, address)
+);
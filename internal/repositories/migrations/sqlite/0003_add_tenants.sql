@@ -0,0 +1,5 @@
+ALTER TABLE jobs ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE history ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX jobs_tenant_id_idx ON jobs (tenant_id);
+CREATE INDEX history_tenant_id_idx ON history (tenant_id);
@@ -0,0 +1,21 @@
+CREATE TABLE audit (
+	id TEXT PRIMARY KEY,
+	message_id TEXT NOT NULL DEFAULT '',
+	recipients TEXT NOT NULL DEFAULT '',
+	subject TEXT NOT NULL DEFAULT '',
+	tenant_id TEXT NOT NULL DEFAULT '',
+	sent_at INTEGER NOT NULL
+);
+
+CREATE INDEX audit_sent_at_idx ON audit (sent_at);
+
+CREATE TABLE audit_attachments (
+	audit_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	size INTEGER NOT NULL DEFAULT 0,
+	sha256 TEXT NOT NULL,
+	PRIMARY KEY (audit_id, position)
+);
+
+CREATE INDEX audit_attachments_sha256_idx ON audit_attachments (sha256);
@@ -0,0 +1,8 @@
+CREATE TABLE recipient_groups (
+	tenant_id TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL,
+	addresses TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, name)
+);
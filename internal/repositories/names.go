@@ -0,0 +1,277 @@
+package repositories
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// zipFlagUTF8 marks the name of an entry as UTF-8 in its general purpose
+// flags
+const zipFlagUTF8 = 0x800
+
+// zipExtraUnicodePath is the Info-ZIP extra field holding the UTF-8 name of
+// an entry whose name is in a code page
+const zipExtraUnicodePath = 0x7075
+
+// nameCharmaps are the code pages names can be read and written in, by name
+var nameCharmaps = map[string]*charmap.Charmap{
+	"cp437":  charmap.CodePage437,
+	"cp850":  charmap.CodePage850,
+	"cp852":  charmap.CodePage852,
+	"cp866":  charmap.CodePage866,
+	"cp1250": charmap.Windows1250,
+	"cp1251": charmap.Windows1251,
+	"cp1252": charmap.Windows1252,
+	"koi8-r": charmap.KOI8R,
+}
+
+// nameDecoder decodes the entry names of archives not marked as UTF-8
+type nameDecoder struct {
+	encodings []string
+	fallback  string
+}
+
+// newNameDecoder creates a nameDecoder trying the code pages cfg sets
+func newNameDecoder(cfg *config.ArchiveNamesConfig) *nameDecoder {
+	return &nameDecoder{
+		encodings: cfg.Encodings,
+		fallback:  cfg.Fallback,
+	}
+}
+
+// decode returns the names of the entries of an archive in UTF-8, and the
+// code page the names not marked as UTF-8 were decoded from, if any. Every
+// such name of an archive was written by the same tool, so they are decoded
+// with the one code page reading most like text across all of them.
+func (d *nameDecoder) decode(files []*zip.File) ([]string, string) {
+	names := make([]string, len(files))
+	var legacy []int
+	for i, f := range files {
+		names[i] = f.Name
+		if f.Flags&zipFlagUTF8 != 0 {
+			continue
+		}
+		if name, ok := unicodePathName(f); ok {
+			names[i] = name
+			continue
+		}
+		if !utf8.ValidString(f.Name) {
+			legacy = append(legacy, i)
+		}
+	}
+	if len(legacy) == 0 {
+		return names, ""
+	}
+
+	raw := make([]string, len(legacy))
+	for i, index := range legacy {
+		raw[i] = files[index].Name
+	}
+	encoding := d.detect(raw)
+	table := nameCharmaps[encoding]
+	for _, index := range legacy {
+		names[index] = decodeName(table, files[index].Name)
+	}
+	return names, encoding
+}
+
+// detect returns the code page the names read most like text in, or the
+// fallback when none does
+func (d *nameDecoder) detect(names []string) string {
+	best, bestScore := d.fallback, 0
+	for _, encoding := range d.encodings {
+		table, ok := nameCharmaps[encoding]
+		if !ok {
+			continue
+		}
+		score := 0
+		for _, name := range names {
+			score += textScore(decodeName(table, name))
+		}
+		if score > bestScore {
+			best, bestScore = encoding, score
+		}
+	}
+	return best
+}
+
+// decodeName decodes a name from a code page, or returns it unchanged when
+// the code page is unknown
+func decodeName(table *charmap.Charmap, name string) string {
+	if table == nil {
+		return name
+	}
+	var b strings.Builder
+	b.Grow(len(name))
+	for i := 0; i < len(name); i++ {
+		b.WriteRune(table.DecodeByte(name[i]))
+	}
+	return b.String()
+}
+
+// nameEncoder writes the entry names of created archives
+type nameEncoder struct {
+	unicodePath bool
+	legacy      *charmap.Charmap
+}
+
+// newNameEncoder creates a nameEncoder writing names as cfg sets
+func newNameEncoder(cfg *config.ArchiveNamesConfig) *nameEncoder {
+	legacy := nameCharmaps[cfg.LegacyEncoding]
+	return &nameEncoder{
+		unicodePath: cfg.UnicodePath || legacy != nil,
+		legacy:      legacy,
+	}
+}
+
+// header returns the header of an entry named name. Non-ASCII names are
+// marked as UTF-8 explicitly, as zip.Writer.CreateRaw doesn't, or written in
+// the legacy code page, with their UTF-8 name in the Unicode Path extra field
+// when it is enabled.
+func (e *nameEncoder) header(name string) *zip.FileHeader {
+	header := &zip.FileHeader{Name: name}
+	if isASCII(name) {
+		return header
+	}
+
+	if e.legacy != nil {
+		header.Name = encodeName(e.legacy, name)
+		header.NonUTF8 = true
+	} else {
+		header.Flags |= zipFlagUTF8
+	}
+	if e.unicodePath {
+		header.Extra = unicodePathField(header.Name, name)
+	}
+	return header
+}
+
+// size returns the number of bytes the name of an entry named name takes in
+// each of its headers, with its extra field
+func (e *nameEncoder) size(name string) int {
+	header := e.header(name)
+	return len(header.Name) + len(header.Extra)
+}
+
+// encodeName encodes a name in a code page, replacing the characters it
+// lacks with underscores
+func encodeName(table *charmap.Charmap, name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, r := range name {
+		c, ok := table.EncodeRune(r)
+		if !ok {
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// unicodePathField returns the Info-ZIP Unicode Path extra field of an entry
+// whose name field is raw, holding its UTF-8 name
+func unicodePathField(raw, name string) []byte {
+	field := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(field[0:2], zipExtraUnicodePath)
+	binary.LittleEndian.PutUint16(field[2:4], uint16(5+len(name)))
+	field[4] = 1
+	binary.LittleEndian.PutUint32(field[5:9], crc32.ChecksumIEEE([]byte(raw)))
+	return append(field, name...)
+}
+
+// isASCII reports whether a name only has ASCII characters, which read the
+// same in UTF-8 and every code page
+func isASCII(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// unicodePathName returns the UTF-8 name of the Info-ZIP Unicode Path extra
+// field of an entry, if it has one matching its name
+func unicodePathName(f *zip.File) (string, bool) {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			return "", false
+		}
+		data := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if tag != zipExtraUnicodePath || len(data) < 5 || data[0] != 1 {
+			continue
+		}
+		// The field is stale if the name was changed by a tool unaware of it
+		if binary.LittleEndian.Uint32(data[1:5]) != crc32.ChecksumIEEE([]byte(f.Name)) {
+			return "", false
+		}
+		if name := string(data[5:]); utf8.ValidString(name) && name != "" {
+			return name, true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// textScore rates how much a decoded name reads like text. Letters of the
+// common alphabets score, while symbols such as box drawing characters and
+// words mixing scripts, the marks of the wrong code page, cost. ASCII
+// characters read the same in every code page, so they don't count.
+func textScore(name string) int {
+	score := 0
+	var scripts [3]bool
+	endWord := func() {
+		mixed := 0
+		for i, seen := range scripts {
+			if seen {
+				mixed++
+			}
+			scripts[i] = false
+		}
+		if mixed > 1 {
+			score -= 3
+		}
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			endWord()
+			if r >= utf8.RuneSelf {
+				score -= 3
+			}
+			continue
+		}
+
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			scripts[0] = true
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts[1] = true
+		default:
+			scripts[2] = true
+		}
+		if r < utf8.RuneSelf {
+			continue
+		}
+		switch {
+		case r >= 0xC0 && r <= 0x17F, r >= 0x410 && r <= 0x44F, r == 'Ё', r == 'ё':
+			score += 2
+		case unicode.Is(unicode.Latin, r), unicode.Is(unicode.Cyrillic, r):
+			score++
+		}
+	}
+	endWord()
+	return score
+}
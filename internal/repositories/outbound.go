@@ -0,0 +1,214 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var (
+	ErrAddressNotAllowed = errors.New("remote address is not allowed")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrInvalidOutbound   = errors.New("invalid outbound http settings")
+)
+
+// maxRetryBackoff caps the delay between retries of outbound requests
+const maxRetryBackoff = 30 * time.Second
+
+// OutboundClient makes the requests of the service to other servers, such
+// as remote archive fetches and webhooks. Each request is bounded by the
+// timeout, follows a limited number of redirects and may only reach public
+// addresses, or the private ones allowed. Requests failing with a network
+// error or a 429, 502, 503 or 504 status are retried with exponential
+// backoff, unless their body cannot be sent again.
+type OutboundClient struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewOutboundClient creates an OutboundClient for cfg
+func NewOutboundClient(cfg *config.OutboundConfig) (*OutboundClient, error) {
+	policy := &addressPolicy{allowAll: cfg.AllowPrivate}
+	for _, raw := range cfg.Allow {
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(raw)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%w: allow %q is not an address or prefix", ErrInvalidOutbound, raw)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		policy.allow = append(policy.allow, prefix.Masked())
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: cfg.Timeout,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") || proxy.Host == "" {
+			return nil, fmt.Errorf("%w: invalid proxy url %q", ErrInvalidOutbound, cfg.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		// Only the proxy is dialed, so the target's addresses are checked
+		// before the request is handed to it
+		roundTripper = &resolvingTransport{base: transport, policy: policy}
+	} else {
+		dialer.Control = policy.control
+	}
+
+	maxRedirects := cfg.MaxRedirects
+	return &OutboundClient{
+		client: &http.Client{
+			Transport: roundTripper,
+			Timeout:   cfg.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("%w: redirect to %s", ErrAddressNotAllowed, req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+		retries: cfg.Retries,
+		backoff: cfg.RetryBackoff,
+	}, nil
+}
+
+// Do sends the request, retrying it on transient failures. The response of
+// the last attempt is returned, whatever its status.
+func (c *OutboundClient) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.client.Do(req)
+		if attempt >= c.retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		// Jitter keeps clients failing together from retrying together
+		delay := min(c.backoff<<attempt, maxRetryBackoff)
+		if delay > 0 {
+			delay = rand.N(delay) + delay/2
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a request that got resp or err may be sent again
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil && !errors.Is(err, ErrAddressNotAllowed) && !errors.Is(err, ErrTooManyRedirects)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// addressPolicy decides which addresses outbound requests may reach: public
+// ones, the prefixes of allow, or any with allowAll
+type addressPolicy struct {
+	allowAll bool
+	allow    []netip.Prefix
+}
+
+// check refuses loopback, private, link-local (including the cloud metadata
+// endpoints) and other non public addresses that are not allowed
+func (p *addressPolicy) check(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if p.allowAll {
+		return nil
+	}
+	for _, prefix := range p.allow {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, addr)
+	}
+	return nil
+}
+
+// control checks the address of every connection dialed
+func (p *addressPolicy) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	return p.check(addr)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routable
+// on the internet but not reported by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// resolvingTransport checks every address the host of a request resolves to
+// before sending it through a proxy
+type resolvingTransport struct {
+	base   http.RoundTripper
+	policy *addressPolicy
+}
+
+func (t *resolvingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addrs, err := resolve(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if err := t.policy.check(addr); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// resolve returns the addresses of host, itself when it is an address
+func resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
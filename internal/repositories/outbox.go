@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var (
+	ErrOutboxEntryNotFound     = errors.New("outbox entry not found")
+	ErrOutboxEntryNotClaimable = errors.New("outbox entry is being sent")
+)
+
+// OutboxRepository persists composed messages and the state of their delivery
+type OutboxRepository interface {
+	Create(entry *entities.OutboxEntry) error
+	Update(entry *entities.OutboxEntry) error
+	Get(id string) (*entities.OutboxEntry, error)
+	// Claim atomically moves an entry to sending and counts the attempt,
+	// unless it is being sent already and was updated after staleBefore, so
+	// a message is resent by a single instance
+	Claim(id string, now, staleBefore time.Time) (*entities.OutboxEntry, error)
+	// Stale returns the ids of the entries left sending since before staleBefore
+	Stale(staleBefore time.Time) ([]string, error)
+	// Delete removes the entries no longer being sent that were last updated
+	// before the given time, and returns the number removed
+	Delete(before time.Time) (int, error)
+}
+
+// MemoryOutboxRepository keeps the outbox in memory; it is lost on restart
+type MemoryOutboxRepository struct {
+	mu      sync.RWMutex
+	entries map[string]*entities.OutboxEntry
+}
+
+// NewMemoryOutboxRepository creates a new instance of MemoryOutboxRepository
+func NewMemoryOutboxRepository() *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{entries: make(map[string]*entities.OutboxEntry)}
+}
+
+// Create stores a new entry
+func (r *MemoryOutboxRepository) Create(entry *entities.OutboxEntry) error {
+	const op = "MemoryOutboxRepository.Create"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.entries[entry.ID]; exists {
+		return fmt.Errorf("%s: entry %s already exists", op, entry.ID)
+	}
+	r.entries[entry.ID] = cloneOutboxEntry(entry)
+
+	return nil
+}
+
+// Update replaces the stored state of an existing entry
+func (r *MemoryOutboxRepository) Update(entry *entities.OutboxEntry) error {
+	const op = "MemoryOutboxRepository.Update"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.entries[entry.ID]; !exists {
+		return fmt.Errorf("%s: %w", op, ErrOutboxEntryNotFound)
+	}
+	r.entries[entry.ID] = cloneOutboxEntry(entry)
+
+	return nil
+}
+
+// Get returns a copy of the entry
+func (r *MemoryOutboxRepository) Get(id string) (*entities.OutboxEntry, error) {
+	const op = "MemoryOutboxRepository.Get"
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.entries[id]
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, ErrOutboxEntryNotFound)
+	}
+
+	return cloneOutboxEntry(entry), nil
+}
+
+// Claim moves an entry to sending
+func (r *MemoryOutboxRepository) Claim(id string, now, staleBefore time.Time) (*entities.OutboxEntry, error) {
+	const op = "MemoryOutboxRepository.Claim"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.entries[id]
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, ErrOutboxEntryNotFound)
+	}
+	if entry.Status == entities.OutboxStatusSending && !entry.UpdatedAt.Before(staleBefore) {
+		return nil, fmt.Errorf("%s: %w", op, ErrOutboxEntryNotClaimable)
+	}
+
+	entry.Status = entities.OutboxStatusSending
+	entry.Attempts++
+	entry.UpdatedAt = now
+
+	return cloneOutboxEntry(entry), nil
+}
+
+// Stale returns the ids of the entries left sending, oldest first
+func (r *MemoryOutboxRepository) Stale(staleBefore time.Time) ([]string, error) {
+	r.mu.RLock()
+	var stale []*entities.OutboxEntry
+	for _, entry := range r.entries {
+		if entry.Status == entities.OutboxStatusSending && entry.UpdatedAt.Before(staleBefore) {
+			stale = append(stale, cloneOutboxEntry(entry))
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(stale, func(a, b *entities.OutboxEntry) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+
+	ids := make([]string, len(stale))
+	for i, entry := range stale {
+		ids[i] = entry.ID
+	}
+	return ids, nil
+}
+
+// Delete removes the entries no longer being sent that were last updated before the given time
+func (r *MemoryOutboxRepository) Delete(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for id, entry := range r.entries {
+		if entry.Status != entities.OutboxStatusSending && entry.UpdatedAt.Before(before) {
+			delete(r.entries, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// cloneOutboxEntry copies an entry so callers can't modify the stored state
+func cloneOutboxEntry(entry *entities.OutboxEntry) *entities.OutboxEntry {
+	c := *entry
+	c.Recipients = slices.Clone(entry.Recipients)
+	return &c
+}
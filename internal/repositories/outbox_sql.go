@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SQLOutboxRepository keeps the outbox in an SQL database so messages
+// interrupted by a restart can be sent again
+type SQLOutboxRepository struct {
+	db *Database
+}
+
+// NewSQLOutboxRepository creates a new instance of SQLOutboxRepository
+func NewSQLOutboxRepository(db *Database) (*SQLOutboxRepository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is nil", ErrInvalidDatabaseConfig)
+	}
+	return &SQLOutboxRepository{db: db}, nil
+}
+
+const outboxColumns = `id, status, recipients, subject, attempts, sent, failed, error, tenant_id, message, created_at, updated_at`
+
+// Create stores a new entry
+func (r *SQLOutboxRepository) Create(entry *entities.OutboxEntry) error {
+	const op = "SQLOutboxRepository.Create"
+
+	_, err := r.db.Exec(r.db.rebind(`INSERT INTO outbox (`+outboxColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		entry.ID, string(entry.Status), strings.Join(entry.Recipients, ","), entry.Subject,
+		entry.Attempts, entry.Sent, entry.Failed, entry.Error, entry.TenantID, nullBytes(entry.Message),
+		entry.CreatedAt.UnixNano(), entry.UpdatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Update replaces the stored state of an existing entry. The message itself
+// never changes once stored.
+func (r *SQLOutboxRepository) Update(entry *entities.OutboxEntry) error {
+	const op = "SQLOutboxRepository.Update"
+
+	res, err := r.db.Exec(r.db.rebind(`UPDATE outbox SET status = ?, attempts = ?, sent = ?, failed = ?, error = ?,
+		updated_at = ? WHERE id = ?`),
+		string(entry.Status), entry.Attempts, entry.Sent, entry.Failed, entry.Error,
+		entry.UpdatedAt.UnixNano(), entry.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrOutboxEntryNotFound)
+	}
+
+	return nil
+}
+
+// Get returns the entry with the given id
+func (r *SQLOutboxRepository) Get(id string) (*entities.OutboxEntry, error) {
+	const op = "SQLOutboxRepository.Get"
+
+	entry, err := scanOutboxEntry(r.db.QueryRow(r.db.rebind(`SELECT `+outboxColumns+` FROM outbox WHERE id = ?`), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, ErrOutboxEntryNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entry, nil
+}
+
+// Claim moves an entry to sending
+func (r *SQLOutboxRepository) Claim(id string, now, staleBefore time.Time) (*entities.OutboxEntry, error) {
+	const op = "SQLOutboxRepository.Claim"
+
+	res, err := r.db.Exec(r.db.rebind(`UPDATE outbox SET status = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = ? AND (status <> ? OR updated_at < ?)`),
+		string(entities.OutboxStatusSending), now.UnixNano(), id, string(entities.OutboxStatusSending), staleBefore.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	entry, err := r.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrOutboxEntryNotClaimable)
+	}
+
+	return entry, nil
+}
+
+// Stale returns the ids of the entries left sending, oldest first
+func (r *SQLOutboxRepository) Stale(staleBefore time.Time) ([]string, error) {
+	const op = "SQLOutboxRepository.Stale"
+
+	rows, err := r.db.Query(r.db.rebind(`SELECT id FROM outbox WHERE status = ? AND updated_at < ? ORDER BY updated_at`),
+		string(entities.OutboxStatusSending), staleBefore.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+// Delete removes the entries no longer being sent that were last updated before the given time
+func (r *SQLOutboxRepository) Delete(before time.Time) (int, error) {
+	const op = "SQLOutboxRepository.Delete"
+
+	res, err := r.db.Exec(r.db.rebind(`DELETE FROM outbox WHERE status <> ? AND updated_at < ?`),
+		string(entities.OutboxStatusSending), before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(n), nil
+}
+
+func scanOutboxEntry(row rowScanner) (*entities.OutboxEntry, error) {
+	var (
+		entry                entities.OutboxEntry
+		status, recipients   string
+		createdAt, updatedAt int64
+	)
+
+	if err := row.Scan(&entry.ID, &status, &recipients, &entry.Subject, &entry.Attempts, &entry.Sent, &entry.Failed,
+		&entry.Error, &entry.TenantID, &entry.Message, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	entry.Status = entities.OutboxStatus(status)
+	if recipients != "" {
+		entry.Recipients = strings.Split(recipients, ",")
+	}
+	entry.CreatedAt = time.Unix(0, createdAt)
+	entry.UpdatedAt = time.Unix(0, updatedAt)
+
+	return &entry, nil
+}
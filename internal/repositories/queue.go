@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var ErrInvalidQueueConfig = errors.New("invalid queue configuration")
+
+// Queue is a work queue shared by the job manager and the outbox. Items
+// become available at their scheduled time and each item is popped by
+// exactly one consumer.
+type Queue interface {
+	// Push adds an item to the named queue that becomes available at the
+	// given time; a zero time makes it available immediately
+	Push(ctx context.Context, name string, item []byte, at time.Time) error
+	// Pop blocks until an item of the named queue is available or ctx is done
+	Pop(ctx context.Context, name string) ([]byte, error)
+	Close() error
+}
+
+// NewQueue creates the queue selected by the configuration
+func NewQueue(cfg *config.QueueConfig) (Queue, error) {
+	if cfg == nil {
+		return NewMemoryQueue(), nil
+	}
+
+	switch cfg.Driver {
+	case "", "memory":
+		return NewMemoryQueue(), nil
+	case "redis":
+		return NewRedisQueue(&cfg.Redis)
+	default:
+		return nil, fmt.Errorf("%w: unsupported driver %q", ErrInvalidQueueConfig, cfg.Driver)
+	}
+}
+
+// queuedItem is an item of a MemoryQueue
+type queuedItem struct {
+	data []byte
+	at   time.Time
+}
+
+// MemoryQueue is a Queue local to the process
+type MemoryQueue struct {
+	mu     sync.Mutex
+	queues map[string][]queuedItem
+	// wake is closed and replaced whenever an item is pushed
+	wake chan struct{}
+}
+
+// NewMemoryQueue creates a new instance of MemoryQueue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		queues: make(map[string][]queuedItem),
+		wake:   make(chan struct{}),
+	}
+}
+
+// Push adds an item to the named queue, keeping items ordered by availability
+func (q *MemoryQueue) Push(ctx context.Context, name string, item []byte, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.queues[name]
+	i := sort.Search(len(items), func(i int) bool { return items[i].at.After(at) })
+	items = append(items, queuedItem{})
+	copy(items[i+1:], items[i:])
+	items[i] = queuedItem{data: item, at: at}
+	q.queues[name] = items
+
+	close(q.wake)
+	q.wake = make(chan struct{})
+
+	return nil
+}
+
+// Pop blocks until an item of the named queue is available or ctx is done
+func (q *MemoryQueue) Pop(ctx context.Context, name string) ([]byte, error) {
+	for {
+		q.mu.Lock()
+		wake := q.wake
+		items := q.queues[name]
+
+		var timer *time.Timer
+		if len(items) > 0 {
+			d := time.Until(items[0].at)
+			if d <= 0 {
+				item := items[0]
+				q.queues[name] = items[1:]
+				q.mu.Unlock()
+				return item.data, nil
+			}
+			timer = time.NewTimer(d)
+		}
+		q.mu.Unlock()
+
+		var due <-chan time.Time
+		if timer != nil {
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close releases the queue; pending items are discarded
+func (q *MemoryQueue) Close() error {
+	return nil
+}
+
+// redisPollInterval is how often an idle consumer checks for due items
+const redisPollInterval = 250 * time.Millisecond
+
+// RedisQueue is a Queue shared by every instance connected to the same Redis.
+// Each queue is a sorted set scored by the time its items become available.
+type RedisQueue struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisQueue connects to Redis and creates a new instance of RedisQueue
+func NewRedisQueue(cfg *config.RedisConfig) (*RedisQueue, error) {
+	if cfg == nil || cfg.Addr == "" {
+		return nil, fmt.Errorf("%w: redis address is required", ErrInvalidQueueConfig)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%w: failed to connect to redis: %v", ErrInvalidQueueConfig, err)
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "doozip:"
+	}
+
+	return &RedisQueue{client: client, prefix: prefix}, nil
+}
+
+// Push adds an item to the sorted set of the named queue
+func (q *RedisQueue) Push(ctx context.Context, name string, item []byte, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	// Items are members of a set, so a unique prefix keeps identical payloads apart
+	member := strconv.FormatInt(time.Now().UnixNano(), 36) + ":" + string(item)
+
+	return q.client.ZAdd(ctx, q.prefix+name, redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: member,
+	}).Err()
+}
+
+// Pop claims the earliest due item of the named queue. Claiming is done with
+// ZREM, which only succeeds for one of the competing consumers.
+func (q *RedisQueue) Pop(ctx context.Context, name string) ([]byte, error) {
+	key := q.prefix + name
+
+	for {
+		members, err := q.client.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:     key,
+			Start:   "-inf",
+			Stop:    strconv.FormatInt(time.Now().UnixMilli(), 10),
+			ByScore: true,
+			Count:   1,
+		}).Result()
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to read queue %s: %w", name, err)
+		}
+
+		if len(members) > 0 {
+			removed, err := q.client.ZRem(ctx, key, members[0]).Result()
+			if err != nil && ctx.Err() == nil {
+				return nil, fmt.Errorf("failed to claim item of queue %s: %w", name, err)
+			}
+			if removed == 1 {
+				_, item, _ := strings.Cut(members[0], ":")
+				return []byte(item), nil
+			}
+			// Another consumer claimed the item first
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(redisPollInterval):
+		}
+	}
+}
+
+// Ping checks that Redis answers
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+// Close closes the connection to Redis
+func (q *RedisQueue) Close() error {
+	return q.client.Close()
+}
@@ -0,0 +1,322 @@
+package repositories
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+)
+
+// errSMTPAuth marks a relay rejecting the configured credentials
+var errSMTPAuth = errors.New("smtp authentication failed")
+
+// smtpClientOptions are the settings of the SMTP client shared by every relay
+type smtpClientOptions struct {
+	// helo is the hostname announced in EHLO
+	helo string
+	// Timeouts of each stage of a delivery; zero leaves a stage unbounded
+	dialTimeout    time.Duration
+	commandTimeout time.Duration
+	dataTimeout    time.Duration
+}
+
+// smtpRelay is a single SMTP server together with its health state
+type smtpRelay struct {
+	host string
+	port string
+	auth smtp.Auth
+	opts smtpClientOptions
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// newSMTPRelay creates a relay authenticating with the given credentials
+func newSMTPRelay(host, port, username, password string, opts smtpClientOptions) *smtpRelay {
+	return &smtpRelay{
+		host: host,
+		port: port,
+		auth: smtp.PlainAuth("", username, password, host),
+		opts: opts,
+	}
+}
+
+// defaultHeloHostname returns the hostname of the machine, as relays may
+// reject the EHLO of "localhost"
+func defaultHeloHostname() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "localhost"
+}
+
+// address returns the host:port address of the relay
+func (r *smtpRelay) address() string {
+	return net.JoinHostPort(r.host, r.port)
+}
+
+// send delivers the content through the relay, following the same steps as
+// smtp.SendMail. Every step must complete within its timeout, so a wedged
+// connection fails like an unreachable relay. If transcript is not nil the
+// conversation is recorded into it.
+func (r *smtpRelay) send(from string, to []string, content []byte, transcript *smtpTranscript) error {
+	client, deadline, err := r.connect(context.Background(), transcript)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// net/smtp announces SMTPUTF8 in MAIL FROM whenever the relay supports
+	// it, but the addresses can only be sent when it does
+	if needsSMTPUTF8(from, to) {
+		if ok, _ := client.Extension("SMTPUTF8"); !ok {
+			transcript.note("-- %v --", ErrSMTPUTF8Unsupported)
+			return ErrSMTPUTF8Unsupported
+		}
+	}
+
+	transcript.command("MAIL FROM:<%s>", from)
+	deadline(r.opts.commandTimeout)
+	err = client.Mail(from)
+	transcript.result(err)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		transcript.command("RCPT TO:<%s>", addr)
+		deadline(r.opts.commandTimeout)
+		err := client.Rcpt(addr)
+		transcript.result(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	transcript.command("DATA")
+	deadline(r.opts.commandTimeout)
+	w, err := client.Data()
+	if err != nil {
+		transcript.result(err)
+		return err
+	}
+	deadline(r.opts.dataTimeout)
+	if _, err := w.Write(content); err != nil {
+		transcript.result(err)
+		return err
+	}
+	err = w.Close()
+	transcript.result(err)
+	if err != nil {
+		return err
+	}
+
+	transcript.command("QUIT")
+	deadline(r.opts.commandTimeout)
+	err = client.Quit()
+	transcript.result(err)
+	return err
+}
+
+// ping connects and authenticates to the relay without sending anything
+func (r *smtpRelay) ping(ctx context.Context) error {
+	client, deadline, err := r.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	deadline(r.opts.commandTimeout)
+	return client.Quit()
+}
+
+// connect opens a session with the relay, upgraded to TLS when offered and
+// authenticated. deadline bounds the next step of the session.
+func (r *smtpRelay) connect(ctx context.Context, transcript *smtpTranscript) (*smtp.Client, func(time.Duration), error) {
+	transcript.note("-- connecting to %s --", r.address())
+
+	dialer := net.Dialer{Timeout: r.opts.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.address())
+	if err != nil {
+		transcript.note("-- %v --", err)
+		return nil, nil, err
+	}
+
+	// The deadline is set on the plain connection, so it also bounds the
+	// conversation once it is encrypted
+	deadline := func(timeout time.Duration) {
+		if timeout > 0 {
+			conn.SetDeadline(time.Now().Add(timeout))
+		}
+	}
+
+	deadline(r.opts.commandTimeout)
+	client, err := smtp.NewClient(transcript.wrap(conn), r.host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	deadline(r.opts.commandTimeout)
+	if err := client.Hello(r.opts.helo); err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		deadline(r.opts.commandTimeout)
+		if err := client.StartTLS(&tls.Config{ServerName: r.host}); err != nil {
+			transcript.note("-- STARTTLS failed: %v --", err)
+			client.Close()
+			return nil, nil, err
+		}
+	}
+
+	if ok, _ := client.Extension("AUTH"); ok && r.auth != nil {
+		transcript.command("AUTH <redacted>")
+		deadline(r.opts.commandTimeout)
+		err := client.Auth(r.auth)
+		transcript.result(err)
+		if err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("%w: %w", errSMTPAuth, err)
+		}
+	}
+
+	return client, deadline, nil
+}
+
+// healthy reports whether the relay is not within its cooldown period
+func (r *smtpRelay) healthy(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !now.Before(r.downUntil)
+}
+
+// markDown skips the relay until the cooldown has passed
+func (r *smtpRelay) markDown(cooldown time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downUntil = time.Now().Add(cooldown)
+}
+
+// markUp clears the relay's failure state after a successful delivery
+func (r *smtpRelay) markUp() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downUntil = time.Time{}
+}
+
+// isRelayFailure reports whether err is caused by the relay itself (connection,
+// timeout, authentication or a temporary failure) rather than by the message,
+// in which case delivery should be retried through the next relay
+func isRelayFailure(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch {
+		case protoErr.Code >= 400 && protoErr.Code < 500:
+			return true
+		case protoErr.Code == 530, protoErr.Code == 534, protoErr.Code == 535:
+			// Authentication required or rejected
+			return true
+		}
+		return false
+	}
+
+	// Errors such as a failed TLS handshake or an unsupported auth mechanism
+	// are not typed by net/smtp, but they are still problems with the relay
+	return true
+}
+
+// SMTPFailureReason classifies a delivery error as one of the failure
+// reasons of the mail metrics
+func SMTPFailureReason(err error) string {
+	if errors.Is(err, ErrInvalidRecipients) || errors.Is(err, ErrInvalidSubject) || errors.Is(err, ErrInvalidFile) {
+		return metrics.FailureValidation
+	}
+	if errors.Is(err, errSMTPAuth) {
+		return metrics.FailureAuth
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch {
+		case protoErr.Code == 530, protoErr.Code == 534, protoErr.Code == 535:
+			return metrics.FailureAuth
+		case protoErr.Code >= 500:
+			return metrics.Failure5xx
+		case protoErr.Code >= 400:
+			return metrics.Failure4xx
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return metrics.FailureConnection
+	}
+
+	return metrics.FailureOther
+}
+
+// sendThroughRelays delivers the message through the first relay that accepts
+// it, skipping relays that recently failed. If every relay is in its cooldown
+// period they are all tried anyway rather than failing outright. transcript
+// is optional and records the conversation with every relay tried.
+func (m *MailRepositoryImpl) sendThroughRelays(to []string, content []byte, transcript *smtpTranscript) error {
+	now := time.Now()
+
+	candidates := make([]*smtpRelay, 0, len(m.relays))
+	for _, relay := range m.relays {
+		if relay.healthy(now) {
+			candidates = append(candidates, relay)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = m.relays
+	}
+
+	var errs []error
+	for _, relay := range candidates {
+		err := relay.send(m.envelopeFrom, to, content, transcript)
+		if err == nil {
+			relay.markUp()
+			return nil
+		}
+
+		err = fmt.Errorf("%s: %w", relay.address(), err)
+		if errors.Is(err, ErrSMTPUTF8Unsupported) {
+			// The relay works, so it is not skipped for other messages
+			errs = append(errs, err)
+			continue
+		}
+		if !isRelayFailure(err) {
+			return err
+		}
+
+		relay.markDown(m.relayCooldown)
+		errs = append(errs, err)
+		if len(errs) < len(candidates) {
+			metrics.MailRetried(SMTPFailureReason(err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
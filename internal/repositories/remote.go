@@ -0,0 +1,249 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var (
+	ErrInvalidRemoteURL      = errors.New("invalid remote archive url")
+	ErrRemoteArchiveTooLarge = errors.New("remote archive exceeds the size limit")
+	ErrRemoteFetchFailed     = errors.New("failed to fetch remote archive")
+)
+
+// remoteBlockSize is the least fetched by a Range request, so the small reads
+// of the zip reader don't each cost a request
+const remoteBlockSize = 64 << 10
+
+// RemoteArchive is an archive fetched by URL
+type RemoteArchive struct {
+	io.ReaderAt
+	Name string
+	Size int64
+	// Ranged reports whether only the parts read are fetched, with Range requests
+	Ranged bool
+}
+
+// RemoteArchiveRepository fetches archives hosted elsewhere
+type RemoteArchiveRepository interface {
+	Open(ctx context.Context, rawURL string) (*RemoteArchive, error)
+}
+
+// HTTPRemoteArchiveRepository fetches archives over HTTP. Servers supporting
+// Range requests are only asked for the parts that are read, such as the
+// central directory; others are downloaded in full, up to the size limit.
+type HTTPRemoteArchiveRepository struct {
+	client  *OutboundClient
+	maxSize int64
+}
+
+// NewHTTPRemoteArchiveRepository creates a new instance of
+// HTTPRemoteArchiveRepository, fetching with an outbound client of outbound
+// whose timeout and private addresses are overridden by cfg
+func NewHTTPRemoteArchiveRepository(cfg *config.RemoteArchiveConfig, outbound config.OutboundConfig) (*HTTPRemoteArchiveRepository, error) {
+	if cfg.Timeout > 0 {
+		outbound.Timeout = cfg.Timeout
+	}
+	outbound.AllowPrivate = outbound.AllowPrivate || cfg.AllowPrivate
+
+	client, err := NewOutboundClient(&outbound)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPRemoteArchiveRepository{
+		client:  client,
+		maxSize: cfg.MaxSize,
+	}, nil
+}
+
+// Open fetches the archive at rawURL. At most the size limit is downloaded,
+// whether the archive is read with Range requests or in full.
+func (r *HTTPRemoteArchiveRepository) Open(ctx context.Context, rawURL string) (*RemoteArchive, error) {
+	const op = "HTTPRemoteArchiveRepository.Open"
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidRemoteURL)
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = "archive.zip"
+	}
+
+	archive, err := r.openRanged(ctx, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if archive == nil {
+		content, err := r.download(ctx, u.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		archive = &RemoteArchive{ReaderAt: bytes.NewReader(content), Size: int64(len(content))}
+	}
+	archive.Name = name
+
+	return archive, nil
+}
+
+// openRanged returns the archive read with Range requests, or nil when the
+// server doesn't announce support for them
+func (r *HTTPRemoteArchiveRepository) openRanged(ctx context.Context, rawURL string) (*RemoteArchive, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRemoteURL, err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fetchError(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 || resp.Header.Get("Accept-Ranges") != "bytes" {
+		return nil, nil
+	}
+
+	return &RemoteArchive{
+		ReaderAt: &rangeReader{
+			ctx:    ctx,
+			client: r.client,
+			url:    resp.Request.URL.String(),
+			size:   resp.ContentLength,
+			budget: r.maxSize,
+		},
+		Size:   resp.ContentLength,
+		Ranged: true,
+	}, nil
+}
+
+// download fetches the whole archive, streaming it up to the size limit
+func (r *HTTPRemoteArchiveRepository) download(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRemoteURL, err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fetchError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %s", ErrRemoteFetchFailed, resp.Status)
+	}
+	if resp.ContentLength > r.maxSize {
+		return nil, ErrRemoteArchiveTooLarge
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, r.maxSize+1))
+	if err != nil {
+		return nil, fetchError(err)
+	}
+	if int64(len(content)) > r.maxSize {
+		return nil, ErrRemoteArchiveTooLarge
+	}
+
+	return content, nil
+}
+
+// rangeReader reads a remote file with Range requests, fetching at least
+// remoteBlockSize bytes at a time and keeping the last block. It stops once
+// budget bytes have been downloaded.
+type rangeReader struct {
+	ctx    context.Context
+	client *OutboundClient
+	url    string
+	size   int64
+	budget int64
+
+	block      []byte
+	blockStart int64
+}
+
+// ReadAt implements io.ReaderAt
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		if off < r.blockStart || off >= r.blockStart+int64(len(r.block)) {
+			if err := r.fetch(off, int64(len(p)-n)); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p[n:], r.block[off-r.blockStart:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fetch replaces the kept block with the one starting at off
+func (r *rangeReader) fetch(off, length int64) error {
+	end := min(off+max(length, remoteBlockSize), r.size) - 1
+	if end-off+1 > r.budget {
+		return ErrRemoteArchiveTooLarge
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRemoteFetchFailed, err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fetchError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%w: range request returned %s", ErrRemoteFetchFailed, resp.Status)
+	}
+
+	block, err := io.ReadAll(io.LimitReader(resp.Body, end-off+1))
+	if err != nil {
+		return fetchError(err)
+	}
+	if int64(len(block)) != end-off+1 {
+		return fmt.Errorf("%w: short range response", ErrRemoteFetchFailed)
+	}
+
+	r.budget -= int64(len(block))
+	r.block = block
+	r.blockStart = off
+	return nil
+}
+
+// fetchError wraps an error of the HTTP client, keeping denied addresses apart
+func fetchError(err error) error {
+	if errors.Is(err, ErrAddressNotAllowed) {
+		return err
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return fmt.Errorf("%w: timed out", ErrRemoteFetchFailed)
+	}
+	return fmt.Errorf("%w: %v", ErrRemoteFetchFailed, err)
+}
@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+// sniffMaxEntrySize is the size above which entries are not sniffed. Only
+// the first bytes are decompressed, but large entries are mostly media whose
+// extension is reliable.
+const sniffMaxEntrySize = 10 << 20
+
+// sniffLength is the number of bytes http.DetectContentType considers
+const sniffLength = 512
+
+// mimeTypeAliases maps the names http.DetectContentType uses to those
+// returned for the extension
+var mimeTypeAliases = map[string]string{
+	"application/x-gzip": "application/gzip",
+	"audio/wave":         "audio/wav",
+	"audio/x-wav":        "audio/wav",
+	"image/x-icon":       "image/vnd.microsoft.icon",
+}
+
+// zipBasedMIMETypes are formats stored as zip archives
+var zipBasedMIMETypes = []string{
+	"application/vnd.openxmlformats-officedocument.",
+	"application/vnd.oasis.opendocument.",
+	"application/java-archive",
+	"application/x-java-archive",
+	"application/vnd.android.package-archive",
+}
+
+// sniffEntry sets the detected type of a small entry and whether it
+// contradicts the one given by its extension. Entries that can't be read,
+// such as encrypted ones, are left as they are.
+func (r *archiveRepositoryImpl) sniffEntry(f *zip.File, details *entities.FileDetails) {
+	if f.UncompressedSize64 == 0 || f.UncompressedSize64 > sniffMaxEntrySize || f.Flags&0x1 != 0 {
+		return
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		r.log.Debug("failed to open entry for sniffing",
+			"filepath", details.FilePath,
+			"error", err,
+		)
+		return
+	}
+	defer rc.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		r.log.Debug("failed to read entry for sniffing",
+			"filepath", details.FilePath,
+			"error", err,
+		)
+		return
+	}
+
+	detected := sniffMimeType(head[:n])
+	if detected == "" {
+		return
+	}
+	details.DetectedMimeType = detected
+	details.MimeTypeMismatch = !mimeTypesAgree(details.MimeType, detected)
+}
+
+// sniffMimeType returns the type of content, or an empty string when it
+// is not recognized beyond plain text or binary data
+func sniffMimeType(content []byte) string {
+	if executable := utils.ExecutableType(content); executable != "" {
+		return executable
+	}
+
+	detected := baseMimeType(http.DetectContentType(content))
+	if detected == "application/octet-stream" || detected == "text/plain" {
+		return ""
+	}
+	return detected
+}
+
+// mimeTypesAgree reports whether content of the detected type may carry the
+// claimed type, allowing for aliases, formats built on zip or XML, and text
+// detected in any textual file
+func mimeTypesAgree(claimed, detected string) bool {
+	claimed = baseMimeType(claimed)
+	detected = baseMimeType(detected)
+
+	switch {
+	case claimed == detected, claimed == "application/octet-stream":
+		return true
+	case strings.HasPrefix(claimed, "text/") && strings.HasPrefix(detected, "text/"):
+		return true
+	case detected == "text/xml":
+		return claimed == "application/xml" || strings.HasSuffix(claimed, "+xml")
+	case detected == "application/zip":
+		if strings.HasSuffix(claimed, "+zip") {
+			return true
+		}
+		for _, prefix := range zipBasedMIMETypes {
+			if strings.HasPrefix(claimed, prefix) {
+				return true
+			}
+		}
+	}
+
+	// Containers such as mp4 hold audio or video alike
+	claimedType, claimedSubtype, _ := strings.Cut(claimed, "/")
+	detectedType, detectedSubtype, _ := strings.Cut(detected, "/")
+	return claimedSubtype == detectedSubtype &&
+		(claimedType == "audio" || claimedType == "video") &&
+		(detectedType == "audio" || detectedType == "video")
+}
+
+// baseMimeType strips parameters from a MIME type and resolves aliases
+func baseMimeType(mimeType string) string {
+	base, _, _ := strings.Cut(mimeType, ";")
+	base = strings.ToLower(strings.TrimSpace(base))
+	if alias, ok := mimeTypeAliases[base]; ok {
+		return alias
+	}
+	return base
+}
@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrArchiveNotFound    = errors.New("stored archive not found")
+	ErrInvalidStoreConfig = errors.New("invalid archive store configuration")
+)
+
+// storeIDRegex restricts archive ids so they can be used as artifact keys
+// safely. The ids of a tenant's archives start with the tenant id and a dot.
+var storeIDRegex = regexp.MustCompile(`^([a-z0-9_-]+\.)?[a-zA-Z0-9_-]+$`)
+
+// archiveKey returns the artifact key of an archive without its extension.
+// Tenant archives are kept under a prefix named after the tenant.
+func archiveKey(id string) string {
+	return strings.Replace(id, ".", "/", 1)
+}
+
+// ArchiveStoreRepository persists created archives for later download
+type ArchiveStoreRepository interface {
+	Save(meta *entities.StoredArchive, content []byte) error
+	Get(id string) (*entities.StoredArchive, error)
+	Open(id string) (Artifact, error)
+	// List returns the metadata of every stored archive
+	List() ([]*entities.StoredArchive, error)
+	// Delete removes the archive together with its access records
+	Delete(id string) error
+	AddAccess(id string, access entities.ArchiveAccess) error
+	ListAccesses(id string) ([]entities.ArchiveAccess, error)
+}
+
+// ArtifactArchiveStore keeps every archive as the artifact <id>.zip next to
+// an <id>.json metadata artifact, under <tenant>/ for tenant archives. Each
+// access to the share link is a separate artifact under <id>.accesses/, so
+// instances never overwrite each other's records.
+type ArtifactArchiveStore struct {
+	artifacts ArtifactStore
+}
+
+// NewArtifactArchiveStore creates a new instance of ArtifactArchiveStore
+func NewArtifactArchiveStore(artifacts ArtifactStore) (*ArtifactArchiveStore, error) {
+	if artifacts == nil {
+		return nil, fmt.Errorf("%w: artifact store is required", ErrInvalidStoreConfig)
+	}
+
+	return &ArtifactArchiveStore{artifacts: artifacts}, nil
+}
+
+// Save writes the archive content and its metadata. The metadata is written
+// last, so an archive is never visible before its content is complete.
+func (s *ArtifactArchiveStore) Save(meta *entities.StoredArchive, content []byte) error {
+	const op = "ArtifactArchiveStore.Save"
+
+	if meta == nil || !storeIDRegex.MatchString(meta.ID) {
+		return fmt.Errorf("%s: invalid archive id", op)
+	}
+
+	ctx := context.Background()
+
+	if err := s.artifacts.Put(ctx, archiveKey(meta.ID)+".zip", bytes.NewReader(content), int64(len(content))); err != nil {
+		return fmt.Errorf("%s: failed to write archive: %w", op, err)
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode metadata: %w", op, err)
+	}
+
+	if err := s.artifacts.Put(ctx, archiveKey(meta.ID)+".json", bytes.NewReader(data), int64(len(data))); err != nil {
+		s.artifacts.Delete(ctx, archiveKey(meta.ID)+".zip")
+		return fmt.Errorf("%s: failed to write metadata: %w", op, err)
+	}
+
+	return nil
+}
+
+// Get returns the metadata of a stored archive
+func (s *ArtifactArchiveStore) Get(id string) (*entities.StoredArchive, error) {
+	const op = "ArtifactArchiveStore.Get"
+
+	if !storeIDRegex.MatchString(id) {
+		return nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+	}
+
+	var meta entities.StoredArchive
+	if err := s.readJSON(archiveKey(id)+".json", &meta); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &meta, nil
+}
+
+// Open opens the content of a stored archive for reading
+func (s *ArtifactArchiveStore) Open(id string) (Artifact, error) {
+	const op = "ArtifactArchiveStore.Open"
+
+	if !storeIDRegex.MatchString(id) {
+		return nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+	}
+
+	artifact, err := s.artifacts.Open(context.Background(), archiveKey(id)+".zip")
+	if err != nil {
+		if errors.Is(err, ErrArtifactNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return artifact, nil
+}
+
+// List returns the metadata of every stored archive
+func (s *ArtifactArchiveStore) List() ([]*entities.StoredArchive, error) {
+	const op = "ArtifactArchiveStore.List"
+
+	keys, err := s.artifacts.List(context.Background(), "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	archives := make([]*entities.StoredArchive, 0)
+	for _, key := range keys {
+		name, ok := strings.CutSuffix(key, ".json")
+		if id := strings.Replace(name, "/", ".", 1); !ok || !storeIDRegex.MatchString(id) {
+			continue
+		}
+
+		var meta entities.StoredArchive
+		if err := s.readJSON(key, &meta); err != nil {
+			if errors.Is(err, ErrArchiveNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		archives = append(archives, &meta)
+	}
+
+	return archives, nil
+}
+
+// Delete removes the archive, its metadata and its access records. The
+// metadata is removed first so the archive disappears even if removing the
+// rest fails.
+func (s *ArtifactArchiveStore) Delete(id string) error {
+	const op = "ArtifactArchiveStore.Delete"
+
+	if !storeIDRegex.MatchString(id) {
+		return fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+	}
+
+	ctx := context.Background()
+
+	accesses, err := s.artifacts.List(ctx, archiveKey(id)+".accesses/")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, key := range append([]string{archiveKey(id) + ".json", archiveKey(id) + ".zip"}, accesses...) {
+		if err := s.artifacts.Delete(ctx, key); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// AddAccess stores an access record for the archive
+func (s *ArtifactArchiveStore) AddAccess(id string, access entities.ArchiveAccess) error {
+	const op = "ArtifactArchiveStore.AddAccess"
+
+	if !storeIDRegex.MatchString(id) {
+		return fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+	}
+
+	data, err := json.Marshal(access)
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode access: %w", op, err)
+	}
+
+	// Keys sort by time; the random suffix keeps concurrent accesses apart
+	key := fmt.Sprintf("%s.accesses/%020d-%s.json", archiveKey(id), access.Time.UnixNano(), utils.NewID()[:8])
+	if err := s.artifacts.Put(context.Background(), key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("%s: failed to write access: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListAccesses returns the access records of the archive, oldest first
+func (s *ArtifactArchiveStore) ListAccesses(id string) ([]entities.ArchiveAccess, error) {
+	const op = "ArtifactArchiveStore.ListAccesses"
+
+	if _, err := s.Get(id); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := s.artifacts.List(context.Background(), archiveKey(id)+".accesses/")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accesses := make([]entities.ArchiveAccess, 0, len(keys))
+	for _, key := range keys {
+		var access entities.ArchiveAccess
+		if err := s.readJSON(key, &access); err != nil {
+			if errors.Is(err, ErrArchiveNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		accesses = append(accesses, access)
+	}
+
+	return accesses, nil
+}
+
+// readJSON decodes the artifact stored under key into v
+func (s *ArtifactArchiveStore) readJSON(key string, v any) error {
+	artifact, err := s.artifacts.Open(context.Background(), key)
+	if err != nil {
+		if errors.Is(err, ErrArtifactNotFound) {
+			return ErrArchiveNotFound
+		}
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer artifact.Close()
+
+	data, err := io.ReadAll(artifact)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+
+	return nil
+}
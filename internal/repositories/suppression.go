@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var ErrSuppressionNotFound = errors.New("address is not suppressed")
+
+// SuppressionRepository stores the addresses mail is never sent to, per tenant
+type SuppressionRepository interface {
+	// Add suppresses an address, replacing the reason and time when it is
+	// suppressed already
+	Add(entry *entities.Suppression) error
+	Remove(tenantID, address string) error
+	// List returns the suppressed addresses of a tenant, sorted
+	List(tenantID string) ([]*entities.Suppression, error)
+	// Suppressed returns which of the addresses are suppressed for a tenant
+	Suppressed(tenantID string, addresses []string) (map[string]bool, error)
+}
+
+// suppressionKey identifies an address of a tenant
+type suppressionKey struct {
+	tenantID, address string
+}
+
+// MemorySuppressionRepository keeps the suppression list in memory; it is
+// lost on restart
+type MemorySuppressionRepository struct {
+	mu      sync.RWMutex
+	entries map[suppressionKey]entities.Suppression
+}
+
+// NewMemorySuppressionRepository creates a new instance of MemorySuppressionRepository
+func NewMemorySuppressionRepository() *MemorySuppressionRepository {
+	return &MemorySuppressionRepository{entries: make(map[suppressionKey]entities.Suppression)}
+}
+
+// Add suppresses an address
+func (r *MemorySuppressionRepository) Add(entry *entities.Suppression) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[suppressionKey{entry.TenantID, entry.Address}] = *entry
+	return nil
+}
+
+// Remove takes an address off the suppression list
+func (r *MemorySuppressionRepository) Remove(tenantID, address string) error {
+	const op = "MemorySuppressionRepository.Remove"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := suppressionKey{tenantID, address}
+	if _, exists := r.entries[key]; !exists {
+		return fmt.Errorf("%s: %w", op, ErrSuppressionNotFound)
+	}
+	delete(r.entries, key)
+
+	return nil
+}
+
+// List returns the suppressed addresses of a tenant, sorted
+func (r *MemorySuppressionRepository) List(tenantID string) ([]*entities.Suppression, error) {
+	r.mu.RLock()
+	entries := make([]*entities.Suppression, 0)
+	for key, entry := range r.entries {
+		if key.tenantID == tenantID {
+			c := entry
+			entries = append(entries, &c)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(entries, func(a, b *entities.Suppression) int { return strings.Compare(a.Address, b.Address) })
+	return entries, nil
+}
+
+// Suppressed returns which of the addresses are suppressed for a tenant
+func (r *MemorySuppressionRepository) Suppressed(tenantID string, addresses []string) (map[string]bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	suppressed := make(map[string]bool)
+	for _, address := range addresses {
+		if _, exists := r.entries[suppressionKey{tenantID, address}]; exists {
+			suppressed[address] = true
+		}
+	}
+	return suppressed, nil
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// SQLSuppressionRepository keeps the suppression list in an SQL database
+type SQLSuppressionRepository struct {
+	db *Database
+}
+
+// NewSQLSuppressionRepository creates a new instance of SQLSuppressionRepository
+func NewSQLSuppressionRepository(db *Database) (*SQLSuppressionRepository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is nil", ErrInvalidDatabaseConfig)
+	}
+	return &SQLSuppressionRepository{db: db}, nil
+}
+
+// Add suppresses an address
+func (r *SQLSuppressionRepository) Add(entry *entities.Suppression) error {
+	const op = "SQLSuppressionRepository.Add"
+
+	_, err := r.db.Exec(r.db.rebind(`INSERT INTO suppressions (tenant_id, address, reason, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (tenant_id, address) DO UPDATE SET reason = excluded.reason, created_at = excluded.created_at`),
+		entry.TenantID, entry.Address, string(entry.Reason), entry.CreatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Remove takes an address off the suppression list
+func (r *SQLSuppressionRepository) Remove(tenantID, address string) error {
+	const op = "SQLSuppressionRepository.Remove"
+
+	res, err := r.db.Exec(r.db.rebind(`DELETE FROM suppressions WHERE tenant_id = ? AND address = ?`), tenantID, address)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrSuppressionNotFound)
+	}
+
+	return nil
+}
+
+// List returns the suppressed addresses of a tenant, sorted
+func (r *SQLSuppressionRepository) List(tenantID string) ([]*entities.Suppression, error) {
+	const op = "SQLSuppressionRepository.List"
+
+	rows, err := r.db.Query(r.db.rebind(`SELECT address, reason, created_at FROM suppressions
+		WHERE tenant_id = ? ORDER BY address`), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := make([]*entities.Suppression, 0)
+	for rows.Next() {
+		var (
+			entry     = entities.Suppression{TenantID: tenantID}
+			reason    string
+			createdAt int64
+		)
+		if err := rows.Scan(&entry.Address, &reason, &createdAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		entry.Reason = entities.SuppressionReason(reason)
+		entry.CreatedAt = time.Unix(0, createdAt)
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+// Suppressed returns which of the addresses are suppressed for a tenant
+func (r *SQLSuppressionRepository) Suppressed(tenantID string, addresses []string) (map[string]bool, error) {
+	const op = "SQLSuppressionRepository.Suppressed"
+
+	suppressed := make(map[string]bool)
+	if len(addresses) == 0 {
+		return suppressed, nil
+	}
+
+	args := make([]any, 0, len(addresses)+1)
+	args = append(args, tenantID)
+	for _, address := range addresses {
+		args = append(args, address)
+	}
+
+	rows, err := r.db.Query(r.db.rebind(`SELECT address FROM suppressions WHERE tenant_id = ? AND address IN (?`+
+		strings.Repeat(", ?", len(addresses)-1)+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		suppressed[address] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return suppressed, nil
+}
@@ -0,0 +1,292 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+const (
+	subjectTemplateFile = "subject.tmpl"
+	textTemplateFile    = "body.txt.tmpl"
+	htmlTemplateFile    = "body.html.tmpl"
+
+	// reloadDebounce coalesces bursts of file events produced by editors
+	reloadDebounce = 200 * time.Millisecond
+)
+
+var (
+	ErrTemplateNotFound = errors.New("mail template not found")
+	ErrInvalidTemplate  = errors.New("invalid mail template")
+)
+
+// MailTemplateRepository defines the interface for rendering named mail templates
+type MailTemplateRepository interface {
+	Render(name string, data entities.MailTemplateData) (*entities.RenderedMail, error)
+}
+
+// mailTemplate holds the parsed parts of a single named template
+type mailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// FileTemplateRepository loads mail templates from a directory where every
+// subdirectory is a template named after it, containing subject.tmpl and at
+// least one of body.txt.tmpl or body.html.tmpl
+type FileTemplateRepository struct {
+	dir string
+	log *slog.Logger
+
+	mu        sync.RWMutex
+	templates map[string]*mailTemplate
+}
+
+// NewFileTemplateRepository creates a new FileTemplateRepository and loads all templates in dir
+func NewFileTemplateRepository(dir string, log *slog.Logger) (*FileTemplateRepository, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("%w: templates directory is required", ErrInvalidTemplate)
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	repo := &FileTemplateRepository{
+		dir: dir,
+		log: log,
+	}
+
+	if err := repo.load(); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Render executes the named template with the given data
+func (r *FileTemplateRepository) Render(name string, data entities.MailTemplateData) (*entities.RenderedMail, error) {
+	r.mu.RLock()
+	tmpl, ok := r.templates[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	var rendered entities.RenderedMail
+	var buf bytes.Buffer
+
+	if err := tmpl.subject.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %s: %w", name, err)
+	}
+	// Subjects are single header lines
+	rendered.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	if tmpl.text != nil {
+		buf.Reset()
+		if err := tmpl.text.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render text body of %s: %w", name, err)
+		}
+		rendered.Text = buf.String()
+	}
+
+	if tmpl.html != nil {
+		buf.Reset()
+		if err := tmpl.html.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render html body of %s: %w", name, err)
+		}
+		rendered.HTML = buf.String()
+	}
+
+	return &rendered, nil
+}
+
+// Watch reloads the templates whenever files in the directory change, until
+// the context is cancelled. If the directory cannot be read, the previously
+// loaded templates are kept.
+func (r *FileTemplateRepository) Watch(ctx context.Context) error {
+	const op = "FileTemplateRepository.Watch"
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("%s: failed to create watcher: %w", op, err)
+	}
+	defer watcher.Close()
+
+	if err := r.watchDirs(watcher); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	reload := make(chan struct{}, 1)
+	debounce := time.AfterFunc(time.Hour, func() {
+		select {
+		case reload <- struct{}{}:
+		default:
+		}
+	})
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			r.log.Warn("template watcher error",
+				"op", op,
+				"error", err,
+			)
+		case <-reload:
+			// Pick up template directories created since the last reload
+			if err := r.watchDirs(watcher); err != nil {
+				r.log.Warn("failed to watch template directories",
+					"op", op,
+					"error", err,
+				)
+			}
+			if err := r.load(); err != nil {
+				r.log.Error("failed to reload mail templates",
+					"op", op,
+					"error", err,
+				)
+				continue
+			}
+			r.log.Info("mail templates reloaded", "op", op)
+		}
+	}
+}
+
+// watchDirs adds the templates directory and its subdirectories to the watcher
+func (r *FileTemplateRepository) watchDirs(watcher *fsnotify.Watcher) error {
+	if err := watcher.Add(r.dir); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", r.dir, err)
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if err := watcher.Add(filepath.Join(r.dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// load parses every template in the directory and atomically replaces the current set
+func (r *FileTemplateRepository) load() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	templates := make(map[string]*mailTemplate, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		tmpl, err := parseMailTemplate(filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			// Skip broken templates so one bad edit doesn't unload the others
+			r.log.Warn("skipping invalid mail template",
+				"template", entry.Name(),
+				"error", fmt.Errorf("%w: %v", ErrInvalidTemplate, err),
+			)
+			continue
+		}
+		templates[entry.Name()] = tmpl
+	}
+
+	r.mu.Lock()
+	r.templates = templates
+	r.mu.Unlock()
+
+	return nil
+}
+
+// parseMailTemplate parses the template files found in dir
+func parseMailTemplate(dir string) (*mailTemplate, error) {
+	var tmpl mailTemplate
+
+	subject, err := readTemplateFile(dir, subjectTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("%s is required", subjectTemplateFile)
+	}
+	if tmpl.subject, err = texttemplate.New(subjectTemplateFile).Parse(subject); err != nil {
+		return nil, err
+	}
+
+	text, err := readTemplateFile(dir, textTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	if text != "" {
+		if tmpl.text, err = texttemplate.New(textTemplateFile).Parse(text); err != nil {
+			return nil, err
+		}
+	}
+
+	html, err := readTemplateFile(dir, htmlTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	if html != "" {
+		if tmpl.html, err = htmltemplate.New(htmlTemplateFile).Parse(html); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmpl.text == nil && tmpl.html == nil {
+		return nil, fmt.Errorf("%s or %s is required", textTemplateFile, htmlTemplateFile)
+	}
+
+	return &tmpl, nil
+}
+
+// readTemplateFile returns the file contents, or an empty string if it does not exist
+func readTemplateFile(dir, name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
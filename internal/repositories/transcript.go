@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// tlsHandshakeRecord is the first byte of a TLS handshake record, which marks
+// the point after STARTTLS from where the traffic is encrypted
+const tlsHandshakeRecord = 0x16
+
+// smtpTranscript records an SMTP conversation for diagnostics. Plaintext
+// traffic is recorded verbatim (with credentials redacted); once TLS is
+// negotiated only the commands issued and the server errors are recorded.
+type smtpTranscript struct {
+	mu        sync.Mutex
+	lines     []string
+	encrypted bool
+}
+
+// Lines returns the recorded transcript
+func (t *smtpTranscript) Lines() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// note records a free-form line
+func (t *smtpTranscript) note(format string, args ...any) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, fmt.Sprintf(format, args...))
+}
+
+// command records a client command issued over the encrypted connection
+func (t *smtpTranscript) command(format string, args ...any) {
+	if t == nil || !t.isEncrypted() {
+		return
+	}
+	t.note("C: "+format, args...)
+}
+
+// result records the outcome of the last command issued over the encrypted connection
+func (t *smtpTranscript) result(err error) {
+	if t == nil || !t.isEncrypted() {
+		return
+	}
+	if err != nil {
+		t.note("S: %v", err)
+		return
+	}
+	t.note("S: OK")
+}
+
+func (t *smtpTranscript) isEncrypted() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.encrypted
+}
+
+// record appends raw plaintext traffic split into lines
+func (t *smtpTranscript) record(prefix string, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.encrypted {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\r\n"), "\r\n") {
+		if strings.HasPrefix(strings.ToUpper(line), "AUTH ") {
+			fields := strings.Fields(line)
+			line = strings.Join(fields[:min(len(fields), 2)], " ") + " <redacted>"
+		}
+		t.lines = append(t.lines, prefix+line)
+	}
+}
+
+// wrap returns a connection that records its traffic into the transcript
+func (t *smtpTranscript) wrap(conn net.Conn) net.Conn {
+	if t == nil {
+		return conn
+	}
+	return &recordingConn{Conn: conn, transcript: t}
+}
+
+// recordingConn is a net.Conn that copies its traffic into a transcript
+type recordingConn struct {
+	net.Conn
+	transcript *smtpTranscript
+	inData     bool
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.transcript.record("S: ", p[:n])
+	}
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	switch {
+	case len(p) > 0 && p[0] == tlsHandshakeRecord:
+		c.transcript.mu.Lock()
+		if !c.transcript.encrypted {
+			c.transcript.encrypted = true
+			c.transcript.lines = append(c.transcript.lines, "-- TLS negotiated, encrypted traffic is not recorded --")
+		}
+		c.transcript.mu.Unlock()
+	case c.inData:
+		// The message content is not useful in a transcript
+		if bytes.HasSuffix(p, []byte("\r\n.\r\n")) || bytes.Equal(p, []byte(".\r\n")) {
+			c.inData = false
+			c.transcript.record("C: ", []byte("<message content>\r\n."))
+		}
+	default:
+		c.transcript.record("C: ", p)
+		if strings.EqualFold(string(p), "DATA\r\n") {
+			c.inData = true
+		}
+	}
+	return c.Conn.Write(p)
+}
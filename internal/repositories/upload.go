@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+var ErrInvalidUploadID = errors.New("invalid upload id")
+
+// uploadIDRegex matches the ids uploads are kept under
+var uploadIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// UploadRepository keeps uploads until the jobs processing them have run
+type UploadRepository interface {
+	Save(ctx context.Context, id string, r io.Reader, size int64) error
+	Open(ctx context.Context, id string) (Artifact, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// ArtifactUploadStore keeps uploads in the artifact store, so the worker
+// running their job may be another instance than the one that received them
+type ArtifactUploadStore struct {
+	artifacts ArtifactStore
+}
+
+// NewArtifactUploadStore creates a new instance of ArtifactUploadStore
+func NewArtifactUploadStore(artifacts ArtifactStore) (*ArtifactUploadStore, error) {
+	if artifacts == nil {
+		return nil, fmt.Errorf("%w: artifact store is required", ErrInvalidStoreConfig)
+	}
+	return &ArtifactUploadStore{artifacts: artifacts}, nil
+}
+
+// Save writes an upload
+func (s *ArtifactUploadStore) Save(ctx context.Context, id string, r io.Reader, size int64) error {
+	const op = "ArtifactUploadStore.Save"
+
+	if !uploadIDRegex.MatchString(id) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidUploadID)
+	}
+	if err := s.artifacts.Put(ctx, uploadKey(id), r, size); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Open opens an upload
+func (s *ArtifactUploadStore) Open(ctx context.Context, id string) (Artifact, error) {
+	const op = "ArtifactUploadStore.Open"
+
+	if !uploadIDRegex.MatchString(id) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidUploadID)
+	}
+	artifact, err := s.artifacts.Open(ctx, uploadKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return artifact, nil
+}
+
+// Delete removes an upload
+func (s *ArtifactUploadStore) Delete(ctx context.Context, id string) error {
+	const op = "ArtifactUploadStore.Delete"
+
+	if !uploadIDRegex.MatchString(id) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidUploadID)
+	}
+	if err := s.artifacts.Delete(ctx, uploadKey(id)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// uploadKey returns the artifact key of an upload
+func uploadKey(id string) string {
+	return "uploads/" + id
+}
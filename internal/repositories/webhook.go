@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var ErrWebhookRejected = errors.New("webhook endpoint rejected the event")
+
+// WebhookRepository posts event payloads to webhook endpoints
+type WebhookRepository interface {
+	// Post sends body to url with the given headers, failing unless the
+	// endpoint answers with a 2xx status
+	Post(ctx context.Context, url string, header http.Header, body []byte) error
+}
+
+// HTTPWebhookRepository posts event payloads with an outbound client, so
+// they are retried and cannot reach addresses that are not allowed
+type HTTPWebhookRepository struct {
+	client *OutboundClient
+}
+
+// NewHTTPWebhookRepository creates a new instance of HTTPWebhookRepository
+func NewHTTPWebhookRepository(client *OutboundClient) *HTTPWebhookRepository {
+	return &HTTPWebhookRepository{client: client}
+}
+
+// Post sends a JSON payload to url
+func (r *HTTPWebhookRepository) Post(ctx context.Context, url string, header http.Header, body []byte) error {
+	const op = "HTTPWebhookRepository.Post"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %w: %s", op, ErrWebhookRejected, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// WinZip AES encryption (AE-2) with 256-bit keys, as read by 7-Zip, WinZip,
+// libarchive and the unzip tools of current operating systems. Entries are
+// stored with method zipMethodAES, the actual method being recorded in the
+// zipExtraAES extra field.
+const (
+	zipMethodAES   = 99
+	zipExtraAES    = 0x9901
+	zipAESVersion  = 2 // AE-2: the CRC is left out, the MAC protects the data
+	zipAESStrength = 3 // AES-256
+	zipAESKeyLen   = 32
+	zipAESSaltLen  = 16
+	zipAESVerifier = 2
+	zipAESMACLen   = 10
+	zipAESRounds   = 1000
+
+	// zipAESExtraLen is the size of the zipExtraAES extra field
+	zipAESExtraLen = 11
+	// zipAESOverhead is the size the encryption adds to the compressed data
+	zipAESOverhead = zipAESSaltLen + zipAESVerifier + zipAESMACLen
+)
+
+// zipAESExtra returns the extra field of an AES encrypted entry compressed
+// with method
+func zipAESExtra(method uint16) []byte {
+	extra := make([]byte, zipAESExtraLen)
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraAES)
+	binary.LittleEndian.PutUint16(extra[2:], zipAESExtraLen-4)
+	binary.LittleEndian.PutUint16(extra[4:], zipAESVersion)
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength
+	binary.LittleEndian.PutUint16(extra[9:], method)
+	return extra
+}
+
+// zipAESEncrypt returns the compressed data of an entry encrypted with a key
+// derived from password and a random salt, framed as the entry data: the
+// salt, the password verifier, the ciphertext and its MAC
+func zipAESEncrypt(data []byte, password string) ([]byte, error) {
+	out := make([]byte, zipAESSaltLen+zipAESVerifier+len(data)+zipAESMACLen)
+	salt := out[:zipAESSaltLen]
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keys := pbkdf2.Key([]byte(password), salt, zipAESRounds, 2*zipAESKeyLen+zipAESVerifier, sha1.New)
+	encKey, macKey, verifier := keys[:zipAESKeyLen], keys[zipAESKeyLen:2*zipAESKeyLen], keys[2*zipAESKeyLen:]
+	copy(out[zipAESSaltLen:], verifier)
+
+	ciphertext := out[zipAESSaltLen+zipAESVerifier : len(out)-zipAESMACLen]
+	if err := zipAESCTR(ciphertext, data, encKey); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(ciphertext)
+	copy(out[len(out)-zipAESMACLen:], mac.Sum(nil))
+
+	return out, nil
+}
+
+// zipAESCTR encrypts src into dst with AES in counter mode as WinZip does:
+// the counter is a little-endian integer starting at 1, unlike the
+// big-endian counter of cipher.NewCTR
+func zipAESCTR(dst, src, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(src); i += aes.BlockSize {
+		for j := range counter {
+			counter[j]++
+			if counter[j] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < min(i+aes.BlockSize, len(src)); j++ {
+			dst[j] = src[j] ^ stream[j-i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// readZipAES decrypts the raw data of an AE-2 entry the way WinZip
+// documents it, independently of zipAESEncrypt, checking the password
+// verifier and the MAC on the way
+func readZipAES(t *testing.T, f *zip.File, password string) []byte {
+	t.Helper()
+
+	require.EqualValues(t, zipMethodAES, f.Method)
+	// AE-2 leaves the CRC out, as the MAC protects the data
+	assert.Zero(t, f.CRC32)
+
+	// Extra field: id, size, vendor version, vendor id, strength, method
+	extra := findExtra(t, f.Extra, zipExtraAES)
+	require.Len(t, extra, 7)
+	assert.EqualValues(t, 2, binary.LittleEndian.Uint16(extra[0:]), "AE-2")
+	assert.Equal(t, "AE", string(extra[2:4]))
+	assert.EqualValues(t, 3, extra[4], "AES-256")
+	method := binary.LittleEndian.Uint16(extra[5:])
+
+	rc, err := f.OpenRaw()
+	require.NoError(t, err)
+	raw, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.EqualValues(t, len(raw), f.CompressedSize64)
+	require.GreaterOrEqual(t, len(raw), 16+2+10)
+
+	// Salt, password verifier, ciphertext, then the first 10 bytes of the
+	// HMAC-SHA1 of the ciphertext
+	salt, verifier := raw[:16], raw[16:18]
+	ciphertext, mac := raw[18:len(raw)-10], raw[len(raw)-10:]
+
+	keys := pbkdf2.Key([]byte(password), salt, 1000, 66, sha1.New)
+	encKey, macKey := keys[:32], keys[32:64]
+	require.Equal(t, keys[64:], verifier, "password verifier")
+	expected := hmac.New(sha1.New, macKey)
+	expected.Write(ciphertext)
+	require.Equal(t, expected.Sum(nil)[:10], mac, "authentication code")
+
+	block, err := aes.NewCipher(encKey)
+	require.NoError(t, err)
+	compressed := make([]byte, len(ciphertext))
+	var counter, stream [aes.BlockSize]byte
+	for i := range ciphertext {
+		if i%aes.BlockSize == 0 {
+			binary.LittleEndian.PutUint64(counter[:], uint64(i/aes.BlockSize+1))
+			block.Encrypt(stream[:], counter[:])
+		}
+		compressed[i] = ciphertext[i] ^ stream[i%aes.BlockSize]
+	}
+
+	switch method {
+	case zip.Store:
+		return compressed
+	case zip.Deflate:
+		data, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		require.NoError(t, err)
+		return data
+	default:
+		t.Fatalf("unexpected method %d", method)
+		return nil
+	}
+}
+
+// findExtra returns the data of the extra field id
+func findExtra(t *testing.T, extra []byte, id uint16) []byte {
+	t.Helper()
+
+	for len(extra) >= 4 {
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		require.LessOrEqual(t, 4+size, len(extra))
+		if binary.LittleEndian.Uint16(extra) == id {
+			return extra[4 : 4+size]
+		}
+		extra = extra[4+size:]
+	}
+	t.Fatalf("extra field %#x not found", id)
+	return nil
+}
+
+func TestEncryptedZipArchive(t *testing.T) {
+	const password = "correct horse battery staple"
+
+	// Random data doesn't compress, so its ciphertext spans more than 256
+	// blocks and the counter carries into its second byte
+	random := make([]byte, 300*aes.BlockSize)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+	files := []*entities.FileData{
+		{Name: "short.txt", Content: []byte("hello")},
+		{Name: "report.txt", Content: bytes.Repeat([]byte("quarterly report "), 1000)},
+		{Name: "random.bin", Content: random},
+	}
+	repo := NewArchiveRepository(&config.ArchiveConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	buf, err := repo.CreateEncryptedZipArchive(files, password, nil)
+	require.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, r.File, len(files))
+	for i, f := range r.File {
+		assert.Equal(t, files[i].Name, f.Name)
+		assert.EqualValues(t, len(files[i].Content), f.UncompressedSize64)
+		assert.Equal(t, files[i].Content, readZipAES(t, f, password))
+
+		// Each entry has its own salt
+		if i > 0 {
+			rc, err := r.File[i-1].OpenRaw()
+			require.NoError(t, err)
+			previous, _ := io.ReadAll(rc)
+			rc, err = f.OpenRaw()
+			require.NoError(t, err)
+			current, _ := io.ReadAll(rc)
+			assert.NotEqual(t, previous[:16], current[:16])
+		}
+	}
+}
+
+// zipAESVector is hello.txt, holding "hello doozip\n", stored in an AE-2
+// archive by bsdtar with the password "vector"
+const zipAESVector = "504b03041400090063002c4f515d00000000000000000000000009002b0068656c6c6f2e747874" +
+	"75780b000104000000000400000000019907000200414503000055540d00078546d36a8546d36a8546d36a" +
+	"6d0b48b4d13756a2fd447254fffda7cbdad763896739c1d167ffe7397da9786de5cac97ae45a1d6d4a504b" +
+	"070800000000290000000d000000504b010214031400090063002c4f515d00000000290000000d00000009" +
+	"0023000000000000000000a4810000000068656c6c6f2e74787475780b00010400000000040000000001990" +
+	"7000200414503000055540500018546d36a504b050600000000010001005a0000008b0000000000"
+
+func TestZipAESVector(t *testing.T) {
+	// The reader checking the archives written here decrypts an archive of
+	// another implementation
+	data, err := hex.DecodeString(zipAESVector)
+	require.NoError(t, err)
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Len(t, r.File, 1)
+	assert.Equal(t, "hello doozip\n", string(readZipAES(t, r.File[0], "vector")))
+}
+
+func TestZipAESCTR(t *testing.T) {
+	// AES-256 in counter mode with a little-endian counter starting at 1,
+	// which carries into the second byte after 255 blocks
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	src := make([]byte, 257*aes.BlockSize+5)
+	dst := make([]byte, len(src))
+	require.NoError(t, zipAESCTR(dst, src, key))
+
+	for _, n := range []uint64{1, 2, 256, 257, 258} {
+		var counter, stream [aes.BlockSize]byte
+		binary.LittleEndian.PutUint64(counter[:], n)
+		block.Encrypt(stream[:], counter[:])
+		start := int(n-1) * aes.BlockSize
+		end := min(start+aes.BlockSize, len(dst))
+		assert.Equal(t, stream[:end-start], dst[start:end], "block %d", n)
+	}
+
+	// Decrypting is encrypting again
+	plain := make([]byte, len(dst))
+	require.NoError(t, zipAESCTR(plain, dst, key))
+	assert.Equal(t, src, plain)
+}
+
+func TestZipAESPasswordVerifier(t *testing.T) {
+	data := []byte("secret data")
+	encrypted, err := zipAESEncrypt(data, "right")
+	require.NoError(t, err)
+	assert.Len(t, encrypted, len(data)+zipAESOverhead)
+
+	// A wrong password is refused by the verifier before any decryption
+	salt := encrypted[:zipAESSaltLen]
+	verifier := encrypted[zipAESSaltLen : zipAESSaltLen+zipAESVerifier]
+	right := pbkdf2.Key([]byte("right"), salt, zipAESRounds, 2*zipAESKeyLen+zipAESVerifier, sha1.New)
+	wrong := pbkdf2.Key([]byte("wrong"), salt, zipAESRounds, 2*zipAESKeyLen+zipAESVerifier, sha1.New)
+	assert.Equal(t, right[2*zipAESKeyLen:], verifier)
+	assert.NotEqual(t, wrong[2*zipAESKeyLen:], verifier)
+}
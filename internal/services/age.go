@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrInvalidRecipientKey = errors.New("invalid recipient public key")
+
+// ageSuffix and ageMIMEType name and type archives encrypted to recipients
+const (
+	ageSuffix   = ".age"
+	ageMIMEType = "application/octet-stream"
+)
+
+// parseAgeRecipients parses the public keys an archive is encrypted to:
+// age X25519 recipients ("age1...") or OpenSSH RSA public keys ("ssh-rsa ...")
+func parseAgeRecipients(keys []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		switch {
+		case strings.HasPrefix(key, "age1"):
+			recipient, err := age.ParseX25519Recipient(key)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not an age recipient", ErrInvalidRecipientKey, abbreviate(key))
+			}
+			recipients = append(recipients, recipient)
+		case strings.HasPrefix(key, "ssh-rsa "):
+			recipient, err := parseSSHRSARecipient(key)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, recipient)
+		default:
+			return nil, fmt.Errorf("%w: %q is neither an age nor an ssh-rsa key", ErrInvalidRecipientKey, abbreviate(key))
+		}
+	}
+	return recipients, nil
+}
+
+// parseSSHRSARecipient parses an OpenSSH RSA public key of at least 2048
+// bits, to which the file key is encrypted with RSA-OAEP
+func parseSSHRSARecipient(s string) (age.Recipient, error) {
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecipientKey, err)
+	}
+	crypto, ok := parsed.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported ssh key", ErrInvalidRecipientKey)
+	}
+	if key, ok := crypto.CryptoPublicKey().(*rsa.PublicKey); !ok || key.Size() < 2048/8 {
+		return nil, fmt.Errorf("%w: ssh-rsa keys must be at least 2048 bits", ErrInvalidRecipientKey)
+	}
+
+	recipient, err := agessh.ParseRecipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecipientKey, err)
+	}
+	return recipient, nil
+}
+
+// encryptAge encrypts content to the recipients in the age v1 format
+// (age-encryption.org/v1), so it can be decrypted with age or rage
+func encryptAge(content []byte, recipients []age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// abbreviate shortens a key for error messages
+func abbreviate(s string) string {
+	if len(s) > 24 {
+		return s[:24] + "..."
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEncryptAge(t *testing.T) {
+	x25519, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	sshKey, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	rsaIdentity, err := agessh.NewRSAIdentity(rsaKey)
+	require.NoError(t, err)
+
+	recipients, err := parseAgeRecipients([]string{
+		x25519.Recipient().String(),
+		string(ssh.MarshalAuthorizedKey(sshKey)),
+	})
+	require.NoError(t, err)
+
+	content := bytes.Repeat([]byte("archive content "), 10000)
+	encrypted, err := encryptAge(content, recipients)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, []byte("age-encryption.org/v1\n")))
+
+	// Every recipient decrypts the archive on its own
+	for _, identity := range []age.Identity{x25519, rsaIdentity} {
+		r, err := age.Decrypt(bytes.NewReader(encrypted), identity)
+		require.NoError(t, err)
+		decrypted, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, content, decrypted)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	_, err = age.Decrypt(bytes.NewReader(encrypted), other)
+	assert.Error(t, err)
+}
+
+func TestParseAgeRecipients(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	sshKey, err := ssh.NewPublicKey(&small.PublicKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "Unknown key type", key: "ssh-dss AAAA"},
+		{name: "Invalid age recipient", key: "age1invalid"},
+		{name: "Small RSA key", key: string(ssh.MarshalAuthorizedKey(sshKey))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseAgeRecipients([]string{tt.key})
+			assert.ErrorIs(t, err, ErrInvalidRecipientKey)
+		})
+	}
+}
@@ -1,11 +1,26 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"mime/multipart"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/ab-dauletkhan/doozip/internal/config"
 	"github.com/ab-dauletkhan/doozip/internal/entities"
 	"github.com/ab-dauletkhan/doozip/internal/repositories"
 )
@@ -16,22 +31,98 @@ var (
 	ErrNilFile           = errors.New("file is nil")
 	ErrRepositoryNil     = errors.New("archive repository is nil")
 	ErrInvalidArchiveZip = errors.New("invalid zip archive")
+	ErrNotADocument      = errors.New("file is not an office document")
+	ErrInvalidManifest   = errors.New("invalid archive manifest")
+	ErrContentsNameTaken = errors.New("file name is reserved for the archive contents")
+	ErrNoSearchPatterns  = errors.New("at least one glob, regex or grep is required")
+	ErrInvalidPattern    = errors.New("invalid search pattern")
+	ErrNoMatchingEntries = errors.New("no entries match the patterns")
+
+	ErrEncryptionDisabled = errors.New("archive encryption is disabled")
+
+	ErrRemoteArchivesDisabled = errors.New("remote archives are not enabled")
+	ErrInvalidRemoteURL       = errors.New("invalid remote archive url")
+	ErrRemoteArchiveTooLarge  = errors.New("remote archive exceeds the size limit")
+	ErrRemoteFetchFailed      = errors.New("failed to fetch remote archive")
 )
 
 // ArchiveService defines the interface for archive operations at service level
 type ArchiveService interface {
 	GetArchiveInformation(file multipart.File, filename string) (*entities.ArchiveInfo, error)
+	// GetArchiveDirectory lists an archive of size bytes from its central
+	// directory only, marking the fields this leaves out as skipped
+	GetArchiveDirectory(file io.ReaderAt, size int64, filename string) (*entities.ArchiveInfo, error)
+	GetDocumentInformation(file multipart.File, size int64, filename string) (*entities.DocumentInfo, error)
+	GetRemoteArchiveInformation(ctx context.Context, rawURL string) (*entities.ArchiveInfo, error)
+	// SearchArchive lists the files of an archive of size bytes matching
+	// query, only reading their content when it greps them
+	SearchArchive(file io.ReaderAt, size int64, filename string, query entities.ArchiveQuery) (*entities.ArchiveSearch, error)
+	// SubsetArchive creates an archive of the files of an archive of size
+	// bytes whose path matches the globs and regexes of query, copying their
+	// compressed data as it is
+	SubsetArchive(file io.ReaderAt, size int64, filename string, query entities.ArchiveQuery) (*entities.FileData, error)
+	ResolveManifest(ctx context.Context, manifest *entities.ArchiveManifest, parts map[string]*entities.FileData) ([]*entities.FileData, error)
 	CreateZipArchive(files []*entities.FileData, archiveName string) (*entities.FileData, error)
+	CreateEncryptedZipArchive(files []*entities.FileData, archiveName, password string) (*entities.FileData, error)
+	// EncryptToRecipients encrypts a created archive to the public keys of
+	// its recipients, so only they can decrypt it
+	EncryptToRecipients(archive *entities.FileData, recipients []string) (*entities.FileData, error)
+	ValidateRecipients(recipients []string) error
+	EstimateArchive(files []*entities.FileData, archiveName string, encrypted bool) (*entities.ArchiveEstimate, error)
+	ValidatePassword(password string) error
+	EncryptionEnabled() bool
+	// SigningKey returns the public key verifying the signatures of created
+	// archives and its algorithm, or nil when signing is disabled
+	SigningKey() ([]byte, string, error)
 	ValidateFiles(files []*entities.FileData) error
+	// ScreenFiles splits files into those passing ValidateFiles and the
+	// errors of the others
+	ScreenFiles(files []*entities.FileData) ([]*entities.FileData, []entities.FileError)
+	// IsExcluded reports whether the file named name is left out of the
+	// archive as a hidden file, such as a dotfile or Thumbs.db. excludeHidden
+	// defaults to the configuration when nil.
+	IsExcluded(name string, excludeHidden *bool) bool
 }
 
 type archiveServiceImpl struct {
 	archiveRepo repositories.ArchiveRepository
-	log         *slog.Logger
+	remote      repositories.RemoteArchiveRepository
+	passwords   *PasswordValidator
+	validator   FileValidator
+	processor   EntryProcessor
+	encryption  bool
+	contents    *archiveContents
+	signer      *ArchiveSigner
+	// specialEntries is the policy for the entries of inspected archives
+	// that are not files
+	specialEntries string
+	hidden         config.ArchiveHiddenConfig
+	grep           config.ArchiveGrepConfig
+	log            *slog.Logger
+}
+
+// archiveContents builds the entries added after the files of created
+// archives: a listing of them and a SHA256SUMS file. An empty name disables
+// the entry.
+type archiveContents struct {
+	name      string
+	creator   string
+	template  *template.Template
+	checksums string
 }
 
-// NewArchiveService creates a new instance of ArchiveService
-func NewArchiveService(archiveRepo repositories.ArchiveRepository, log *slog.Logger) (ArchiveService, error) {
+// NewArchiveService creates a new instance of ArchiveService.
+// remote is optional; without it archives cannot be inspected by URL.
+// cfg is optional; without it encryption passwords are not checked against
+// a policy.
+// validator is optional; without it files and entries are only checked
+// against the allowed MIME types.
+// processor is optional; without it files are archived as uploaded.
+// keys is optional; without it the signing key cannot be sealed.
+// Encrypted archives are refused when features disables encryption.
+// The contents template and the signing key, if configured, are read once
+// here.
+func NewArchiveService(archiveRepo repositories.ArchiveRepository, remote repositories.RemoteArchiveRepository, cfg *config.ArchiveConfig, validator FileValidator, processor EntryProcessor, keys repositories.KeyProvider, features config.FeaturesConfig, log *slog.Logger) (ArchiveService, error) {
 	if archiveRepo == nil {
 		return nil, ErrRepositoryNil
 	}
@@ -40,12 +131,173 @@ func NewArchiveService(archiveRepo repositories.ArchiveRepository, log *slog.Log
 		log = slog.Default()
 	}
 
+	var (
+		policy         config.PasswordPolicy
+		contents       *archiveContents
+		signer         *ArchiveSigner
+		specialEntries string
+		hidden         config.ArchiveHiddenConfig
+		grep           config.ArchiveGrepConfig
+	)
+	if cfg != nil {
+		policy = cfg.PasswordPolicy
+		specialEntries = cfg.SpecialEntries
+		hidden = cfg.Hidden
+		grep = cfg.Grep
+
+		var err error
+		if contents, err = newArchiveContents(cfg.Contents, cfg.Checksums); err != nil {
+			return nil, err
+		}
+		if signer, err = NewArchiveSigner(cfg.Signing, keys); err != nil {
+			return nil, err
+		}
+	}
+
 	return &archiveServiceImpl{
-		archiveRepo: archiveRepo,
-		log:         log,
+		archiveRepo:    archiveRepo,
+		remote:         remote,
+		passwords:      NewPasswordValidator(policy),
+		validator:      validator,
+		processor:      processor,
+		encryption:     features.Enabled(config.FeatureEncryption),
+		contents:       contents,
+		signer:         signer,
+		specialEntries: specialEntries,
+		hidden:         hidden,
+		grep:           grep,
+		log:            log,
+	}, nil
+}
+
+// newArchiveContents returns the builder of the entries added after the
+// files, or nil when they are all disabled
+func newArchiveContents(cfg config.ArchiveContentsConfig, checksums config.ArchiveChecksumsConfig) (*archiveContents, error) {
+	if !cfg.Enabled && !checksums.Enabled {
+		return nil, nil
+	}
+
+	contents := &archiveContents{}
+	if checksums.Enabled {
+		contents.checksums = checksums.Name
+	}
+	if !cfg.Enabled {
+		return contents, nil
+	}
+
+	contents.name, contents.creator = cfg.Name, cfg.Creator
+	if cfg.Template != "" {
+		text, err := os.ReadFile(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive contents template: %w", err)
+		}
+		contents.template, err = template.New(path.Base(cfg.Template)).Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse archive contents template: %w", err)
+		}
+	}
+	return contents, nil
+}
+
+// reserved reports whether name is taken by one of the entries added
+func (c *archiveContents) reserved(name string) bool {
+	if c == nil {
+		return false
+	}
+	name = path.Clean(name)
+	return (c.name != "" && name == c.name) || (c.checksums != "" && name == c.checksums)
+}
+
+// entries returns the function building the entries added to the archive
+// named archiveName, or nil when they are all disabled
+func (c *archiveContents) entries(archiveName string) repositories.ContentsFunc {
+	if c == nil {
+		return nil
+	}
+
+	return func(files []*entities.FileData) ([]*entities.FileData, error) {
+		var entries []*entities.FileData
+		if c.name != "" {
+			listing, err := c.listing(archiveName, files)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, listing)
+		}
+		if c.checksums != "" {
+			entries = append(entries, c.sums(slices.Concat(files, entries)))
+		}
+		return entries, nil
+	}
+}
+
+// listing renders the listing of the files as JSON, or with the template
+func (c *archiveContents) listing(archiveName string, files []*entities.FileData) (*entities.FileData, error) {
+	contents := entities.ArchiveContents{
+		Archive:   archiveName,
+		Creator:   c.creator,
+		CreatedAt: time.Now().UTC(),
+		FileCount: len(files),
+		Files:     make([]entities.ArchiveContentsEntry, 0, len(files)),
+	}
+	for _, file := range files {
+		contents.TotalSize += file.Size()
+		contents.Files = append(contents.Files, entities.ArchiveContentsEntry{
+			Path:     file.Name,
+			Size:     file.Size(),
+			SHA256:   file.SHA256,
+			MIMEType: file.MIMEType,
+		})
+	}
+
+	var (
+		buf      bytes.Buffer
+		mimeType = "application/json"
+	)
+	if c.template != nil {
+		if err := c.template.Execute(&buf, contents); err != nil {
+			return nil, err
+		}
+		mimeType = "text/plain"
+	} else {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(contents); err != nil {
+			return nil, err
+		}
+	}
+	if t := mime.TypeByExtension(path.Ext(c.name)); t != "" {
+		mimeType = t
+	}
+
+	return &entities.FileData{
+		Name:     c.name,
+		Content:  buf.Bytes(),
+		MIMEType: mimeType,
 	}, nil
 }
 
+// sums lists the hashes of the entries in the format of sha256sum, so the
+// extracted archive can be checked with sha256sum -c. Entries not written
+// yet, such as the listing, are hashed here.
+func (c *archiveContents) sums(entries []*entities.FileData) *entities.FileData {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		hash := entry.SHA256
+		if hash == "" {
+			sum := sha256.Sum256(entry.Content)
+			hash = hex.EncodeToString(sum[:])
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", hash, path.Clean(entry.Name))
+	}
+
+	return &entities.FileData{
+		Name:     c.checksums,
+		Content:  buf.Bytes(),
+		MIMEType: "text/plain",
+	}
+}
+
 // GetArchiveInformation retrieves information about an archive file
 func (s *archiveServiceImpl) GetArchiveInformation(file multipart.File, filename string) (*entities.ArchiveInfo, error) {
 	const op = "archiveServiceImpl.GetArchiveInformation"
@@ -71,9 +323,344 @@ func (s *archiveServiceImpl) GetArchiveInformation(file multipart.File, filename
 		return nil, fmt.Errorf("%s: failed to get archive info: %w", op, err)
 	}
 
+	if err := s.applySpecialEntries(archiveInfo); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.validateEntries(archiveInfo); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return archiveInfo, nil
+}
+
+// GetArchiveDirectory retrieves information about an archive file from its
+// central directory only, which takes about as long for a huge archive as
+// for a small one
+func (s *archiveServiceImpl) GetArchiveDirectory(file io.ReaderAt, size int64, filename string) (*entities.ArchiveInfo, error) {
+	const op = "archiveServiceImpl.GetArchiveDirectory"
+
+	if file == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNilFile)
+	}
+
+	if filename == "" {
+		filename = "archive.zip"
+	}
+
+	archiveInfo, err := s.archiveRepo.GetArchiveDirectory(file, size, filename)
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidZip) || errors.Is(err, repositories.ErrEmptyFile) {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidArchiveZip)
+		}
+		return nil, fmt.Errorf("%s: failed to get archive info: %w", op, err)
+	}
+	archiveInfo.Skipped = entities.ArchiveFastSkipped
+
+	if err := s.applySpecialEntries(archiveInfo); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.validateEntries(archiveInfo); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return archiveInfo, nil
 }
 
+// GetDocumentInformation retrieves the metadata of an Office Open XML or
+// OpenDocument document of size bytes. ErrNotADocument is returned for other
+// archives.
+func (s *archiveServiceImpl) GetDocumentInformation(file multipart.File, size int64, filename string) (*entities.DocumentInfo, error) {
+	const op = "archiveServiceImpl.GetDocumentInformation"
+
+	if file == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNilFile)
+	}
+
+	documentInfo, err := s.archiveRepo.GetDocumentInfo(file, size, filename)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotADocument):
+			return nil, fmt.Errorf("%s: %w", op, ErrNotADocument)
+		case errors.Is(err, repositories.ErrInvalidZip):
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidArchiveZip)
+		}
+		return nil, fmt.Errorf("%s: failed to get document info: %w", op, err)
+	}
+
+	return documentInfo, nil
+}
+
+// GetRemoteArchiveInformation fetches the archive at rawURL and retrieves
+// information about it. Servers supporting Range requests are only asked
+// for the central directory.
+func (s *archiveServiceImpl) GetRemoteArchiveInformation(ctx context.Context, rawURL string) (*entities.ArchiveInfo, error) {
+	const op = "archiveServiceImpl.GetRemoteArchiveInformation"
+
+	if s.remote == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrRemoteArchivesDisabled)
+	}
+
+	archive, err := s.remote.Open(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, remoteArchiveError(err))
+	}
+
+	// The central directory is only fetched now, so fetch errors can still occur
+	archiveInfo, err := s.archiveRepo.GetArchiveInfoAt(archive, archive.Size, archive.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, remoteArchiveError(err))
+	}
+
+	if err := s.applySpecialEntries(archiveInfo); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.validateEntries(archiveInfo); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return archiveInfo, nil
+}
+
+// SearchArchive lists the files of an archive matching query
+func (s *archiveServiceImpl) SearchArchive(file io.ReaderAt, size int64, filename string, query entities.ArchiveQuery) (*entities.ArchiveSearch, error) {
+	const op = "archiveServiceImpl.SearchArchive"
+
+	if file == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNilFile)
+	}
+
+	match, err := compileQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	opts := repositories.SearchOptions{Match: match, Limit: query.Limit, Special: s.specialEntry}
+	if query.Grep != "" {
+		grep, err := compileGrep(query)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		opts.Grep = &repositories.GrepOptions{Match: grep, Limits: s.grep}
+	}
+
+	if filename == "" {
+		filename = "archive.zip"
+	}
+
+	search, err := s.archiveRepo.SearchArchive(file, size, filename, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrInvalidZip) || errors.Is(err, repositories.ErrEmptyFile):
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidArchiveZip)
+		case errors.Is(err, ErrFileRejected):
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return nil, fmt.Errorf("%s: failed to search archive: %w", op, err)
+	}
+
+	return search, nil
+}
+
+// SubsetArchive creates an archive of the files of an archive matching
+// query, named after it
+func (s *archiveServiceImpl) SubsetArchive(file io.ReaderAt, size int64, filename string, query entities.ArchiveQuery) (*entities.FileData, error) {
+	const op = "archiveServiceImpl.SubsetArchive"
+
+	if file == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNilFile)
+	}
+
+	// Entries are selected by path alone, as their content is never read
+	if len(query.Globs) == 0 && len(query.Regexes) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoSearchPatterns)
+	}
+	match, err := compileQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if filename == "" {
+		filename = "archive.zip"
+	}
+	archiveName := strings.TrimSuffix(path.Base(filename), path.Ext(filename)) + "-subset.zip"
+
+	buf, copied, err := s.archiveRepo.SubsetArchive(file, size, match, s.specialEntry)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrInvalidZip) || errors.Is(err, repositories.ErrEmptyFile):
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidArchiveZip)
+		case errors.Is(err, ErrFileRejected):
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return nil, fmt.Errorf("%s: failed to subset archive: %w", op, err)
+	}
+	if copied == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoMatchingEntries)
+	}
+
+	return s.newArchiveFile(op, archiveName, buf.Bytes())
+}
+
+// compileQuery returns the function matching the paths selected by query,
+// nil when only its grep selects entries
+func compileQuery(query entities.ArchiveQuery) (func(string) bool, error) {
+	if len(query.Globs) == 0 && len(query.Regexes) == 0 {
+		if query.Grep != "" {
+			return nil, nil
+		}
+		return nil, ErrNoSearchPatterns
+	}
+	for _, glob := range query.Globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidPattern, glob, err)
+		}
+	}
+	regexes := make([]*regexp.Regexp, 0, len(query.Regexes))
+	for _, expr := range query.Regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidPattern, expr, err)
+		}
+		regexes = append(regexes, re)
+	}
+
+	return func(name string) bool {
+		for _, glob := range query.Globs {
+			target := name
+			if !strings.Contains(glob, "/") {
+				target = path.Base(name)
+			}
+			if ok, _ := path.Match(glob, target); ok {
+				return true
+			}
+		}
+		for _, re := range regexes {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// compileGrep returns the function matching the lines selected by the grep
+// of query
+func compileGrep(query entities.ArchiveQuery) (func([]byte) bool, error) {
+	if !query.GrepRegex {
+		needle := []byte(query.Grep)
+		return func(line []byte) bool {
+			return bytes.Contains(line, needle)
+		}, nil
+	}
+	re, err := regexp.Compile(query.Grep)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrInvalidPattern, query.Grep, err)
+	}
+	return re.Match, nil
+}
+
+// remoteArchiveError translates an error of fetching or reading a remote
+// archive into the matching service error
+func remoteArchiveError(err error) error {
+	switch {
+	case errors.Is(err, repositories.ErrInvalidRemoteURL), errors.Is(err, repositories.ErrAddressNotAllowed):
+		return fmt.Errorf("%w: %w", ErrInvalidRemoteURL, err)
+	case errors.Is(err, repositories.ErrRemoteArchiveTooLarge):
+		return ErrRemoteArchiveTooLarge
+	case errors.Is(err, repositories.ErrRemoteFetchFailed):
+		return fmt.Errorf("%w: %w", ErrRemoteFetchFailed, err)
+	case errors.Is(err, repositories.ErrInvalidZip), errors.Is(err, repositories.ErrEmptyFile):
+		return ErrInvalidArchiveZip
+	}
+	return fmt.Errorf("failed to get archive info: %w", err)
+}
+
+// ResolveManifest returns the files laid out by manifest, in its order,
+// named after their path in the archive. parts are the uploaded files by
+// part name, each of which can be used once as they are streamed. Remote
+// entries are fetched like remote archives, so they need remote archives to
+// be enabled and are held to the same size limit and address checks.
+func (s *archiveServiceImpl) ResolveManifest(ctx context.Context, manifest *entities.ArchiveManifest, parts map[string]*entities.FileData) ([]*entities.FileData, error) {
+	const op = "archiveServiceImpl.ResolveManifest"
+
+	if len(manifest.Entries) == 0 {
+		return nil, fmt.Errorf("%s: %w: no entries", op, ErrInvalidManifest)
+	}
+
+	files := make([]*entities.FileData, 0, len(manifest.Entries))
+	paths := make(map[string]bool, len(manifest.Entries))
+	used := make(map[string]bool)
+	for i, entry := range manifest.Entries {
+		name := path.Clean(entry.Path)
+		if entry.Path == "" || strings.HasSuffix(entry.Path, "/") || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("%s: %w: entry %d has invalid path %q", op, ErrInvalidManifest, i, entry.Path)
+		}
+		if paths[name] {
+			return nil, fmt.Errorf("%s: %w: %s is listed twice", op, ErrInvalidManifest, name)
+		}
+		paths[name] = true
+
+		file, err := s.resolveEntry(ctx, entry, parts, used)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, name, err)
+		}
+		file.Name = name
+		if mimeType := mime.TypeByExtension(path.Ext(name)); mimeType != "" {
+			file.MIMEType = mimeType
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// resolveEntry returns the content of a manifest entry, marking the parts
+// it uses in used
+func (s *archiveServiceImpl) resolveEntry(ctx context.Context, entry entities.ManifestEntry, parts map[string]*entities.FileData, used map[string]bool) (*entities.FileData, error) {
+	sources := 0
+	for _, source := range []string{entry.Part, entry.Content, entry.URL} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("%w: exactly one of part, content and url must be set", ErrInvalidManifest)
+	}
+
+	switch {
+	case entry.Part != "":
+		part, ok := parts[entry.Part]
+		if !ok {
+			return nil, fmt.Errorf("%w: part %q was not uploaded", ErrInvalidManifest, entry.Part)
+		}
+		if used[entry.Part] {
+			return nil, fmt.Errorf("%w: part %q is used twice", ErrInvalidManifest, entry.Part)
+		}
+		used[entry.Part] = true
+		return part, nil
+	case entry.Content != "":
+		return &entities.FileData{
+			Content:  []byte(entry.Content),
+			MIMEType: "text/plain; charset=utf-8",
+		}, nil
+	}
+
+	if s.remote == nil {
+		return nil, ErrRemoteArchivesDisabled
+	}
+	remote, err := s.remote.Open(ctx, entry.URL)
+	if err != nil {
+		return nil, remoteArchiveError(err)
+	}
+	content, err := io.ReadAll(io.NewSectionReader(remote, 0, remote.Size))
+	if err != nil {
+		return nil, remoteArchiveError(err)
+	}
+	return &entities.FileData{
+		Content:  content,
+		MIMEType: mime.TypeByExtension(path.Ext(remote.Name)),
+	}, nil
+}
+
 // CreateZipArchive creates a new zip archive from the provided files
 func (s *archiveServiceImpl) CreateZipArchive(files []*entities.FileData, archiveName string) (*entities.FileData, error) {
 	const op = "archiveServiceImpl.CreateZipArchive"
@@ -82,11 +669,15 @@ func (s *archiveServiceImpl) CreateZipArchive(files []*entities.FileData, archiv
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := s.processEntries(files); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	if archiveName == "" {
 		archiveName = "archive.zip"
 	}
 
-	buf, err := s.archiveRepo.CreateZipArchive(files)
+	buf, err := s.archiveRepo.CreateZipArchive(files, s.contents.entries(archiveName))
 	if err != nil {
 		s.log.Error("failed to create zip archive",
 			"op", op,
@@ -96,9 +687,138 @@ func (s *archiveServiceImpl) CreateZipArchive(files []*entities.FileData, archiv
 		return nil, fmt.Errorf("%s: failed to create zip archive: %w", op, err)
 	}
 
+	return s.newArchiveFile(op, archiveName, buf.Bytes())
+}
+
+// CreateEncryptedZipArchive creates a new password protected zip archive from
+// the provided files. The password must satisfy the configured policy; a
+// *PasswordPolicyError lists every violated rule otherwise.
+func (s *archiveServiceImpl) CreateEncryptedZipArchive(files []*entities.FileData, archiveName, password string) (*entities.FileData, error) {
+	const op = "archiveServiceImpl.CreateEncryptedZipArchive"
+
+	if !s.encryption {
+		return nil, fmt.Errorf("%s: %w", op, ErrEncryptionDisabled)
+	}
+
+	if err := s.ValidatePassword(password); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.ValidateFiles(files); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.processEntries(files); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if archiveName == "" {
+		archiveName = "archive.zip"
+	}
+
+	buf, err := s.archiveRepo.CreateEncryptedZipArchive(files, password, s.contents.entries(archiveName))
+	if err != nil {
+		s.log.Error("failed to create zip archive",
+			"op", op,
+			"error", err,
+			"filesCount", len(files),
+		)
+		return nil, fmt.Errorf("%s: failed to create zip archive: %w", op, err)
+	}
+
+	return s.newArchiveFile(op, archiveName, buf.Bytes())
+}
+
+// EncryptToRecipients encrypts the archive with age to every recipient, an
+// age X25519 recipient or an ssh-rsa public key. The result is named after
+// the archive with an .age suffix and is signed in place of the archive.
+func (s *archiveServiceImpl) EncryptToRecipients(archive *entities.FileData, recipients []string) (*entities.FileData, error) {
+	const op = "archiveServiceImpl.EncryptToRecipients"
+
+	if !s.encryption {
+		return nil, fmt.Errorf("%s: %w", op, ErrEncryptionDisabled)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%s: %w: no recipients", op, ErrInvalidRecipientKey)
+	}
+
+	parsed, err := parseAgeRecipients(recipients)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	content, err := encryptAge(archive.Content, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to encrypt archive: %w", op, err)
+	}
+
+	encrypted, err := s.newArchiveFile(op, archive.Name+ageSuffix, content)
+	if err != nil {
+		return nil, err
+	}
+	encrypted.MIMEType = ageMIMEType
+	return encrypted, nil
+}
+
+// ValidateRecipients checks the public keys an archive would be encrypted to
+func (s *archiveServiceImpl) ValidateRecipients(recipients []string) error {
+	if !s.encryption {
+		return ErrEncryptionDisabled
+	}
+	_, err := parseAgeRecipients(recipients)
+	return err
+}
+
+// EstimateArchive validates the files and predicts the entries and size of
+// the archive that would be created from them, without building it. Entry
+// processors are not run, so sizes are those of the files as uploaded.
+func (s *archiveServiceImpl) EstimateArchive(files []*entities.FileData, archiveName string, encrypted bool) (*entities.ArchiveEstimate, error) {
+	const op = "archiveServiceImpl.EstimateArchive"
+
+	if encrypted && !s.encryption {
+		return nil, fmt.Errorf("%s: %w", op, ErrEncryptionDisabled)
+	}
+
+	if err := s.ValidateFiles(files); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if archiveName == "" {
+		archiveName = "archive.zip"
+	}
+
+	estimate, err := s.archiveRepo.EstimateZipArchive(files, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to estimate zip archive: %w", op, err)
+	}
+	estimate.Filename = archiveName
+
+	return estimate, nil
+}
+
+// ValidatePassword checks an archive encryption password against the policy
+func (s *archiveServiceImpl) ValidatePassword(password string) error {
+	return s.passwords.Validate(password)
+}
+
+// EncryptionEnabled reports whether password protected archives can be created
+func (s *archiveServiceImpl) EncryptionEnabled() bool {
+	return s.encryption
+}
+
+// SigningKey returns the public key verifying the signatures of created archives
+func (s *archiveServiceImpl) SigningKey() ([]byte, string, error) {
+	key, err := s.signer.PublicKey()
+	return key, s.signer.Algorithm(), err
+}
+
+// newArchiveFile wraps the archive content into a validated FileData,
+// signed when signing is enabled
+func (s *archiveServiceImpl) newArchiveFile(op, archiveName string, content []byte) (*entities.FileData, error) {
 	archiveFile := &entities.FileData{
 		Name:     archiveName,
-		Content:  buf.Bytes(),
+		Content:  content,
 		MIMEType: "application/zip",
 	}
 
@@ -106,9 +826,111 @@ func (s *archiveServiceImpl) CreateZipArchive(files []*entities.FileData, archiv
 		return nil, fmt.Errorf("%s: invalid archive file: %w", op, err)
 	}
 
+	signature, err := s.signer.Sign(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	archiveFile.Signature = signature
+	archiveFile.SignatureAlgorithm = s.signer.Algorithm()
+
 	return archiveFile, nil
 }
 
+// processEntries runs the processor, if any, on every file to be archived
+func (s *archiveServiceImpl) processEntries(files []*entities.FileData) error {
+	if s.processor == nil {
+		return nil
+	}
+	for _, file := range files {
+		if err := s.processor.ProcessEntry(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFile runs the validator, if any, on file
+func (s *archiveServiceImpl) validateFile(file *entities.FileData, kind entities.UploadKind) error {
+	if s.validator == nil {
+		return nil
+	}
+	return s.validator.ValidateFile(file, kind)
+}
+
+// applySpecialEntries applies the policy for special entries, such as
+// symlinks, to an inspected archive: they are left out with
+// SpecialEntriesSkip, and the archive is rejected with SpecialEntriesReject
+func (s *archiveServiceImpl) applySpecialEntries(archiveInfo *entities.ArchiveInfo) error {
+	switch s.specialEntries {
+	case config.SpecialEntriesSkip:
+		archiveInfo.Files = slices.DeleteFunc(archiveInfo.Files, func(entry entities.FileDetails) bool {
+			return entry.EntryType != entities.EntryTypeFile
+		})
+		archiveInfo.CalculateTotals()
+	case config.SpecialEntriesReject:
+		for _, entry := range archiveInfo.Files {
+			if entry.EntryType != entities.EntryTypeFile {
+				_, err := s.specialEntry(entry.FilePath, entry.EntryType)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// specialEntry applies the policy for special entries to an entry of a
+// searched or subset archive, whose entries are never all listed first
+func (s *archiveServiceImpl) specialEntry(path, entryType string) (bool, error) {
+	switch s.specialEntries {
+	case config.SpecialEntriesSkip:
+		return true, nil
+	case config.SpecialEntriesReject:
+		return false, fmt.Errorf("%w: %s is a %s", ErrFileRejected, path, entryType)
+	}
+	return false, nil
+}
+
+// validateEntries runs the validator on every entry of an inspected archive.
+// Entries are described by their metadata only; their content is not read.
+func (s *archiveServiceImpl) validateEntries(archiveInfo *entities.ArchiveInfo) error {
+	for _, entry := range archiveInfo.Files {
+		file := &entities.FileData{
+			Name:     entry.FilePath,
+			Length:   entry.Size,
+			MIMEType: entry.MimeType,
+		}
+		if err := s.validateFile(file, entities.UploadKindInformation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsExcluded reports whether a file is left out as a hidden file
+func (s *archiveServiceImpl) IsExcluded(name string, excludeHidden *bool) bool {
+	if excludeHidden == nil {
+		excludeHidden = &s.hidden.Exclude
+	}
+	return *excludeHidden && s.isHidden(name)
+}
+
+// isHidden reports whether a part of a path starts with a dot or is one of
+// the configured hidden names
+func (s *archiveServiceImpl) isHidden(name string) bool {
+	name = path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if entities.IsDotfile(name) {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		for _, hidden := range s.hidden.Names {
+			if strings.EqualFold(part, hidden) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ValidateFiles validates a list of files for processing
 func (s *archiveServiceImpl) ValidateFiles(files []*entities.FileData) error {
 	const op = "archiveServiceImpl.ValidateFiles"
@@ -122,19 +944,89 @@ func (s *archiveServiceImpl) ValidateFiles(files []*entities.FileData) error {
 			return fmt.Errorf("%s: file cannot be nil", op)
 		}
 
-		if err := file.Validate(); err != nil {
-			return fmt.Errorf("%s: invalid file %s: %w", op, file.Name, err)
+		if err := s.validateEntry(file); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
 		}
+	}
+
+	return nil
+}
 
-		if !file.IsAllowedMimeType() {
-			s.log.Warn("invalid mime type detected",
-				"op", op,
-				"filename", file.Name,
-				"mimeType", file.MIMEType,
-			)
-			return fmt.Errorf("%s: %w: %s", op, ErrInvalidMimeType, file.MIMEType)
+// ScreenFiles returns the files passing the checks of ValidateFiles,
+// reporting the others instead of failing on the first of them
+func (s *archiveServiceImpl) ScreenFiles(files []*entities.FileData) ([]*entities.FileData, []entities.FileError) {
+	accepted := make([]*entities.FileData, 0, len(files))
+	var skipped []entities.FileError
+	for _, file := range files {
+		if err := s.validateEntry(file); err != nil {
+			skipped = append(skipped, NewFileError(file.Name, err))
+			continue
 		}
+		accepted = append(accepted, file)
+	}
+	return accepted, skipped
+}
+
+// validateEntry checks a file to be archived
+func (s *archiveServiceImpl) validateEntry(file *entities.FileData) error {
+	if err := s.validateFile(file, entities.UploadKindArchive); err != nil {
+		return err
+	}
+
+	if s.contents.reserved(file.Name) {
+		return fmt.Errorf("%w: %s", ErrContentsNameTaken, file.Name)
+	}
+
+	if err := file.Validate(); err != nil {
+		return fmt.Errorf("invalid file %s: %w", file.Name, err)
+	}
+
+	if !file.IsAllowedMimeType() {
+		s.log.Warn("invalid mime type detected",
+			"filename", file.Name,
+			"mimeType", file.MIMEType,
+		)
+		return fmt.Errorf("%w: %s", ErrInvalidMimeType, file.MIMEType)
 	}
 
 	return nil
 }
+
+// NewFileError reports the file named name as left out of an operation for
+// err, with the code matching err
+func NewFileError(name string, err error) entities.FileError {
+	code := entities.FileErrorInvalid
+	switch {
+	case errors.Is(err, ErrFileBlocked):
+		code = entities.FileErrorBlocked
+	case errors.Is(err, ErrFileRejected):
+		code = entities.FileErrorRejected
+	case errors.Is(err, ErrInvalidMimeType), errors.Is(err, ErrFileTypeNotAllowed):
+		code = entities.FileErrorTypeNotAllowed
+	case errors.Is(err, ErrContentsNameTaken):
+		code = entities.FileErrorNameReserved
+	}
+	return entities.FileError{File: name, Code: code, Error: err.Error()}
+}
+
+// FlattenNames strips the directories from the names of files, so they are
+// all archived at the root. Names colliding with an earlier one, ignoring
+// case as the filesystems of many recipients do, are numbered like
+// "report-1.pdf".
+func FlattenNames(files []*entities.FileData) {
+	taken := make(map[string]bool, len(files))
+	for _, file := range files {
+		name := path.Base(path.Clean(strings.ReplaceAll(file.Name, `\`, "/")))
+		ext := path.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		if stem == "" {
+			// A dotfile like ".env" is all stem
+			stem, ext = name, ""
+		}
+		for i := 1; taken[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+		}
+		taken[strings.ToLower(name)] = true
+		file.Name = name
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+func TestFlattenNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		expected []string
+	}{
+		{
+			name:     "Root names kept",
+			files:    []string{"report.pdf", "notes.txt"},
+			expected: []string{"report.pdf", "notes.txt"},
+		},
+		{
+			name:     "Directories stripped",
+			files:    []string{"2024/q1/report.pdf", "./notes.txt", "a/../b/c.txt"},
+			expected: []string{"report.pdf", "notes.txt", "c.txt"},
+		},
+		{
+			name:     "Backslash paths",
+			files:    []string{`C:\Users\bob\report.pdf`, `docs\notes.txt`, `mixed/dir\photo.jpg`},
+			expected: []string{"report.pdf", "notes.txt", "photo.jpg"},
+		},
+		{
+			name:     "Collisions numbered",
+			files:    []string{"a/report.pdf", "b/report.pdf", "c/report.pdf"},
+			expected: []string{"report.pdf", "report-1.pdf", "report-2.pdf"},
+		},
+		{
+			name:     "Collision across separators",
+			files:    []string{"a/report.pdf", `b\report.pdf`},
+			expected: []string{"report.pdf", "report-1.pdf"},
+		},
+		{
+			name:     "Case-insensitive clashes",
+			files:    []string{"a/Report.PDF", "b/report.pdf", "c/REPORT.pdf"},
+			expected: []string{"Report.PDF", "report-1.pdf", "REPORT-2.pdf"},
+		},
+		{
+			name:     "Clash with a numbered name",
+			files:    []string{"a/report.pdf", "b/report.pdf", "report-1.pdf"},
+			expected: []string{"report.pdf", "report-1.pdf", "report-1-1.pdf"},
+		},
+		{
+			name:     "Numbered name taken first",
+			files:    []string{"report-1.pdf", "a/report.pdf", "b/report.pdf"},
+			expected: []string{"report-1.pdf", "report.pdf", "report-2.pdf"},
+		},
+		{
+			name:     "No extension",
+			files:    []string{"a/Makefile", "b/makefile"},
+			expected: []string{"Makefile", "makefile-1"},
+		},
+		{
+			name:     "Last extension numbered",
+			files:    []string{"a/backup.tar.gz", "b/backup.tar.gz"},
+			expected: []string{"backup.tar.gz", "backup.tar-1.gz"},
+		},
+		{
+			name:     "Dotfiles",
+			files:    []string{"a/.env", "b/.env"},
+			expected: []string{".env", ".env-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make([]*entities.FileData, len(tt.files))
+			for i, name := range tt.files {
+				files[i] = &entities.FileData{Name: name}
+			}
+
+			FlattenNames(files)
+
+			names := make([]string, len(files))
+			for i, file := range files {
+				names[i] = file.Name
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrAuditRepositoryNil = errors.New("audit repository is nil")
+	ErrInvalidAuditFilter = errors.New("invalid audit filter")
+)
+
+const (
+	defaultAuditListLimit = 50
+	maxAuditListLimit     = 500
+)
+
+// sha256HexRegex matches a hex encoded SHA-256 hash
+var sha256HexRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// AuditService keeps an audit trail of every mail sent, with the SHA-256
+// hashes of its attachments, so it can be found who a document was ever
+// sent to. A nil *AuditService records nothing.
+type AuditService struct {
+	repo     repositories.AuditRepository
+	exporter *AuditExporter
+	log      *slog.Logger
+}
+
+// NewAuditService creates a new AuditService. exporter is optional; without
+// it entries are only kept in repo. log is optional; without it
+// slog.Default() is used.
+func NewAuditService(repo repositories.AuditRepository, exporter *AuditExporter, log *slog.Logger) (*AuditService, error) {
+	if repo == nil {
+		return nil, ErrAuditRepositoryNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &AuditService{repo: repo, exporter: exporter, log: log}, nil
+}
+
+// fingerprint hashes the attachments of a message. Streamed files are
+// loaded into memory first, so they can still be sent after being read.
+func (s *AuditService) fingerprint(attachments []*entities.Attachment) ([]entities.AuditAttachment, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	fingerprints := make([]entities.AuditAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		if err := attachment.File.Load(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		sum := sha256.Sum256(attachment.File.Content)
+		fingerprints = append(fingerprints, entities.AuditAttachment{
+			Name:   attachment.File.Name,
+			Size:   int64(len(attachment.File.Content)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	return fingerprints, nil
+}
+
+// recordMail adds the delivery of a message to the recipients it reached
+// to the audit trail. Failing to record it is logged but never fails the
+// delivery itself.
+func (s *AuditService) recordMail(msg *entities.MailMessage, attachments []entities.AuditAttachment, report *entities.DeliveryReport, messageID string) {
+	const op = "AuditService.recordMail"
+
+	if s == nil || report.Sent == 0 {
+		return
+	}
+
+	recipients := make([]string, 0, report.Sent)
+	for _, result := range report.Recipients {
+		if result.Success {
+			recipients = append(recipients, result.Recipient)
+		}
+	}
+
+	entry := &entities.AuditEntry{
+		ID:          utils.NewID(),
+		MessageID:   messageID,
+		Recipients:  recipients,
+		Subject:     msg.Subject,
+		Attachments: attachments,
+		TenantID:    msg.TenantID,
+		SentAt:      time.Now(),
+	}
+	if err := s.repo.Add(entry); err != nil {
+		s.log.Error("failed to record mail audit",
+			"op", op,
+			"message_id", messageID,
+			"error", err,
+		)
+	}
+	s.exporter.export(entry)
+}
+
+// List returns a page of audit entries matching the filter, newest first
+func (s *AuditService) List(filter entities.AuditFilter) (*entities.AuditPage, error) {
+	const op = "AuditService.List"
+
+	filter.SHA256 = strings.ToLower(filter.SHA256)
+	if filter.SHA256 != "" && !sha256HexRegex.MatchString(filter.SHA256) {
+		return nil, fmt.Errorf("%s: %w: sha256 must be 64 hex digits", op, ErrInvalidAuditFilter)
+	}
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, fmt.Errorf("%s: %w: limit and offset cannot be negative", op, ErrInvalidAuditFilter)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditListLimit
+	}
+	filter.Limit = min(filter.Limit, maxAuditListLimit)
+
+	entries, total, err := s.repo.List(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &entities.AuditPage{
+		Entries: entries,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	}, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+var ErrAuditSinkNil = errors.New("audit sink is nil")
+
+const (
+	defaultAuditBatchSize     = 100
+	defaultAuditFlushInterval = 5 * time.Second
+	defaultAuditQueueSize     = 10000
+	defaultAuditExportTimeout = 30 * time.Second
+
+	// auditRetryBackoff is the delay before the first retry of a failed
+	// batch, doubled for each one up to maxAuditRetryBackoff
+	auditRetryBackoff    = time.Second
+	maxAuditRetryBackoff = time.Minute
+
+	// auditDrainTimeout bounds the export of the entries still queued at
+	// shutdown
+	auditDrainTimeout = 5 * time.Second
+)
+
+// AuditExporter streams audit entries to a sink as they are recorded. Entries
+// are queued and sent in batches, once a batch is full or its oldest entry
+// has waited for the flush interval. Failed batches are sent again with
+// backoff while new entries keep queueing; entries recorded while the queue
+// is full, and batches failing every retry, are dropped and logged. A nil
+// AuditExporter exports nothing.
+type AuditExporter struct {
+	sink          repositories.AuditSink
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	timeout       time.Duration
+	queue         chan *entities.AuditEntry
+	log           *slog.Logger
+}
+
+// NewAuditExporter creates an AuditExporter sending to sink as cfg sets
+func NewAuditExporter(sink repositories.AuditSink, cfg *config.AuditExportConfig, log *slog.Logger) (*AuditExporter, error) {
+	if sink == nil {
+		return nil, ErrAuditSinkNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	e := &AuditExporter{
+		sink:          sink,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		retries:       cfg.Retries,
+		timeout:       cfg.Timeout,
+		log:           log,
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = defaultAuditBatchSize
+	}
+	if e.flushInterval <= 0 {
+		e.flushInterval = defaultAuditFlushInterval
+	}
+	if e.timeout <= 0 {
+		e.timeout = defaultAuditExportTimeout
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultAuditQueueSize
+	}
+	e.queue = make(chan *entities.AuditEntry, queueSize)
+
+	return e, nil
+}
+
+// export queues an entry for export
+func (e *AuditExporter) export(entry *entities.AuditEntry) {
+	if e == nil {
+		return
+	}
+
+	select {
+	case e.queue <- entry:
+	default:
+		e.log.Error("audit export queue is full, entry dropped", "op", "AuditExporter.export", "id", entry.ID)
+	}
+}
+
+// Run sends queued entries until the context is cancelled, then makes a
+// last attempt at sending the entries still queued
+func (e *AuditExporter) Run(ctx context.Context) {
+	if e == nil {
+		return
+	}
+
+	timer := time.NewTimer(e.flushInterval)
+	timer.Stop()
+	defer timer.Stop()
+
+	batch := make([]*entities.AuditEntry, 0, e.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			e.drain(batch)
+			return
+		case entry := <-e.queue:
+			if len(batch) == 0 {
+				timer.Reset(e.flushInterval)
+			}
+			batch = append(batch, entry)
+			if len(batch) < e.batchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		e.send(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// drain sends batch and the entries still queued once, without retries
+func (e *AuditExporter) drain(batch []*entities.AuditEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditDrainTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case entry := <-e.queue:
+			batch = append(batch, entry)
+			if len(batch) < e.batchSize {
+				continue
+			}
+		default:
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.attempt(ctx, batch); err != nil {
+			e.log.Error("failed to export audit entries at shutdown", "op", "AuditExporter.drain", "count", len(batch), "error", err)
+			return
+		}
+		batch = batch[:0]
+	}
+}
+
+// send exports a batch, retrying with backoff until it succeeds, the retries
+// are used up or the context is cancelled
+func (e *AuditExporter) send(ctx context.Context, batch []*entities.AuditEntry) {
+	const op = "AuditExporter.send"
+
+	backoff := auditRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := e.attempt(ctx, batch)
+		if err == nil {
+			return
+		}
+		if attempt >= e.retries || ctx.Err() != nil {
+			e.log.Error("failed to export audit entries, dropped",
+				"op", op,
+				"count", len(batch),
+				"attempts", attempt+1,
+				"error", err,
+			)
+			return
+		}
+
+		e.log.Warn("failed to export audit entries, retrying", "op", op, "count", len(batch), "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxAuditRetryBackoff)
+	}
+}
+
+// attempt exports a batch once
+func (e *AuditExporter) attempt(ctx context.Context, batch []*entities.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	return e.sink.Export(ctx, batch)
+}
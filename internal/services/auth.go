@@ -0,0 +1,330 @@
+package services
+
+import (
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient role")
+	ErrStaleRequest    = errors.New("request timestamp is outside the allowed window")
+	ErrReplayedRequest = errors.New("request signature was already used")
+)
+
+// defaultHMACMaxSkew is the allowed clock difference for signed requests
+// when none is configured
+const defaultHMACMaxSkew = 5 * time.Minute
+
+// principalContextKey is the context key of the request's principal
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *entities.Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal carried by ctx, or nil
+func PrincipalFromContext(ctx context.Context) *entities.Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*entities.Principal)
+	return principal
+}
+
+// AuthService authenticates clients by API key or OIDC bearer token and
+// checks their roles. A nil *AuthService authenticates nothing and is not
+// used when auth is disabled.
+type AuthService struct {
+	// keys maps the SHA-256 of each API key to its role, so the keys are
+	// never compared directly
+	keys map[[sha256.Size]byte]entities.Role
+
+	// verifier is nil unless an OIDC issuer is configured
+	verifier  *oidc.IDTokenVerifier
+	roleClaim string
+	// claimRoles maps lower case role claim values to roles
+	claimRoles map[string]entities.Role
+
+	hmacClients map[string]hmacClient
+	maxSkew     time.Duration
+	// mu guards seen and expiries, the signatures used within the allowed
+	// window. Signatures cover the timestamp, so each serves as the nonce
+	// of its request.
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	expiries signatureExpiries
+
+	log *slog.Logger
+	now func() time.Time
+}
+
+// hmacClient is a client signing its requests with a shared secret
+type hmacClient struct {
+	// secrets are the current secret and, during a rotation, the previous one
+	secrets [][]byte
+	role    entities.Role
+}
+
+// usedSignature is a signature kept until it can no longer be replayed
+type usedSignature struct {
+	key     string
+	expires time.Time
+}
+
+// signatureExpiries is a min-heap of used signatures by expiry, so expired
+// ones are dropped without scanning the others
+type signatureExpiries []usedSignature
+
+func (h signatureExpiries) Len() int           { return len(h) }
+func (h signatureExpiries) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h signatureExpiries) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *signatureExpiries) Push(x any)        { *h = append(*h, x.(usedSignature)) }
+func (h *signatureExpiries) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// NewAuthService creates a new AuthService. It returns nil when auth is
+// disabled. With an OIDC issuer, its discovery document is fetched using ctx.
+func NewAuthService(ctx context.Context, cfg *config.AuthConfig, log *slog.Logger) (*AuthService, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	s := &AuthService{
+		keys:        make(map[[sha256.Size]byte]entities.Role, len(cfg.APIKeys)),
+		hmacClients: make(map[string]hmacClient, len(cfg.HMAC.Clients)),
+		maxSkew:     cfg.HMAC.MaxSkew,
+		seen:        make(map[string]time.Time),
+		log:         log,
+		now:         time.Now,
+	}
+	if s.maxSkew <= 0 {
+		s.maxSkew = defaultHMACMaxSkew
+	}
+
+	for i, key := range cfg.APIKeys {
+		role := entities.Role(key.Role)
+		if key.Key == "" || !role.Valid() {
+			return nil, fmt.Errorf("invalid api key %d", i)
+		}
+		s.keys[sha256.Sum256([]byte(key.Key))] = role
+	}
+
+	for _, client := range cfg.HMAC.Clients {
+		role := entities.Role(client.Role)
+		if client.ID == "" || client.Secret == "" || !role.Valid() {
+			return nil, fmt.Errorf("invalid hmac client %q", client.ID)
+		}
+		secrets := [][]byte{[]byte(client.Secret)}
+		if client.PreviousSecret != "" {
+			secrets = append(secrets, []byte(client.PreviousSecret))
+		}
+		s.hmacClients[client.ID] = hmacClient{secrets: secrets, role: role}
+	}
+
+	if cfg.OIDC.Issuer != "" {
+		provider, err := oidc.NewProvider(ctx, cfg.OIDC.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+		}
+
+		s.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.OIDC.Audience})
+		s.roleClaim = cfg.OIDC.RoleClaim
+		s.claimRoles = make(map[string]entities.Role, len(cfg.OIDC.Roles))
+		for value, role := range cfg.OIDC.Roles {
+			if !entities.Role(role).Valid() {
+				return nil, fmt.Errorf("invalid role for oidc claim %s: %s", value, role)
+			}
+			s.claimRoles[strings.ToLower(value)] = entities.Role(role)
+		}
+	}
+
+	return s, nil
+}
+
+// SupportsBearer reports whether bearer tokens can be authenticated
+func (s *AuthService) SupportsBearer() bool {
+	return s != nil && s.verifier != nil
+}
+
+// AuthenticateBearer verifies an OIDC token, checking its issuer, audience,
+// expiry and signature, and returns its subject with the most privileged
+// role mapped from the role claim. A token without a mapped role yields a
+// principal without role, which no route accepts.
+func (s *AuthService) AuthenticateBearer(ctx context.Context, token string) (*entities.Principal, error) {
+	const op = "AuthService.AuthenticateBearer"
+
+	if !s.SupportsBearer() || token == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	idToken, err := s.verifier.Verify(ctx, token)
+	if err != nil {
+		s.log.Warn("invalid bearer token", "op", op, "error", err)
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	principal := &entities.Principal{ID: idToken.Subject}
+	for _, value := range claimValues(claims[s.roleClaim]) {
+		role, ok := s.claimRoles[strings.ToLower(value)]
+		if ok && !principal.Role.Includes(role) {
+			principal.Role = role
+		}
+	}
+
+	return principal, nil
+}
+
+// claimValues returns the strings of a claim holding a string or a list of strings
+func claimValues(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// SupportsSignatures reports whether signed requests can be authenticated
+func (s *AuthService) SupportsSignatures() bool {
+	return s != nil && len(s.hmacClients) > 0
+}
+
+// SignaturePayload returns the string a client signs: the method, the path
+// with its query string, the Unix timestamp in seconds and the hex SHA-256
+// of the body, each on its own line
+func SignaturePayload(method, uri, timestamp string, bodyHash []byte) string {
+	return strings.Join([]string{method, uri, timestamp, hex.EncodeToString(bodyHash)}, "\n")
+}
+
+// AuthenticateSignature verifies the hex HMAC-SHA256 signature of a request
+// by clientID, made with its current or previous secret. Requests are
+// rejected when their timestamp is outside the allowed window or when their
+// signature was already used, so a captured request cannot be replayed.
+func (s *AuthService) AuthenticateSignature(clientID, timestamp, signature, method, uri string, bodyHash []byte) (*entities.Principal, error) {
+	const op = "AuthService.AuthenticateSignature"
+
+	if !s.SupportsSignatures() {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	client, ok := s.hmacClients[clientID]
+	if !ok {
+		s.log.Warn("unknown hmac client", "op", op, "client", clientID)
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil || !client.signed(got, SignaturePayload(method, uri, timestamp, bodyHash)) {
+		s.log.Warn("invalid request signature", "op", op, "client", clientID)
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	// The timestamp is only trusted once the signature covering it is valid
+	now := s.now()
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrUnauthenticated, ErrStaleRequest)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-s.maxSkew)) || signedAt.After(now.Add(s.maxSkew)) {
+		s.log.Warn("stale request signature", "op", op, "client", clientID, "signedAt", signedAt)
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrUnauthenticated, ErrStaleRequest)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.expiries.Len() > 0 && now.After(s.expiries[0].expires) {
+		delete(s.seen, heap.Pop(&s.expiries).(usedSignature).key)
+	}
+	key := clientID + ":" + hex.EncodeToString(got)
+	if _, used := s.seen[key]; used {
+		s.log.Warn("replayed request signature", "op", op, "client", clientID)
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrUnauthenticated, ErrReplayedRequest)
+	}
+	expires := signedAt.Add(s.maxSkew)
+	s.seen[key] = expires
+	heap.Push(&s.expiries, usedSignature{key: key, expires: expires})
+
+	return &entities.Principal{ID: clientID, Role: client.role}, nil
+}
+
+// signed reports whether signature is the HMAC-SHA256 of payload with one
+// of the secrets of the client
+func (c hmacClient) signed(signature []byte, payload string) bool {
+	for _, secret := range c.secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		if hmac.Equal(signature, mac.Sum(nil)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateAPIKey returns the principal of a client sending apiKey
+func (s *AuthService) AuthenticateAPIKey(apiKey string) (*entities.Principal, error) {
+	const op = "AuthService.AuthenticateAPIKey"
+
+	if s == nil || apiKey == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	role, ok := s.keys[sha256.Sum256([]byte(apiKey))]
+	if !ok {
+		s.log.Warn("unknown api key", "op", op, "apiKeyID", utils.KeyID(apiKey))
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	return &entities.Principal{ID: utils.KeyID(apiKey), Role: role}, nil
+}
+
+// Authorize checks that the principal holds the required role
+func (s *AuthService) Authorize(principal *entities.Principal, required entities.Role) error {
+	const op = "AuthService.Authorize"
+
+	if principal == nil {
+		return fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+	if !principal.Role.Includes(required) {
+		return fmt.Errorf("%s: %w: %s required", op, ErrForbidden, required)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+// signRequest returns the signature of a request as a client would make it
+func signRequest(secret, method, uri, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(SignaturePayload(method, uri, timestamp, bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSigningAuthService(t *testing.T, now time.Time) *AuthService {
+	t.Helper()
+
+	s, err := NewAuthService(context.Background(), &config.AuthConfig{
+		Enabled: true,
+		HMAC: config.HMACConfig{
+			MaxSkew: time.Minute,
+			Clients: []config.HMACClientConfig{
+				{ID: "billing", Secret: "new-secret", PreviousSecret: "old-secret", Role: "sender"},
+				{ID: "reports", Secret: "reports-secret", Role: "viewer"},
+			},
+		},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	return s
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	const (
+		method = "POST"
+		uri    = "/api/mail/file?async=true"
+	)
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte("multipart body")
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		client    string
+		secret    string
+		timestamp string
+		// signed is the body the client signed, sent is the one received
+		signed, sent []byte
+		signature    string
+		expectedErr  error
+		role         entities.Role
+	}{
+		{name: "Current secret", client: "billing", secret: "new-secret", role: entities.RoleSender},
+		{name: "Previous secret", client: "billing", secret: "old-secret", role: entities.RoleSender},
+		{name: "Other client", client: "reports", secret: "reports-secret", role: entities.RoleViewer},
+		{name: "Secret of another client", client: "reports", secret: "new-secret", expectedErr: ErrUnauthenticated},
+		{name: "Unknown client", client: "unknown", secret: "new-secret", expectedErr: ErrUnauthenticated},
+		{name: "Unknown secret", client: "billing", secret: "guess", expectedErr: ErrUnauthenticated},
+		{name: "Malformed signature", client: "billing", signature: "not-hex", expectedErr: ErrUnauthenticated},
+		{name: "Empty signature", client: "billing", signature: "", expectedErr: ErrUnauthenticated},
+		{
+			name: "Body hash mismatch", client: "billing", secret: "new-secret",
+			signed: body, sent: []byte("tampered body"),
+			expectedErr: ErrUnauthenticated,
+		},
+		{
+			name: "Stale timestamp", client: "billing", secret: "new-secret",
+			timestamp:   strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10),
+			expectedErr: ErrStaleRequest,
+		},
+		{
+			name: "Future timestamp", client: "billing", secret: "new-secret",
+			timestamp:   strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10),
+			expectedErr: ErrStaleRequest,
+		},
+		{
+			name: "Edge of the window", client: "billing", secret: "new-secret",
+			timestamp: strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+			role:      entities.RoleSender,
+		},
+		{
+			name: "Malformed timestamp", client: "billing", secret: "new-secret",
+			timestamp:   "yesterday",
+			expectedErr: ErrStaleRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSigningAuthService(t, now)
+			if tt.timestamp == "" {
+				tt.timestamp = timestamp
+			}
+			if tt.signed == nil {
+				tt.signed, tt.sent = body, body
+			}
+			signature := tt.signature
+			if tt.secret != "" {
+				signature = signRequest(tt.secret, method, uri, tt.timestamp, tt.signed)
+			}
+
+			sentHash := sha256.Sum256(tt.sent)
+			principal, err := s.AuthenticateSignature(tt.client, tt.timestamp, signature, method, uri, sentHash[:])
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, ErrUnauthenticated)
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, principal)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.client, principal.ID)
+			assert.Equal(t, tt.role, principal.Role)
+		})
+	}
+}
+
+func TestAuthenticateSignatureReplay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newSigningAuthService(t, now)
+	bodyHash := sha256.Sum256(nil)
+
+	authenticate := func(timestamp time.Time, signature string) error {
+		_, err := s.AuthenticateSignature("billing", strconv.FormatInt(timestamp.Unix(), 10), signature,
+			"GET", "/jobs", bodyHash[:])
+		return err
+	}
+	sign := func(secret string, timestamp time.Time) string {
+		return signRequest(secret, "GET", "/jobs", strconv.FormatInt(timestamp.Unix(), 10), nil)
+	}
+
+	signature := sign("new-secret", now)
+	require.NoError(t, authenticate(now, signature))
+
+	// The same request, even with the signature in upper case, is refused
+	assert.ErrorIs(t, authenticate(now, signature), ErrReplayedRequest)
+	assert.ErrorIs(t, authenticate(now, strings.ToUpper(signature)), ErrReplayedRequest)
+
+	// Other requests within the window are not replays
+	later := now.Add(time.Second)
+	require.NoError(t, authenticate(later, sign("new-secret", later)))
+	require.NoError(t, authenticate(now, sign("old-secret", now)))
+	assert.Len(t, s.seen, 3)
+
+	// Used signatures are forgotten once their timestamp leaves the window,
+	// when a replay is refused as stale instead
+	s.now = func() time.Time { return now.Add(time.Minute + 2*time.Second) }
+	assert.ErrorIs(t, authenticate(now, signature), ErrStaleRequest)
+	require.NoError(t, authenticate(s.now(), sign("new-secret", s.now())))
+	assert.Len(t, s.seen, 1)
+	assert.Equal(t, len(s.seen), s.expiries.Len())
+}
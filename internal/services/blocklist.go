@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var ErrFileBlocked = errors.New("file type is blocked")
+
+// Blocklist refuses files by extension and, optionally, executables and
+// scripts whatever their name. Mail relays silently drop messages carrying
+// such files, so they are refused up front.
+type Blocklist struct {
+	extensions  map[string]bool
+	executables bool
+}
+
+// NewBlocklist creates a Blocklist from the configuration
+func NewBlocklist(cfg *config.BlocklistConfig) *Blocklist {
+	extensions := make(map[string]bool, len(cfg.Extensions))
+	for _, ext := range cfg.Extensions {
+		extensions[strings.ToLower(ext)] = true
+	}
+
+	return &Blocklist{
+		extensions:  extensions,
+		executables: cfg.Executables,
+	}
+}
+
+// ValidateFile returns ErrFileBlocked when the file is refused. A nil
+// Blocklist accepts every file, and the entries of inspected archives are
+// not checked. Streamed files are peeked, not consumed.
+func (b *Blocklist) ValidateFile(file *entities.FileData, kind entities.UploadKind) error {
+	if b == nil || kind == entities.UploadKindInformation {
+		return nil
+	}
+
+	// Windows ignores trailing dots and spaces, so "setup.exe." is an .exe
+	ext := strings.ToLower(filepath.Ext(strings.TrimRight(file.Name, ". ")))
+	if b.extensions[ext] {
+		return fmt.Errorf("%w: %s files are not accepted (%s)", ErrFileBlocked, ext, file.Name)
+	}
+
+	if !b.executables {
+		return nil
+	}
+	head, err := file.Peek(utils.ExecutableHeadSize)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	if executable := utils.ExecutableType(head); executable != "" {
+		return fmt.Errorf("%w: %s is an executable (%s)", ErrFileBlocked, file.Name, executable)
+	}
+
+	return nil
+}
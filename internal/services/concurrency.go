@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var ErrTooBusy = errors.New("too many archives are being processed, try again later")
+
+// WorkLimiter bounds the archive builds and extractions run at once. Excess
+// requests queue for a slot up to the queue timeout, and are rejected when
+// the queue is full. A nil WorkLimiter runs everything at once.
+type WorkLimiter struct {
+	slots     chan struct{}
+	maxQueued int64
+	timeout   time.Duration
+
+	queued atomic.Int64
+}
+
+// NewWorkLimiter creates a WorkLimiter for cfg
+func NewWorkLimiter(cfg *config.ConcurrencyConfig) *WorkLimiter {
+	size := cfg.MaxArchives
+	if size <= 0 {
+		size = runtime.GOMAXPROCS(0)
+	}
+
+	return &WorkLimiter{
+		slots:     make(chan struct{}, size),
+		maxQueued: int64(cfg.MaxQueued),
+		timeout:   cfg.QueueTimeout,
+	}
+}
+
+// Acquire takes a slot for a request, waiting up to the queue timeout for
+// one to be released. It returns ErrTooBusy when none is.
+func (l *WorkLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	const op = "WorkLimiter.Acquire"
+
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaser(), nil
+	default:
+	}
+
+	if l.timeout <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrTooBusy)
+	}
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		return nil, fmt.Errorf("%s: %w", op, ErrTooBusy)
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaser(), nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%s: %w", op, ErrTooBusy)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+}
+
+// Wait takes a slot for background work such as a job, waiting for as long
+// as the context allows
+func (l *WorkLimiter) Wait(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.releaser(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns the function releasing a slot taken, once
+func (l *WorkLimiter) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.slots })
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package services
+
+import "errors"
+
+// freeDiskSpace is not supported here, so free disk is never checked
+func freeDiskSpace(string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
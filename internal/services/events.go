@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var ErrEventBusNil = errors.New("event bus is nil")
+
+const (
+	defaultEventTimeout   = 10 * time.Second
+	defaultEventQueueSize = 1000
+)
+
+// EventPublisher hands events to the systems subscribed to them. Publish
+// must not block, as events are published on the paths of archives, jobs
+// and mail.
+type EventPublisher interface {
+	Publish(event *entities.Event)
+}
+
+// EventPublishers hands every event to each of its publishers
+type EventPublishers []EventPublisher
+
+// Publish hands the event to every publisher
+func (p EventPublishers) Publish(event *entities.Event) {
+	for _, publisher := range p {
+		publisher.Publish(event)
+	}
+}
+
+// publish sends an event of the given type about data through events,
+// which may be nil
+func publish(events EventPublisher, eventType entities.EventType, tenantID string, data any) {
+	if events == nil {
+		return
+	}
+	events.Publish(&entities.Event{
+		ID:        utils.NewID(),
+		Type:      eventType,
+		TenantID:  tenantID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+}
+
+// archiveEvent is the data of archive events. Unlike StoredArchive it
+// leaves out the passphrase hash.
+type archiveEvent struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Protected bool      `json:"protected"`
+	CreatedAt time.Time `json:"created_at"`
+	// Access is the download, for archive.downloaded
+	Access *entities.ArchiveAccess `json:"access,omitempty"`
+}
+
+// newArchiveEvent returns the data of an event about the archive of meta
+func newArchiveEvent(meta *entities.StoredArchive) archiveEvent {
+	return archiveEvent{
+		ID:        meta.ID,
+		Filename:  meta.Filename,
+		Size:      meta.Size,
+		Protected: meta.Protected(),
+		CreatedAt: meta.CreatedAt,
+	}
+}
+
+// EventBusPublisher publishes events to a message bus, each to the topic
+// named after its type. Events are queued and published in order by a
+// single worker; those published while the queue is full, and those still
+// queued at shutdown, are dropped. A nil EventBusPublisher drops every event.
+type EventBusPublisher struct {
+	bus     repositories.EventBus
+	topic   string
+	events  map[entities.EventType]bool
+	timeout time.Duration
+	queue   chan *busEvent
+	log     *slog.Logger
+}
+
+// busEvent is an encoded event waiting to be published
+type busEvent struct {
+	id      string
+	event   entities.EventType
+	payload []byte
+}
+
+// NewEventBusPublisher creates an EventBusPublisher publishing to bus the
+// events selected by cfg
+func NewEventBusPublisher(bus repositories.EventBus, cfg *config.EventsConfig, log *slog.Logger) (*EventBusPublisher, error) {
+	if bus == nil {
+		return nil, ErrEventBusNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	p := &EventBusPublisher{
+		bus:     bus,
+		topic:   cfg.Topic,
+		events:  make(map[entities.EventType]bool, len(cfg.Events)),
+		timeout: cfg.Timeout,
+		log:     log,
+	}
+	for _, event := range cfg.Events {
+		p.events[entities.EventType(event)] = true
+	}
+	if p.timeout <= 0 {
+		p.timeout = defaultEventTimeout
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultEventQueueSize
+	}
+	p.queue = make(chan *busEvent, queueSize)
+
+	return p, nil
+}
+
+// Publish queues the event, unless its type is not published
+func (p *EventBusPublisher) Publish(event *entities.Event) {
+	const op = "EventBusPublisher.Publish"
+
+	if p == nil || (len(p.events) > 0 && !p.events[event.Type]) {
+		return
+	}
+
+	// Encoded before returning, so the subject of the event may change
+	// afterwards
+	payload, err := json.Marshal(event)
+	if err != nil {
+		p.log.Error("failed to encode event", "op", op, "id", event.ID, "type", event.Type, "error", err)
+		return
+	}
+
+	select {
+	case p.queue <- &busEvent{id: event.ID, event: event.Type, payload: payload}:
+	default:
+		p.log.Error("event queue is full, event dropped", "op", op, "id", event.ID, "type", event.Type)
+	}
+}
+
+// Run publishes queued events until the context is cancelled
+func (p *EventBusPublisher) Run(ctx context.Context) {
+	const op = "EventBusPublisher.Run"
+
+	if p == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-p.queue:
+			topic := strings.ReplaceAll(p.topic, "{type}", string(event.event))
+			publishCtx, cancel := context.WithTimeout(ctx, p.timeout)
+			err := p.bus.Publish(publishCtx, topic, event.id, event.payload)
+			cancel()
+			if err != nil {
+				p.log.Error("failed to publish event",
+					"op", op,
+					"id", event.id,
+					"type", event.event,
+					"topic", topic,
+					"error", err,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+// maxGroupAddresses bounds the addresses of a recipient group
+const maxGroupAddresses = 1000
+
+var (
+	ErrGroupRepositoryNil = errors.New("group repository is nil")
+	ErrInvalidGroup       = errors.New("invalid recipient group")
+	ErrGroupNotFound      = errors.New("recipient group not found")
+	ErrGroupExists        = errors.New("recipient group already exists")
+)
+
+// groupName matches the names of recipient groups, such as "finance-team"
+var groupName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// GroupService manages the recipient groups mail may be sent to by name, so
+// the addresses of a list are maintained in one place. Each tenant has its
+// own groups.
+type GroupService struct {
+	repo repositories.GroupRepository
+}
+
+// NewGroupService creates a new GroupService
+func NewGroupService(repo repositories.GroupRepository) (*GroupService, error) {
+	if repo == nil {
+		return nil, ErrGroupRepositoryNil
+	}
+	return &GroupService{repo: repo}, nil
+}
+
+// Create adds a group for a tenant
+func (s *GroupService) Create(tenantID, name string, addresses []string) (*entities.RecipientGroup, error) {
+	const op = "GroupService.Create"
+
+	group, err := newGroup(tenantID, name, addresses)
+	if err != nil {
+		return nil, err
+	}
+	group.CreatedAt = group.UpdatedAt
+
+	if err := s.repo.Create(group); err != nil {
+		if errors.Is(err, repositories.ErrGroupExists) {
+			return nil, ErrGroupExists
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return group, nil
+}
+
+// Update replaces the addresses of a group of a tenant
+func (s *GroupService) Update(tenantID, name string, addresses []string) (*entities.RecipientGroup, error) {
+	const op = "GroupService.Update"
+
+	group, err := newGroup(tenantID, name, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(group); err != nil {
+		if errors.Is(err, repositories.ErrGroupNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.Get(tenantID, name)
+}
+
+// Get returns a group of a tenant
+func (s *GroupService) Get(tenantID, name string) (*entities.RecipientGroup, error) {
+	const op = "GroupService.Get"
+
+	group, err := s.repo.Get(tenantID, strings.ToLower(name))
+	if err != nil {
+		if errors.Is(err, repositories.ErrGroupNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return group, nil
+}
+
+// List returns the groups of a tenant
+func (s *GroupService) List(tenantID string) ([]*entities.RecipientGroup, error) {
+	const op = "GroupService.List"
+
+	groups, err := s.repo.List(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return groups, nil
+}
+
+// Delete removes a group of a tenant
+func (s *GroupService) Delete(tenantID, name string) error {
+	const op = "GroupService.Delete"
+
+	if err := s.repo.Delete(tenantID, strings.ToLower(name)); err != nil {
+		if errors.Is(err, repositories.ErrGroupNotFound) {
+			return ErrGroupNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// newGroup validates the name and addresses of a group, normalizing the
+// addresses and dropping duplicates
+func newGroup(tenantID, name string, addresses []string) (*entities.RecipientGroup, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !groupName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be 1 to 64 lowercase letters, digits, '.', '_' or '-': %s", ErrInvalidGroup, name)
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%w: addresses are required", ErrInvalidGroup)
+	}
+	if len(addresses) > maxGroupAddresses {
+		return nil, fmt.Errorf("%w: a group has at most %d addresses", ErrInvalidGroup, maxGroupAddresses)
+	}
+
+	seen := make(map[string]bool, len(addresses))
+	normalized := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		addr, err := mail.ParseAddress(strings.TrimSpace(address))
+		if err != nil || addr.Name != "" {
+			return nil, fmt.Errorf("%w: invalid address: %s", ErrInvalidGroup, address)
+		}
+		address = entities.NormalizeAddress(addr.Address)
+		if key := strings.ToLower(address); !seen[key] {
+			seen[key] = true
+			normalized = append(normalized, address)
+		}
+	}
+
+	return &entities.RecipientGroup{
+		Name:      name,
+		Addresses: normalized,
+		TenantID:  tenantID,
+		UpdatedAt: time.Now(),
+	}, nil
+}
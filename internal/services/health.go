@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+const defaultHealthTimeout = 5 * time.Second
+
+// HealthProbe checks that a dependency can be reached, failing when it
+// cannot
+type HealthProbe func(ctx context.Context) error
+
+// HealthService reports the state of the dependencies registered with it,
+// such as the SMTP relays, the storage, the queue and the database. Probes
+// run when a report is asked for, and their results are reused until they
+// are older than the cache TTL.
+type HealthService struct {
+	cacheTTL time.Duration
+	timeout  time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	probes map[string]*healthProbe
+}
+
+// healthProbe is a registered probe and its latest result
+type healthProbe struct {
+	probe HealthProbe
+	// mu is held while probing, so concurrent reports share a probe
+	mu     sync.Mutex
+	result entities.DependencyHealth
+}
+
+// NewHealthService creates a new HealthService without dependencies
+func NewHealthService(cfg *config.HealthConfig) *HealthService {
+	s := &HealthService{
+		cacheTTL: cfg.CacheTTL,
+		timeout:  cfg.Timeout,
+		now:      time.Now,
+		probes:   make(map[string]*healthProbe),
+	}
+	if s.cacheTTL < 0 {
+		s.cacheTTL = 0
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultHealthTimeout
+	}
+	return s
+}
+
+// Register reports the dependency under name, checked with probe. It
+// replaces a dependency registered under the same name.
+func (s *HealthService) Register(name string, probe HealthProbe) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probes[name] = &healthProbe{probe: probe}
+}
+
+// Check probes the dependencies whose results have expired, all at once,
+// and reports every dependency. The service is degraded while any
+// dependency is down.
+func (s *HealthService) Check(ctx context.Context) *entities.HealthReport {
+	s.mu.Lock()
+	probes := make(map[string]*healthProbe, len(s.probes))
+	for name, probe := range s.probes {
+		probes[name] = probe
+	}
+	s.mu.Unlock()
+
+	report := &entities.HealthReport{
+		Status:       entities.HealthUp,
+		Dependencies: make(map[string]*entities.DependencyHealth, len(probes)),
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, probe := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := s.result(ctx, probe)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[name] = &result
+			if result.Status != entities.HealthUp {
+				report.Status = entities.HealthDegraded
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// result returns the latest result of a probe, probing again when it has
+// expired
+func (s *HealthService) result(ctx context.Context, probe *healthProbe) entities.DependencyHealth {
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+
+	if !probe.result.CheckedAt.IsZero() && s.now().Sub(probe.result.CheckedAt) < s.cacheTTL {
+		return probe.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := s.now()
+	err := probe.probe(ctx)
+	end := s.now()
+
+	probe.result.Status = entities.HealthUp
+	probe.result.LatencyMS = end.Sub(start).Milliseconds()
+	probe.result.CheckedAt = end
+	if err != nil {
+		probe.result.Status = entities.HealthDown
+		probe.result.LastError = err.Error()
+		probe.result.LastErrorAt = &end
+	}
+	return probe.result
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrHistoryRepositoryNil = errors.New("history repository is nil")
+	ErrInvalidHistoryFilter = errors.New("invalid history filter")
+)
+
+const (
+	defaultHistoryListLimit = 50
+	maxHistoryListLimit     = 500
+)
+
+// HistoryService records the metadata of processed uploads so they can be
+// reviewed later. A nil *HistoryService records nothing.
+type HistoryService struct {
+	repo repositories.HistoryRepository
+	log  *slog.Logger
+}
+
+// NewHistoryService creates a new HistoryService
+func NewHistoryService(repo repositories.HistoryRepository, log *slog.Logger) (*HistoryService, error) {
+	if repo == nil {
+		return nil, ErrHistoryRepositoryNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	return &HistoryService{repo: repo, log: log}, nil
+}
+
+// Record stores the entry with the outcome err. Failing to record history is
+// logged but never fails the upload itself.
+func (s *HistoryService) Record(entry entities.HistoryEntry, err error) {
+	const op = "HistoryService.Record"
+
+	if s == nil {
+		return
+	}
+
+	entry.ID = utils.NewID()
+	if entry.FinishedAt.IsZero() {
+		entry.FinishedAt = time.Now()
+	}
+	if entry.StartedAt.IsZero() {
+		entry.StartedAt = entry.FinishedAt
+	}
+	entry.Result = entities.UploadResultSucceeded
+	if err != nil {
+		entry.Result = entities.UploadResultFailed
+		entry.Error = err.Error()
+	}
+
+	if err := s.repo.Add(&entry); err != nil {
+		s.log.Error("failed to record upload history",
+			"op", op,
+			"kind", entry.Kind,
+			"error", err,
+		)
+	}
+}
+
+// List returns a page of history entries matching the filter, newest first
+func (s *HistoryService) List(filter entities.HistoryFilter) (*entities.HistoryPage, error) {
+	const op = "HistoryService.List"
+
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, fmt.Errorf("%s: %w: limit and offset cannot be negative", op, ErrInvalidHistoryFilter)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultHistoryListLimit
+	}
+	filter.Limit = min(filter.Limit, maxHistoryListLimit)
+
+	entries, total, err := s.repo.List(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &entities.HistoryPage{
+		Entries: entries,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	}, nil
+}
+
+// NewUploadEntry starts a history entry for an upload of the given files by
+// the client with apiKey in the tenant tenantID
+func NewUploadEntry(kind entities.UploadKind, tenantID, apiKey string, files []*entities.FileData) entities.HistoryEntry {
+	entry := entities.HistoryEntry{
+		Kind:       kind,
+		EntryCount: len(files),
+		TenantID:   tenantID,
+		APIKeyID:   utils.KeyID(apiKey),
+		StartedAt:  time.Now(),
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+		entry.Size += file.Size()
+	}
+	entry.Filename = strings.Join(names, ", ")
+
+	return entry
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrJobRepositoryNil = errors.New("job repository is nil")
+	ErrJobNotFound      = errors.New("job not found")
+	ErrUnknownJobType   = errors.New("unknown job type")
+	ErrInvalidJobFilter = errors.New("invalid job filter")
+	ErrJobNotRetryable  = errors.New("only failed jobs can be retried")
+	ErrRetryLimit       = errors.New("job retry limit reached")
+)
+
+const (
+	defaultJobListLimit = 50
+	maxJobListLimit     = 500
+
+	// jobQueueName is the name of the queue holding ids of jobs to run
+	jobQueueName = "jobs"
+
+	defaultJobMaxAttempts = 3
+)
+
+// JobHandlerFunc performs a job and returns a JSON serializable result
+type JobHandlerFunc func(ctx context.Context, job *entities.Job) (any, error)
+
+// JobManager runs asynchronous archive and mail jobs on a pool of workers
+// and keeps their state in a JobRepository
+type JobManager struct {
+	repo    repositories.JobRepository
+	log     *slog.Logger
+	workers int
+	// maxAttempts bounds how often a job runs, including retries
+	maxAttempts int
+	queue       repositories.Queue
+	events      EventPublisher
+	handlers    map[entities.JobType]JobHandlerFunc
+
+	mu sync.RWMutex
+}
+
+// NewJobManager creates a new JobManager. queue is optional and defaults to
+// a queue local to the process. events is optional; without it finished
+// jobs are not announced. cfg is optional; without it a single worker runs
+// jobs and failed jobs may be retried twice.
+func NewJobManager(repo repositories.JobRepository, queue repositories.Queue, events EventPublisher, cfg *config.JobsConfig, log *slog.Logger) (*JobManager, error) {
+	if repo == nil {
+		return nil, ErrJobRepositoryNil
+	}
+
+	if queue == nil {
+		queue = repositories.NewMemoryQueue()
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	m := &JobManager{
+		repo:        repo,
+		log:         log,
+		workers:     1,
+		maxAttempts: defaultJobMaxAttempts,
+		queue:       queue,
+		events:      events,
+		handlers:    make(map[entities.JobType]JobHandlerFunc),
+	}
+
+	if cfg != nil {
+		m.workers = max(cfg.Workers, 1)
+		if cfg.MaxAttempts > 0 {
+			m.maxAttempts = cfg.MaxAttempts
+		}
+	}
+
+	return m, nil
+}
+
+// Register sets the handler performing jobs of the given type. It must be
+// called before Run.
+func (m *JobManager) Register(jobType entities.JobType, handler JobHandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[jobType] = handler
+}
+
+// MaxAttempts returns how often a job runs at most, including retries
+func (m *JobManager) MaxAttempts() int {
+	return m.maxAttempts
+}
+
+// Submit stores a new job with the given input and queues it for a worker.
+// tenantID and apiKey identify the submitting client, if any; only the KeyID
+// of the key is kept.
+func (m *JobManager) Submit(jobType entities.JobType, tenantID, apiKey string, input any) (*entities.Job, error) {
+	const op = "JobManager.Submit"
+
+	m.mu.RLock()
+	_, known := m.handlers[jobType]
+	m.mu.RUnlock()
+	if !known {
+		return nil, fmt.Errorf("%s: %w: %s", op, ErrUnknownJobType, jobType)
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to encode input: %w", op, err)
+	}
+
+	now := time.Now()
+	job := &entities.Job{
+		ID:        utils.NewID(),
+		Type:      jobType,
+		Status:    entities.JobStatusQueued,
+		TenantID:  tenantID,
+		APIKeyID:  utils.KeyID(apiKey),
+		Input:     data,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := m.repo.Create(job); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.enqueue(job.ID); err != nil {
+		m.finish(job, nil, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.log.Info("job submitted",
+		"op", op,
+		"id", job.ID,
+		"type", job.Type,
+	)
+
+	return job, nil
+}
+
+// Retry requeues a failed job with its stored inputs. A job runs at most
+// maxAttempts times in total.
+func (m *JobManager) Retry(id string) (*entities.Job, error) {
+	const op = "JobManager.Retry"
+
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if job.Status != entities.JobStatusFailed {
+		return nil, fmt.Errorf("%s: %w", op, ErrJobNotRetryable)
+	}
+	if job.Attempts >= m.maxAttempts {
+		return nil, fmt.Errorf("%s: %w: %d of %d attempts used", op, ErrRetryLimit, job.Attempts, m.maxAttempts)
+	}
+	if job.Input == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrJobNotRetryable)
+	}
+
+	job.Status = entities.JobStatusQueued
+	job.Error = ""
+	job.FinishedAt = nil
+	job.UpdatedAt = time.Now()
+	if err := m.repo.Update(job); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.enqueue(job.ID); err != nil {
+		m.finish(job, nil, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.log.Info("job requeued",
+		"op", op,
+		"id", job.ID,
+		"type", job.Type,
+		"attempts", job.Attempts,
+	)
+
+	return job, nil
+}
+
+// Get returns the current state of a job
+func (m *JobManager) Get(id string) (*entities.Job, error) {
+	const op = "JobManager.Get"
+
+	job, err := m.repo.Get(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrJobNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrJobNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return job, nil
+}
+
+// List returns a page of jobs matching the filter, newest first
+func (m *JobManager) List(filter entities.JobFilter) (*entities.JobPage, error) {
+	const op = "JobManager.List"
+
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, fmt.Errorf("%s: %w: limit and offset cannot be negative", op, ErrInvalidJobFilter)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultJobListLimit
+	}
+	filter.Limit = min(filter.Limit, maxJobListLimit)
+
+	jobs, total, err := m.repo.List(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &entities.JobPage{
+		Jobs:   jobs,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+// Run processes queued jobs until the context is cancelled. Jobs left queued
+// or running by a previous process are requeued first.
+func (m *JobManager) Run(ctx context.Context) {
+	m.recoverPending()
+
+	var wg sync.WaitGroup
+	for range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				id, err := m.queue.Pop(ctx, jobQueueName)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					m.log.Error("failed to pop job", "op", "JobManager.Run", "error", err)
+					time.Sleep(time.Second)
+					continue
+				}
+				m.process(ctx, string(id))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// recoverPending requeues jobs that were queued or interrupted while running
+// when the process stopped. With a shared queue, running jobs may belong to
+// another instance, so they are left alone and queued jobs are already in the
+// queue; duplicates are harmless since a job can only be claimed once.
+func (m *JobManager) recoverPending() {
+	const op = "JobManager.recoverPending"
+
+	if _, local := m.queue.(*repositories.MemoryQueue); !local {
+		return
+	}
+
+	for _, status := range []entities.JobStatus{entities.JobStatusRunning, entities.JobStatusQueued} {
+		jobs, _, err := m.repo.List(entities.JobFilter{Status: status})
+		if err != nil {
+			m.log.Error("failed to list pending jobs", "op", op, "status", status, "error", err)
+			continue
+		}
+
+		for _, job := range jobs {
+			if job.Status == entities.JobStatusRunning {
+				job.Status = entities.JobStatusQueued
+				job.UpdatedAt = time.Now()
+				if err := m.repo.Update(job); err != nil {
+					m.log.Error("failed to requeue job", "op", op, "id", job.ID, "error", err)
+					continue
+				}
+			}
+
+			if err := m.enqueue(job.ID); err != nil {
+				m.finish(job, nil, err)
+				continue
+			}
+
+			m.log.Info("pending job recovered", "op", op, "id", job.ID, "type", job.Type)
+		}
+	}
+}
+
+// enqueue hands a job to the workers
+func (m *JobManager) enqueue(id string) error {
+	return m.queue.Push(context.Background(), jobQueueName, []byte(id), time.Time{})
+}
+
+// process runs a single job and records its outcome
+func (m *JobManager) process(ctx context.Context, id string) {
+	const op = "JobManager.process"
+
+	job, err := m.repo.Claim(id, time.Now())
+	if err != nil {
+		if errors.Is(err, repositories.ErrJobNotClaimable) {
+			// Already run by another worker
+			return
+		}
+		m.log.Error("failed to claim job", "op", op, "id", id, "error", err)
+		return
+	}
+
+	m.mu.RLock()
+	handler := m.handlers[job.Type]
+	m.mu.RUnlock()
+
+	var result any
+	if handler == nil {
+		err = fmt.Errorf("%w: %s", ErrUnknownJobType, job.Type)
+	} else {
+		result, err = handler(ctx, job)
+	}
+
+	m.finish(job, result, err)
+}
+
+// finish records the result or error of a job and announces it
+func (m *JobManager) finish(job *entities.Job, result any, jobErr error) {
+	const op = "JobManager.finish"
+
+	now := time.Now()
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+
+	if jobErr != nil {
+		job.Status = entities.JobStatusFailed
+		job.Error = jobErr.Error()
+		// Inputs of jobs that can't be retried are no longer needed either
+		if job.Attempts >= m.maxAttempts {
+			job.Input = nil
+		}
+		m.log.Error("job failed", "op", op, "id", job.ID, "type", job.Type, "error", jobErr)
+	} else {
+		job.Status = entities.JobStatusSucceeded
+		job.Error = ""
+		// Inputs of succeeded jobs are no longer needed
+		job.Input = nil
+		if result != nil {
+			data, err := json.Marshal(result)
+			if err != nil {
+				m.log.Error("failed to encode job result", "op", op, "id", job.ID, "error", err)
+			}
+			job.Result = data
+		}
+		m.log.Info("job succeeded", "op", op, "id", job.ID, "type", job.Type)
+	}
+
+	if err := m.repo.Update(job); err != nil {
+		m.log.Error("failed to update job", "op", op, "id", job.ID, "error", err)
+	}
+
+	if job.Status == entities.JobStatusFailed {
+		publish(m.events, entities.EventJobFailed, job.TenantID, job)
+	} else {
+		publish(m.events, entities.EventJobSucceeded, job.TenantID, job)
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+)
+
+// defaultArchiveName is the name of archives created by jobs
+const defaultArchiveName = "archive.zip"
+
+// NewArchiveJobHandler returns a job handler that creates an archive from an
+// entities.ArchiveJobInput and stores it for download. Its uploads are
+// removed once the job succeeds or has used its last of maxAttempts
+// attempts. Every attempt is recorded in history, which is optional. builds
+// is optional; without it archives are built as soon as the job runs.
+func NewArchiveJobHandler(archives ArchiveService, shares ShareService, uploads *UploadService, secrets *SecretSealer, history *HistoryService, builds *WorkLimiter, maxAttempts int) JobHandlerFunc {
+	return func(ctx context.Context, job *entities.Job) (result any, err error) {
+		var input entities.ArchiveJobInput
+		if err := json.Unmarshal(job.Input, &input); err != nil {
+			return nil, fmt.Errorf("invalid archive job input: %w", err)
+		}
+
+		files := make([]*entities.FileData, len(input.Files))
+		for i, file := range input.Files {
+			files[i] = &entities.FileData{
+				Name:     file.Name,
+				Length:   file.Size,
+				MIMEType: file.MIMEType,
+				SkipScan: file.SkipScan,
+			}
+		}
+		entry := NewUploadEntry(entities.UploadKindStore, job.TenantID, "", files)
+		entry.APIKeyID = job.APIKeyID
+		entry.JobID = job.ID
+		defer func() { history.Record(entry, err) }()
+		defer func() {
+			if err == nil || job.Attempts >= maxAttempts {
+				for _, file := range input.Files {
+					uploads.Discard(file.UploadID)
+				}
+			}
+		}()
+
+		password, err := secrets.Open(ctx, input.Password)
+		if err != nil {
+			return nil, err
+		}
+		passphrase, err := secrets.Open(ctx, input.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, file := range input.Files {
+			f, cleanup, err := uploads.Open(ctx, file.UploadID)
+			if err != nil {
+				return nil, err
+			}
+			defer cleanup()
+			files[i].Reader = f
+		}
+
+		release, err := builds.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var archive *entities.FileData
+		if password != "" {
+			archive, err = archives.CreateEncryptedZipArchive(files, defaultArchiveName, password)
+		} else {
+			archive, err = archives.CreateZipArchive(files, defaultArchiveName)
+		}
+		if err == nil && len(input.Recipients) > 0 {
+			archive, err = archives.EncryptToRecipients(archive, input.Recipients)
+		}
+		release()
+		metrics.ObserveArchive(entities.UploadKindStore, files, archive, err)
+		if err != nil {
+			return nil, err
+		}
+
+		stored, err := shares.Store(archive, passphrase, job.TenantID, job.APIKeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		return entities.ArchiveJobResult{
+			ArchiveID: stored.ID,
+			Filename:  stored.Filename,
+			Size:      stored.Size,
+			Protected: stored.Protected(),
+			Signature: stored.Signature,
+		}, nil
+	}
+}
+
+// NewInformationJobHandler returns a job handler that inspects an archive
+// uploaded with an entities.InformationJobInput. The upload is removed once
+// the job succeeds or has used its last of maxAttempts attempts. Every
+// attempt is recorded in history, which is optional. builds is optional;
+// without it archives are inspected as soon as the job runs.
+func NewInformationJobHandler(archives ArchiveService, uploads *UploadService, history *HistoryService, builds *WorkLimiter, maxAttempts int) JobHandlerFunc {
+	return func(ctx context.Context, job *entities.Job) (result any, err error) {
+		var input entities.InformationJobInput
+		if err := json.Unmarshal(job.Input, &input); err != nil {
+			return nil, fmt.Errorf("invalid information job input: %w", err)
+		}
+
+		entry := entities.HistoryEntry{
+			Kind:      entities.UploadKindInformation,
+			Filename:  input.Filename,
+			Size:      input.Size,
+			TenantID:  job.TenantID,
+			APIKeyID:  job.APIKeyID,
+			JobID:     job.ID,
+			StartedAt: time.Now(),
+		}
+		defer func() { history.Record(entry, err) }()
+		defer func() {
+			if err == nil || job.Attempts >= maxAttempts {
+				uploads.Discard(input.UploadID)
+			}
+		}()
+
+		file, cleanup, err := uploads.Open(ctx, input.UploadID)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+
+		release, err := builds.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		info, err := archives.GetArchiveInformation(file, input.Filename)
+		release()
+		metrics.ObserveInput(entities.UploadKindInformation, input.Size, err)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.EntryCount = int(info.TotalFiles)
+		return info, nil
+	}
+}
+
+// NewMailJobHandler returns a job handler that delivers an entities.MailMessage.
+// The job fails only when no recipient received the message; the delivery
+// report is the result either way. Every attempt is recorded in history,
+// which is optional.
+func NewMailJobHandler(mail MailService, history *HistoryService) JobHandlerFunc {
+	return func(ctx context.Context, job *entities.Job) (result any, err error) {
+		var msg entities.MailMessage
+		if err := json.Unmarshal(job.Input, &msg); err != nil {
+			return nil, fmt.Errorf("invalid mail job input: %w", err)
+		}
+
+		files := make([]*entities.FileData, 0, 1)
+		if len(msg.Attachments) > 0 {
+			files = append(files, msg.Attachments[0].File)
+		}
+		entry := NewUploadEntry(entities.UploadKindMail, job.TenantID, "", files)
+		entry.APIKeyID = job.APIKeyID
+		entry.JobID = job.ID
+		entry.Recipients = len(msg.To)
+		defer func() { history.Record(entry, err) }()
+
+		start := time.Now()
+		report, err := mail.DeliverMessage(&msg)
+		if err == nil && report.Sent == 0 && report.Failed > 0 {
+			err = fmt.Errorf("%w: delivery failed for all %d recipients", ErrMailSendFailed, report.Failed)
+		}
+		metrics.ObserveMailSend(string(entities.UploadKindMail), time.Since(start), err)
+		if err != nil {
+			return nil, err
+		}
+
+		return report, nil
+	}
+}
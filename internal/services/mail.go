@@ -1,17 +1,56 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
 	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
 	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
 )
 
 var (
 	ErrNoRecipients   = errors.New("no recipients provided")
+	ErrInvalidEmail   = errors.New("invalid email address")
 	ErrInvalidFile    = errors.New("invalid file data")
 	ErrMailSendFailed = errors.New("failed to send mail")
+	ErrMailDisabled   = errors.New("mail delivery is disabled")
+
+	ErrTemplateNotFound  = errors.New("mail template not found")
+	ErrTemplatesDisabled = errors.New("mail templates are not configured")
+	ErrInvalidInlineType = errors.New("inline attachments must be images")
+	ErrZipUnavailable    = errors.New("zipping attachments is not available")
+
+	ErrOutboxUnavailable   = errors.New("failed to store message in outbox")
+	ErrOutboxEntryNotFound = errors.New("message not found")
+	ErrOutboxEntrySending  = errors.New("message is being sent")
+)
+
+const (
+	defaultSubject = "File Attachment"
+	defaultBody    = "Please find the attached file."
+
+	testMailSubject  = "Doozip test message"
+	testMailBody     = "This is a test message sent from the Doozip admin API to verify the mail configuration."
+	testMailFilename = "doozip-test.pdf"
+
+	// maxBatchConcurrency bounds the number of batch items sent simultaneously
+	maxBatchConcurrency = 4
 )
 
 // MailService defines the interface for mail operations
@@ -20,24 +59,118 @@ type MailService interface {
 	SendMail(to []string, filename, mimeType string, fileContent []byte) error
 	// SendMailWithTemplate sends a file with custom subject and body template
 	SendMailWithTemplate(to []string, filename, mimeType string, fileContent []byte, subject, bodyTemplate string) error
+	// ApplyTemplate fills the message subject and bodies from a template loaded from the templates directory
+	ApplyTemplate(msg *entities.MailMessage, templateName string) error
+	// SendMessage validates and sends a composed message
+	SendMessage(msg *entities.MailMessage) error
+	// DeliverMessage validates and sends a composed message, reporting the outcome per recipient
+	DeliverMessage(msg *entities.MailMessage) (*entities.DeliveryReport, error)
 	// ValidateFileType checks if the given mime type is supported
 	ValidateFileType(mimeType string) error
+	// SendBatch sends every batch item concurrently and reports per-item results
+	SendBatch(items []entities.MailBatchItem) []entities.MailBatchResult
+	// SendTestMail sends a canned message to a single address and reports the delivery transcript
+	SendTestMail(to string, withAttachment bool) (*entities.TestMailResult, error)
+	// AttachmentZip returns how to zip the attachments of a message, given the choices of a request
+	AttachmentZip(zip, encrypt *bool) (*entities.AttachmentZip, error)
+	// SealZip seals the password of zip, so a message zipped with it can be queued
+	SealZip(ctx context.Context, zip *entities.AttachmentZip) error
+	// OutboxEntry returns a message kept in the outbox with the state of its delivery
+	OutboxEntry(id string) (*entities.OutboxEntry, error)
+	// Resend delivers a message kept in the outbox again, reporting the outcome per recipient
+	Resend(id string) (*entities.DeliveryReport, error)
 }
 
 // MailServiceImpl implements the MailService interface
 type MailServiceImpl struct {
-	repo repositories.MailRepository
+	repo            repositories.MailRepository
+	templates       repositories.MailTemplateRepository
+	archives        repositories.ArchiveRepository
+	outbox          repositories.OutboxRepository
+	suppressions    *SuppressionService
+	audit           *AuditService
+	events          EventPublisher
+	staleAfter      time.Duration
+	fanOutThreshold int
+	fanOutWorkers   int
+	maxAttachment   int64
+	validator       FileValidator
+	mx              *MXChecker
+	keyring         *PGPKeyring
+	zip             config.MailZipConfig
+	secrets         *SecretSealer
+	// subject and body render the subject and body of messages sent without
+	// them
+	subject    *template.Template
+	body       *template.Template
+	encryption bool
+	disabled   bool
 }
 
-// NewMailService creates a new instance of MailService with validation
-func NewMailService(repo repositories.MailRepository) (MailService, error) {
+// NewMailService creates a new instance of MailService with validation.
+// templates is optional; without it named templates are unavailable.
+// archives is optional; without it attachments cannot be zipped.
+// outbox is optional; without it messages are not kept and cannot be resent.
+// suppressions is optional; without it mail is sent to every recipient.
+// audit is optional; without it mail sent is not recorded in the audit trail.
+// events is optional; without it deliveries are not announced.
+// validator is optional; without it attachments are only checked against
+// the allowed MIME types.
+// keyring is optional; without it attachments are only encrypted with the
+// PGP keys uploaded with a message.
+// Recipient domains are resolved before sending when cfg sets the "mx"
+// validation level.
+// Every message is refused when features disables mail, and encrypted zip
+// archives when it disables encryption.
+// secrets seals the passwords of zip archives in the messages kept or queued.
+func NewMailService(repo repositories.MailRepository, templates repositories.MailTemplateRepository, archives repositories.ArchiveRepository, outbox repositories.OutboxRepository, suppressions *SuppressionService, audit *AuditService, events EventPublisher, cfg *config.MailConfig, validator FileValidator, keyring *PGPKeyring, secrets *SecretSealer, features config.FeaturesConfig) (MailService, error) {
 	if repo == nil {
 		return nil, errors.New("mail repository is required")
 	}
+	if secrets == nil {
+		return nil, errors.New("secret sealer is required")
+	}
 
-	return &MailServiceImpl{
-		repo: repo,
-	}, nil
+	service := &MailServiceImpl{
+		repo:          repo,
+		templates:     templates,
+		archives:      archives,
+		outbox:        outbox,
+		suppressions:  suppressions,
+		audit:         audit,
+		events:        events,
+		fanOutWorkers: 1,
+		subject:       template.Must(template.New("subject").Parse(defaultSubject)),
+		body:          template.Must(template.New("body").Parse(defaultBody)),
+		validator:     validator,
+		keyring:       keyring,
+		secrets:       secrets,
+		encryption:    features.Enabled(config.FeatureEncryption),
+		disabled:      !features.Enabled(config.FeatureMail),
+	}
+
+	if cfg != nil {
+		service.fanOutThreshold = cfg.FanOutThreshold
+		service.fanOutWorkers = max(cfg.FanOutWorkers, 1)
+		service.zip = cfg.Zip
+		service.maxAttachment = cfg.MaxAttachmentSize
+		service.staleAfter = cfg.Outbox.StaleAfter
+		service.mx = NewMXChecker(&cfg.RecipientValidation)
+
+		var err error
+		if cfg.DefaultSubject != "" {
+			if service.subject, err = template.New("subject").Parse(cfg.DefaultSubject); err != nil {
+				return nil, fmt.Errorf("invalid default mail subject: %w", err)
+			}
+		}
+		if cfg.DefaultBody != "" {
+			if service.body, err = template.New("body").Parse(cfg.DefaultBody); err != nil {
+				return nil, fmt.Errorf("invalid default mail body: %w", err)
+			}
+		}
+	}
+
+	return service, nil
 }
 
 // validateInput checks if the input parameters are valid
@@ -75,6 +208,14 @@ func (s *MailServiceImpl) ValidateFileType(mimeType string) error {
 	return nil
 }
 
+// validateFile runs the validator, if any, on an attachment
+func (s *MailServiceImpl) validateFile(file *entities.FileData) error {
+	if s.validator == nil {
+		return nil
+	}
+	return s.validator.ValidateFile(file, entities.UploadKindMail)
+}
+
 // createFileData creates a new FileData instance with validation
 func (s *MailServiceImpl) createFileData(filename, mimeType string, fileContent []byte) (*entities.FileData, error) {
 	fileData := &entities.FileData{
@@ -86,24 +227,782 @@ func (s *MailServiceImpl) createFileData(filename, mimeType string, fileContent
 	if err := fileData.Validate(); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
 	}
+	if err := s.validateFile(fileData); err != nil {
+		return nil, err
+	}
 
 	return fileData, nil
 }
 
 // SendMail sends a file to multiple recipients with default subject and body
 func (s *MailServiceImpl) SendMail(to []string, filename, mimeType string, fileContent []byte) error {
-	return s.SendMailWithTemplate(
-		to,
-		filename,
-		mimeType,
-		fileContent,
-		"File Attachment",
-		"Please find the attached file.",
+	data := entities.MailTemplateData{Filename: filename, Recipients: to, Date: time.Now()}
+	subject, err := renderDefault(s.subject, data)
+	if err != nil {
+		return err
+	}
+	body, err := renderDefault(s.body, data)
+	if err != nil {
+		return err
+	}
+	return s.SendMailWithTemplate(to, filename, mimeType, fileContent, subject, body)
+}
+
+// ApplyTemplate renders the named template into the message subject and bodies
+func (s *MailServiceImpl) ApplyTemplate(msg *entities.MailMessage, templateName string) error {
+	if s.templates == nil {
+		return ErrTemplatesDisabled
+	}
+
+	rendered, err := s.templates.Render(templateName, templateData(msg))
+	if err != nil {
+		if errors.Is(err, repositories.ErrTemplateNotFound) {
+			return fmt.Errorf("%w: %s", ErrTemplateNotFound, templateName)
+		}
+		return fmt.Errorf("failed to render template %s: %w", templateName, err)
+	}
+
+	msg.Subject = rendered.Subject
+	msg.Text = rendered.Text
+	msg.HTML = rendered.HTML
+
+	return nil
+}
+
+// templateData returns the variables templates render a message with
+func templateData(msg *entities.MailMessage) entities.MailTemplateData {
+	data := entities.MailTemplateData{
+		Recipients: msg.To,
+		Date:       time.Now(),
+	}
+	for _, attachment := range msg.Attachments {
+		if attachment != nil && !attachment.Inline && attachment.File != nil {
+			data.Filename = attachment.File.Name
+			break
+		}
+	}
+	return data
+}
+
+// renderDefault renders the default subject or body of a message
+func renderDefault(tmpl *template.Template, data entities.MailTemplateData) (string, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render default %s: %w", tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// SendMessage validates and sends a composed message, failing if delivery
+// to any recipient failed
+func (s *MailServiceImpl) SendMessage(msg *entities.MailMessage) error {
+	report, err := s.DeliverMessage(msg)
+	if err != nil {
+		return err
+	}
+	return reportError(report)
+}
+
+// reportError returns an error for the first recipient of report delivery
+// to whom failed, if any
+func reportError(report *entities.DeliveryReport) error {
+	for _, result := range report.Recipients {
+		if !result.Success && !result.Suppressed {
+			return fmt.Errorf("%w: %s: %s", ErrMailSendFailed, result.Recipient, result.Error)
+		}
+	}
+	return nil
+}
+
+// DeliverMessage validates and sends a composed message, applying the default
+// subject and body when they are missing. Messages with at least
+// FanOutThreshold recipients are sent individually to every recipient through
+// a bounded worker pool, so one failing address doesn't affect the others.
+// Attachments are zipped first when msg.Zip is set, and recipients with a
+// PGP key get their own copy with encrypted attachments. Attachments above
+// the size limit are split into volumes sent in a sequence of messages,
+// which are reported as a single delivery to every recipient.
+// Valid messages are kept in the outbox, together with the outcome of
+// their delivery, before they are sent.
+// The returned error is only set when the message itself is invalid or
+// cannot be kept.
+func (s *MailServiceImpl) DeliverMessage(msg *entities.MailMessage) (*entities.DeliveryReport, error) {
+	err := s.prepareMessage(msg)
+	if err == nil {
+		err = s.openZip(msg.Zip)
+	}
+	var entry *entities.OutboxEntry
+	if err == nil {
+		entry, err = s.storeMessage(msg)
+	}
+	if err != nil {
+		if msg != nil {
+			for _, recipient := range msg.To {
+				recordDelivery(recipient, err)
+			}
+		}
+		return nil, err
+	}
+
+	return s.deliverEntry(msg, entry)
+}
+
+// Resend delivers a message kept in the outbox again to all of its
+// recipients. A message still being sent is only resent once it has been
+// sending for longer than the configured time, as its delivery was then
+// interrupted.
+func (s *MailServiceImpl) Resend(id string) (*entities.DeliveryReport, error) {
+	const op = "MailService.Resend"
+
+	if s.disabled {
+		return nil, ErrMailDisabled
+	}
+	if s.outbox == nil {
+		return nil, ErrOutboxEntryNotFound
+	}
+
+	now := time.Now()
+	staleBefore := time.Unix(0, 0)
+	if s.staleAfter > 0 {
+		staleBefore = now.Add(-s.staleAfter)
+	}
+	entry, err := s.outbox.Claim(id, now, staleBefore)
+	switch {
+	case errors.Is(err, repositories.ErrOutboxEntryNotFound):
+		return nil, ErrOutboxEntryNotFound
+	case errors.Is(err, repositories.ErrOutboxEntryNotClaimable):
+		return nil, ErrOutboxEntrySending
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var msg entities.MailMessage
+	if err := json.Unmarshal(entry.Message, &msg); err != nil {
+		err = fmt.Errorf("%s: invalid outbox message: %w", op, err)
+		s.finishEntry(entry, nil, err)
+		return nil, err
+	}
+	if err := s.openZip(msg.Zip); err != nil {
+		err = fmt.Errorf("%s: %w", op, err)
+		s.finishEntry(entry, nil, err)
+		return nil, err
+	}
+
+	return s.deliverEntry(&msg, entry)
+}
+
+// OutboxEntry returns a message kept in the outbox
+func (s *MailServiceImpl) OutboxEntry(id string) (*entities.OutboxEntry, error) {
+	const op = "MailService.OutboxEntry"
+
+	if s.outbox == nil {
+		return nil, ErrOutboxEntryNotFound
+	}
+
+	entry, err := s.outbox.Get(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrOutboxEntryNotFound) {
+			return nil, ErrOutboxEntryNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entry, nil
+}
+
+// storeMessage keeps a prepared message in the outbox as being sent, unless
+// there is no outbox
+func (s *MailServiceImpl) storeMessage(msg *entities.MailMessage) (*entities.OutboxEntry, error) {
+	if s.outbox == nil {
+		return nil, nil
+	}
+
+	for _, attachment := range msg.Attachments {
+		if err := attachment.File.Load(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrOutboxUnavailable, err)
+		}
+	}
+	if err := s.SealZip(context.Background(), msg.Zip); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOutboxUnavailable, err)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOutboxUnavailable, err)
+	}
+
+	now := time.Now()
+	entry := &entities.OutboxEntry{
+		ID:         utils.NewID(),
+		Status:     entities.OutboxStatusSending,
+		Recipients: msg.To,
+		Subject:    msg.Subject,
+		Attempts:   1,
+		TenantID:   msg.TenantID,
+		Message:    data,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.outbox.Create(entry); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOutboxUnavailable, err)
+	}
+
+	return entry, nil
+}
+
+// finishEntry records the outcome of delivering the message of entry, when
+// there is one. An entry whose outcome can't be recorded stays sending and
+// is sent again later, as losing a message is worse than repeating it.
+func (s *MailServiceImpl) finishEntry(entry *entities.OutboxEntry, report *entities.DeliveryReport, err error) {
+	if entry == nil {
+		return
+	}
+
+	entry.UpdatedAt = time.Now()
+	switch {
+	case err != nil:
+		entry.Status = entities.OutboxStatusFailed
+		entry.Sent, entry.Failed = 0, len(entry.Recipients)
+		entry.Error = err.Error()
+	case report.Failed > 0:
+		entry.Status = entities.OutboxStatusFailed
+		entry.Sent, entry.Failed = report.Sent, report.Failed
+		entry.Error = reportError(report).Error()
+	default:
+		entry.Status = entities.OutboxStatusSent
+		entry.Sent, entry.Failed = report.Sent, 0
+		entry.Error = ""
+	}
+
+	s.outbox.Update(entry)
+}
+
+// deliverEntry sends a prepared message and records the outcome in its
+// outbox entry, which may be nil. Suppressed recipients are skipped, the
+// delivery is recorded in the audit trail, and announced.
+func (s *MailServiceImpl) deliverEntry(msg *entities.MailMessage, entry *entities.OutboxEntry) (*entities.DeliveryReport, error) {
+	to, suppressed, err := s.suppressions.Filter(msg.TenantID, msg.To)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrMailSendFailed, err)
+	} else if len(suppressed) > 0 {
+		if len(to) == 0 {
+			report := &entities.DeliveryReport{}
+			for _, recipient := range suppressed {
+				report.AddSuppressed(recipient)
+			}
+			s.finishEntry(entry, report, nil)
+			if entry != nil {
+				report.ID = entry.ID
+			}
+			s.publishDelivery(msg, report, nil)
+			return report, nil
+		}
+		filtered := *msg
+		filtered.To = to
+		msg = &filtered
+	}
+	var fingerprints []entities.AuditAttachment
+	if err == nil {
+		fingerprints, err = s.audit.fingerprint(msg.Attachments)
+	}
+	if err == nil && msg.Zip != nil {
+		err = s.zipAttachments(msg)
+	}
+	var parts []*entities.MailMessage
+	if err == nil {
+		parts, err = s.splitMessage(msg)
+	}
+	var keys map[string]*openpgp.Entity
+	if err == nil {
+		keys, err = s.keyring.recipientKeys(msg)
+	}
+	if err != nil {
+		for _, recipient := range msg.To {
+			recordDelivery(recipient, err)
+		}
+		s.finishEntry(entry, nil, err)
+		s.publishDelivery(msg, &entities.DeliveryReport{ID: entryID(entry)}, err)
+		return nil, err
+	}
+
+	var report *entities.DeliveryReport
+	if len(keys) > 0 {
+		report = s.deliverEncrypted(parts, keys)
+	} else {
+		report = s.deliver(parts)
+	}
+	for _, recipient := range suppressed {
+		report.AddSuppressed(recipient)
+	}
+	if len(parts) > 1 {
+		report.Parts = len(parts)
+	}
+	s.finishEntry(entry, report, nil)
+	if entry != nil {
+		report.ID = entry.ID
+	}
+	s.audit.recordMail(msg, fingerprints, report, report.ID)
+	s.publishDelivery(msg, report, nil)
+	return report, nil
+}
+
+// mailEvent is the data of mail events
+type mailEvent struct {
+	*entities.DeliveryReport
+	Subject string `json:"subject"`
+	Error   string `json:"error,omitempty"`
+}
+
+// publishDelivery announces the outcome of delivering msg: sent when no
+// recipient failed, failed otherwise or when the message could not be sent
+func (s *MailServiceImpl) publishDelivery(msg *entities.MailMessage, report *entities.DeliveryReport, err error) {
+	event := mailEvent{DeliveryReport: report, Subject: msg.Subject}
+	switch {
+	case err != nil:
+		event.Error = err.Error()
+	case report.Failed > 0:
+		event.Error = reportError(report).Error()
+	default:
+		publish(s.events, entities.EventMailSent, msg.TenantID, event)
+		return
+	}
+	publish(s.events, entities.EventMailFailed, msg.TenantID, event)
+}
+
+// entryID returns the id of an outbox entry, which may be nil
+func entryID(entry *entities.OutboxEntry) string {
+	if entry == nil {
+		return ""
+	}
+	return entry.ID
+}
+
+// deliver sends the parts of a message to their recipients, individually
+// from the fan-out threshold on
+func (s *MailServiceImpl) deliver(parts []*entities.MailMessage) *entities.DeliveryReport {
+	to := parts[0].To
+	if s.fanOutThreshold <= 0 || len(to) < s.fanOutThreshold {
+		report := &entities.DeliveryReport{}
+		err := s.sendParts(parts, to, nil)
+		for _, recipient := range to {
+			addDelivery(report, recipient, err)
+		}
+		return report
+	}
+
+	return s.fanOut(parts)
+}
+
+// deliverEncrypted sends every recipient with a key in keys a copy of the
+// message parts with their attachments encrypted to that key, and the others
+// the parts as they are
+func (s *MailServiceImpl) deliverEncrypted(parts []*entities.MailMessage, keys map[string]*openpgp.Entity) *entities.DeliveryReport {
+	var plain []string
+	for _, recipient := range parts[0].To {
+		if keys[recipient] == nil {
+			plain = append(plain, recipient)
+		}
+	}
+
+	report := &entities.DeliveryReport{}
+	if len(plain) > 0 {
+		rest := make([]*entities.MailMessage, len(parts))
+		for i, part := range parts {
+			copied := *part
+			copied.To = plain
+			rest[i] = &copied
+		}
+		report = s.deliver(rest)
+	}
+
+	for _, recipient := range parts[0].To {
+		key := keys[recipient]
+		if key == nil {
+			continue
+		}
+
+		err := s.sendParts(parts, []string{recipient}, key)
+		addDelivery(report, recipient, err)
+	}
+
+	return report
+}
+
+// sendParts sends the parts of a message to recipients in order, with their
+// attachments encrypted to key when it is set. It stops at the first
+// failure, as the remaining volumes are of no use without it.
+func (s *MailServiceImpl) sendParts(parts []*entities.MailMessage, to []string, key *openpgp.Entity) error {
+	for _, part := range parts {
+		msg := *part
+		msg.To = to
+		if key != nil {
+			attachments, err := encryptAttachments(part.Attachments, key)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrMailSendFailed, err)
+			}
+			msg.Attachments = attachments
+		}
+		if err := s.repo.SendMessage(&msg); err != nil {
+			return fmt.Errorf("%w: %w", ErrMailSendFailed, err)
+		}
+	}
+	return nil
+}
+
+// prepareMessage validates the message and fills in the default subject and body
+func (s *MailServiceImpl) prepareMessage(msg *entities.MailMessage) error {
+	if s.disabled {
+		return ErrMailDisabled
+	}
+	if msg == nil {
+		return fmt.Errorf("%w: message is nil", ErrInvalidFile)
+	}
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	for _, attachment := range msg.Attachments {
+		if err := s.validateFile(attachment.File); err != nil {
+			return err
+		}
+		if attachment.Inline {
+			if !strings.HasPrefix(attachment.File.MIMEType, "image/") {
+				return fmt.Errorf("%w: %s", ErrInvalidInlineType, attachment.File.MIMEType)
+			}
+			continue
+		}
+		if err := s.ValidateFileType(attachment.File.MIMEType); err != nil {
+			return err
+		}
+	}
+
+	if s.mx != nil {
+		if err := s.mx.CheckRecipients(msg.To); err != nil {
+			return err
+		}
+	}
+
+	if msg.Subject == "" || msg.Text == "" && msg.HTML == "" {
+		data := templateData(msg)
+		var err error
+		if msg.Subject == "" {
+			if msg.Subject, err = renderDefault(s.subject, data); err != nil {
+				return err
+			}
+		}
+		if msg.Text == "" && msg.HTML == "" {
+			if msg.Text, err = renderDefault(s.body, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AttachmentZip returns how to zip the attachments of a message, or nil to
+// send them as they are. zip and encrypt default to the configuration when
+// nil, and asking for encryption implies zipping. An encrypted archive gets
+// a generated password, which the caller must pass on to the recipients
+// apart from the message.
+func (s *MailServiceImpl) AttachmentZip(zip, encrypt *bool) (*entities.AttachmentZip, error) {
+	enabled, encrypted := s.zip.Enabled, s.zip.Encrypt
+	if encrypt != nil {
+		encrypted = *encrypt
+		enabled = enabled || encrypted
+	}
+	if zip != nil {
+		enabled = *zip
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	if s.archives == nil {
+		return nil, ErrZipUnavailable
+	}
+
+	options := &entities.AttachmentZip{}
+	if encrypted {
+		if !s.encryption {
+			return nil, ErrEncryptionDisabled
+		}
+		password, err := newZipPassword()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate zip password: %w", err)
+		}
+		options.Password = password
+	}
+
+	return options, nil
+}
+
+// SealZip seals the password of zip into it, as messages are stored without
+// the password itself. A zip without a password, or already sealed, is left
+// unchanged.
+func (s *MailServiceImpl) SealZip(ctx context.Context, zip *entities.AttachmentZip) error {
+	if zip == nil || zip.Password == "" || zip.SealedPassword != nil {
+		return nil
+	}
+
+	sealed, err := s.secrets.Seal(ctx, zip.Password)
+	if err != nil {
+		return fmt.Errorf("failed to seal zip password: %w", err)
+	}
+	zip.SealedPassword = sealed
+
+	return nil
+}
+
+// openZip restores the password of a zip sealed by SealZip
+func (s *MailServiceImpl) openZip(zip *entities.AttachmentZip) error {
+	if zip == nil || zip.Password != "" || zip.SealedPassword == nil {
+		return nil
+	}
+
+	password, err := s.secrets.Open(context.Background(), zip.SealedPassword)
+	if err != nil {
+		return fmt.Errorf("%w: failed to open zip password: %v", ErrMailSendFailed, err)
+	}
+	zip.Password = password
+
+	return nil
+}
+
+// newZipPassword returns a random password for an encrypted zip archive
+func newZipPassword() (string, error) {
+	b := make([]byte, 15)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// zipAttachments replaces the regular attachments of msg with a zip archive
+// of them, named after the attachment when there is a single one. Inline
+// attachments are kept, as the HTML body displays them.
+func (s *MailServiceImpl) zipAttachments(msg *entities.MailMessage) error {
+	if s.archives == nil {
+		return ErrZipUnavailable
+	}
+
+	var files []*entities.FileData
+	inline := make([]*entities.Attachment, 0, len(msg.Attachments))
+	for _, attachment := range msg.Attachments {
+		if attachment.Inline {
+			inline = append(inline, attachment)
+			continue
+		}
+		files = append(files, attachment.File)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	var (
+		buf *bytes.Buffer
+		err error
 	)
+	if msg.Zip.Password != "" {
+		buf, err = s.archives.CreateEncryptedZipArchive(files, msg.Zip.Password, nil)
+	} else {
+		buf, err = s.archives.CreateZipArchive(files, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to zip attachments: %w", err)
+	}
+
+	msg.Attachments = append([]*entities.Attachment{{File: &entities.FileData{
+		Name:     zipName(files),
+		Content:  buf.Bytes(),
+		MIMEType: "application/zip",
+	}}}, inline...)
+
+	return nil
+}
+
+// zipName returns the name of a zip archive of files, which is named after
+// the file when there is a single one
+func zipName(files []*entities.FileData) string {
+	if len(files) == 1 {
+		return strings.TrimSuffix(files[0].Name, path.Ext(files[0].Name)) + ".zip"
+	}
+	return "attachments.zip"
+}
+
+// splitMessage returns the parts msg is sent as. Regular attachments above
+// the size limit are zipped together, unless msg.Zip already did, and an
+// archive still above it is split into numbered volumes of at most the
+// limit. The first part is msg with the first volume in place of the
+// oversized attachments, and each further part carries the next volume.
+// Every part explains how to reassemble the archive.
+func (s *MailServiceImpl) splitMessage(msg *entities.MailMessage) ([]*entities.MailMessage, error) {
+	if s.maxAttachment <= 0 {
+		return []*entities.MailMessage{msg}, nil
+	}
+
+	var oversized []*entities.FileData
+	kept := make([]*entities.Attachment, 0, len(msg.Attachments))
+	for _, attachment := range msg.Attachments {
+		if !attachment.Inline && attachment.File.Size() > s.maxAttachment {
+			oversized = append(oversized, attachment.File)
+			continue
+		}
+		kept = append(kept, attachment)
+	}
+	if len(oversized) == 0 {
+		return []*entities.MailMessage{msg}, nil
+	}
+
+	// Attachments zipped by msg.Zip are a single archive already
+	archive := oversized[0]
+	if msg.Zip == nil {
+		if s.archives == nil {
+			return nil, ErrZipUnavailable
+		}
+		buf, err := s.archives.CreateZipArchive(oversized, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to zip attachments: %w", err)
+		}
+		archive = &entities.FileData{Name: zipName(oversized), Content: buf.Bytes()}
+	} else if err := archive.Load(); err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	content := archive.Content
+	if int64(len(content)) <= s.maxAttachment {
+		single := *msg
+		single.Attachments = append([]*entities.Attachment{{File: &entities.FileData{
+			Name:     archive.Name,
+			Content:  content,
+			MIMEType: "application/zip",
+		}}}, kept...)
+		return []*entities.MailMessage{&single}, nil
+	}
+	count := int((int64(len(content)) + s.maxAttachment - 1) / s.maxAttachment)
+	notice := volumeNotice(archive.Name, count)
+
+	parts := make([]*entities.MailMessage, count)
+	for i := range count {
+		volume := &entities.Attachment{File: &entities.FileData{
+			Name:     fmt.Sprintf("%s.%03d", archive.Name, i+1),
+			Content:  content[int64(i)*s.maxAttachment : min(int64(i+1)*s.maxAttachment, int64(len(content)))],
+			MIMEType: "application/octet-stream",
+		}}
+
+		part := &entities.MailMessage{
+			From:    msg.From,
+			To:      msg.To,
+			Subject: fmt.Sprintf("%s (part %d of %d)", msg.Subject, i+1, count),
+			Text:    notice,
+		}
+		if i == 0 {
+			part.Text = joinNotice(msg.Text, notice)
+			if msg.HTML != "" {
+				part.HTML = msg.HTML + "<p>" + html.EscapeString(notice) + "</p>"
+			}
+			part.Attachments = append([]*entities.Attachment{volume}, kept...)
+		} else {
+			part.Attachments = []*entities.Attachment{volume}
+		}
+		parts[i] = part
+	}
+
+	return parts, nil
+}
+
+// volumeNotice explains how to reassemble an archive split into count volumes
+func volumeNotice(name string, count int) string {
+	return fmt.Sprintf("The attachment %[1]s was split into %[2]d volumes, %[1]s.001 to %[1]s.%03[2]d, "+
+		"sent in %[2]d separate messages. Save every volume to the same folder and join them in order, "+
+		"for example with \"cat %[1]s.0* > %[1]s\", or open %[1]s.001 with 7-Zip.", name, count)
+}
+
+// joinNotice appends notice to a plain text body, which may be empty when
+// the message only has an HTML body
+func joinNotice(text, notice string) string {
+	if text == "" {
+		return notice
+	}
+	return text + "\n\n" + notice
+}
+
+// fanOut sends an individual copy of the message parts to every recipient
+func (s *MailServiceImpl) fanOut(parts []*entities.MailMessage) *entities.DeliveryReport {
+	to := parts[0].To
+	errs := make([]error, len(to))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(s.fanOutWorkers, len(to)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = s.sendParts(parts, []string{to[i]}, nil)
+			}
+		}()
+	}
+
+	for i := range to {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &entities.DeliveryReport{}
+	for i, recipient := range to {
+		addDelivery(report, recipient, errs[i])
+	}
+	return report
+}
+
+// recordDelivery counts the outcome of delivering a message to recipient
+func recordDelivery(recipient string, err error) {
+	if err == nil {
+		metrics.MailSent(recipient)
+		return
+	}
+	metrics.MailBounced(mailFailureReason(err), recipient)
+}
+
+// addDelivery records the outcome for a recipient in report and the mail
+// metrics. Failures the server may get over, such as 4xx replies and
+// connection errors, defer the recipient; others reject it.
+func addDelivery(report *entities.DeliveryReport, recipient string, err error) {
+	status := entities.RecipientAccepted
+	if err != nil {
+		status = entities.RecipientRejected
+		switch mailFailureReason(err) {
+		case metrics.Failure4xx, metrics.FailureConnection, metrics.FailureAuth:
+			status = entities.RecipientDeferred
+		}
+	}
+	report.AddStatus(recipient, status, err)
+	recordDelivery(recipient, err)
+}
+
+// mailFailureReason classifies a delivery error for the mail metrics,
+// counting rejected messages as validation failures
+func mailFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrNoRecipients), errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrInvalidFile),
+		errors.Is(err, ErrInvalidInlineType), errors.Is(err, ErrInvalidMimeType), errors.Is(err, ErrFileBlocked),
+		errors.Is(err, ErrFileRejected), errors.Is(err, ErrInvalidPGPKey), errors.Is(err, ErrNoPGPKey):
+		return metrics.FailureValidation
+	}
+	return repositories.SMTPFailureReason(err)
 }
 
 // SendMailWithTemplate sends a file with custom subject and body template
 func (s *MailServiceImpl) SendMailWithTemplate(to []string, filename, mimeType string, fileContent []byte, subject, bodyTemplate string) error {
+	if s.disabled {
+		return ErrMailDisabled
+	}
+
 	// Validate input parameters
 	if err := s.validateInput(to, filename, mimeType, fileContent); err != nil {
 		return err
@@ -122,3 +1021,128 @@ func (s *MailServiceImpl) SendMailWithTemplate(to []string, filename, mimeType s
 
 	return nil
 }
+
+// SendBatch sends every batch item concurrently and reports per-item results,
+// so a single failing item does not affect the rest of the batch
+func (s *MailServiceImpl) SendBatch(items []entities.MailBatchItem) []entities.MailBatchResult {
+	results := make([]entities.MailBatchResult, len(items))
+	sem := make(chan struct{}, maxBatchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.sendBatchItem(item)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// sendBatchItem sends a single batch item and converts the outcome into a result
+func (s *MailServiceImpl) sendBatchItem(item entities.MailBatchItem) entities.MailBatchResult {
+	result := entities.MailBatchResult{
+		Index:      item.Index,
+		Recipients: item.Recipients,
+	}
+
+	if item.File == nil {
+		result.Error = fmt.Sprintf("%v: file is missing", ErrInvalidFile)
+		return result
+	}
+	result.File = item.File.Name
+
+	zip, err := s.AttachmentZip(nil, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if zip != nil {
+		result.ZipPassword = zip.Password
+	}
+
+	start := time.Now()
+	report, err := s.DeliverMessage(&entities.MailMessage{
+		From:        item.From,
+		To:          item.Recipients,
+		Subject:     item.Subject,
+		Attachments: []*entities.Attachment{{File: item.File}},
+		Zip:         zip,
+		TenantID:    item.TenantID,
+	})
+	result.Duration = time.Since(start)
+	if err == nil {
+		result.ID = report.ID
+		for _, recipient := range report.Recipients {
+			if recipient.Suppressed {
+				result.Suppressed = append(result.Suppressed, recipient.Recipient)
+			}
+		}
+		err = reportError(report)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// testMailAttachment is a minimal valid single page PDF attached to test messages
+var testMailAttachment = []byte("%PDF-1.1\n" +
+	"1 0 obj<</Type/Catalog/Pages 2 0 R>>endobj\n" +
+	"2 0 obj<</Type/Pages/Kids[3 0 R]/Count 1>>endobj\n" +
+	"3 0 obj<</Type/Page/Parent 2 0 R/MediaBox[0 0 72 72]>>endobj\n" +
+	"trailer<</Root 1 0 R>>\n" +
+	"%%EOF\n")
+
+// SendTestMail sends a canned message, optionally with a tiny PDF attachment,
+// to a single address using the live configuration. Delivery failures are
+// reported in the result together with the transcript; the returned error is
+// only set when the request itself is invalid.
+func (s *MailServiceImpl) SendTestMail(to string, withAttachment bool) (*entities.TestMailResult, error) {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return nil, ErrNoRecipients
+	}
+
+	msg := &entities.MailMessage{
+		To:      []string{to},
+		Subject: testMailSubject,
+		Text:    testMailBody,
+	}
+	if withAttachment {
+		msg.Attachments = []*entities.Attachment{{File: &entities.FileData{
+			Name:     testMailFilename,
+			Content:  testMailAttachment,
+			MIMEType: "application/pdf",
+		}}}
+	}
+
+	if err := s.prepareMessage(msg); err != nil {
+		return nil, err
+	}
+
+	transcript, err := s.repo.SendMessageWithTranscript(msg)
+	recordDelivery(to, err)
+	if errors.Is(err, repositories.ErrInvalidRecipients) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEmail, to)
+	}
+
+	result := &entities.TestMailResult{
+		Recipient:  to,
+		Success:    err == nil,
+		Transcript: transcript,
+		SentAt:     time.Now(),
+	}
+	if err != nil {
+		result.Error = fmt.Errorf("%w: %v", ErrMailSendFailed, err).Error()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+func TestZipPasswordNotStored(t *testing.T) {
+	const password = "SECRETZIPPASSWORD234567ABCDEF"
+
+	secrets, err := NewSecretSealer(nil)
+	require.NoError(t, err)
+	outbox := repositories.NewMemoryOutboxRepository()
+	service := &MailServiceImpl{outbox: outbox, secrets: secrets}
+
+	newMessage := func() *entities.MailMessage {
+		return &entities.MailMessage{
+			To: []string{"bob@example.com"},
+			Attachments: []*entities.Attachment{{File: &entities.FileData{
+				Name:     "report.pdf",
+				Content:  []byte("%PDF-1.4"),
+				MIMEType: "application/pdf",
+			}}},
+			Zip: &entities.AttachmentZip{Password: password},
+		}
+	}
+
+	// opened checks that data carries the zip password only sealed
+	opened := func(t *testing.T, data []byte, zip func() *entities.AttachmentZip) {
+		assert.NotContains(t, string(data), password)
+		require.NotNil(t, zip())
+		assert.Empty(t, zip().Password)
+		require.NoError(t, service.openZip(zip()))
+		assert.Equal(t, password, zip().Password)
+	}
+
+	t.Run("Message", func(t *testing.T) {
+		msg := newMessage()
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), password)
+
+		require.NoError(t, service.SealZip(context.Background(), msg.Zip))
+		data, err = json.Marshal(msg)
+		require.NoError(t, err)
+		var decoded entities.MailMessage
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		opened(t, data, func() *entities.AttachmentZip { return decoded.Zip })
+	})
+
+	t.Run("Outbox entry", func(t *testing.T) {
+		entry, err := service.storeMessage(newMessage())
+		require.NoError(t, err)
+		stored, err := outbox.Get(entry.ID)
+		require.NoError(t, err)
+		var decoded entities.MailMessage
+		require.NoError(t, json.Unmarshal(stored.Message, &decoded))
+		opened(t, stored.Message, func() *entities.AttachmentZip { return decoded.Zip })
+	})
+
+	t.Run("Scheduled message", func(t *testing.T) {
+		queue := repositories.NewMemoryQueue()
+		scheduler, err := NewOutbox(service, queue, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		require.NoError(t, err)
+		msg := newMessage()
+		_, err = scheduler.Schedule(&entities.OutboxMessage{
+			To:     msg.To,
+			File:   msg.Attachments[0].File,
+			Zip:    msg.Zip,
+			SendAt: time.Now().Add(100 * time.Millisecond),
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		data, err := queue.Pop(ctx, outboxQueueName)
+		require.NoError(t, err)
+		var item outboxItem
+		require.NoError(t, json.Unmarshal(data, &item))
+		opened(t, data, func() *entities.AttachmentZip { return item.Zip })
+	})
+
+	t.Run("Batch result", func(t *testing.T) {
+		data, err := json.Marshal(entities.MailBatchResult{ZipPassword: password})
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), password)
+	})
+}
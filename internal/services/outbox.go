@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrMailServiceNil = errors.New("mail service is nil")
+	ErrSendAtInPast   = errors.New("send time must be in the future")
+)
+
+// outboxQueueName is the name of the queue holding scheduled messages
+const outboxQueueName = "outbox"
+
+// outboxRecoveryInterval is how often messages left sending are looked for
+const outboxRecoveryInterval = time.Minute
+
+// outboxItem is the queued form of a scheduled message. Unlike
+// OutboxMessage it carries the body and attachment, which are never part of
+// API responses.
+type outboxItem struct {
+	ID        string                  `json:"id"`
+	From      string                  `json:"from,omitempty"`
+	To        []string                `json:"to"`
+	Subject   string                  `json:"subject"`
+	Body      string                  `json:"body"`
+	File      entities.FileData       `json:"file"`
+	PGPKeys   [][]byte                `json:"pgp_keys,omitempty"`
+	Zip       *entities.AttachmentZip `json:"zip,omitempty"`
+	TenantID  string                  `json:"tenant_id,omitempty"`
+	SendAt    time.Time               `json:"send_at"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+// Outbox holds scheduled messages and delivers them once their send time is
+// reached. It also resends the messages kept by the mail service whose
+// delivery was interrupted, and removes them once they expire.
+type Outbox struct {
+	service MailService
+	queue   repositories.Queue
+	entries repositories.OutboxRepository
+	cfg     config.MailOutboxConfig
+	log     *slog.Logger
+	now     func() time.Time
+}
+
+// NewOutbox creates a new Outbox that delivers messages through the given
+// mail service. queue is optional and defaults to a queue local to the process.
+// entries is optional; without it interrupted messages are not resent.
+func NewOutbox(svc MailService, queue repositories.Queue, entries repositories.OutboxRepository, cfg *config.MailOutboxConfig, log *slog.Logger) (*Outbox, error) {
+	if svc == nil {
+		return nil, ErrMailServiceNil
+	}
+
+	if queue == nil {
+		queue = repositories.NewMemoryQueue()
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	o := &Outbox{
+		service: svc,
+		queue:   queue,
+		entries: entries,
+		log:     log,
+		now:     time.Now,
+	}
+	if cfg != nil {
+		o.cfg = *cfg
+	}
+
+	return o, nil
+}
+
+// Schedule validates a message and queues it for delivery at its send time
+func (o *Outbox) Schedule(msg *entities.OutboxMessage) (*entities.OutboxMessage, error) {
+	const op = "Outbox.Schedule"
+
+	if err := msg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.service.ValidateFileType(msg.File.MIMEType); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := o.now()
+	if !msg.SendAt.After(now) {
+		return nil, fmt.Errorf("%s: %w", op, ErrSendAtInPast)
+	}
+
+	// A missing subject or body is rendered from the defaults when the
+	// message is sent
+	msg.ID = utils.NewID()
+	msg.CreatedAt = now
+
+	if err := o.service.SealZip(context.Background(), msg.Zip); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	item, err := json.Marshal(outboxItem{
+		ID:        msg.ID,
+		From:      msg.From,
+		To:        msg.To,
+		Subject:   msg.Subject,
+		Body:      msg.Body,
+		File:      *msg.File,
+		PGPKeys:   msg.PGPKeys,
+		Zip:       msg.Zip,
+		TenantID:  msg.TenantID,
+		SendAt:    msg.SendAt,
+		CreatedAt: msg.CreatedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.queue.Push(context.Background(), outboxQueueName, item, msg.SendAt); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	metrics.MailQueued("outbox")
+	o.log.Info("message scheduled",
+		"op", op,
+		"id", msg.ID,
+		"sendAt", msg.SendAt,
+		"recipients", len(msg.To),
+	)
+
+	return msg, nil
+}
+
+// Run delivers messages as they become due until the context is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	const op = "Outbox.Run"
+
+	if o.entries != nil {
+		go o.maintain(ctx)
+	}
+
+	for {
+		data, err := o.queue.Pop(ctx, outboxQueueName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			o.log.Error("failed to pop scheduled message", "op", op, "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var item outboxItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			o.log.Error("failed to decode scheduled message", "op", op, "error", err)
+			continue
+		}
+
+		o.deliver(&item)
+	}
+}
+
+// deliver sends a single scheduled message, as a sequence of messages when
+// its attachment is split into volumes
+func (o *Outbox) deliver(msg *outboxItem) {
+	const op = "Outbox.deliver"
+
+	start := time.Now()
+	report, err := o.service.DeliverMessage(&entities.MailMessage{
+		From:        msg.From,
+		To:          msg.To,
+		Subject:     msg.Subject,
+		Text:        msg.Body,
+		Attachments: []*entities.Attachment{{File: &msg.File}},
+		PGPKeys:     msg.PGPKeys,
+		Zip:         msg.Zip,
+		TenantID:    msg.TenantID,
+	})
+	if err == nil {
+		err = reportError(report)
+	}
+	metrics.ObserveMailSend("outbox", time.Since(start), err)
+	if err != nil {
+		o.log.Error("failed to deliver scheduled message",
+			"op", op,
+			"id", msg.ID,
+			"error", err,
+		)
+		return
+	}
+
+	// Attachments split into volumes are sent as several messages, which
+	// are a single delivery of the scheduled message
+	o.log.Info("scheduled message delivered",
+		"op", op,
+		"id", msg.ID,
+		"recipients", len(msg.To),
+		"parts", max(report.Parts, 1),
+	)
+}
+
+// maintain resends interrupted messages and removes expired ones every
+// recovery interval until the context is cancelled. The first pass runs
+// right away, to resume the deliveries a crash interrupted.
+func (o *Outbox) maintain(ctx context.Context) {
+	ticker := time.NewTicker(outboxRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		o.resendStale()
+		o.purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resendStale sends the messages left sending for longer than the configured
+// time again
+func (o *Outbox) resendStale() {
+	const op = "Outbox.resendStale"
+
+	if o.cfg.StaleAfter <= 0 {
+		return
+	}
+
+	ids, err := o.entries.Stale(o.now().Add(-o.cfg.StaleAfter))
+	if err != nil {
+		o.log.Error("failed to list interrupted messages", "op", op, "error", err)
+		return
+	}
+
+	for _, id := range ids {
+		report, err := o.service.Resend(id)
+		switch {
+		case errors.Is(err, ErrOutboxEntrySending), errors.Is(err, ErrOutboxEntryNotFound):
+			// Another instance resent or removed it first
+		case err != nil:
+			o.log.Error("failed to resend interrupted message", "op", op, "id", id, "error", err)
+		default:
+			o.log.Info("interrupted message resent",
+				"op", op,
+				"id", id,
+				"sent", report.Sent,
+				"failed", report.Failed,
+			)
+		}
+	}
+}
+
+// purge removes the messages kept for longer than the configured retention
+func (o *Outbox) purge() {
+	const op = "Outbox.purge"
+
+	if o.cfg.Retention <= 0 {
+		return
+	}
+
+	removed, err := o.entries.Delete(o.now().Add(-o.cfg.Retention))
+	if err != nil {
+		o.log.Error("failed to remove expired outbox messages", "op", op, "error", err)
+		return
+	}
+	if removed > 0 {
+		o.log.Info("expired outbox messages removed", "op", op, "count", removed)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// commonPasswords are rejected when the policy denies common passwords
+var commonPasswords = map[string]struct{}{
+	"123456": {}, "12345678": {}, "123456789": {}, "1234567890": {}, "111111": {},
+	"000000": {}, "123123": {}, "654321": {}, "password": {}, "password1": {},
+	"password123": {}, "passw0rd": {}, "qwerty": {}, "qwerty123": {}, "qwertyuiop": {},
+	"1q2w3e4r": {}, "abc123": {}, "abcd1234": {}, "iloveyou": {}, "letmein": {},
+	"welcome": {}, "welcome1": {}, "admin": {}, "admin123": {}, "monkey": {},
+	"dragon": {}, "football": {}, "baseball": {}, "sunshine": {}, "princess": {},
+	"trustno1": {}, "secret": {}, "changeme": {}, "master": {}, "zaq12wsx": {},
+	"doozip": {}, "doozip123": {},
+}
+
+// PasswordPolicyError lists every rule a password violated
+type PasswordPolicyError struct {
+	Violations []entities.PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrWeakPassword, strings.Join(messages, "; "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// PasswordValidator checks archive encryption passwords against a policy
+type PasswordValidator struct {
+	policy config.PasswordPolicy
+}
+
+// NewPasswordValidator creates a validator for the given policy
+func NewPasswordValidator(policy config.PasswordPolicy) *PasswordValidator {
+	return &PasswordValidator{policy: policy}
+}
+
+// Validate returns a *PasswordPolicyError listing every violated rule, or nil
+func (v *PasswordValidator) Validate(password string) error {
+	var violations []entities.PasswordViolation
+	add := func(rule, message string) {
+		violations = append(violations, entities.PasswordViolation{Rule: rule, Message: message})
+	}
+
+	if n := len([]rune(password)); n < v.policy.MinLength {
+		add("min_length", fmt.Sprintf("password must be at least %d characters long", v.policy.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if v.policy.RequireUpper && !upper {
+		add("require_upper", "password must contain an uppercase letter")
+	}
+	if v.policy.RequireLower && !lower {
+		add("require_lower", "password must contain a lowercase letter")
+	}
+	if v.policy.RequireDigit && !digit {
+		add("require_digit", "password must contain a digit")
+	}
+	if v.policy.RequireSymbol && !symbol {
+		add("require_symbol", "password must contain a symbol")
+	}
+
+	if v.policy.DenyCommon {
+		if _, common := commonPasswords[strings.ToLower(password)]; common {
+			add("deny_common", "password is too common")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
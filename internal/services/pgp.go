@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var (
+	ErrInvalidPGPKey = errors.New("invalid pgp public key")
+	ErrNoPGPKey      = errors.New("no pgp public key for recipient")
+)
+
+// pgpMIMEType is the type of encrypted attachments, which are OpenPGP
+// messages named after the original file with a .pgp suffix
+const pgpMIMEType = "application/octet-stream"
+
+// PGPKeyring holds the configured PGP public keys of mail recipients. A nil
+// keyring has no keys and does not require encryption.
+type PGPKeyring struct {
+	keys    map[string]*openpgp.Entity
+	require bool
+}
+
+// NewPGPKeyring reads the public key files of cfg
+func NewPGPKeyring(cfg *config.PGPConfig) (*PGPKeyring, error) {
+	keyring := &PGPKeyring{
+		keys:    make(map[string]*openpgp.Entity, len(cfg.Keys)),
+		require: cfg.Require,
+	}
+
+	for _, key := range cfg.Keys {
+		data, err := os.ReadFile(key.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pgp key of %s: %w", key.Address, err)
+		}
+		parsed, err := ParsePGPKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("pgp key of %s: %w", key.Address, err)
+		}
+		keyring.keys[strings.ToLower(key.Address)] = parsed[0]
+	}
+
+	return keyring, nil
+}
+
+// ParsePGPKeys parses armored or binary PGP public keys, each of which must
+// be usable for encryption
+func ParsePGPKeys(data []byte) (openpgp.EntityList, error) {
+	var (
+		keys openpgp.EntityList
+		err  error
+	)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPGPKey, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys found", ErrInvalidPGPKey)
+	}
+
+	// Encrypting to a key fails only once mail is sent if it has no usable
+	// encryption subkey, such as a signing key or an expired one
+	for _, key := range keys {
+		w, err := openpgp.Encrypt(io.Discard, []*openpgp.Entity{key}, nil, nil, nil)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPGPKey, err)
+		}
+	}
+
+	return keys, nil
+}
+
+// recipientKeys returns the key of every recipient of msg that has one. Keys
+// uploaded with the message are matched by the addresses of their
+// identities and take precedence over configured ones.
+func (k *PGPKeyring) recipientKeys(msg *entities.MailMessage) (map[string]*openpgp.Entity, error) {
+	uploaded := make(map[string]*openpgp.Entity)
+	for _, data := range msg.PGPKeys {
+		keys, err := ParsePGPKeys(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			for _, identity := range key.Identities {
+				if identity.UserId != nil && identity.UserId.Email != "" {
+					uploaded[strings.ToLower(identity.UserId.Email)] = key
+				}
+			}
+		}
+	}
+
+	keys := make(map[string]*openpgp.Entity)
+	var missing []string
+	for _, recipient := range msg.To {
+		address := recipientAddress(recipient)
+		key, ok := uploaded[address]
+		if !ok && k != nil {
+			key, ok = k.keys[address]
+		}
+		switch {
+		case ok:
+			keys[recipient] = key
+		case k != nil && k.require:
+			missing = append(missing, recipient)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPGPKey, strings.Join(missing, ", "))
+	}
+
+	return keys, nil
+}
+
+// recipientAddress returns the lower case address of a recipient, which may
+// include a display name
+func recipientAddress(recipient string) string {
+	if addr, err := mail.ParseAddress(recipient); err == nil {
+		recipient = addr.Address
+	}
+	return strings.ToLower(strings.TrimSpace(recipient))
+}
+
+// encryptAttachments returns the attachments with the content of regular
+// ones encrypted to key. Inline attachments are kept, as the HTML body
+// displays them.
+func encryptAttachments(attachments []*entities.Attachment, key *openpgp.Entity) ([]*entities.Attachment, error) {
+	encrypted := make([]*entities.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		if attachment.Inline {
+			encrypted[i] = attachment
+			continue
+		}
+
+		file, err := encryptFile(attachment.File, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", attachment.File.Name, err)
+		}
+		copied := *attachment
+		copied.File = file
+		encrypted[i] = &copied
+	}
+	return encrypted, nil
+}
+
+// encryptFile returns file encrypted to key as an OpenPGP message
+func encryptFile(file *entities.FileData, key *openpgp.Entity) (*entities.FileData, error) {
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, []*openpgp.Entity{key}, nil, &openpgp.FileHints{IsBinary: true, FileName: file.Name}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPGPKey, err)
+	}
+	if _, err := io.Copy(w, file.Open()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &entities.FileData{
+		Name:     file.Name + ".pgp",
+		Content:  buf.Bytes(),
+		MIMEType: pgpMIMEType,
+	}, nil
+}
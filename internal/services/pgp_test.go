@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+func TestPGPEncryptFile(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	require.NoError(t, err)
+
+	// Upload the armored public key, as a mail request would
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	msg := &entities.MailMessage{
+		To:      []string{"Alice <ALICE@example.com>", "bob@example.com"},
+		PGPKeys: [][]byte{armored.Bytes()},
+	}
+	var keyring *PGPKeyring
+	keys, err := keyring.recipientKeys(msg)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	key := keys["Alice <ALICE@example.com>"]
+	require.NotNil(t, key)
+
+	content := []byte("quarterly report")
+	encrypted, err := encryptFile(&entities.FileData{Name: "report.txt", Content: content}, key)
+	require.NoError(t, err)
+	assert.Equal(t, "report.txt.pgp", encrypted.Name)
+	assert.Equal(t, pgpMIMEType, encrypted.MIMEType)
+	assert.NotContains(t, string(encrypted.Content), string(content))
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(encrypted.Content), openpgp.EntityList{entity}, nil, nil)
+	require.NoError(t, err)
+	decrypted, err := io.ReadAll(md.UnverifiedBody)
+	require.NoError(t, err)
+	assert.Equal(t, content, decrypted)
+	assert.Equal(t, "report.txt", md.LiteralData.FileName)
+}
+
+func TestPGPRequiredKey(t *testing.T) {
+	keyring := &PGPKeyring{keys: map[string]*openpgp.Entity{}, require: true}
+	_, err := keyring.recipientKeys(&entities.MailMessage{To: []string{"bob@example.com"}})
+	assert.ErrorIs(t, err, ErrNoPGPKey)
+
+	_, err = ParsePGPKeys([]byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nnot a key\n"))
+	assert.ErrorIs(t, err, ErrInvalidPGPKey)
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var (
+	ErrEntryProcessing   = errors.New("failed to process file")
+	ErrUnknownProcessor  = errors.New("unknown entry processor")
+	ErrInvalidImageBytes = errors.New("invalid image data")
+)
+
+// EntryProcessor transforms a file as it is added to an archive, such as by
+// stripping metadata or adding a watermark. It may replace the content, name
+// or MIME type of the file. Uploads are streamed and can be read only once,
+// so a processor replacing the content reads it with Load or wraps Reader.
+type EntryProcessor interface {
+	ProcessEntry(file *entities.FileData) error
+}
+
+// EntryProcessorFunc adapts a function to an EntryProcessor
+type EntryProcessorFunc func(file *entities.FileData) error
+
+// ProcessEntry calls f
+func (f EntryProcessorFunc) ProcessEntry(file *entities.FileData) error {
+	return f(file)
+}
+
+// EntryPipeline runs its processors in order on every file added to an
+// archive. Errors are wrapped in ErrEntryProcessing.
+type EntryPipeline []EntryProcessor
+
+// NewEntryPipeline returns the pipeline of the processors named, in order,
+// looked up in available
+func NewEntryPipeline(names []string, available map[string]EntryProcessor) (EntryPipeline, error) {
+	pipeline := make(EntryPipeline, 0, len(names))
+	for _, name := range names {
+		processor, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProcessor, name)
+		}
+		pipeline = append(pipeline, processor)
+	}
+	return pipeline, nil
+}
+
+// BuiltinEntryProcessors returns the processors available by name in
+// archive.processors without registering them
+func BuiltinEntryProcessors() map[string]EntryProcessor {
+	return map[string]EntryProcessor{
+		"strip_exif": MetadataStripper{},
+	}
+}
+
+// ProcessEntry runs every processor of the pipeline
+func (p EntryPipeline) ProcessEntry(file *entities.FileData) error {
+	for _, processor := range p {
+		if err := processor.ProcessEntry(file); err != nil {
+			return fmt.Errorf("%w %s: %v", ErrEntryProcessing, file.Name, err)
+		}
+	}
+	return nil
+}
+
+// MetadataStripper removes EXIF, XMP and text metadata, which can reveal
+// where and with what a picture was taken, from JPEG and PNG images. Other
+// files are left as they are. Images are read into memory to be rewritten.
+type MetadataStripper struct{}
+
+// ProcessEntry implements EntryProcessor
+func (MetadataStripper) ProcessEntry(file *entities.FileData) error {
+	mimeType, _, _ := strings.Cut(file.MIMEType, ";")
+
+	var strip func([]byte) ([]byte, error)
+	switch strings.TrimSpace(mimeType) {
+	case "image/jpeg":
+		strip = stripJPEGMetadata
+	case "image/png":
+		strip = stripPNGMetadata
+	default:
+		return nil
+	}
+
+	if err := file.Load(); err != nil {
+		return err
+	}
+	content, err := strip(file.Content)
+	if err != nil {
+		return err
+	}
+	file.Content = content
+
+	return nil
+}
+
+// stripJPEGMetadata drops the APP1 segments, which hold EXIF and XMP, of a
+// JPEG image. Everything from the start of the scan on is kept as is.
+func stripJPEGMetadata(content []byte) ([]byte, error) {
+	if len(content) < 4 || content[0] != 0xff || content[1] != 0xd8 {
+		return nil, fmt.Errorf("%w: not a JPEG image", ErrInvalidImageBytes)
+	}
+
+	stripped := make([]byte, 0, len(content))
+	stripped = append(stripped, content[:2]...)
+	for offset := 2; ; {
+		if offset+4 > len(content) || content[offset] != 0xff {
+			return nil, fmt.Errorf("%w: truncated JPEG segment", ErrInvalidImageBytes)
+		}
+		marker := content[offset+1]
+		// Start of scan: the compressed image data follows
+		if marker == 0xda {
+			return append(stripped, content[offset:]...), nil
+		}
+		// Fill bytes and markers without a length
+		if marker == 0xff {
+			offset++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			stripped = append(stripped, content[offset:offset+2]...)
+			offset += 2
+			continue
+		}
+
+		end := offset + 2 + (int(content[offset+2])<<8 | int(content[offset+3]))
+		if end > len(content) || end < offset+4 {
+			return nil, fmt.Errorf("%w: truncated JPEG segment", ErrInvalidImageBytes)
+		}
+		if marker != 0xe1 {
+			stripped = append(stripped, content[offset:end]...)
+		}
+		offset = end
+	}
+}
+
+// pngMetadataChunks are the PNG chunks dropped by stripPNGMetadata
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNGMetadata drops the EXIF, text and time chunks of a PNG image. The
+// remaining chunks are copied with their checksums, which cover only the
+// chunk itself.
+func stripPNGMetadata(content []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !strings.HasPrefix(string(content[:min(len(content), len(signature))]), signature) {
+		return nil, fmt.Errorf("%w: not a PNG image", ErrInvalidImageBytes)
+	}
+
+	stripped := make([]byte, 0, len(content))
+	stripped = append(stripped, signature...)
+	for offset := len(signature); offset < len(content); {
+		if offset+8 > len(content) {
+			return nil, fmt.Errorf("%w: truncated PNG chunk", ErrInvalidImageBytes)
+		}
+		length := int(content[offset])<<24 | int(content[offset+1])<<16 | int(content[offset+2])<<8 | int(content[offset+3])
+		chunkType := string(content[offset+4 : offset+8])
+		end := offset + 12 + length
+		if length < 0 || end > len(content) {
+			return nil, fmt.Errorf("%w: truncated PNG chunk", ErrInvalidImageBytes)
+		}
+		if !pngMetadataChunks[chunkType] {
+			stripped = append(stripped, content[offset:end]...)
+		}
+		offset = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return stripped, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// rateLimitSweepInterval is how often idle clients are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter limits the requests of each client to a sustained rate with
+// bursts. Limits are tracked per instance.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*clientBucket
+	swept   time.Time
+}
+
+// clientBucket holds the tokens left to a client
+type clientBucket struct {
+	tokens   float64
+	refilled time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing cfg.Rate requests per second
+// and bursts of cfg.Burst, which defaults to the rate rounded up
+func NewRateLimiter(cfg *config.RateLimitConfig) *RateLimiter {
+	burst := float64(cfg.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(cfg.Rate))
+	}
+
+	return &RateLimiter{
+		rate:    cfg.Rate,
+		burst:   burst,
+		now:     time.Now,
+		clients: make(map[string]*clientBucket),
+	}
+}
+
+// RateLimitStatus is the state of a client's limit once a request is
+// counted, as told to clients in RateLimit headers
+type RateLimitStatus struct {
+	// Limit is the number of requests allowed in a burst; zero when the
+	// requests are not limited
+	Limit int
+	// Remaining is the number of requests allowed right away
+	Remaining int
+	// Reset is how long until a whole burst is allowed again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, when none is
+	RetryAfter time.Duration
+}
+
+// bucketStatus returns the status of a token bucket holding tokens of burst,
+// refilled at rate tokens per second
+func bucketStatus(tokens, burst, rate float64) RateLimitStatus {
+	status := RateLimitStatus{
+		Limit:     int(burst),
+		Remaining: int(math.Floor(tokens)),
+	}
+	if rate > 0 {
+		status.Reset = time.Duration((burst - tokens) / rate * float64(time.Second))
+		if tokens < 1 {
+			status.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+		}
+	}
+	return status
+}
+
+// Allow takes a request of client from its limit, returning the status of
+// the limit either way
+func (l *RateLimiter) Allow(client string) (RateLimitStatus, error) {
+	const op = "RateLimiter.Allow"
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucket, ok := l.clients[client]
+	if !ok {
+		bucket = &clientBucket{tokens: l.burst, refilled: now}
+		l.clients[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.refilled).Seconds()*l.rate)
+	bucket.refilled = now
+
+	if bucket.tokens < 1 {
+		return bucketStatus(bucket.tokens, l.burst, l.rate), fmt.Errorf("%s: %w", op, ErrRateLimited)
+	}
+	bucket.tokens--
+
+	return bucketStatus(bucket.tokens, l.burst, l.rate), nil
+}
+
+// sweep forgets the clients whose bucket has refilled, which are in the
+// state of a new client, so the map does not grow with every address seen
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+
+	for client, bucket := range l.clients {
+		if bucket.tokens+now.Sub(bucket.refilled).Seconds()*l.rate >= l.burst {
+			delete(l.clients, client)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// maxMXCacheEntries bounds the number of domains whose MX verdict is cached
+const maxMXCacheEntries = 10000
+
+// MXChecker rejects recipients whose domain obviously cannot receive mail:
+// domains that don't exist, have neither MX nor address records, or publish
+// a null MX (RFC 7505). Lookups that fail otherwise, such as timeouts,
+// accept the recipient so an unreliable resolver never blocks mail.
+// Verdicts are cached per domain.
+type MXChecker struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	verdicts map[string]mxVerdict
+}
+
+// mxVerdict is the cached result of resolving a domain
+type mxVerdict struct {
+	deliverable bool
+	expires     time.Time
+}
+
+// NewMXChecker creates an MXChecker using the system resolver, or returns
+// nil when cfg doesn't ask for MX validation
+func NewMXChecker(cfg *config.MailRecipientValidationConfig) *MXChecker {
+	if cfg == nil || cfg.Level != "mx" {
+		return nil
+	}
+
+	return &MXChecker{
+		resolver: net.DefaultResolver,
+		timeout:  cfg.Timeout,
+		ttl:      cfg.CacheTTL,
+		now:      time.Now,
+		verdicts: make(map[string]mxVerdict),
+	}
+}
+
+// CheckRecipients returns an error wrapping ErrInvalidEmail for the first
+// recipient whose domain cannot receive mail. Addresses that are not valid
+// are left to the mail repository to reject.
+func (c *MXChecker) CheckRecipients(recipients []string) error {
+	checked := make(map[string]bool, len(recipients))
+	for _, recipient := range recipients {
+		at := strings.LastIndex(recipient, "@")
+		if at < 0 {
+			continue
+		}
+		domain, err := idna.Lookup.ToASCII(recipient[at+1:])
+		if err != nil || checked[domain] {
+			continue
+		}
+		checked[domain] = true
+
+		if !c.deliverable(domain) {
+			return fmt.Errorf("%w: %s: domain does not accept mail", ErrInvalidEmail, recipient)
+		}
+	}
+	return nil
+}
+
+// deliverable reports whether domain can receive mail, using the cached
+// verdict if it has not expired
+func (c *MXChecker) deliverable(domain string) bool {
+	now := c.now()
+
+	c.mu.Lock()
+	verdict, ok := c.verdicts[domain]
+	c.mu.Unlock()
+	if ok && now.Before(verdict.expires) {
+		return verdict.deliverable
+	}
+
+	deliverable, err := c.resolve(domain)
+	if err != nil {
+		return true
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if len(c.verdicts) >= maxMXCacheEntries {
+			for cached, v := range c.verdicts {
+				if !now.Before(v.expires) {
+					delete(c.verdicts, cached)
+				}
+			}
+			if len(c.verdicts) >= maxMXCacheEntries {
+				clear(c.verdicts)
+			}
+		}
+		c.verdicts[domain] = mxVerdict{deliverable: deliverable, expires: now.Add(c.ttl)}
+		c.mu.Unlock()
+	}
+
+	return deliverable
+}
+
+// resolve looks up the MX records of domain, falling back to its address
+// records as the implicit MX. The error is only set when the answer is not
+// conclusive.
+func (c *MXChecker) resolve(domain string) (bool, error) {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	records, err := c.resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		// A null MX is a single record with the root as host
+		nullMX := len(records) == 1 && strings.Trim(records[0].Host, ".") == ""
+		return !nullMX, nil
+	}
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(addrs) > 0, nil
+}
+
+// isNotFound reports whether a lookup failed because the name or its records
+// don't exist, rather than because the resolver could not answer
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
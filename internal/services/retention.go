@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+// defaultRetentionInterval is how often the cleanup runs when no interval is configured
+const defaultRetentionInterval = time.Hour
+
+// RetentionService removes stored archives and history entries once they are
+// older than the retention policy of the API key that created them, and the
+// audit trail once it is older than its own retention period
+type RetentionService struct {
+	archives repositories.ArchiveStoreRepository
+	history  repositories.HistoryRepository
+	audit    repositories.AuditRepository
+	cfg      config.RetentionConfig
+	log      *slog.Logger
+	now      func() time.Time
+}
+
+// NewRetentionService creates a new RetentionService. archives, history and
+// audit are optional; data without a repository is left alone.
+func NewRetentionService(archives repositories.ArchiveStoreRepository, history repositories.HistoryRepository, audit repositories.AuditRepository, cfg *config.RetentionConfig, log *slog.Logger) *RetentionService {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	s := &RetentionService{
+		archives: archives,
+		history:  history,
+		audit:    audit,
+		log:      log,
+		now:      time.Now,
+	}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+	if s.cfg.Interval <= 0 {
+		s.cfg.Interval = defaultRetentionInterval
+	}
+
+	return s
+}
+
+// Run enforces the retention policies every interval until the context is cancelled
+func (s *RetentionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Enforce(); err != nil {
+			s.log.Error("failed to enforce retention", "op", "RetentionService.Run", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Enforce removes every archive, history and audit entry past its retention period
+func (s *RetentionService) Enforce() error {
+	const op = "RetentionService.Enforce"
+
+	now := s.now()
+	var errs []error
+
+	if s.archives != nil {
+		removed, err := s.purgeArchives(now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if removed > 0 {
+			s.log.Info("expired archives removed", "op", op, "count", removed)
+		}
+	}
+
+	if s.history != nil {
+		removed, err := s.purgeHistory(now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if removed > 0 {
+			s.log.Info("expired history removed", "op", op, "count", removed)
+		}
+	}
+
+	if s.audit != nil && s.cfg.AuditDays > 0 {
+		removed, err := s.audit.Delete(entities.AuditFilter{SentBefore: now.AddDate(0, 0, -s.cfg.AuditDays)})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if removed > 0 {
+			s.log.Info("expired audit entries removed", "op", op, "count", removed)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// policy returns the retention policy of an API key
+func (s *RetentionService) policy(apiKeyID string) config.RetentionPolicy {
+	if policy, ok := s.cfg.Keys[apiKeyID]; ok && apiKeyID != "" {
+		return policy
+	}
+	return s.cfg.Default
+}
+
+// purgeArchives deletes the stored archives older than their owner's policy
+func (s *RetentionService) purgeArchives(now time.Time) (int, error) {
+	archives, err := s.archives.List()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, archive := range archives {
+		days := s.policy(archive.APIKeyID).ArchiveDays
+		if days == 0 || archive.CreatedAt.After(now.AddDate(0, 0, -days)) {
+			continue
+		}
+
+		if err := s.archives.Delete(archive.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// purgeHistory deletes the history entries older than their API key's
+// policy, first for keys with their own policy and then for all others
+func (s *RetentionService) purgeHistory(now time.Time) (int, error) {
+	removed := 0
+	overridden := make([]string, 0, len(s.cfg.Keys))
+
+	for apiKeyID, policy := range s.cfg.Keys {
+		if apiKeyID == "" {
+			continue
+		}
+		overridden = append(overridden, apiKeyID)
+		if policy.HistoryDays == 0 {
+			continue
+		}
+
+		n, err := s.history.Delete(entities.HistoryFilter{
+			APIKeyID:      apiKeyID,
+			StartedBefore: now.AddDate(0, 0, -policy.HistoryDays),
+		})
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	if days := s.cfg.Default.HistoryDays; days > 0 {
+		n, err := s.history.Delete(entities.HistoryFilter{
+			ExcludeAPIKeyIDs: overridden,
+			StartedBefore:    now.AddDate(0, 0, -days),
+		})
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+// ScanCache runs virus scanners on uploads and remembers their verdicts by
+// content hash, so a file uploaded again within cfg.CacheTTL, such as the
+// same nightly report, is not scanned again. Files marked SkipScan, which
+// come from the trusted API keys of cfg, are not scanned at all.
+//
+// Scanners are FileValidators, which the service does not ship; without any
+// the cache accepts every file. Only accepted files and rejections marked
+// with ErrFileRejected or ErrFileBlocked are cached: other errors, such as
+// an unreachable scanner, reject the upload but are tried again next time.
+type ScanCache struct {
+	scanners []FileValidator
+	ttl      time.Duration
+	size     int
+	trusted  map[string]bool
+	now      func() time.Time
+	log      *slog.Logger
+
+	mu       sync.Mutex
+	verdicts map[[sha256.Size]byte]scanVerdict
+}
+
+// scanVerdict is the cached result of scanning a content
+type scanVerdict struct {
+	err     error
+	expires time.Time
+}
+
+// NewScanCache creates a ScanCache running scanners in order. log is
+// optional; without it slog.Default() is used.
+func NewScanCache(cfg *config.ScanConfig, log *slog.Logger, scanners ...FileValidator) *ScanCache {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	trusted := make(map[string]bool, len(cfg.TrustedAPIKeys))
+	for _, id := range cfg.TrustedAPIKeys {
+		trusted[id] = true
+	}
+
+	return &ScanCache{
+		scanners: scanners,
+		ttl:      cfg.CacheTTL,
+		size:     cfg.CacheSize,
+		trusted:  trusted,
+		now:      time.Now,
+		log:      log,
+		verdicts: make(map[[sha256.Size]byte]scanVerdict),
+	}
+}
+
+// Trusts reports whether uploads with apiKey skip scanning
+func (c *ScanCache) Trusts(apiKey string) bool {
+	return apiKey != "" && c.trusted[utils.KeyID(apiKey)]
+}
+
+// ValidateFile implements FileValidator. Entries of inspected archives are
+// only known by their metadata and are not scanned. Streamed uploads are
+// loaded into memory to be hashed.
+func (c *ScanCache) ValidateFile(file *entities.FileData, kind entities.UploadKind) error {
+	const op = "ScanCache.ValidateFile"
+
+	if len(c.scanners) == 0 || file.SkipScan || kind == entities.UploadKindInformation {
+		return nil
+	}
+
+	if err := file.Load(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	sum := sha256.Sum256(file.Content)
+
+	if verdict, ok := c.lookup(sum); ok {
+		c.log.Debug("reused scan verdict", "op", op, "file", file.Name, "rejected", verdict.err != nil)
+		return verdict.err
+	}
+
+	err := c.scan(file, kind)
+	if err == nil || errors.Is(err, ErrFileRejected) || errors.Is(err, ErrFileBlocked) {
+		c.store(sum, err)
+	}
+	return err
+}
+
+// scan runs the scanners until one refuses the file
+func (c *ScanCache) scan(file *entities.FileData, kind entities.UploadKind) error {
+	for _, scanner := range c.scanners {
+		if err := scanner.ValidateFile(file, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the unexpired verdict on the content hashed to sum
+func (c *ScanCache) lookup(sum [sha256.Size]byte) (scanVerdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	verdict, ok := c.verdicts[sum]
+	if !ok || !c.now().Before(verdict.expires) {
+		return scanVerdict{}, false
+	}
+	return verdict, true
+}
+
+// store caches a verdict. When the cache is full, expired verdicts are
+// dropped first and then an arbitrary one.
+func (c *ScanCache) store(sum [sha256.Size]byte, err error) {
+	if c.ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.verdicts[sum]; !ok && len(c.verdicts) >= c.size {
+		for key, verdict := range c.verdicts {
+			if !now.Before(verdict.expires) {
+				delete(c.verdicts, key)
+			}
+		}
+		for key := range c.verdicts {
+			if len(c.verdicts) < c.size {
+				break
+			}
+			delete(c.verdicts, key)
+		}
+	}
+
+	c.verdicts[sum] = scanVerdict{err: err, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+// SecretSealer seals the secrets of queued jobs and kept messages, such as
+// archive and zip passwords, in envelopes of the master key provider, so
+// they are never stored in the clear. Without a provider, a key generated at
+// start and held in memory is used: secrets sealed by another process, or
+// before a restart, can't be opened.
+type SecretSealer struct {
+	keys repositories.KeyProvider
+}
+
+// NewSecretSealer creates a new SecretSealer. keys is optional.
+func NewSecretSealer(keys repositories.KeyProvider) (*SecretSealer, error) {
+	if keys == nil {
+		ephemeral, err := repositories.NewEphemeralKeyProvider()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ephemeral key: %w", err)
+		}
+		keys = ephemeral
+	}
+	return &SecretSealer{keys: keys}, nil
+}
+
+// Seal seals secret; an empty secret is sealed as nil
+func (s *SecretSealer) Seal(ctx context.Context, secret string) ([]byte, error) {
+	const op = "SecretSealer.Seal"
+
+	if secret == "" {
+		return nil, nil
+	}
+	sealed, err := repositories.SealEnvelope(ctx, s.keys, []byte(secret))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sealed, nil
+}
+
+// Open returns the secret sealed by Seal
+func (s *SecretSealer) Open(ctx context.Context, sealed []byte) (string, error) {
+	const op = "SecretSealer.Open"
+
+	if len(sealed) == 0 {
+		return "", nil
+	}
+	secret, err := repositories.OpenEnvelope(ctx, s.keys, sealed)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return string(secret), nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrStoreNil           = errors.New("archive store is nil")
+	ErrArchiveNotFound    = errors.New("archive not found")
+	ErrPassphraseRequired = errors.New("passphrase is required")
+	ErrInvalidPassphrase  = errors.New("invalid passphrase")
+)
+
+// ShareService stores created archives and serves them through share links
+type ShareService interface {
+	// Store keeps the archive for download, protected by passphrase when it
+	// is not empty. tenantID and apiKeyID identify the owner, see utils.KeyID.
+	Store(archive *entities.FileData, passphrase, tenantID, apiKeyID string) (*entities.StoredArchive, error)
+	// Open checks the passphrase and opens the archive for download
+	Open(id, passphrase string) (*entities.StoredArchive, repositories.Artifact, error)
+	// RecordAccess records a request to the share link of an archive
+	RecordAccess(id string, access entities.ArchiveAccess) error
+	// Accesses lists the recorded requests to the share link of an archive.
+	// With a tenantID, archives of other tenants are not found.
+	Accesses(id, tenantID string) ([]entities.ArchiveAccess, error)
+}
+
+type shareServiceImpl struct {
+	store     repositories.ArchiveStoreRepository
+	passwords *PasswordValidator
+	events    EventPublisher
+	log       *slog.Logger
+}
+
+// NewShareService creates a new instance of ShareService. Link passphrases
+// are checked against the archive password policy from cfg when it is set.
+// events is optional; without it stored and downloaded archives are not
+// announced.
+func NewShareService(store repositories.ArchiveStoreRepository, events EventPublisher, cfg *config.ArchiveConfig, log *slog.Logger) (ShareService, error) {
+	if store == nil {
+		return nil, ErrStoreNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	var policy config.PasswordPolicy
+	if cfg != nil {
+		policy = cfg.PasswordPolicy
+	}
+
+	return &shareServiceImpl{
+		store:     store,
+		passwords: NewPasswordValidator(policy),
+		events:    events,
+		log:       log,
+	}, nil
+}
+
+// Store keeps the archive for download. The passphrase is only kept as a
+// bcrypt hash.
+func (s *shareServiceImpl) Store(archive *entities.FileData, passphrase, tenantID, apiKeyID string) (*entities.StoredArchive, error) {
+	const op = "shareServiceImpl.Store"
+
+	if archive == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrNilFile)
+	}
+	if err := archive.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	meta := &entities.StoredArchive{
+		ID:        utils.NewID(),
+		Filename:  archive.Name,
+		Size:      archive.Size(),
+		CreatedAt: time.Now(),
+		TenantID:  tenantID,
+		APIKeyID:  apiKeyID,
+	}
+	if len(archive.Signature) > 0 {
+		meta.Signature = base64.StdEncoding.EncodeToString(archive.Signature)
+		meta.SignatureAlgorithm = archive.SignatureAlgorithm
+	}
+	if tenantID != "" {
+		// The tenant prefix keeps the archive under the tenant's storage prefix
+		meta.ID = tenantID + "." + meta.ID
+	}
+
+	if passphrase != "" {
+		if err := s.passwords.Validate(passphrase); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to hash passphrase: %w", op, err)
+		}
+		meta.PassphraseHash = string(hash)
+	}
+
+	if err := s.store.Save(meta, archive.Content); err != nil {
+		s.log.Error("failed to store archive",
+			"op", op,
+			"error", err,
+			"filename", archive.Name,
+		)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("archive stored",
+		"op", op,
+		"id", meta.ID,
+		"size", meta.Size,
+		"protected", meta.Protected(),
+	)
+	publish(s.events, entities.EventArchiveCreated, tenantID, newArchiveEvent(meta))
+
+	return meta, nil
+}
+
+// Open checks the passphrase of a protected archive and opens it for download.
+// The caller must close the returned artifact.
+func (s *shareServiceImpl) Open(id, passphrase string) (*entities.StoredArchive, repositories.Artifact, error) {
+	const op = "shareServiceImpl.Open"
+
+	meta, err := s.store.Get(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrArchiveNotFound) {
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+		}
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if meta.Protected() {
+		if passphrase == "" {
+			return meta, nil, fmt.Errorf("%s: %w", op, ErrPassphraseRequired)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(meta.PassphraseHash), []byte(passphrase)); err != nil {
+			s.log.Warn("invalid passphrase for archive",
+				"op", op,
+				"id", id,
+			)
+			return meta, nil, fmt.Errorf("%s: %w", op, ErrInvalidPassphrase)
+		}
+	}
+
+	f, err := s.store.Open(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrArchiveNotFound) {
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+		}
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return meta, f, nil
+}
+
+// RecordAccess records a request to the share link of an archive, and
+// announces successful downloads
+func (s *shareServiceImpl) RecordAccess(id string, access entities.ArchiveAccess) error {
+	const op = "shareServiceImpl.RecordAccess"
+
+	if access.Time.IsZero() {
+		access.Time = time.Now()
+	}
+	if s.events != nil && access.Status >= 200 && access.Status < 300 {
+		s.publishDownload(id, access)
+	}
+
+	if err := s.store.AddAccess(id, access); err != nil {
+		s.log.Error("failed to record archive access",
+			"op", op,
+			"id", id,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// publishDownload announces a download of the archive id
+func (s *shareServiceImpl) publishDownload(id string, access entities.ArchiveAccess) {
+	meta, err := s.store.Get(id)
+	if err != nil {
+		s.log.Error("failed to read downloaded archive", "op", "shareServiceImpl.publishDownload", "id", id, "error", err)
+		return
+	}
+
+	event := newArchiveEvent(meta)
+	event.Access = &access
+	publish(s.events, entities.EventArchiveDownloaded, meta.TenantID, event)
+}
+
+// Accesses lists the recorded requests to the share link of an archive
+func (s *shareServiceImpl) Accesses(id, tenantID string) ([]entities.ArchiveAccess, error) {
+	const op = "shareServiceImpl.Accesses"
+
+	if tenantID != "" {
+		meta, err := s.store.Get(id)
+		if err != nil && !errors.Is(err, repositories.ErrArchiveNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if meta == nil || meta.TenantID != tenantID {
+			return nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+		}
+	}
+
+	accesses, err := s.store.ListAccesses(id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrArchiveNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrArchiveNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accesses, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var ErrOverloaded = errors.New("server is overloaded, try again later")
+
+// Reasons requests are shed for
+const (
+	ShedDisk     = "disk"
+	ShedHeap     = "heap"
+	ShedInflight = "inflight"
+)
+
+// heapMetric is the runtime metric of the heap memory occupied by objects
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// LoadShedder admits archive and extraction requests while free disk, heap
+// in use and the bytes of the requests already in flight stay within their
+// thresholds. A nil LoadShedder admits every request.
+type LoadShedder struct {
+	dir         string
+	minFreeDisk int64
+	maxHeap     int64
+	maxInflight int64
+	retryAfter  time.Duration
+
+	freeDisk func(dir string) (int64, error)
+	heap     func() int64
+
+	mu       sync.Mutex
+	inflight int64
+}
+
+// ShedError is returned for a request that was shed, with the reason
+type ShedError struct {
+	Reason string
+}
+
+func (e *ShedError) Error() string {
+	return fmt.Sprintf("%s (%s)", ErrOverloaded, e.Reason)
+}
+
+func (e *ShedError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// NewLoadShedder creates a LoadShedder for cfg watching the free disk of the
+// volume of dir. It returns nil when load shedding is disabled.
+func NewLoadShedder(cfg *config.SheddingConfig, dir string) *LoadShedder {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &LoadShedder{
+		dir:         dir,
+		minFreeDisk: cfg.MinFreeDisk,
+		maxHeap:     cfg.MaxHeap,
+		maxInflight: cfg.MaxInflight,
+		retryAfter:  cfg.RetryAfter,
+		freeDisk:    freeDiskSpace,
+		heap:        heapInUse,
+	}
+}
+
+// RetryAfter returns the delay suggested to shed clients
+func (s *LoadShedder) RetryAfter() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return s.retryAfter
+}
+
+// Admit checks the thresholds for a request of size bytes and counts it in
+// flight until release is called. It returns a *ShedError when the request
+// must be shed. Free disk that cannot be read is not checked.
+func (s *LoadShedder) Admit(size int64) (release func(), err error) {
+	if s == nil {
+		return func() {}, nil
+	}
+
+	if s.minFreeDisk > 0 {
+		if free, err := s.freeDisk(s.dir); err == nil && free < s.minFreeDisk {
+			return nil, &ShedError{Reason: ShedDisk}
+		}
+	}
+	if s.maxHeap > 0 && s.heap() > s.maxHeap {
+		return nil, &ShedError{Reason: ShedHeap}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A request larger than the threshold is admitted when alone, or it
+	// could never be
+	if s.maxInflight > 0 && s.inflight > 0 && s.inflight+size > s.maxInflight {
+		return nil, &ShedError{Reason: ShedInflight}
+	}
+
+	s.inflight += size
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.inflight -= size
+			s.mu.Unlock()
+		})
+	}, nil
+}
+
+// heapInUse returns the bytes of heap memory occupied by objects, live or
+// not yet swept
+func heapInUse() int64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
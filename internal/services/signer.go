@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+var ErrInvalidSigningKey = errors.New("invalid archive signing key")
+
+// Signature algorithms of created archives
+const (
+	SignatureEd25519 = "ed25519"
+	SignaturePGP     = "pgp"
+)
+
+// ArchiveSigner makes detached signatures of created archives with the
+// server's key. A nil signer signs nothing.
+type ArchiveSigner struct {
+	ed25519 ed25519.PrivateKey
+	pgp     *openpgp.Entity
+}
+
+// NewArchiveSigner reads the signing key of cfg: a PEM encoded PKCS #8
+// Ed25519 private key or an unencrypted armored PGP private key, either of
+// which may be sealed by the key provider keys. It returns nil when signing
+// is disabled.
+func NewArchiveSigner(cfg config.ArchiveSigningConfig, keys repositories.KeyProvider) (*ArchiveSigner, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive signing key: %w", err)
+	}
+	if repositories.IsEnvelope(data) {
+		if keys == nil {
+			return nil, fmt.Errorf("%w: sealed key requires a keys provider", ErrInvalidSigningKey)
+		}
+		if data, err = repositories.OpenEnvelope(context.Background(), keys, data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+		}
+	}
+
+	if block, _ := pem.Decode(data); block != nil && block.Type == "PRIVATE KEY" {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+		}
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T is not an Ed25519 key", ErrInvalidSigningKey, key)
+		}
+		return &ArchiveSigner{ed25519: private}, nil
+	}
+
+	ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: neither a PKCS #8 nor a PGP key: %v", ErrInvalidSigningKey, err)
+	}
+	if len(ring) == 0 || ring[0].PrivateKey == nil {
+		return nil, fmt.Errorf("%w: no pgp private key found", ErrInvalidSigningKey)
+	}
+	if ring[0].PrivateKey.Encrypted {
+		return nil, fmt.Errorf("%w: pgp private key is protected by a passphrase", ErrInvalidSigningKey)
+	}
+	return &ArchiveSigner{pgp: ring[0]}, nil
+}
+
+// Algorithm returns the algorithm of the signatures, SignatureEd25519 or
+// SignaturePGP
+func (s *ArchiveSigner) Algorithm() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.pgp != nil:
+		return SignaturePGP
+	default:
+		return SignatureEd25519
+	}
+}
+
+// Sign returns the detached signature of content: the raw 64 byte Ed25519
+// signature, or a binary OpenPGP signature packet
+func (s *ArchiveSigner) Sign(content []byte) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	if s.pgp == nil {
+		return ed25519.Sign(s.ed25519, content), nil
+	}
+
+	var buf bytes.Buffer
+	if err := openpgp.DetachSign(&buf, s.pgp, bytes.NewReader(content), nil); err != nil {
+		return nil, fmt.Errorf("failed to sign archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PublicKey returns the key verifying the signatures: a PEM encoded PKIX
+// Ed25519 public key, or an armored PGP public key
+func (s *ArchiveSigner) PublicKey() ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	if s.pgp == nil {
+		der, err := x509.MarshalPKIXPublicKey(s.ed25519.Public())
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pgp.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+var (
+	ErrSuppressionRepositoryNil = errors.New("suppression repository is nil")
+	ErrInvalidSuppression       = errors.New("invalid suppression")
+	ErrSuppressionNotFound      = errors.New("address is not suppressed")
+)
+
+// SuppressionService manages the addresses mail is never sent to, such as
+// hard bounces and recipients who unsubscribed. Each tenant has its own
+// list. A nil *SuppressionService suppresses nothing.
+type SuppressionService struct {
+	repo repositories.SuppressionRepository
+}
+
+// NewSuppressionService creates a new SuppressionService
+func NewSuppressionService(repo repositories.SuppressionRepository) (*SuppressionService, error) {
+	if repo == nil {
+		return nil, ErrSuppressionRepositoryNil
+	}
+	return &SuppressionService{repo: repo}, nil
+}
+
+// Add suppresses an address for a tenant. The reason defaults to manual.
+func (s *SuppressionService) Add(tenantID, address string, reason entities.SuppressionReason) (*entities.Suppression, error) {
+	const op = "SuppressionService.Add"
+
+	addr, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil || addr.Name != "" {
+		return nil, fmt.Errorf("%w: invalid address: %s", ErrInvalidSuppression, address)
+	}
+
+	switch reason {
+	case "":
+		reason = entities.SuppressionReasonManual
+	case entities.SuppressionReasonBounce, entities.SuppressionReasonUnsubscribe, entities.SuppressionReasonManual:
+	default:
+		return nil, fmt.Errorf("%w: invalid reason: %s", ErrInvalidSuppression, reason)
+	}
+
+	entry := &entities.Suppression{
+		Address:   suppressionAddress(addr.Address),
+		Reason:    reason,
+		TenantID:  tenantID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.Add(entry); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entry, nil
+}
+
+// Remove takes an address off the suppression list of a tenant
+func (s *SuppressionService) Remove(tenantID, address string) error {
+	const op = "SuppressionService.Remove"
+
+	if err := s.repo.Remove(tenantID, suppressionAddress(address)); err != nil {
+		if errors.Is(err, repositories.ErrSuppressionNotFound) {
+			return ErrSuppressionNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// List returns the suppressed addresses of a tenant
+func (s *SuppressionService) List(tenantID string) ([]*entities.Suppression, error) {
+	const op = "SuppressionService.List"
+
+	entries, err := s.repo.List(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+// Filter splits recipients into those mail may be sent to and those
+// suppressed for the tenant, keeping their order
+func (s *SuppressionService) Filter(tenantID string, recipients []string) (send, suppressed []string, err error) {
+	const op = "SuppressionService.Filter"
+
+	if s == nil {
+		return recipients, nil, nil
+	}
+
+	addresses := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		addresses[i] = suppressionAddress(recipient)
+	}
+
+	matches, err := s.repo.Suppressed(tenantID, addresses)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, recipient := range recipients {
+		if matches[addresses[i]] {
+			suppressed = append(suppressed, recipient)
+		} else {
+			send = append(send, recipient)
+		}
+	}
+	return send, suppressed, nil
+}
+
+// suppressionAddress normalizes an address so it matches regardless of case
+func suppressionAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+var ErrTempSpaceExhausted = errors.New("temporary storage is full, try again later")
+
+// defaultTempCleanupInterval is how often orphaned temp files are looked for
+// when no interval is configured
+const defaultTempCleanupInterval = 10 * time.Minute
+
+// tempFilePattern matches the files uploads are spooled to by the multipart
+// parser. Only these are counted and cleaned up, so the temp root may be
+// shared with other programs.
+const tempFilePattern = "multipart-*"
+
+// TempSpace accounts for the disk used by uploads spooled to the temp root
+// and removes the files orphaned there by crashed requests. A nil TempSpace
+// reserves without limit and cleans nothing.
+type TempSpace struct {
+	dir         string
+	maxSize     int64
+	largeUpload int64
+	orphanAge   time.Duration
+	interval    time.Duration
+	log         *slog.Logger
+	now         func() time.Time
+
+	mu       sync.Mutex
+	reserved int64
+}
+
+// NewTempSpace creates a TempSpace for cfg, creating its temp root if needed
+func NewTempSpace(cfg *config.TempConfig, log *slog.Logger) (*TempSpace, error) {
+	const op = "NewTempSpace"
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	s := &TempSpace{
+		dir:         cfg.Dir,
+		maxSize:     cfg.MaxSize,
+		largeUpload: cfg.LargeUpload,
+		orphanAge:   cfg.OrphanAge,
+		interval:    cfg.CleanupInterval,
+		log:         log,
+		now:         time.Now,
+	}
+	if s.dir == "" {
+		s.dir = os.TempDir()
+	} else if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if s.interval <= 0 {
+		s.interval = defaultTempCleanupInterval
+	}
+
+	return s, nil
+}
+
+// Dir returns the temp root
+func (s *TempSpace) Dir() string {
+	if s == nil {
+		return os.TempDir()
+	}
+	return s.dir
+}
+
+// Reserve sets size bytes of the budget aside for an upload until release
+// is called. Uploads of up to the large upload size are parsed in memory and
+// always fit. Reservations count on top of the files already spooled, so
+// the budget errs on the side of refusing uploads.
+func (s *TempSpace) Reserve(size int64) (release func(), err error) {
+	const op = "TempSpace.Reserve"
+
+	if s == nil || s.maxSize == 0 || size <= s.largeUpload {
+		return func() {}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, err := s.usage()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if used+s.reserved+size > s.maxSize {
+		return nil, fmt.Errorf("%s: %w", op, ErrTempSpaceExhausted)
+	}
+
+	s.reserved += size
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.reserved -= size
+			s.mu.Unlock()
+		})
+	}, nil
+}
+
+// Usage returns the number of bytes spooled to the temp root
+func (s *TempSpace) Usage() (int64, error) {
+	if s == nil {
+		return 0, nil
+	}
+	return s.usage()
+}
+
+func (s *TempSpace) usage() (int64, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, tempFilePattern))
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	for _, name := range names {
+		info, err := os.Lstat(name)
+		if err != nil {
+			// Removed by its request meanwhile
+			continue
+		}
+		if info.Mode().IsRegular() {
+			used += info.Size()
+		}
+	}
+	return used, nil
+}
+
+// Run removes orphaned temp files every cleanup interval until the context
+// is cancelled
+func (s *TempSpace) Run(ctx context.Context) {
+	if s == nil || s.orphanAge == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Clean(); err != nil {
+			s.log.Error("failed to clean temp files", "op", "TempSpace.Run", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Clean removes the spooled files not modified for the orphan age, left
+// behind by requests that crashed or were killed, and returns their number
+func (s *TempSpace) Clean() (int, error) {
+	const op = "TempSpace.Clean"
+
+	if s == nil || s.orphanAge == 0 {
+		return 0, nil
+	}
+
+	names, err := filepath.Glob(filepath.Join(s.dir, tempFilePattern))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cutoff := s.now().Add(-s.orphanAge)
+	removed := 0
+	var errs []error
+	for _, name := range names {
+		info, err := os.Lstat(name)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		s.log.Info("orphaned temp files removed", "op", op, "count", removed)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return removed, fmt.Errorf("%s: %w", op, err)
+	}
+	return removed, nil
+}
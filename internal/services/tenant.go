@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var (
+	ErrTenantRequired     = errors.New("tenant is required")
+	ErrUnknownTenant      = errors.New("unknown tenant")
+	ErrTenantMismatch     = errors.New("api key does not belong to the tenant")
+	ErrRateLimited        = errors.New("rate limit exceeded")
+	ErrQuotaExceeded      = errors.New("daily quota exceeded")
+	ErrFileTypeNotAllowed = errors.New("file type is not allowed for the tenant")
+)
+
+// Tenant is a team sharing the deployment with others. Its archives, jobs
+// and history are kept apart from those of other tenants.
+type Tenant struct {
+	ID string
+	// MailFrom is the sender of the tenant's mail; empty uses mail.from
+	MailFrom string
+	// AllowedMIMETypes restricts the accepted uploads; empty allows all
+	AllowedMIMETypes []string
+}
+
+// AllowsMIMEType reports whether the tenant accepts uploads of mimeType. A nil
+// tenant accepts everything.
+func (t *Tenant) AllowsMIMEType(mimeType string) bool {
+	if t == nil || len(t.AllowedMIMETypes) == 0 {
+		return true
+	}
+	return slices.Contains(t.AllowedMIMETypes, mimeType)
+}
+
+// tenantContextKey is the context key of the request's tenant
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant
+func WithTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx, or nil
+func TenantFromContext(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantContextKey{}).(*Tenant)
+	return tenant
+}
+
+// TenantService resolves the tenant of requests and enforces its rate limit
+// and daily quota. Limits are tracked per instance. A nil or disabled
+// *TenantService resolves no tenant and limits nothing.
+type TenantService struct {
+	header    string
+	defaultID string
+	tenants   map[string]*tenantState
+	// keys maps API key ids to the id of the tenant owning them
+	keys map[string]string
+	log  *slog.Logger
+	now  func() time.Time
+}
+
+// tenantState holds a tenant with its limits and their current usage
+type tenantState struct {
+	tenant Tenant
+	keyed  bool
+
+	rate       float64
+	burst      float64
+	dailyQuota int64
+
+	mu       sync.Mutex
+	tokens   float64
+	refilled time.Time
+	day      string
+	used     int64
+}
+
+// NewTenantService creates a new TenantService. It returns nil when tenancy
+// is disabled.
+func NewTenantService(cfg *config.TenancyConfig, log *slog.Logger) (*TenantService, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	s := &TenantService{
+		header:    cfg.Header,
+		defaultID: cfg.Default,
+		tenants:   make(map[string]*tenantState, len(cfg.Tenants)),
+		keys:      make(map[string]string),
+		log:       log,
+		now:       time.Now,
+	}
+
+	for id, tenantCfg := range cfg.Tenants {
+		state := &tenantState{
+			tenant: Tenant{
+				ID:               id,
+				MailFrom:         tenantCfg.MailFrom,
+				AllowedMIMETypes: tenantCfg.AllowedMIMETypes,
+			},
+			keyed:      len(tenantCfg.APIKeys) > 0,
+			rate:       tenantCfg.RateLimit,
+			burst:      float64(tenantCfg.Burst),
+			dailyQuota: tenantCfg.DailyQuota,
+		}
+		if state.burst <= 0 {
+			state.burst = math.Max(1, math.Ceil(state.rate))
+		}
+		state.tokens = state.burst
+		s.tenants[id] = state
+
+		for _, key := range tenantCfg.APIKeys {
+			if other, ok := s.keys[key]; ok && other != id {
+				return nil, fmt.Errorf("api key %s belongs to tenants %s and %s", key, other, id)
+			}
+			s.keys[key] = id
+		}
+	}
+
+	if s.defaultID != "" && s.tenants[s.defaultID] == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, s.defaultID)
+	}
+
+	return s, nil
+}
+
+// Header returns the name of the request header selecting the tenant
+func (s *TenantService) Header() string {
+	if s == nil {
+		return ""
+	}
+	return s.header
+}
+
+// Resolve returns the tenant of a request made with apiKey naming tenantID,
+// either of which may be empty. An API key belonging to a tenant selects it;
+// otherwise the named tenant is used if it has no API keys of its own, and
+// then the default tenant.
+func (s *TenantService) Resolve(apiKey, tenantID string) (*Tenant, error) {
+	const op = "TenantService.Resolve"
+
+	if s == nil {
+		return nil, nil
+	}
+
+	tenantID = strings.ToLower(strings.TrimSpace(tenantID))
+
+	if id, ok := s.keys[utils.KeyID(apiKey)]; ok && apiKey != "" {
+		if tenantID != "" && tenantID != id {
+			return nil, fmt.Errorf("%s: %w", op, ErrTenantMismatch)
+		}
+		return &s.tenants[id].tenant, nil
+	}
+
+	if tenantID != "" {
+		state, ok := s.tenants[tenantID]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: %s", op, ErrUnknownTenant, tenantID)
+		}
+		if state.keyed {
+			return nil, fmt.Errorf("%s: %w", op, ErrTenantMismatch)
+		}
+		return &state.tenant, nil
+	}
+
+	if s.defaultID != "" {
+		return &s.tenants[s.defaultID].tenant, nil
+	}
+
+	return nil, fmt.Errorf("%s: %w", op, ErrTenantRequired)
+}
+
+// Allow takes a request of size bytes from the tenant's rate limit and daily
+// quota. A request that is not allowed takes nothing. The status is that of
+// the rate limit, telling when to retry a request over the quota too.
+func (s *TenantService) Allow(tenant *Tenant, size int64) (RateLimitStatus, error) {
+	const op = "TenantService.Allow"
+
+	if s == nil || tenant == nil {
+		return RateLimitStatus{}, nil
+	}
+
+	state, ok := s.tenants[tenant.ID]
+	if !ok {
+		return RateLimitStatus{}, fmt.Errorf("%s: %w: %s", op, ErrUnknownTenant, tenant.ID)
+	}
+
+	now := s.now()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.rate > 0 {
+		if !state.refilled.IsZero() {
+			state.tokens = math.Min(state.burst, state.tokens+now.Sub(state.refilled).Seconds()*state.rate)
+		}
+		state.refilled = now
+		if state.tokens < 1 {
+			return state.status(), fmt.Errorf("%s: %w", op, ErrRateLimited)
+		}
+	}
+
+	if state.dailyQuota > 0 {
+		if day := now.UTC().Format(time.DateOnly); day != state.day {
+			state.day = day
+			state.used = 0
+		}
+		if state.used+size > state.dailyQuota {
+			s.log.Warn("tenant quota exceeded",
+				"op", op,
+				"tenant", tenant.ID,
+				"used", state.used,
+				"size", size,
+			)
+			// The quota is renewed at midnight UTC
+			status := state.status()
+			status.RetryAfter = now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+			return status, fmt.Errorf("%s: %w", op, ErrQuotaExceeded)
+		}
+		state.used += size
+	}
+
+	if state.rate > 0 {
+		state.tokens--
+	}
+
+	return state.status(), nil
+}
+
+// status returns the status of the tenant's rate limit, if it has one
+func (t *tenantState) status() RateLimitStatus {
+	if t.rate <= 0 {
+		return RateLimitStatus{}
+	}
+	return bucketStatus(t.tokens, t.burst, t.rate)
+}
+
+// LimitsQuota reports whether the tenant has a daily quota
+func (s *TenantService) LimitsQuota(tenant *Tenant) bool {
+	if s == nil || tenant == nil {
+		return false
+	}
+	state, ok := s.tenants[tenant.ID]
+	return ok && state.dailyQuota > 0
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/utils"
+)
+
+var ErrUploadRepositoryNil = errors.New("upload repository is nil")
+
+// UploadService keeps uploads for the jobs processing them after the
+// request that received them has returned
+type UploadService struct {
+	repo repositories.UploadRepository
+	temp *TempSpace
+	log  *slog.Logger
+}
+
+// NewUploadService creates a new UploadService. temp is optional; without
+// it uploads are copied to the system temp directory when opened.
+func NewUploadService(repo repositories.UploadRepository, temp *TempSpace, log *slog.Logger) (*UploadService, error) {
+	if repo == nil {
+		return nil, ErrUploadRepositoryNil
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+	return &UploadService{repo: repo, temp: temp, log: log}, nil
+}
+
+// Save keeps an upload of size bytes and returns its id
+func (s *UploadService) Save(ctx context.Context, r io.Reader, size int64) (string, error) {
+	const op = "UploadService.Save"
+
+	id := utils.NewID()
+	if err := s.repo.Save(ctx, id, r, size); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Open copies an upload to a temp file, as archives are read at random
+// rather than from start to end. cleanup removes the file.
+func (s *UploadService) Open(ctx context.Context, id string) (file *os.File, cleanup func(), err error) {
+	const op = "UploadService.Open"
+
+	artifact, err := s.repo.Open(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer artifact.Close()
+
+	release, err := s.temp.Reserve(artifact.Size())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	file, err = os.CreateTemp(s.temp.Dir(), "upload-*")
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	cleanup = func() {
+		file.Close()
+		os.Remove(file.Name())
+		release()
+	}
+
+	if _, err := io.Copy(file, artifact); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return file, cleanup, nil
+}
+
+// Discard removes an upload once no job needs it. Failures are only
+// logged, as they don't change the outcome of the job.
+func (s *UploadService) Discard(id string) {
+	const op = "UploadService.Discard"
+
+	if err := s.repo.Delete(context.Background(), id); err != nil {
+		s.log.Warn("failed to remove upload", "op", op, "id", id, "error", err)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+)
+
+var ErrFileRejected = errors.New("file rejected")
+
+// FileValidator checks a file before it is accepted. It is called for every
+// file added to an archive (kind entities.UploadKindArchive) or attached to
+// mail (entities.UploadKindMail), and for every entry of an inspected
+// archive (entities.UploadKindInformation), which is only known by its name,
+// size and MIME type. Uploads are streamed and can be read only once, so
+// validators reading content must use Peek or Load.
+type FileValidator interface {
+	ValidateFile(file *entities.FileData, kind entities.UploadKind) error
+}
+
+// FileValidatorFunc adapts a function to a FileValidator
+type FileValidatorFunc func(file *entities.FileData, kind entities.UploadKind) error
+
+// ValidateFile calls f
+func (f FileValidatorFunc) ValidateFile(file *entities.FileData, kind entities.UploadKind) error {
+	return f(file, kind)
+}
+
+// FileValidatorChain runs its validators in order and stops at the first
+// error. Errors not already marking a rejection are wrapped in
+// ErrFileRejected, so custom validators can return plain errors.
+type FileValidatorChain []FileValidator
+
+// ChainFileValidators returns a chain of the validators, skipping nil ones
+func ChainFileValidators(validators ...FileValidator) FileValidatorChain {
+	chain := make(FileValidatorChain, 0, len(validators))
+	for _, validator := range validators {
+		if validator != nil {
+			chain = append(chain, validator)
+		}
+	}
+	return chain
+}
+
+// ValidateFile runs every validator of the chain
+func (c FileValidatorChain) ValidateFile(file *entities.FileData, kind entities.UploadKind) error {
+	for _, validator := range c {
+		err := validator.ValidateFile(file, kind)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrFileRejected), errors.Is(err, ErrFileBlocked):
+			return err
+		default:
+			return fmt.Errorf("%w: %s: %v", ErrFileRejected, file.Name, err)
+		}
+	}
+	return nil
+}
+
+// NewFileValidators returns the built-in validators enabled by cfg
+func NewFileValidators(cfg *config.ValidationConfig) FileValidatorChain {
+	var validators []FileValidator
+	if cfg.MaxFileSize > 0 {
+		validators = append(validators, FileSizeValidator{MaxSize: cfg.MaxFileSize})
+	}
+	if len(cfg.MIMETypes) > 0 {
+		validators = append(validators, MIMETypeValidator{Allowed: cfg.MIMETypes})
+	}
+	validators = append(validators, FileNameValidator{MaxLength: cfg.MaxNameLength})
+
+	return ChainFileValidators(validators...)
+}
+
+// FileSizeValidator refuses files larger than MaxSize bytes
+type FileSizeValidator struct {
+	MaxSize int64
+}
+
+// ValidateFile implements FileValidator
+func (v FileSizeValidator) ValidateFile(file *entities.FileData, _ entities.UploadKind) error {
+	if file.Size() > v.MaxSize {
+		return fmt.Errorf("%w: %s is %d bytes, at most %d are accepted", ErrFileRejected, file.Name, file.Size(), v.MaxSize)
+	}
+	return nil
+}
+
+// MIMETypeValidator accepts only the Allowed MIME types. "image/*" allows
+// every image type.
+type MIMETypeValidator struct {
+	Allowed []string
+}
+
+// ValidateFile implements FileValidator
+func (v MIMETypeValidator) ValidateFile(file *entities.FileData, _ entities.UploadKind) error {
+	mimeType, _, _ := strings.Cut(file.MIMEType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	for _, allowed := range v.Allowed {
+		allowed = strings.ToLower(allowed)
+		if allowed == mimeType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, allowed[:len(allowed)-1])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s has type %s, which is not accepted", ErrFileRejected, file.Name, mimeType)
+}
+
+// FileNameValidator refuses names with control characters, absolute paths,
+// parent directory references, and names longer than MaxLength bytes when
+// it is set
+type FileNameValidator struct {
+	MaxLength int
+}
+
+// ValidateFile implements FileValidator
+func (v FileNameValidator) ValidateFile(file *entities.FileData, _ entities.UploadKind) error {
+	name := file.Name
+	if v.MaxLength > 0 && len(name) > v.MaxLength {
+		return fmt.Errorf("%w: name of %.32s... is longer than %d bytes", ErrFileRejected, name, v.MaxLength)
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return fmt.Errorf("%w: name %q contains control characters", ErrFileRejected, name)
+	}
+
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(slashed) || (len(slashed) > 1 && slashed[1] == ':') {
+		return fmt.Errorf("%w: name %q is an absolute path", ErrFileRejected, name)
+	}
+	for _, element := range strings.Split(slashed, "/") {
+		if element == ".." {
+			return fmt.Errorf("%w: name %q refers to a parent directory", ErrFileRejected, name)
+		}
+	}
+
+	return nil
+}
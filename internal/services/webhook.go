@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+var ErrWebhookRepositoryNil = errors.New("webhook repository is nil")
+
+// Headers of webhook deliveries
+const (
+	webhookSignatureHeader = "X-Doozip-Signature"
+	webhookTimestampHeader = "X-Doozip-Timestamp"
+	webhookEventHeader     = "X-Doozip-Event"
+	webhookDeliveryHeader  = "X-Doozip-Delivery"
+)
+
+const (
+	defaultWebhookWorkers   = 2
+	defaultWebhookQueueSize = 1000
+)
+
+// WebhookService posts events to the endpoints subscribed to them. Events
+// are queued and delivered in the background; those published while the
+// queue is full, and those still queued at shutdown, are dropped. A nil
+// WebhookService drops every event.
+type WebhookService struct {
+	endpoints  []*webhookEndpoint
+	repo       repositories.WebhookRepository
+	workers    int
+	deliveries chan *webhookDelivery
+	log        *slog.Logger
+	now        func() time.Time
+}
+
+// webhookEndpoint is a URL subscribed to events
+type webhookEndpoint struct {
+	url string
+	// secrets sign the payloads, the current one first
+	secrets [][]byte
+	// events are the event types delivered; empty delivers every type
+	events map[entities.EventType]bool
+}
+
+// webhookDelivery is an encoded event waiting to be posted to an endpoint
+type webhookDelivery struct {
+	endpoint *webhookEndpoint
+	id       string
+	event    entities.EventType
+	body     []byte
+}
+
+// NewWebhookService creates a WebhookService posting through repo to the
+// endpoints of cfg. It returns nil when there are no endpoints.
+func NewWebhookService(cfg *config.WebhooksConfig, repo repositories.WebhookRepository, log *slog.Logger) (*WebhookService, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, nil
+	}
+	if repo == nil {
+		return nil, ErrWebhookRepositoryNil
+	}
+
+	if log == nil {
+		log = slog.Default()
+	}
+
+	s := &WebhookService{
+		repo:    repo,
+		workers: cfg.Workers,
+		log:     log,
+		now:     time.Now,
+	}
+	if s.workers <= 0 {
+		s.workers = defaultWebhookWorkers
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultWebhookQueueSize
+	}
+	s.deliveries = make(chan *webhookDelivery, queueSize)
+
+	for _, endpointCfg := range cfg.Endpoints {
+		endpoint := &webhookEndpoint{
+			url:     endpointCfg.URL,
+			secrets: [][]byte{[]byte(endpointCfg.Secret)},
+			events:  make(map[entities.EventType]bool, len(endpointCfg.Events)),
+		}
+		if endpointCfg.PreviousSecret != "" {
+			endpoint.secrets = append(endpoint.secrets, []byte(endpointCfg.PreviousSecret))
+		}
+		for _, event := range endpointCfg.Events {
+			endpoint.events[entities.EventType(event)] = true
+		}
+		s.endpoints = append(s.endpoints, endpoint)
+	}
+
+	return s, nil
+}
+
+// Publish queues the event for every endpoint subscribed to it
+func (s *WebhookService) Publish(event *entities.Event) {
+	const op = "WebhookService.Publish"
+
+	if s == nil {
+		return
+	}
+
+	var body []byte
+	for _, endpoint := range s.endpoints {
+		if len(endpoint.events) > 0 && !endpoint.events[event.Type] {
+			continue
+		}
+
+		// Encoded once, and before returning, so the subject of the event
+		// may change afterwards
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(event); err != nil {
+				s.log.Error("failed to encode event", "op", op, "id", event.ID, "type", event.Type, "error", err)
+				return
+			}
+		}
+
+		select {
+		case s.deliveries <- &webhookDelivery{endpoint: endpoint, id: event.ID, event: event.Type, body: body}:
+		default:
+			s.log.Error("webhook queue is full, event dropped",
+				"op", op,
+				"id", event.ID,
+				"type", event.Type,
+				"url", endpoint.url,
+			)
+		}
+	}
+}
+
+// Run delivers queued events until the context is cancelled
+func (s *WebhookService) Run(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-s.deliveries:
+					s.deliver(ctx, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver posts a single event to its endpoint
+func (s *WebhookService) deliver(ctx context.Context, delivery *webhookDelivery) {
+	const op = "WebhookService.deliver"
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	header := http.Header{}
+	header.Set(webhookSignatureHeader, signWebhook(delivery.endpoint.secrets, timestamp, delivery.body))
+	header.Set(webhookTimestampHeader, timestamp)
+	header.Set(webhookEventHeader, string(delivery.event))
+	header.Set(webhookDeliveryHeader, delivery.id)
+
+	if err := s.repo.Post(ctx, delivery.endpoint.url, header, delivery.body); err != nil {
+		s.log.Error("failed to deliver webhook",
+			"op", op,
+			"id", delivery.id,
+			"type", delivery.event,
+			"url", delivery.endpoint.url,
+			"error", err,
+		)
+		return
+	}
+
+	s.log.Debug("webhook delivered", "op", op, "id", delivery.id, "type", delivery.event, "url", delivery.endpoint.url)
+}
+
+// signWebhook returns the signature header of a payload: the hex
+// HMAC-SHA256 of the timestamp and body joined with a newline, once per
+// secret, as in "sha256=<current>,sha256=<previous>"
+func signWebhook(secrets [][]byte, timestamp string, body []byte) string {
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(timestamp))
+		mac.Write([]byte{'\n'})
+		mac.Write(body)
+		signatures = append(signatures, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return strings.Join(signatures, ",")
+}
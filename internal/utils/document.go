@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+)
+
+// ooxmlMainParts identify the format of an Office Open XML document by the
+// part holding its content
+var ooxmlMainParts = map[string]string{
+	"word/document.xml":    "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xl/workbook.xml":      "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ppt/presentation.xml": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// DocumentType returns the MIME type of a PDF or Office Open XML document
+// from its content, or an empty string for other content. It doesn't depend
+// on the MIME types known to the system, which may lack the Office ones.
+func DocumentType(content []byte) string {
+	if bytes.HasPrefix(content, []byte("%PDF-")) {
+		return "application/pdf"
+	}
+	if !bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		return ""
+	}
+
+	// Only the central directory is read; no part is decompressed
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return ""
+	}
+	for _, f := range reader.File {
+		if mimeType, ok := ooxmlMainParts[f.Name]; ok {
+			return mimeType
+		}
+	}
+	return ""
+}
@@ -0,0 +1,32 @@
+package utils
+
+import "bytes"
+
+// ExecutableHeadSize is the number of leading bytes ExecutableType needs
+const ExecutableHeadSize = 4
+
+// executableSignatures identify executables and scripts by their first
+// bytes, which http.DetectContentType doesn't recognize
+var executableSignatures = []struct {
+	prefix   []byte
+	mimeType string
+}{
+	{[]byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "application/x-mach-binary"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte("#!"), "text/x-shellscript"},
+}
+
+// ExecutableType returns the MIME type of an executable or script whose
+// content starts with head, or an empty string for other content
+func ExecutableType(head []byte) string {
+	for _, signature := range executableSignatures {
+		if bytes.HasPrefix(head, signature.prefix) {
+			return signature.mimeType
+		}
+	}
+	return ""
+}
@@ -0,0 +1,337 @@
+package doozip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// app holds the services shared by the API server and the worker
+type app struct {
+	jobs    *services.JobManager
+	outbox  *services.Outbox
+	archive services.ArchiveService
+	shares  services.ShareService
+	mail    services.MailService
+	history *services.HistoryService
+	// suppressions holds the addresses mail is never sent to
+	suppressions *services.SuppressionService
+	// groups holds the named recipient groups mail may be sent to
+	groups *services.GroupService
+	// audit records every mail sent with its attachment fingerprints
+	audit *services.AuditService
+	// retention removes expired archives, history and audit entries
+	retention *services.RetentionService
+	// tenants is nil unless tenancy is enabled
+	tenants *services.TenantService
+	// auth is nil unless auth is enabled
+	auth *services.AuthService
+	// scans runs the virus scanners of the options, if any
+	scans *services.ScanCache
+	// temp is where large uploads are spooled
+	temp *services.TempSpace
+	// uploads keeps the files of jobs until they have run
+	uploads *services.UploadService
+	// secrets seals the passwords of archive jobs and zipped mail
+	secrets *services.SecretSealer
+	// builds bounds the archive builds and extractions run at once
+	builds *services.WorkLimiter
+	// webhooks is nil unless webhook endpoints are configured
+	webhooks *services.WebhookService
+	// bus is nil unless an events driver is configured
+	bus *services.EventBusPublisher
+	// health probes the SMTP relays, storage, queue and database
+	health *services.HealthService
+
+	// lc runs the background components and closes the connections
+	lc *lifecycle
+}
+
+// newApp wires the repositories and services described by cfg and the
+// extensions of opts. Its background components run until ctx is cancelled.
+// The returned app must be closed to drain them and release its
+// connections.
+func newApp(ctx context.Context, cfg *config.Config, opts *options, log *slog.Logger) (*app, error) {
+	a := &app{
+		health: services.NewHealthService(&cfg.Health),
+		lc:     newLifecycle(ctx, cfg.Server.ShutdownTimeout, log),
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			a.close()
+		}
+	}()
+
+	// Temp root of spooled uploads. The multipart parser spools to the
+	// system temp directory, so the configured root replaces it.
+	temp, err := services.NewTempSpace(&cfg.Temp, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp space: %w", err)
+	}
+	a.temp = temp
+	if cfg.Temp.Dir != "" {
+		if err := os.Setenv("TMPDIR", temp.Dir()); err != nil {
+			return nil, fmt.Errorf("failed to set temp dir: %w", err)
+		}
+	}
+
+	// Queue
+	queue, err := repositories.NewQueue(&cfg.Queue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create queue: %w", err)
+	}
+	a.lc.OnClose("queue", queue.Close)
+	if pinger, ok := queue.(interface{ Ping(context.Context) error }); ok {
+		a.health.Register("queue", pinger.Ping)
+	}
+
+	// Webhooks and the event bus announcing stored and downloaded archives,
+	// finished jobs and mail deliveries
+	var publishers services.EventPublishers
+	if len(cfg.Webhooks.Endpoints) > 0 {
+		client, err := repositories.NewOutboundClient(&cfg.Outbound)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook client: %w", err)
+		}
+		a.webhooks, err = services.NewWebhookService(&cfg.Webhooks, repositories.NewHTTPWebhookRepository(client), log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook service: %w", err)
+		}
+		a.lc.Go("webhooks", a.webhooks.Run)
+		publishers = append(publishers, a.webhooks)
+	}
+	if cfg.Events.Driver != "" {
+		bus, err := repositories.NewEventBus(&cfg.Events)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to event bus: %w", err)
+		}
+		a.lc.OnClose("event bus", bus.Close)
+		a.bus, err = services.NewEventBusPublisher(bus, &cfg.Events, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event publisher: %w", err)
+		}
+		a.lc.Go("event bus", a.bus.Run)
+		publishers = append(publishers, a.bus)
+	}
+	var events services.EventPublisher
+	if len(publishers) > 0 {
+		events = publishers
+	}
+
+	// Jobs, history, the mail outbox, suppression list, recipient groups and
+	// audit trail
+	var jobRepo repositories.JobRepository = repositories.NewMemoryJobRepository()
+	var historyRepo repositories.HistoryRepository = repositories.NewMemoryHistoryRepository()
+	var outboxRepo repositories.OutboxRepository = repositories.NewMemoryOutboxRepository()
+	var suppressionRepo repositories.SuppressionRepository = repositories.NewMemorySuppressionRepository()
+	var groupRepo repositories.GroupRepository = repositories.NewMemoryGroupRepository()
+	var auditRepo repositories.AuditRepository = repositories.NewMemoryAuditRepository()
+	if cfg.Jobs.Store != "memory" {
+		db, err := repositories.OpenDatabase(&cfg.Database)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		a.lc.OnClose("database", db.Close)
+		a.health.Register("db", db.PingContext)
+
+		jobRepo, err = repositories.NewSQLJobRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create job repository: %w", err)
+		}
+		historyRepo, err = repositories.NewSQLHistoryRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create history repository: %w", err)
+		}
+		outboxRepo, err = repositories.NewSQLOutboxRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create outbox repository: %w", err)
+		}
+		suppressionRepo, err = repositories.NewSQLSuppressionRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create suppression repository: %w", err)
+		}
+		groupRepo, err = repositories.NewSQLGroupRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create group repository: %w", err)
+		}
+		auditRepo, err = repositories.NewSQLAuditRepository(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit repository: %w", err)
+		}
+	}
+	a.history, err = services.NewHistoryService(historyRepo, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create history service: %w", err)
+	}
+	auditSink, err := repositories.NewAuditSink(&cfg.Audit.Export, &cfg.Outbound)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit sink: %w", err)
+	}
+	var auditExporter *services.AuditExporter
+	if auditSink != nil {
+		a.lc.OnClose("audit sink", auditSink.Close)
+		auditExporter, err = services.NewAuditExporter(auditSink, &cfg.Audit.Export, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit exporter: %w", err)
+		}
+		a.lc.Go("audit export", auditExporter.Run)
+	}
+	a.audit, err = services.NewAuditService(auditRepo, auditExporter, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit service: %w", err)
+	}
+	a.jobs, err = services.NewJobManager(jobRepo, queue, events, &cfg.Jobs, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job manager: %w", err)
+	}
+
+	// Shared by archives and mail; custom validators run after the built-in
+	// ones, and virus scanners last, on files passing every cheaper check
+	a.scans = services.NewScanCache(&cfg.Scan, log, opts.scanners...)
+	fileValidator := services.ChainFileValidators(append(append([]services.FileValidator{
+		services.NewBlocklist(&cfg.Blocklist),
+		services.NewFileValidators(&cfg.Validation),
+	}, opts.validators...), a.scans)...)
+
+	// Master keys of the data encrypted at rest and of the signing key
+	keys, err := repositories.NewKeyProvider(&cfg.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key provider: %w", err)
+	}
+
+	// Archive
+	processors, err := services.NewEntryPipeline(cfg.Archive.Processors, opts.processors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entry processors: %w", err)
+	}
+	archiveRepo := repositories.NewArchiveRepository(&cfg.Archive, log)
+	var remoteArchives repositories.RemoteArchiveRepository
+	if cfg.Archive.Remote.Enabled {
+		remote, err := repositories.NewHTTPRemoteArchiveRepository(&cfg.Archive.Remote, cfg.Outbound)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote archive repository: %w", err)
+		}
+		remoteArchives = remote
+	}
+	a.archive, err = services.NewArchiveService(archiveRepo, remoteArchives, &cfg.Archive, fileValidator, processors, keys, cfg.Features, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive service: %w", err)
+	}
+	artifacts, err := newArtifactStore(cfg, keys)
+	if err != nil {
+		return nil, err
+	}
+	a.health.Register("storage", func(ctx context.Context) error {
+		return repositories.PingArtifactStore(ctx, artifacts)
+	})
+	archiveStore, err := repositories.NewArtifactArchiveStore(artifacts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive store: %w", err)
+	}
+	a.shares, err = services.NewShareService(archiveStore, events, &cfg.Archive, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share service: %w", err)
+	}
+	uploadStore, err := repositories.NewArtifactUploadStore(artifacts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload store: %w", err)
+	}
+	a.uploads, err = services.NewUploadService(uploadStore, a.temp, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload service: %w", err)
+	}
+	a.secrets, err = services.NewSecretSealer(keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret sealer: %w", err)
+	}
+
+	// Mail
+	var mailRepo repositories.MailRepository
+	switch cfg.Mail.Transport {
+	case "maildir":
+		mailRepo, err = repositories.NewMaildirRepository(&cfg.Mail, &cfg.SMTP)
+	default:
+		var smtpRepo *repositories.MailRepositoryImpl
+		smtpRepo, err = repositories.NewMailRepository(&cfg.SMTP, &cfg.Mail)
+		if err == nil {
+			mailRepo = smtpRepo
+			a.health.Register("smtp", smtpRepo.Ping)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mail repository: %w", err)
+	}
+	var mailTemplates repositories.MailTemplateRepository
+	if cfg.Mail.TemplatesDir != "" {
+		templateRepo, err := repositories.NewFileTemplateRepository(cfg.Mail.TemplatesDir, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mail templates: %w", err)
+		}
+		a.lc.Go("mail templates", func(ctx context.Context) {
+			if err := templateRepo.Watch(ctx); err != nil {
+				log.Error("mail template watcher stopped", "error", err)
+			}
+		})
+		mailTemplates = templateRepo
+	}
+	keyring, err := services.NewPGPKeyring(&cfg.Mail.PGP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mail pgp keys: %w", err)
+	}
+	a.suppressions, err = services.NewSuppressionService(suppressionRepo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create suppression service: %w", err)
+	}
+	a.groups, err = services.NewGroupService(groupRepo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group service: %w", err)
+	}
+	a.mail, err = services.NewMailService(mailRepo, mailTemplates, archiveRepo, outboxRepo, a.suppressions, a.audit, events, &cfg.Mail, fileValidator, keyring, a.secrets, cfg.Features)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mail service: %w", err)
+	}
+	a.outbox, err = services.NewOutbox(a.mail, queue, outboxRepo, &cfg.Mail.Outbox, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create outbox: %w", err)
+	}
+
+	a.auth, err = services.NewAuthService(ctx, &cfg.Auth, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth service: %w", err)
+	}
+	a.tenants, err = services.NewTenantService(&cfg.Tenancy, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tenant service: %w", err)
+	}
+
+	a.retention = services.NewRetentionService(archiveStore, historyRepo, auditRepo, &cfg.Retention, log)
+
+	a.builds = services.NewWorkLimiter(&cfg.Concurrency)
+	a.jobs.Register(entities.JobTypeArchive, services.NewArchiveJobHandler(a.archive, a.shares, a.uploads, a.secrets, a.history, a.builds, a.jobs.MaxAttempts()))
+	a.jobs.Register(entities.JobTypeMail, services.NewMailJobHandler(a.mail, a.history))
+	a.jobs.Register(entities.JobTypeInformation, services.NewInformationJobHandler(a.archive, a.uploads, a.history, a.builds, a.jobs.MaxAttempts()))
+
+	ok = true
+	return a, nil
+}
+
+// process starts the job workers, scheduled mail delivery and the removal
+// of expired data, which run until the app is closed
+func (a *app) process() {
+	a.lc.Go("outbox", a.outbox.Run)
+	a.lc.Go("retention", a.retention.Run)
+	a.lc.Go("jobs", a.jobs.Run)
+}
+
+// close stops the background components, waits for them to drain and
+// releases the app's connections in reverse order of creation
+func (a *app) close() {
+	a.lc.shutdown()
+}
@@ -0,0 +1,128 @@
+package doozip
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// commands are the subcommands of the binary, in the order of the usage
+// message
+var commands = []struct {
+	name    string
+	summary string
+}{
+	{"serve", "serve the HTTP API (the default)"},
+	{"worker", "process jobs and scheduled mail from the shared queue"},
+	{"migrate", "apply pending database migrations, or list them with \"status\""},
+	{"keys", "manage the master keys: \"generate ID\", \"seal IN OUT\" or \"rotate\""},
+	{"config validate", "check the configuration and print its effective settings"},
+	{"config init", "write a commented config file with every key set to its default"},
+}
+
+// commandFlags are the flags of a command, which precede its arguments.
+// Every command but config init reads the config file and logs at the level
+// they set; the others belong to a single command.
+type commandFlags struct {
+	config   string
+	logLevel string
+	// addr is the address serve listens on
+	addr string
+	// checkConnectivity makes config validate connect to the dependencies
+	checkConnectivity bool
+	// env, output and force are the environment config init writes a
+	// config file for, where it writes it and whether it may replace one
+	env    string
+	output string
+	force  bool
+}
+
+// parseCommand splits args into the command, its flags and its remaining
+// arguments. Without a command, or when args start with a flag, the
+// command is serve. The config command is named with its action, as in
+// "config validate".
+func parseCommand(args []string) (string, *commandFlags, []string, error) {
+	command := "serve"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	if command == "config" && len(args) > 0 {
+		command, args = command+" "+args[0], args[1:]
+	}
+	known := false
+	for _, c := range commands {
+		known = known || c.name == command
+	}
+	if !known {
+		return "", nil, nil, fmt.Errorf("unknown command: %s", command)
+	}
+
+	f := &commandFlags{}
+	fs := flag.NewFlagSet("doozip "+command, flag.ContinueOnError)
+	if command != "config init" {
+		fs.StringVar(&f.config, "config", "", "read the configuration from `file` instead of ./config/config.yml")
+		fs.StringVar(&f.logLevel, "log-level", "", "log at `level`: debug, info, warn or error (default set by environment)")
+	}
+	if command == "serve" {
+		fs.StringVar(&f.addr, "addr", "", "listen on `host:port` instead of the server address and listeners of the configuration")
+	}
+	if command == "config validate" {
+		fs.BoolVar(&f.checkConnectivity, "check-connectivity", false, "also connect to the SMTP relays and the storage with their credentials")
+	}
+	if command == "config init" {
+		fs.StringVar(&f.env, "env", "development", "write the defaults of `environment`: development or production")
+		fs.StringVar(&f.output, "output", "config/config.yml", "write the config to `file`, or to stdout with -")
+		fs.BoolVar(&f.force, "force", false, "replace the output file if it exists")
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: doozip [command] [flags] [arguments]\n\nCommands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(out, "  %-16s %s\n", c.name, c.summary)
+		}
+		fmt.Fprintf(out, "\nFlags of %s:\n", command)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", nil, nil, err
+	}
+
+	return command, f, fs.Args(), nil
+}
+
+// loadOptions returns where the configuration is read from and the settings
+// the flags override
+func (f *commandFlags) loadOptions() (config.LoadOptions, error) {
+	opts := config.LoadOptions{File: f.config, Overrides: map[string]any{}}
+	if f.addr != "" {
+		host, port, err := net.SplitHostPort(f.addr)
+		if err != nil {
+			return opts, fmt.Errorf("invalid address %q: %w", f.addr, err)
+		}
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			return opts, fmt.Errorf("invalid address %q: port must be a number", f.addr)
+		}
+		opts.Overrides["server.host"] = host
+		opts.Overrides["server.port"] = portNumber
+		opts.Overrides["server.listeners"] = []any{}
+	}
+	return opts, nil
+}
+
+// level returns the log level set by the flags, or nil to use the level of
+// the environment
+func (f *commandFlags) level() (slog.Leveler, error) {
+	if f.logLevel == "" {
+		return nil, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(f.logLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", f.logLevel, err)
+	}
+	return level, nil
+}
@@ -0,0 +1,121 @@
+package doozip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+// connectivityTimeout bounds the connectivity checks of config validate
+const connectivityTimeout = 30 * time.Second
+
+// errConnectivity reports that a dependency failed its connectivity check
+var errConnectivity = errors.New("connectivity check failed")
+
+// runConfigValidate loads and validates the configuration and writes the
+// effective settings, with secrets redacted, to out. With connectivity set
+// it also connects to the SMTP relays and the storage with their
+// credentials, reporting each to report.
+func runConfigValidate(ctx context.Context, opts config.LoadOptions, connectivity bool, out, report io.Writer) error {
+	cfg, err := config.Load(opts)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	data, err := yaml.Marshal(config.RedactedSettings())
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if _, err := out.Write(data); err != nil {
+		return err
+	}
+
+	if !connectivity {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectivityTimeout)
+	defer cancel()
+
+	failed := false
+	check := func(name string, ping func(context.Context) error) {
+		if err := ping(ctx); err != nil {
+			failed = true
+			fmt.Fprintf(report, "%s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(report, "%s: ok\n", name)
+	}
+
+	if cfg.Mail.Transport != "maildir" {
+		check("smtp", func(ctx context.Context) error {
+			mail, err := repositories.NewMailRepository(&cfg.SMTP, &cfg.Mail)
+			if err != nil {
+				return err
+			}
+			return mail.Ping(ctx)
+		})
+	}
+	check("storage", func(ctx context.Context) error {
+		artifacts, err := repositories.NewArtifactStore(&cfg.Storage)
+		if err != nil {
+			return err
+		}
+		return repositories.PingArtifactStore(ctx, artifacts)
+	})
+
+	if failed {
+		return errConnectivity
+	}
+	return nil
+}
+
+// runConfigInit writes a commented config file with the defaults of env to
+// output, or to stdout when output is "-". An existing file is only
+// replaced with force.
+func runConfigInit(env, output string, force bool) error {
+	sample, err := config.Sample(env)
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		_, err := os.Stdout.Write(sample)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(output, flags, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists; pass --force to replace it", output)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %w", err)
+	}
+	if _, err := file.Write(sample); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "config written to %s\n", output)
+	return nil
+}
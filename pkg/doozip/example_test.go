@@ -0,0 +1,54 @@
+package doozip_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ab-dauletkhan/doozip/pkg/doozip"
+)
+
+// A program embedding the service refuses to archive or mail the files of a
+// confidential project, and upper-cases the names of archived files
+func ExampleRun() {
+	confidential := doozip.FileValidatorFunc(func(file *doozip.FileData, kind doozip.UploadKind) error {
+		if kind != doozip.UploadKindInformation && strings.HasPrefix(file.Name, "project-x/") {
+			return fmt.Errorf("%w: %s is confidential", doozip.ErrFileRejected, file.Name)
+		}
+		return nil
+	})
+	upper := doozip.EntryProcessorFunc(func(file *doozip.FileData) error {
+		file.Name = strings.ToUpper(file.Name)
+		return nil
+	})
+
+	err := doozip.Run(os.Args[1:],
+		doozip.WithFileValidator(confidential),
+		// Runs when archive.processors lists "upper_names"
+		doozip.WithEntryProcessor("upper_names", upper),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// A program embedding the service hides which blocklist refused a file, and
+// answers every other failure as usual
+func ExampleWithErrorHandler() {
+	handler := func(w http.ResponseWriter, r *http.Request, err error) {
+		var statusErr *doozip.StatusError
+		if errors.As(err, &statusErr) && errors.Is(err, doozip.ErrFileBlocked) {
+			http.Error(w, "file not allowed", statusErr.Status)
+			return
+		}
+		doozip.DefaultErrorHandler(w, r, err)
+	}
+
+	if err := doozip.Run(os.Args[1:], doozip.WithErrorHandler(handler)); err != nil {
+		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,110 @@
+package doozip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+// newArtifactStore creates the artifact store of the storage configuration,
+// encrypting artifacts at rest with keys when storage.encrypt is set
+func newArtifactStore(cfg *config.Config, keys repositories.KeyProvider) (repositories.ArtifactStore, error) {
+	artifacts, err := repositories.NewArtifactStore(&cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact store: %w", err)
+	}
+	if !cfg.Storage.Encrypt {
+		return artifacts, nil
+	}
+
+	encrypted, err := repositories.NewEncryptedArtifactStore(artifacts, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact store: %w", err)
+	}
+	return encrypted, nil
+}
+
+// runKeys manages the master keys: "generate ID" writes a new local master
+// key, "seal IN OUT" encrypts a file such as the archive signing key with
+// the current master key, and "rotate" rewraps every stored artifact with
+// the current master key after keys.key_id was changed
+func runKeys(ctx context.Context, cfg *config.Config, args []string, log *slog.Logger) error {
+	if len(args) == 0 {
+		return errors.New("missing keys action: generate, seal or rotate")
+	}
+
+	switch action := args[0]; action {
+	case "generate":
+		if len(args) != 2 {
+			return errors.New("usage: keys generate ID")
+		}
+		name, err := repositories.GenerateLocalKey(cfg.Keys.Local.Dir, args[1])
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		log.Info("master key generated", "file", name)
+		return nil
+
+	case "seal":
+		if len(args) != 3 {
+			return errors.New("usage: keys seal IN OUT")
+		}
+		keys, err := newKeyProvider(cfg)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		sealed, err := repositories.SealEnvelope(ctx, keys, data)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[2], sealed, 0o600); err != nil {
+			return err
+		}
+		log.Info("file sealed", "file", args[2], "key_id", keys.KeyID())
+		return nil
+
+	case "rotate":
+		keys, err := newKeyProvider(cfg)
+		if err != nil {
+			return err
+		}
+		if !cfg.Storage.Encrypt {
+			return errors.New("storage encryption is not enabled")
+		}
+		artifacts, err := repositories.NewArtifactStore(&cfg.Storage)
+		if err != nil {
+			return fmt.Errorf("failed to create artifact store: %w", err)
+		}
+		encrypted, err := repositories.NewEncryptedArtifactStore(artifacts, keys)
+		if err != nil {
+			return err
+		}
+		rewritten, err := encrypted.Rewrap(ctx, "")
+		log.Info("stored artifacts rewrapped", "key_id", keys.KeyID(), "rewritten", rewritten)
+		return err
+
+	default:
+		return fmt.Errorf("unknown keys action: %s", action)
+	}
+}
+
+// newKeyProvider creates the configured key provider, which is required
+func newKeyProvider(cfg *config.Config) (repositories.KeyProvider, error) {
+	keys, err := repositories.NewKeyProvider(&cfg.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key provider: %w", err)
+	}
+	if keys == nil {
+		return nil, errors.New("no keys provider is configured")
+	}
+	return keys, nil
+}
@@ -0,0 +1,114 @@
+package doozip
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lifecycle runs the background components of the app and releases its
+// resources at shutdown. Components started with Go drain once shutdown
+// begins, such as exporters flushing their queues, and the hooks registered
+// with OnClose only run after they have returned, so nothing is closed
+// under a component still using it.
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// timeout bounds the wait for the components to drain
+	timeout time.Duration
+	log     *slog.Logger
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]int
+	closers []closeHook
+}
+
+// closeHook releases a resource at shutdown
+type closeHook struct {
+	name  string
+	close func() error
+}
+
+// newLifecycle creates a lifecycle whose components run until ctx is
+// cancelled or shutdown begins, and are given timeout to drain
+func newLifecycle(ctx context.Context, timeout time.Duration, log *slog.Logger) *lifecycle {
+	ctx, cancel := context.WithCancel(ctx)
+	return &lifecycle{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: timeout,
+		log:     log,
+		running: make(map[string]int),
+	}
+}
+
+// Go runs a component in the background until shutdown. run must return
+// once its context is cancelled, after draining any work in flight.
+func (l *lifecycle) Go(name string, run func(ctx context.Context)) {
+	l.mu.Lock()
+	l.running[name]++
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.running[name]--; l.running[name] == 0 {
+				delete(l.running, name)
+			}
+		}()
+		run(l.ctx)
+	}()
+}
+
+// OnClose registers a hook releasing a resource, such as a connection,
+// run at shutdown in reverse order of registration
+func (l *lifecycle) OnClose(name string, close func() error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closers = append(l.closers, closeHook{name: name, close: close})
+}
+
+// shutdown stops the components and waits for them to drain, for at most
+// the timeout, then runs the close hooks. Components still running at the
+// timeout and hooks failing are logged.
+func (l *lifecycle) shutdown() {
+	l.cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		l.mu.Lock()
+		names := make([]string, 0, len(l.running))
+		for name := range l.running {
+			names = append(names, name)
+		}
+		l.mu.Unlock()
+		sort.Strings(names)
+		l.log.Warn("components did not drain in time", "components", names, "timeout", l.timeout)
+	}
+
+	l.mu.Lock()
+	closers := l.closers
+	l.closers = nil
+	l.mu.Unlock()
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].close(); err != nil {
+			l.log.Error("failed to close resource", "resource", closers[i].name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package doozip
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// listen returns the listeners the API server accepts connections on: one
+// per configured listener, or a single plaintext one on the server address.
+// For the latter a socket passed by systemd is used when present, so the
+// service can bind privileged ports without root and keep its socket across
+// restarts. The listeners share one limit of cfg.Server.MaxConnections.
+func listen(cfg *config.Config, log *slog.Logger) ([]net.Listener, error) {
+	limit := newConnLimit(cfg.Server.MaxConnections)
+	if len(cfg.Server.Listeners) == 0 {
+		ln, err := systemdListener()
+		if err != nil {
+			return nil, err
+		}
+		if ln != nil {
+			log.Info("using socket passed by systemd", "address", ln.Addr().String())
+		} else {
+			ln, err = net.Listen("tcp", cfg.GetAddress())
+			if err != nil {
+				return nil, fmt.Errorf("failed to listen on %s: %w", cfg.GetAddress(), err)
+			}
+		}
+		return []net.Listener{limit.listener(ln)}, nil
+	}
+
+	listeners := make([]net.Listener, 0, len(cfg.Server.Listeners))
+	for _, listenerCfg := range cfg.Server.Listeners {
+		ln, err := listenOn(listenerCfg, limit)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+// listenOn binds the address of a configured listener under limit,
+// terminating TLS on it when a certificate is configured
+func listenOn(cfg config.ListenerConfig, limit connLimit) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled() {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls certificate for %s: %w", cfg.Address, err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Address, err)
+	}
+	// Limited below TLS, so the server still sees TLS connections
+	ln = limit.listener(ln)
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	return ln, nil
+}
+
+// connLimit bounds the connections served at once across listeners, so slow
+// clients cannot exhaust the server. Connections over the limit wait to be
+// accepted. A nil connLimit is unlimited.
+type connLimit chan struct{}
+
+// newConnLimit returns a limit of n connections, or nil when n is zero
+func newConnLimit(n int) connLimit {
+	if n <= 0 {
+		return nil
+	}
+	return make(connLimit, n)
+}
+
+// listener returns ln accepting connections only while the limit allows
+func (l connLimit) listener(ln net.Listener) net.Listener {
+	if l == nil {
+		return ln
+	}
+	return &limitListener{Listener: ln, limit: l, done: make(chan struct{})}
+}
+
+// limitListener is a listener sharing its connLimit with others
+type limitListener struct {
+	net.Listener
+	limit     connLimit
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for a free connection slot, then for a connection
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.limit <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.limit
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.limit }}, nil
+}
+
+// Close closes the listener, failing an Accept waiting for a slot
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+// limitConn frees its slot of the connLimit once closed
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// systemdListener returns the first socket passed through the LISTEN_PID and
+// LISTEN_FDS variables of systemd socket activation, or nil when none was
+// passed to this process
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	// The variables are meant for this process only, not for its children
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	syscall.CloseOnExec(listenFDsStart)
+	file := os.NewFile(listenFDsStart, "LISTEN_FD_3")
+	defer file.Close()
+
+	ln, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by systemd: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,88 @@
+package doozip
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnLimit(t *testing.T) {
+	limit := newConnLimit(2)
+	var listeners, raw []net.Listener
+	for range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		raw = append(raw, ln)
+		listeners = append(listeners, limit.listener(ln))
+	}
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+
+	dial := func(ln net.Listener) net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	accept := func(ln net.Listener) <-chan net.Conn {
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err == nil {
+				accepted <- conn
+			}
+		}()
+		return accepted
+	}
+
+	// One connection on each listener takes the whole limit
+	dial(raw[0])
+	first := <-accept(listeners[0])
+	dial(raw[1])
+	<-accept(listeners[1])
+
+	dial(raw[1])
+	waiting := accept(listeners[1])
+	select {
+	case <-waiting:
+		t.Fatal("accepted a connection over the limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing a connection of one listener frees a slot for the other, once
+	require.NoError(t, first.Close())
+	first.Close()
+	select {
+	case <-waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted after a slot was freed")
+	}
+	assert.Len(t, limit, 2)
+
+	// A listener closed while waiting for a slot stops accepting
+	done := make(chan error, 1)
+	go func() {
+		_, err := listeners[0].Accept()
+		done <- err
+	}()
+	require.NoError(t, listeners[0].Close())
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept not failed by Close")
+	}
+}
+
+func TestConnLimitUnlimited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Same(t, ln, newConnLimit(0).listener(ln))
+}
@@ -0,0 +1,52 @@
+package doozip
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/handlers"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// middlewareStack assembles the middleware chains declared per route group
+// in the config. The names were checked when the config was loaded.
+type middlewareStack struct {
+	auth   *handlers.AuthMiddleware
+	tenant *handlers.TenantMiddleware
+	// accessLog is nil unless access logging is enabled
+	accessLog *handlers.AccessLog
+	// limiter is shared by every group using rate_limit
+	limiter *services.RateLimiter
+	cors    *config.CORSConfig
+	log     *slog.Logger
+}
+
+// chain returns the middlewares named, in order, for routes requiring role
+func (s *middlewareStack) chain(names []string, role entities.Role) []handlers.Middleware {
+	middlewares := make([]handlers.Middleware, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case config.MiddlewareAuth:
+			middlewares = append(middlewares, func(next http.Handler) http.Handler {
+				return s.auth.Require(role, next)
+			})
+		case config.MiddlewareTenant:
+			middlewares = append(middlewares, s.tenant.Wrap)
+		case config.MiddlewareRateLimit:
+			middlewares = append(middlewares, handlers.RateLimit(s.limiter))
+		case config.MiddlewareCORS:
+			middlewares = append(middlewares, handlers.CORS(s.cors))
+		case config.MiddlewareLogging:
+			if s.accessLog != nil {
+				middlewares = append(middlewares, s.accessLog.Wrap)
+			}
+		case config.MiddlewareRecovery:
+			middlewares = append(middlewares, handlers.Recover(s.log))
+		case config.MiddlewareMetrics:
+			middlewares = append(middlewares, handlers.RequestMetrics)
+		}
+	}
+	return middlewares
+}
@@ -0,0 +1,60 @@
+package doozip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/repositories"
+)
+
+// runMigrate applies pending database migrations ("up", the default) or
+// prints which migrations have been applied ("status")
+func runMigrate(ctx context.Context, cfg *config.Config, args []string, log *slog.Logger) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if action != "up" && action != "status" {
+		return fmt.Errorf("unknown migrate action: %s", action)
+	}
+
+	db, err := repositories.ConnectDatabase(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if action == "status" {
+		statuses, err := db.MigrationStatuses(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied() {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+
+	applied, err := db.Migrate(ctx)
+	for _, s := range applied {
+		log.Info("migration applied", "version", s.Version, "name", s.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("database is up to date", "applied", len(applied))
+	return nil
+}
@@ -0,0 +1,109 @@
+package doozip
+
+import (
+	"net/http"
+
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/handlers"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// The extension points of the service, aliased so programs outside this
+// module can implement them
+type (
+	// FileValidator checks the files being archived, mailed or inspected.
+	// Its errors reject the file.
+	FileValidator      = services.FileValidator
+	FileValidatorFunc  = services.FileValidatorFunc
+	EntryProcessor     = services.EntryProcessor
+	EntryProcessorFunc = services.EntryProcessorFunc
+	// FileData is a file being validated or processed
+	FileData = entities.FileData
+	// UploadKind tells validators which operation a file is checked for
+	UploadKind = entities.UploadKind
+	// ErrorHandler writes the response to a failed request. err is a
+	// *StatusError with the status chosen by the route.
+	ErrorHandler = handlers.ErrorHandler
+	// StatusError is the error of a failed request. Client errors wrap the
+	// service error, such as ErrFileBlocked, so they can be told apart with
+	// errors.Is; internal failures only carry a generic message.
+	StatusError = handlers.StatusError
+)
+
+// Operations files are validated for
+const (
+	UploadKindInformation = entities.UploadKindInformation
+	UploadKindArchive     = entities.UploadKindArchive
+	UploadKindStore       = entities.UploadKindStore
+	UploadKindMail        = entities.UploadKindMail
+)
+
+var (
+	// ErrFileRejected is wrapped by the errors of rejected files. Virus
+	// scanners wrap it in their rejections to have them cached.
+	ErrFileRejected = services.ErrFileRejected
+	// ErrFileBlocked is wrapped by the errors of files refused by the
+	// blocklist
+	ErrFileBlocked = services.ErrFileBlocked
+)
+
+// Option customizes the application wired by Run
+type Option func(*options)
+
+type options struct {
+	validators []services.FileValidator
+	scanners   []services.FileValidator
+	processors map[string]services.EntryProcessor
+	// errorHandler is nil to keep DefaultErrorHandler
+	errorHandler ErrorHandler
+}
+
+// WithFileValidator checks uploads with v after the configured validators,
+// so policy checks can be added without changing the services
+func WithFileValidator(v FileValidator) Option {
+	return func(o *options) {
+		o.validators = append(o.validators, v)
+	}
+}
+
+// WithVirusScanner checks uploads with scanner after every other validator.
+// Its verdicts are cached by content hash as configured by scan, and uploads
+// with a trusted API key are not scanned. Rejections should wrap
+// ErrFileRejected to be cached.
+func WithVirusScanner(scanner FileValidator) Option {
+	return func(o *options) {
+		o.scanners = append(o.scanners, scanner)
+	}
+}
+
+// WithEntryProcessor makes p available under name to archive.processors,
+// which decides whether and in which order it runs. It replaces a built-in
+// processor of the same name.
+func WithEntryProcessor(name string, p EntryProcessor) Option {
+	return func(o *options) {
+		o.processors[name] = p
+	}
+}
+
+// DefaultErrorHandler writes err as a JSON response with the message of err.
+// Error handlers can fall back to it for the errors they leave alone.
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	handlers.DefaultErrorHandler(w, r, err)
+}
+
+// WithErrorHandler makes h write every error response of the API, such as
+// to localize messages or add a support ticket id
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(o *options) {
+		o.errorHandler = h
+	}
+}
+
+// newOptions applies opts over the built-in extensions
+func newOptions(opts []Option) *options {
+	o := &options{processors: services.BuiltinEntryProcessors()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
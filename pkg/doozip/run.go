@@ -0,0 +1,314 @@
+// Package doozip runs the doozip service. Programs embedding it call Run
+// with Options registering their extensions, such as file validators, entry
+// processors and an error handler; cmd/doozip runs it without any.
+package doozip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ab-dauletkhan/doozip/internal/config"
+	"github.com/ab-dauletkhan/doozip/internal/entities"
+	"github.com/ab-dauletkhan/doozip/internal/handlers"
+	"github.com/ab-dauletkhan/doozip/internal/logger"
+	"github.com/ab-dauletkhan/doozip/internal/metrics"
+	"github.com/ab-dauletkhan/doozip/internal/services"
+)
+
+// Run loads the configuration and runs the command named by args: "serve"
+// (the default) wires the application and serves HTTP until a shutdown
+// signal is received, "worker" only processes jobs and scheduled mail from
+// the shared queue, "migrate" applies or lists database migrations and
+// "keys" manages the master keys of data encrypted at rest, "config
+// validate" checks the configuration and "config init" writes a sample of
+// it. Flags between the command and its arguments choose the config file
+// and log level, and the address serve listens on.
+// opts register extensions such as file validators and entry processors.
+func Run(args []string, opts ...Option) error {
+	command, flags, args, err := parseCommand(args)
+	if err != nil {
+		return err
+	}
+	if (command == "serve" || command == "worker") && len(args) > 0 {
+		return fmt.Errorf("unexpected arguments to %s: %v", command, args)
+	}
+	loadOpts, err := flags.loadOptions()
+	if err != nil {
+		return err
+	}
+	level, err := flags.level()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Reports problems of the configuration itself rather than failing to
+	// start
+	if command == "config validate" {
+		return runConfigValidate(ctx, loadOpts, flags.checkConnectivity, os.Stdout, os.Stderr)
+	}
+	// Writes the config file, so there may be none yet
+	if command == "config init" {
+		return runConfigInit(flags.env, flags.output, flags.force)
+	}
+
+	cfg, err := config.Load(loadOpts)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	log := logger.SetupLogger(cfg.Env, level)
+	log.Info("starting service",
+		"name", cfg.App.Name,
+		"version", cfg.App.Version,
+		"env", cfg.Env,
+		"command", command,
+	)
+	log.Debug(cfg.String())
+
+	if command == "migrate" {
+		return runMigrate(ctx, cfg, args, log)
+	}
+
+	if command == "keys" {
+		return runKeys(ctx, cfg, args, log)
+	}
+
+	if command == "worker" {
+		if cfg.Queue.Driver != "redis" {
+			return errors.New("worker mode requires a shared queue (queue.driver: redis)")
+		}
+		if cfg.Jobs.Store == "memory" {
+			return errors.New("worker mode requires jobs to be kept in the database")
+		}
+	}
+
+	o := newOptions(opts)
+	a, err := newApp(ctx, cfg, o, log)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	if command == "worker" {
+		return runWorker(ctx, cfg, a, log)
+	}
+	return serve(ctx, cfg, a, o, log)
+}
+
+// serve runs the HTTP API until the context is cancelled. Unless jobs are
+// handed to dedicated workers, it also processes them itself.
+func serve(ctx context.Context, cfg *config.Config, a *app, o *options, log *slog.Logger) error {
+	// Without async jobs, uploads are always processed within the request
+	jobs := a.jobs
+	if !cfg.Features.Enabled(config.FeatureAsyncJobs) {
+		jobs = nil
+	}
+
+	archiveHandler, err := handlers.NewArchiveHandler(a.archive, a.shares, jobs, a.history, a.builds, a.uploads, a.secrets, cfg.Archive.Information, cfg.Limits.MaxFiles, log)
+	if err != nil {
+		return fmt.Errorf("failed to create archive handler: %w", err)
+	}
+	mailHandler := handlers.NewMailHandler(a.mail, a.outbox, jobs, a.history, a.groups, cfg.Mail.Upload, log)
+	jobHandler, err := handlers.NewJobHandler(a.jobs, log)
+	if err != nil {
+		return fmt.Errorf("failed to create job handler: %w", err)
+	}
+	historyHandler, err := handlers.NewHistoryHandler(a.history, log)
+	if err != nil {
+		return fmt.Errorf("failed to create history handler: %w", err)
+	}
+	suppressionHandler, err := handlers.NewSuppressionHandler(a.suppressions, log)
+	if err != nil {
+		return fmt.Errorf("failed to create suppression handler: %w", err)
+	}
+	groupHandler, err := handlers.NewGroupHandler(a.groups, log)
+	if err != nil {
+		return fmt.Errorf("failed to create group handler: %w", err)
+	}
+	auditHandler, err := handlers.NewAuditHandler(a.audit, log)
+	if err != nil {
+		return fmt.Errorf("failed to create audit handler: %w", err)
+	}
+	adminHandler, err := handlers.NewAdminHandler(a.mail, log)
+	if err != nil {
+		return fmt.Errorf("failed to create admin handler: %w", err)
+	}
+	healthHandler, err := handlers.NewHealthHandler(a.health)
+	if err != nil {
+		return fmt.Errorf("failed to create health handler: %w", err)
+	}
+
+	var accessLog *handlers.AccessLog
+	if cfg.AccessLog.Enabled {
+		out, err := logger.OpenAccessLog(&cfg.AccessLog)
+		if err != nil {
+			return err
+		}
+		a.lc.OnClose("access log", out.Close)
+
+		accessLog, err = handlers.NewAccessLog(out, cfg.AccessLog.Format, log)
+		if err != nil {
+			return fmt.Errorf("failed to create access log: %w", err)
+		}
+	}
+
+	a.lc.Go("temp janitor", a.temp.Run)
+
+	if cfg.Jobs.Embedded {
+		a.process()
+	} else if cfg.Queue.Driver != "redis" {
+		return errors.New("jobs can only run outside the API server with a shared queue (queue.driver: redis)")
+	}
+
+	// Share links, the version, health and the demo UI are public. The
+	// middlewares of each route group are declared in the config; by default
+	// every other route requires a role when auth is enabled and belongs to a
+	// tenant when tenancy is enabled. Bodies are limited first, so oversized
+	// requests are rejected before anything reads them, and large uploads
+	// must fit in the temp space last, once the request is known to be
+	// allowed.
+	stack := &middlewareStack{
+		auth:      handlers.NewAuthMiddleware(a.auth, log),
+		tenant:    handlers.NewTenantMiddleware(a.tenants, log),
+		accessLog: accessLog,
+		limiter:   services.NewRateLimiter(&cfg.Middleware.RateLimit),
+		cors:      &cfg.Middleware.CORS,
+		log:       log,
+	}
+	api := func(role entities.Role, limit int64, h http.HandlerFunc) http.Handler {
+		return handlers.LimitBody(limit, handlers.Chain(h, append(stack.chain(cfg.Middleware.API, role), handlers.TrustScans(a.scans), handlers.ReserveTemp(a.temp, limit))...))
+	}
+	// Archive builds and extractions are shed while the server is overloaded
+	shedder := services.NewLoadShedder(&cfg.Shedding, a.temp.Dir())
+	heavy := func(role entities.Role, limit int64, h http.HandlerFunc) http.Handler {
+		return api(role, limit, handlers.ShedLoad(shedder, limit)(h).ServeHTTP)
+	}
+	public := func(h http.HandlerFunc) http.Handler {
+		return handlers.LimitBody(handlers.DefaultBodyLimit, handlers.Chain(h, stack.chain(cfg.Middleware.Public, "")...))
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return handlers.LimitBody(handlers.AdminBodyLimit, handlers.Chain(h, stack.chain(cfg.Middleware.Admin, entities.RoleAdmin)...))
+	}
+
+	proxies, err := handlers.NewProxyMiddleware(cfg.Server.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("failed to create proxy middleware: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/archive/information", heavy(entities.RoleViewer, handlers.InformationUploadLimit(&cfg.Archive.Information), archiveHandler.GetInformation))
+	mux.Handle("POST /api/archive/files", heavy(entities.RoleSender, handlers.ArchiveBodyLimit, archiveHandler.CreateArchive))
+	mux.Handle("POST /api/archive/validate", api(entities.RoleSender, handlers.ArchiveBodyLimit, archiveHandler.ValidateArchive))
+	mux.Handle("GET /api/archive/signing-key", public(archiveHandler.SigningKey))
+	mux.Handle("POST /archives", heavy(entities.RoleSender, handlers.ArchiveBodyLimit, archiveHandler.StoreArchive))
+	mux.Handle("POST /archives/search", heavy(entities.RoleViewer, handlers.InformationBodyLimit, archiveHandler.SearchArchive))
+	mux.Handle("POST /archives/subset", heavy(entities.RoleViewer, handlers.InformationBodyLimit, archiveHandler.SubsetArchive))
+	mux.Handle("GET /archives/{id}/download", public(archiveHandler.DownloadArchive))
+	mux.Handle("POST /archives/{id}/download", public(archiveHandler.DownloadArchive))
+	mux.Handle("GET /archives/{id}/accesses", api(entities.RoleViewer, handlers.DefaultBodyLimit, archiveHandler.Accesses))
+	if cfg.Features.Enabled(config.FeatureMail) {
+		mux.Handle("POST /api/mail/file", api(entities.RoleSender, handlers.MailBodyLimit, mailHandler.SendMail))
+		mux.Handle("GET /mail/{id}", api(entities.RoleViewer, handlers.DefaultBodyLimit, mailHandler.GetMessage))
+		mux.Handle("POST /mail/{id}/resend", api(entities.RoleSender, handlers.DefaultBodyLimit, mailHandler.Resend))
+		mux.Handle("GET /suppressions", api(entities.RoleViewer, handlers.DefaultBodyLimit, suppressionHandler.List))
+		mux.Handle("POST /suppressions", api(entities.RoleSender, handlers.DefaultBodyLimit, suppressionHandler.Add))
+		mux.Handle("DELETE /suppressions/{address}", api(entities.RoleSender, handlers.DefaultBodyLimit, suppressionHandler.Remove))
+		mux.Handle("GET /groups", api(entities.RoleViewer, handlers.DefaultBodyLimit, groupHandler.List))
+		mux.Handle("POST /groups", api(entities.RoleSender, handlers.DefaultBodyLimit, groupHandler.Create))
+		mux.Handle("GET /groups/{name}", api(entities.RoleViewer, handlers.DefaultBodyLimit, groupHandler.Get))
+		mux.Handle("PUT /groups/{name}", api(entities.RoleSender, handlers.DefaultBodyLimit, groupHandler.Update))
+		mux.Handle("DELETE /groups/{name}", api(entities.RoleSender, handlers.DefaultBodyLimit, groupHandler.Delete))
+		mux.Handle("GET /audit", api(entities.RoleAdmin, handlers.DefaultBodyLimit, auditHandler.List))
+	}
+	if jobs != nil {
+		mux.Handle("GET /jobs", api(entities.RoleViewer, handlers.DefaultBodyLimit, jobHandler.List))
+		mux.Handle("GET /jobs/{id}", api(entities.RoleViewer, handlers.DefaultBodyLimit, jobHandler.Get))
+		mux.Handle("POST /jobs/{id}/retry", api(entities.RoleSender, handlers.DefaultBodyLimit, jobHandler.Retry))
+	}
+	mux.Handle("GET /history", api(entities.RoleViewer, handlers.DefaultBodyLimit, historyHandler.List))
+	mux.Handle("GET /version", public(handlers.NewVersionHandler(cfg.App.Name, cfg.App.Version).Get))
+	mux.Handle("GET /health", public(healthHandler.Get))
+	if cfg.UI.Enabled {
+		mux.Handle("GET /{$}", public(handlers.NewUIHandler().Index))
+	}
+	if cfg.Metrics.Enabled {
+		mux.Handle("GET "+cfg.Metrics.Path, metrics.Handler())
+	}
+	if cfg.Features.Enabled(config.FeatureMail) {
+		mux.Handle("POST /admin/mail/test", admin(adminHandler.TestMail))
+	}
+
+	// Requests are logged with the client IP resolved by the proxy middleware
+	handler := handlers.Chain(mux, stack.chain(cfg.Middleware.Server, "")...)
+	if o.errorHandler != nil {
+		handler = handlers.HandleErrors(o.errorHandler)(handler)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.GetAddress(),
+		Handler:           proxies.Wrap(handler),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelError),
+	}
+
+	listeners, err := listen(cfg, log)
+	if err != nil {
+		return err
+	}
+
+	// All listeners share the server, so they are shut down together
+	errCh := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() {
+			log.Info("starting server", "address", ln.Addr().String(), "maxConnections", cfg.Server.MaxConnections)
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("failed to serve on %s: %w", ln.Addr(), err)
+			}
+		}()
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	}
+
+	log.Info("starting graceful shutdown", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+
+	log.Info("server stopped gracefully")
+	return nil
+}
+
+// runWorker processes jobs and scheduled mail from the shared queue without
+// serving HTTP, until the context is cancelled
+func runWorker(ctx context.Context, cfg *config.Config, a *app, log *slog.Logger) error {
+	log.Info("starting worker", "workers", cfg.Jobs.Workers)
+	a.process()
+
+	<-ctx.Done()
+	log.Info("shutdown signal received")
+	a.close()
+
+	log.Info("worker stopped gracefully")
+	return nil
+}